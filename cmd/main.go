@@ -7,10 +7,21 @@
 package main
 
 import (
+	"fmt"
+	"os"
+
 	"intel/kbs/v1"
 )
 
 func main() {
 	app := &kbs.App{}
+	// the container starts the service with the run command
+	if len(os.Args) > 1 && os.Args[1] != "run" {
+		if err := app.RunCommand(os.Args[1:]); err != nil {
+			fmt.Printf("KBS command %s exit with an error : %v\n", os.Args[1], err.Error())
+			os.Exit(1)
+		}
+		return
+	}
 	app.Run()
 }
@@ -0,0 +1,61 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+// vault-plugin is the reference key manager plugin. It serves the in-tree vault key manager over
+// the plugin protocol and is configured with the same VAULT_* settings as the vault key manager.
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"intel/kbs/v1/config"
+	"intel/kbs/v1/constant"
+	"intel/kbs/v1/keymanager"
+	"intel/kbs/v1/kmsplugin"
+	"intel/kbs/v1/vaultclient"
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Printf("Vault key manager plugin exit with an error : %v\n", err.Error())
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_", "-", "_"))
+	viper.AutomaticEnv()
+	log.SetFormatter(&log.JSONFormatter{})
+
+	// the socket path is passed by the KBS when it starts the plugin, otherwise it is the first
+	// argument
+	socketPath := os.Getenv(kmsplugin.SocketPathEnv)
+	if socketPath == "" && len(os.Args) > 1 {
+		socketPath = os.Args[1]
+	}
+	if socketPath == "" {
+		return fmt.Errorf("socket path must be given in %s or as first argument", kmsplugin.SocketPathEnv)
+	}
+
+	vaultConfig := config.DefaultVaultConfig()
+	if err := vaultConfig.Validate(); err != nil {
+		return err
+	}
+	vaultClient := vaultclient.NewVaultClient()
+	if err := vaultClient.InitializeClient(&vaultConfig); err != nil {
+		return err
+	}
+
+	capabilities := kmsplugin.Capabilities{
+		Name:       constant.VaultKeyManager,
+		Algorithms: []string{constant.CRYPTOALGAES, constant.CRYPTOALGRSA, constant.CRYPTOALGEC, constant.CRYPTOALGHMAC, constant.CRYPTOALGCHACHA20, constant.CRYPTOALGED25519, constant.CRYPTOALGX25519},
+	}
+	return kmsplugin.Serve(keymanager.NewPluginServer(keymanager.NewVaultManager(vaultClient)), capabilities, socketPath)
+}
@@ -0,0 +1,325 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package kbs
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"intel/kbs/v1/config"
+	"intel/kbs/v1/constant"
+	"intel/kbs/v1/crypt"
+	"intel/kbs/v1/keymanager"
+	"intel/kbs/v1/repository"
+	"intel/kbs/v1/repository/directory"
+	"intel/kbs/v1/tasks"
+)
+
+const (
+	backupCommand      = "backup"
+	restoreCommand     = "restore"
+	migrateKeysCommand = "migrate-keys"
+
+	// backupPassphraseEnv is read when no passphrase file is given on the command line
+	backupPassphraseEnv = "BACKUP_PASSPHRASE"
+)
+
+// RunCommand runs one of the administrative subcommands of the KBS
+func (app *App) RunCommand(args []string) error {
+
+	if len(args) == 0 {
+		return errors.New("No command given")
+	}
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_", "-", "_"))
+	viper.AutomaticEnv()
+	if app.configuration() == nil {
+		app.Config = config.DefaultConfig()
+	}
+	if err := app.Config.Validate(); err != nil {
+		return errors.Wrap(err, "Invalid configuration")
+	}
+	if err := app.configureLogs(); err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case backupCommand:
+		return app.runBackup(args[1:])
+	case restoreCommand:
+		return app.runRestore(args[1:])
+	case migrateKeysCommand:
+		return app.runMigrateKeys(args[1:])
+	default:
+		return errors.Errorf("Unknown command %s, supported commands are %s, %s and %s", args[0], backupCommand, restoreCommand, migrateKeysCommand)
+	}
+}
+
+func (app *App) runBackup(args []string) error {
+
+	flags := flag.NewFlagSet(backupCommand, flag.ContinueOnError)
+	output := flags.String("output", "", "path of the backup archive to create")
+	passphraseFile := flags.String("passphrase-file", "", "file containing the backup passphrase, "+backupPassphraseEnv+" is used when not set")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *output == "" {
+		return errors.New("-output is required")
+	}
+	passphrase, err := readBackupPassphrase(*passphraseFile)
+	if err != nil {
+		return err
+	}
+
+	keyManager, err := keymanager.NewKeyManager(app.Config)
+	if err != nil {
+		return err
+	}
+	repo, err := app.newRepository()
+	if err != nil {
+		return err
+	}
+	signingKey, err := loadSigningKey(constant.DefaultBackupSigningKeyPath)
+	if err != nil {
+		return err
+	}
+
+	archiveFile, err := os.OpenFile(filepath.Clean(*output), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to create backup archive %s", *output)
+	}
+	defer archiveFile.Close()
+
+	backup := tasks.Backup{
+		Repository: repo,
+		KeyManager: keyManager,
+		Passphrase: passphrase,
+		SigningKey: signingKey,
+	}
+	if err := backup.CreateBackup(archiveFile); err != nil {
+		_ = os.Remove(filepath.Clean(*output))
+		return err
+	}
+
+	// the signer public key is needed to restore the archive on another KBS
+	publicKeyBytes, err := x509.MarshalPKIXPublicKey(&signingKey.PublicKey)
+	if err != nil {
+		return errors.Wrap(err, "Failed to marshal signer public key")
+	}
+	publicKeyPem := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyBytes})
+	if err := os.WriteFile(filepath.Clean(*output+".pub"), publicKeyPem, 0600); err != nil {
+		return errors.Wrap(err, "Failed to write signer public key")
+	}
+	log.Infof("Backup written to %s, signer public key written to %s.pub", *output, *output)
+	return nil
+}
+
+func (app *App) runRestore(args []string) error {
+
+	flags := flag.NewFlagSet(restoreCommand, flag.ContinueOnError)
+	input := flags.String("input", "", "path of the backup archive to restore")
+	passphraseFile := flags.String("passphrase-file", "", "file containing the backup passphrase, "+backupPassphraseEnv+" is used when not set")
+	signerPublicKeyFile := flags.String("signer-public-key", "", "PEM file with the public key of the KBS that created the backup, the local backup signing key is used when not set")
+	onConflict := flags.String("on-conflict", tasks.RestoreConflictFail, "how to handle records that already exist: "+
+		strings.Join([]string{tasks.RestoreConflictFail, tasks.RestoreConflictSkip, tasks.RestoreConflictOverwrite}, ", "))
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *input == "" {
+		return errors.New("-input is required")
+	}
+	passphrase, err := readBackupPassphrase(*passphraseFile)
+	if err != nil {
+		return err
+	}
+
+	var signerPublicKey *rsa.PublicKey
+	if *signerPublicKeyFile != "" {
+		publicKeyPem, err := os.ReadFile(filepath.Clean(*signerPublicKeyFile))
+		if err != nil {
+			return errors.Wrapf(err, "Failed to read signer public key %s", *signerPublicKeyFile)
+		}
+		publicKey, err := crypt.GetPublicKeyFromPem(publicKeyPem)
+		if err != nil {
+			return err
+		}
+		var ok bool
+		if signerPublicKey, ok = publicKey.(*rsa.PublicKey); !ok {
+			return errors.New("Signer public key is not an RSA key")
+		}
+	} else {
+		signingKey, err := loadSigningKey(constant.DefaultBackupSigningKeyPath)
+		if err != nil {
+			return err
+		}
+		signerPublicKey = &signingKey.PublicKey
+	}
+
+	keyManager, err := keymanager.NewKeyManager(app.Config)
+	if err != nil {
+		return err
+	}
+	repo, err := app.newRepository()
+	if err != nil {
+		return err
+	}
+
+	archiveFile, err := os.Open(filepath.Clean(*input))
+	if err != nil {
+		return errors.Wrapf(err, "Failed to open backup archive %s", *input)
+	}
+	defer archiveFile.Close()
+
+	restore := tasks.Restore{
+		Repository:      repo,
+		KeyManager:      keyManager,
+		Passphrase:      passphrase,
+		SignerPublicKey: signerPublicKey,
+		OnConflict:      *onConflict,
+	}
+	return restore.RestoreBackup(archiveFile)
+}
+
+func (app *App) runMigrateKeys(args []string) error {
+
+	flags := flag.NewFlagSet(migrateKeysCommand, flag.ContinueOnError)
+	from := flags.String("from", "", "name of the key manager backend the keys are migrated from")
+	to := flags.String("to", app.Config.DefaultKeyManagerBackend(), "name of the key manager backend the keys are migrated to")
+	dryRun := flags.Bool("dry-run", false, "read every key from the source without migrating it")
+	deleteSource := flags.Bool("delete-source", false, "delete each key from the source once it is migrated")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *from == "" {
+		return errors.New("-from is required")
+	}
+
+	keyManager, err := keymanager.NewKeyManager(app.Config)
+	if err != nil {
+		return err
+	}
+	repo, err := app.newRepository()
+	if err != nil {
+		return err
+	}
+
+	mk := tasks.MigrateKeys{
+		KeyStore:     repo.KeyStore,
+		KeyManager:   keyManager,
+		From:         strings.ToLower(*from),
+		To:           strings.ToLower(*to),
+		DryRun:       *dryRun,
+		DeleteSource: *deleteSource,
+	}
+	if err := mk.MigrateKeys(); err != nil {
+		return err
+	}
+	if !*dryRun && mk.To != app.Config.DefaultKeyManagerBackend() {
+		log.Warnf("Keys were migrated to %s, new keys are still created in %s unless KEY_MANAGER=%s is set", mk.To, app.Config.DefaultKeyManagerBackend(), strings.ToUpper(mk.To))
+	}
+	return nil
+}
+
+func readBackupPassphrase(passphraseFile string) (string, error) {
+
+	if passphraseFile == "" {
+		passphrase := os.Getenv(backupPassphraseEnv)
+		if passphrase == "" {
+			return "", errors.New("Backup passphrase must be given with -passphrase-file or " + backupPassphraseEnv)
+		}
+		return passphrase, nil
+	}
+	bytes, err := os.ReadFile(filepath.Clean(passphraseFile))
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to read passphrase file %s", passphraseFile)
+	}
+	return strings.TrimSpace(string(bytes)), nil
+}
+
+// newRepository creates the directory repository, sealing records with the repository master
+// key when one is configured
+func (app *App) newRepository() (*repository.Repository, error) {
+
+	var recordSealer directory.RecordSealer
+	masterKey, err := keymanager.NewRepositoryMasterKey(app.Config)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to initialize repository master key")
+	}
+	if masterKey != nil {
+		aeadCipher, err := crypt.NewAeadCipher(masterKey)
+		crypt.ZeroizeByteArray(masterKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to initialize repository record sealer")
+		}
+		recordSealer = aeadCipher
+
+		srr := tasks.SealRepositoryRecords{
+			BasePath: constant.HomeDir,
+			Sealer:   recordSealer,
+		}
+		if app.Config.RepositoryEncryption.SealExistingRecords {
+			if err := srr.SealRepositoryRecords(); err != nil {
+				return nil, err
+			}
+		} else if err := srr.CheckRecordsSealed(); err != nil {
+			return nil, err
+		}
+	} else {
+		log.Warn("Repository master key source is not configured, records will be stored unencrypted")
+	}
+
+	return repository.NewDirectoryRepository(constant.HomeDir, recordSealer), nil
+}
+
+// loadJWTSigningKey reads the JWT signing key, creating it when it does not exist yet
+func loadJWTSigningKey() (*rsa.PrivateKey, error) {
+	return loadSigningKey(constant.DefaultJWTSigningKeyPath)
+}
+
+// loadSigningKey reads the RSA signing key at path, creating it when it does not exist yet
+func loadSigningKey(path string) (*rsa.PrivateKey, error) {
+
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		// create signing key
+		csk := tasks.CreateSigningKey{
+			JWTSigningKeyPath: path,
+		}
+		err := csk.CreateJWTSigningKey()
+		if err != nil {
+			log.WithError(err).Errorf("Error while creating signing key %s", path)
+			return nil, err
+		}
+	}
+
+	bytes, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		log.WithError(err).Errorf("Error while reading signing key %s", path)
+		return nil, err
+	}
+
+	block, _ := pem.Decode(bytes)
+	if block == nil {
+		return nil, errors.Errorf("Error while pem decoding signing key %s", path)
+	}
+
+	privKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signingKey, ok := privKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.Errorf("Signing key %s is not an RSA key", path)
+	}
+	return signingKey, nil
+}
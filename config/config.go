@@ -11,6 +11,7 @@ import (
 	"intel/kbs/v1/constant"
 	"net/url"
 	"regexp"
+	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/spf13/viper"
@@ -26,6 +27,7 @@ const (
 	TrustAuthorityApiUrl                = "trustauthority-api-url"
 	TrustAuthorityApiKey                = "trustauthority-api-key"
 	KeyManager                          = "key-manager"
+	KeyManagers                         = "key-managers"
 	AdminUsername                       = "admin-username"
 	AdminPassword                       = "admin-password"
 	SanList                             = "san-list"
@@ -38,11 +40,51 @@ const (
 	KmipClientKeyPath                   = "kmip.client-key-path"
 	KmipClientCertPath                  = "kmip.client-cert-path"
 	KmipRootCertPath                    = "kmip.root-cert-path"
+	KmipMaxConnections                  = "kmip.max-connections"
+	KmipIdleTimeout                     = "kmip.idle-timeout"
+	KmipRequestTimeout                  = "kmip.request-timeout"
+	KmipMaxBatchItems                   = "kmip.max-batch-items"
+	KmipKeyWrapping                     = "kmip.key-wrapping"
+	Pkcs11ModulePath                    = "pkcs11.module-path"
+	Pkcs11Slot                          = "pkcs11.slot"
+	Pkcs11Pin                           = "pkcs11.pin"
+	Pkcs11LabelPrefix                   = "pkcs11.label-prefix"
+	Pkcs11KeyWrapping                   = "pkcs11.key-wrapping"
+	PluginCommand                       = "plugin.command"
+	PluginArgs                          = "plugin.args"
+	PluginSocketPath                    = "plugin.socket-path"
+	PluginTimeout                       = "plugin.timeout"
+	LocalKeystorePath                   = "local.keystore-path"
+	LocalMasterKeyFile                  = "local.master-key-file"
+	LocalMasterKeyPassphrase            = "local.master-key-passphrase"
 	VaultClientToken                    = "vault.client-token"
 	VaultServerIP                       = "vault.server-ip"
 	VaultServerPort                     = "vault.server-port"
+	VaultTLSEnabled                     = "vault.tls-enabled"
+	VaultCACertPath                     = "vault.ca-cert-path"
+	VaultClientCertPath                 = "vault.client-cert-path"
+	VaultClientKeyPath                  = "vault.client-key-path"
+	VaultTLSServerName                  = "vault.tls-server-name"
+	VaultAuthMethod                     = "vault.auth-method"
+	VaultAuthMountPath                  = "vault.auth-mount-path"
+	VaultRoleID                         = "vault.role-id"
+	VaultSecretID                       = "vault.secret-id"
+	VaultRole                           = "vault.role"
+	VaultServiceAccountTokenPath        = "vault.service-account-token-path"
+	VaultMountPath                      = "vault.mount-path"
+	VaultKVVersion                      = "vault.kv-version"
+	VaultNamespace                      = "vault.namespace"
+	VaultKVSoftDelete                   = "vault.kv-soft-delete"
+	RepositoryMasterKeySource           = "repository-encryption.master-key-source"
+	RepositoryMasterKeyFile             = "repository-encryption.master-key-file"
+	RepositoryMasterKeyPassphrase       = "repository-encryption.master-key-passphrase"
+	RepositoryMasterKeyKmipID           = "repository-encryption.master-key-kmip-id"
+	RepositorySealExistingRecords       = "repository-encryption.seal-existing-records"
 	BearerTokenValidityInMinutes        = "bearer-token-validity-in-minutes"
 	HttpReadHeaderTimeout               = "http-read-header-timeout"
+	ReportDataHash                      = "report-data-hash"
+	RequireIssuedNonce                  = "require-issued-nonce"
+	SecretMaxSize                       = "secret-max-size"
 	AuthenticationDefendMaxAttempts     = "authentication-defend-max-attempts"
 	AuthenticationDefendIntervalMinutes = "authentication-defend-interval-minutes"
 	AuthenticationDefendLockoutMinutes  = "authentication-defend-lockout-minutes"
@@ -50,27 +92,36 @@ const (
 
 var (
 	userOrEmailReg = regexp.MustCompile(`^[a-zA-Z0-9.-_]+@?[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$`)
+	backendNameReg = regexp.MustCompile(`^[a-z][a-z0-9]*$`)
 	passwordReg    = regexp.MustCompile("(?:([a-zA-Z0-9_\\\\.\\\\, @!#$%^+=>?:{}()\\[\\]\\\"|;~`'*-/]+))")
 )
 
 type Configuration struct {
-	ServicePort                         int         `yaml:"service-port" mapstructure:"service-port"`
-	LogLevel                            string      `yaml:"log-level" mapstructure:"log-level"`
-	LogCaller                           bool        `yaml:"log-caller" mapstructure:"log-caller"`
-	TrustAuthorityBaseUrl               string      `yaml:"trustauthority-base-url" mapstructure:"trustauthority-base-url"`
-	TrustAuthorityApiUrl                string      `yaml:"trustauthority-api-url" mapstructure:"trustauthority-api-url"`
-	TrustAuthorityApiKey                string      `yaml:"trustauthority-api-key" mapstructure:"trustauthority-api-key"`
-	KeyManager                          string      `yaml:"key-manager" mapstructure:"key-manager"`
-	AdminUsername                       string      `yaml:"admin-username" mapstructure:"admin-username"`
-	AdminPassword                       string      `yaml:"admin-password" mapstructure:"admin-password"`
-	SanList                             string      `yaml:"san-list" mapstructure:"san-list"`
-	Kmip                                KmipConfig  `yaml:"kmip"`
-	Vault                               VaultConfig `yaml:"vault"`
-	BearerTokenValidityInMinutes        int         `yaml:"bearer-token-validity-in-minutes" mapstructure:"bearer-token-validity-in-minutes"`
-	HttpReadHeaderTimeout               int         `yaml:"http-read-header-timeout" mapstructure:"http-read-header-timeout"`
-	AuthenticationDefendMaxAttempts     int         `yaml:"authentication-defend-max-attempts" mapstructure:"authentication-defend-max-attempts"`
-	AuthenticationDefendIntervalMinutes int         `yaml:"authentication-defend-interval-minutes" mapstructure:"authentication-defend-interval-minutes"`
-	AuthenticationDefendLockoutMinutes  int         `yaml:"authentication-defend-lockout-minutes" mapstructure:"authentication-defend-lockout-minutes"`
+	ServicePort                         int                        `yaml:"service-port" mapstructure:"service-port"`
+	LogLevel                            string                     `yaml:"log-level" mapstructure:"log-level"`
+	LogCaller                           bool                       `yaml:"log-caller" mapstructure:"log-caller"`
+	TrustAuthorityBaseUrl               string                     `yaml:"trustauthority-base-url" mapstructure:"trustauthority-base-url"`
+	TrustAuthorityApiUrl                string                     `yaml:"trustauthority-api-url" mapstructure:"trustauthority-api-url"`
+	TrustAuthorityApiKey                string                     `yaml:"trustauthority-api-key" mapstructure:"trustauthority-api-key"`
+	KeyManager                          string                     `yaml:"key-manager" mapstructure:"key-manager"`
+	KeyManagers                         []KeyManagerBackendConfig  `yaml:"key-managers" mapstructure:"key-managers"`
+	AdminUsername                       string                     `yaml:"admin-username" mapstructure:"admin-username"`
+	AdminPassword                       string                     `yaml:"admin-password" mapstructure:"admin-password"`
+	SanList                             string                     `yaml:"san-list" mapstructure:"san-list"`
+	Kmip                                KmipConfig                 `yaml:"kmip"`
+	Vault                               VaultConfig                `yaml:"vault"`
+	Pkcs11                              Pkcs11Config               `yaml:"pkcs11"`
+	Plugin                              PluginConfig               `yaml:"plugin"`
+	Local                               LocalConfig                `yaml:"local"`
+	RepositoryEncryption                RepositoryEncryptionConfig `yaml:"repository-encryption" mapstructure:"repository-encryption"`
+	BearerTokenValidityInMinutes        int                        `yaml:"bearer-token-validity-in-minutes" mapstructure:"bearer-token-validity-in-minutes"`
+	HttpReadHeaderTimeout               int                        `yaml:"http-read-header-timeout" mapstructure:"http-read-header-timeout"`
+	ReportDataHash                      string                     `yaml:"report-data-hash" mapstructure:"report-data-hash"`
+	RequireIssuedNonce                  bool                       `yaml:"require-issued-nonce" mapstructure:"require-issued-nonce"`
+	SecretMaxSize                       int                        `yaml:"secret-max-size" mapstructure:"secret-max-size"`
+	AuthenticationDefendMaxAttempts     int                        `yaml:"authentication-defend-max-attempts" mapstructure:"authentication-defend-max-attempts"`
+	AuthenticationDefendIntervalMinutes int                        `yaml:"authentication-defend-interval-minutes" mapstructure:"authentication-defend-interval-minutes"`
+	AuthenticationDefendLockoutMinutes  int                        `yaml:"authentication-defend-lockout-minutes" mapstructure:"authentication-defend-lockout-minutes"`
 }
 
 type KmipConfig struct {
@@ -83,12 +134,95 @@ type KmipConfig struct {
 	ClientKeyFilePath         string `yaml:"client-key-path" mapstructure:"client-key-path"`
 	ClientCertificateFilePath string `yaml:"client-cert-path" mapstructure:"client-cert-path"`
 	RootCertificateFilePath   string `yaml:"root-cert-path" mapstructure:"root-cert-path"`
+	// MaxConnections bounds the pool of TLS connections to the kmip server. Connections idle for
+	// IdleTimeout seconds are closed and every request must complete within RequestTimeout seconds.
+	MaxConnections int `yaml:"max-connections" mapstructure:"max-connections"`
+	IdleTimeout    int `yaml:"idle-timeout" mapstructure:"idle-timeout"`
+	RequestTimeout int `yaml:"request-timeout" mapstructure:"request-timeout"`
+	// MaxBatchItems is the number of operations sent in a single request message, servers that
+	// do not support batching need 1
+	MaxBatchItems int `yaml:"max-batch-items" mapstructure:"max-batch-items"`
+	// KeyWrapping has the kmip server wrap keys released to workloads, it requires a server that
+	// supports key wrapping with AES key wrap with padding on Get
+	KeyWrapping bool `yaml:"key-wrapping" mapstructure:"key-wrapping"`
 }
 
 type VaultConfig struct {
 	ServerIP    string `yaml:"server-ip" mapstructure:"server-ip"`
 	ServerPort  string `yaml:"server-port" mapstructure:"server-port"`
 	ClientToken string `yaml:"client-token" mapstructure:"client-token"`
+	// the vault server is reached over https when TLSEnabled is set
+	TLSEnabled     bool   `yaml:"tls-enabled" mapstructure:"tls-enabled"`
+	CACertPath     string `yaml:"ca-cert-path" mapstructure:"ca-cert-path"`
+	ClientCertPath string `yaml:"client-cert-path" mapstructure:"client-cert-path"`
+	ClientKeyPath  string `yaml:"client-key-path" mapstructure:"client-key-path"`
+	TLSServerName  string `yaml:"tls-server-name" mapstructure:"tls-server-name"`
+	// AuthMethod is one of token, approle, kubernetes or cert. AuthMountPath defaults to the
+	// name of the auth method.
+	AuthMethod              string `yaml:"auth-method" mapstructure:"auth-method"`
+	AuthMountPath           string `yaml:"auth-mount-path" mapstructure:"auth-mount-path"`
+	RoleID                  string `yaml:"role-id" mapstructure:"role-id"`
+	SecretID                string `yaml:"secret-id" mapstructure:"secret-id"`
+	Role                    string `yaml:"role" mapstructure:"role"`
+	ServiceAccountTokenPath string `yaml:"service-account-token-path" mapstructure:"service-account-token-path"`
+	// keys are stored in the kv secrets engine mounted at MountPath, in Namespace on vault enterprise
+	MountPath string `yaml:"mount-path" mapstructure:"mount-path"`
+	KVVersion int    `yaml:"kv-version" mapstructure:"kv-version"`
+	Namespace string `yaml:"namespace" mapstructure:"namespace"`
+	// KVSoftDelete keeps the versions of deleted keys in a kv v2 engine instead of destroying them
+	KVSoftDelete bool `yaml:"kv-soft-delete" mapstructure:"kv-soft-delete"`
+}
+
+// Pkcs11Config configures a key manager backed by a PKCS#11 token, e.g. a network HSM
+type Pkcs11Config struct {
+	// ModulePath is the path of the PKCS#11 library of the HSM vendor
+	ModulePath string `yaml:"module-path" mapstructure:"module-path"`
+	Slot       uint   `yaml:"slot" mapstructure:"slot"`
+	Pin        string `yaml:"pin" mapstructure:"pin"`
+	// keys are labelled with LabelPrefix followed by their key ID
+	LabelPrefix string `yaml:"label-prefix" mapstructure:"label-prefix"`
+	// KeyWrapping has the token wrap keys released to workloads, so that the key material is never
+	// in plaintext in the KBS
+	KeyWrapping bool `yaml:"key-wrapping" mapstructure:"key-wrapping"`
+}
+
+// PluginConfig configures a key manager that runs out of process and is called over a Unix socket
+type PluginConfig struct {
+	// Command is the plugin executable, which is started by the KBS when it is set. Otherwise the
+	// plugin is expected to be running already.
+	Command    string   `yaml:"command" mapstructure:"command"`
+	Args       []string `yaml:"args" mapstructure:"args"`
+	SocketPath string   `yaml:"socket-path" mapstructure:"socket-path"`
+	// Timeout is the number of seconds within which the plugin must start and answer each call
+	Timeout int `yaml:"timeout" mapstructure:"timeout"`
+}
+
+// LocalConfig configures a key manager that keeps keys in an encrypted keystore on the local disk
+type LocalConfig struct {
+	KeystorePath string `yaml:"keystore-path" mapstructure:"keystore-path"`
+	// MasterKeyFile holds the master key of the keystore. It is sealed under MasterKeyPassphrase
+	// when a passphrase is set, and is a raw 32 byte key otherwise.
+	MasterKeyFile       string `yaml:"master-key-file" mapstructure:"master-key-file"`
+	MasterKeyPassphrase string `yaml:"master-key-passphrase" mapstructure:"master-key-passphrase"`
+}
+
+// KeyManagerBackendConfig configures one named key manager backend
+type KeyManagerBackendConfig struct {
+	Name   string       `yaml:"name" mapstructure:"name"`
+	Type   string       `yaml:"type" mapstructure:"type"`
+	Kmip   KmipConfig   `yaml:"kmip" mapstructure:"kmip"`
+	Vault  VaultConfig  `yaml:"vault" mapstructure:"vault"`
+	Pkcs11 Pkcs11Config `yaml:"pkcs11" mapstructure:"pkcs11"`
+	Plugin PluginConfig `yaml:"plugin" mapstructure:"plugin"`
+	Local  LocalConfig  `yaml:"local" mapstructure:"local"`
+}
+
+type RepositoryEncryptionConfig struct {
+	MasterKeySource     string `yaml:"master-key-source" mapstructure:"master-key-source"`
+	MasterKeyFile       string `yaml:"master-key-file" mapstructure:"master-key-file"`
+	MasterKeyPassphrase string `yaml:"master-key-passphrase" mapstructure:"master-key-passphrase"`
+	MasterKeyKmipID     string `yaml:"master-key-kmip-id" mapstructure:"master-key-kmip-id"`
+	SealExistingRecords bool   `yaml:"seal-existing-records" mapstructure:"seal-existing-records"`
 }
 
 // init sets the configuration file name and type
@@ -172,6 +306,163 @@ func (conf *Configuration) Validate() error {
 		return errors.New("Authentication Defend Lockout Minutes config should be set for at least 1 minute")
 	}
 
+	switch strings.ToLower(conf.ReportDataHash) {
+	case "", constant.ReportDataHashAuto, constant.ReportDataHashSHA256, constant.ReportDataHashSHA512, constant.ReportDataHashNone:
+	default:
+		return errors.Errorf("Unsupported report data hash: %s", conf.ReportDataHash)
+	}
+
+	if conf.SecretMaxSize < 1 {
+		return errors.New("Secret Max Size config should be at least 1 byte")
+	}
+
+	if err := conf.validateKeyManagers(); err != nil {
+		return err
+	}
+	if strings.ToLower(conf.RepositoryEncryption.MasterKeySource) == constant.VaultKeyManager {
+		if err := conf.Vault.Validate(); err != nil {
+			return err
+		}
+	}
+
+	return conf.RepositoryEncryption.Validate()
+}
+
+// KeyManagerBackends returns the configured key manager backends. When no named backends are
+// configured, the single backend selected by KEY_MANAGER is returned under the name of its type.
+func (conf *Configuration) KeyManagerBackends() []KeyManagerBackendConfig {
+	if len(conf.KeyManagers) > 0 {
+		return conf.KeyManagers
+	}
+	keyManager := strings.ToLower(conf.KeyManager)
+	return []KeyManagerBackendConfig{{
+		Name:   keyManager,
+		Type:   keyManager,
+		Kmip:   conf.Kmip,
+		Vault:  conf.Vault,
+		Pkcs11: conf.Pkcs11,
+		Plugin: conf.Plugin,
+		Local:  conf.Local,
+	}}
+}
+
+// DefaultKeyManagerBackend returns the name of the backend used for keys that do not request one
+func (conf *Configuration) DefaultKeyManagerBackend() string {
+	return strings.ToLower(conf.KeyManager)
+}
+
+func (conf *Configuration) validateKeyManagers() error {
+
+	names := map[string]bool{}
+	for _, backend := range conf.KeyManagerBackends() {
+		// the implicit backend is named after its type, which may contain a hyphen
+		if backend.Name == "" || (len(conf.KeyManagers) > 0 && !backendNameReg.MatchString(backend.Name)) {
+			return errors.Errorf("Invalid key manager backend name %q", backend.Name)
+		}
+		if names[backend.Name] {
+			return errors.Errorf("Key manager backend %s is configured more than once", backend.Name)
+		}
+		names[backend.Name] = true
+
+		backendType := strings.ToLower(backend.Type)
+		switch backendType {
+		case constant.KmipKeyManager:
+		case constant.VaultKeyManager, constant.VaultTransitKeyManager:
+			if err := backend.Vault.Validate(); err != nil {
+				return errors.Wrapf(err, "Invalid configuration of key manager backend %s", backend.Name)
+			}
+		case constant.Pkcs11KeyManager:
+			if err := backend.Pkcs11.Validate(); err != nil {
+				return errors.Wrapf(err, "Invalid configuration of key manager backend %s", backend.Name)
+			}
+		case constant.PluginKeyManager:
+			if backend.Plugin.SocketPath == "" {
+				return errors.Errorf("Plugin socket path of key manager backend %s must be provided", backend.Name)
+			}
+		case constant.LocalKeyManager:
+			if backend.Local.KeystorePath == "" || backend.Local.MasterKeyFile == "" {
+				return errors.Errorf("Keystore path and master key file of key manager backend %s must be provided", backend.Name)
+			}
+		default:
+			return errors.Errorf("Key manager backend %s has unsupported type %s", backend.Name, backend.Type)
+		}
+	}
+
+	if len(conf.KeyManagers) == 0 && conf.DefaultKeyManagerBackend() == constant.VaultTransitKeyManager &&
+		strings.ToLower(conf.RepositoryEncryption.MasterKeySource) == constant.VaultKeyManager {
+		return errors.New("Vault transit and vault kv settings must be configured as separate backends in key-managers to use vault as repository master key source")
+	}
+	if !names[conf.DefaultKeyManagerBackend()] {
+		return errors.Errorf("Default key manager %s is not a configured key manager backend", conf.KeyManager)
+	}
+	return nil
+}
+
+func (vc *VaultConfig) Validate() error {
+
+	if vc.KVVersion != 0 && vc.KVVersion != constant.VaultKVVersion1 && vc.KVVersion != constant.VaultKVVersion2 {
+		return errors.Errorf("Unsupported vault kv version: %d", vc.KVVersion)
+	}
+	if vc.KVSoftDelete && vc.KVVersion != constant.VaultKVVersion2 {
+		return errors.New("Vault kv soft delete requires kv version 2")
+	}
+	if (vc.ClientCertPath == "") != (vc.ClientKeyPath == "") {
+		return errors.New("Vault client certificate and client key must be provided together")
+	}
+	if !vc.TLSEnabled && (vc.CACertPath != "" || vc.ClientCertPath != "" || vc.TLSServerName != "") {
+		return errors.New("Vault TLS settings require vault TLS to be enabled")
+	}
+
+	switch strings.ToLower(vc.AuthMethod) {
+	case "", constant.VaultAuthToken:
+	case constant.VaultAuthAppRole:
+		if vc.RoleID == "" || vc.SecretID == "" {
+			return errors.New("Vault role ID and secret ID must be provided for the approle auth method")
+		}
+	case constant.VaultAuthKubernetes:
+		if vc.Role == "" {
+			return errors.New("Vault role must be provided for the kubernetes auth method")
+		}
+	case constant.VaultAuthCert:
+		if !vc.TLSEnabled || vc.ClientCertPath == "" {
+			return errors.New("Vault TLS with a client certificate must be configured for the cert auth method")
+		}
+	default:
+		return errors.Errorf("Unsupported vault auth method: %s", vc.AuthMethod)
+	}
+	return nil
+}
+
+func (pc *Pkcs11Config) Validate() error {
+
+	if pc.ModulePath == "" {
+		return errors.New("PKCS#11 module path must be provided")
+	}
+	if pc.Pin == "" {
+		return errors.New("PKCS#11 user PIN must be provided")
+	}
+	return nil
+}
+
+func (rec *RepositoryEncryptionConfig) Validate() error {
+
+	switch strings.ToLower(rec.MasterKeySource) {
+	case "", constant.VaultKeyManager:
+	case constant.KmipKeyManager:
+		if rec.MasterKeyKmipID == "" {
+			return errors.New("Repository master key KMIP ID must be provided when the master key source is KMIP")
+		}
+	case constant.MasterKeySourceFile:
+		if rec.MasterKeyFile == "" || rec.MasterKeyPassphrase == "" {
+			return errors.New("Repository master key file and passphrase must be provided when the master key source is file")
+		}
+	default:
+		return errors.Errorf("Unsupported repository master key source: %s", rec.MasterKeySource)
+	}
+
+	if rec.SealExistingRecords && rec.MasterKeySource == "" {
+		return errors.New("Repository master key source must be configured to seal existing records")
+	}
 	return nil
 }
 
@@ -260,3 +260,217 @@ func TestInvalidAuthenticationDefendLockoutMinutesConfig(t *testing.T) {
 	err = cfg.Validate()
 	g.Expect(err).To(gomega.HaveOccurred())
 }
+
+func TestInvalidReportDataHashConfig(t *testing.T) {
+	setValidEnv()
+	setViperInit()
+	cfg, err := LoadConfiguration()
+	if err != nil {
+		t.Log(err)
+	}
+	g := gomega.NewGomegaWithT(t)
+	g.Expect(cfg.ReportDataHash).To(gomega.Equal(constant.ReportDataHashAuto))
+	g.Expect(cfg.RequireIssuedNonce).To(gomega.BeFalse())
+	cfg.ReportDataHash = "md5"
+	err = cfg.Validate()
+	g.Expect(err).To(gomega.HaveOccurred())
+}
+
+func TestInvalidSecretMaxSizeConfig(t *testing.T) {
+	setValidEnv()
+	setViperInit()
+	cfg, err := LoadConfiguration()
+	if err != nil {
+		t.Log(err)
+	}
+	g := gomega.NewGomegaWithT(t)
+	g.Expect(cfg.SecretMaxSize).To(gomega.Equal(constant.DefaultSecretMaxSize))
+	cfg.SecretMaxSize = 0
+	err = cfg.Validate()
+	g.Expect(err).To(gomega.HaveOccurred())
+}
+
+func TestKeyManagerBackends(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	setValidEnv()
+	setViperInit()
+	os.Setenv("KEY_MANAGERS", "kmip:kmip, HSM:kmip, vault:vault")
+	os.Setenv("HSM_SERVER_IP", "10.0.0.1")
+	os.Setenv("VAULT_SERVER_IP", "10.0.0.2")
+	defer func() {
+		os.Unsetenv("KEY_MANAGERS")
+		os.Unsetenv("HSM_SERVER_IP")
+		os.Unsetenv("VAULT_SERVER_IP")
+		clearEnv()
+	}()
+
+	cfg := DefaultConfig()
+	g.Expect(cfg.Validate()).To(gomega.Succeed())
+	g.Expect(cfg.DefaultKeyManagerBackend()).To(gomega.Equal("kmip"))
+	backends := cfg.KeyManagerBackends()
+	g.Expect(backends).To(gomega.HaveLen(3))
+	g.Expect(backends[0].Kmip.ServerIP).To(gomega.Equal("0.0.0.0"))
+	g.Expect(backends[1].Name).To(gomega.Equal("hsm"))
+	g.Expect(backends[1].Kmip.ServerIP).To(gomega.Equal("10.0.0.1"))
+	g.Expect(backends[2].Vault.ServerIP).To(gomega.Equal("10.0.0.2"))
+
+	// without named backends the key manager is the only backend
+	cfg.KeyManagers = nil
+	backends = cfg.KeyManagerBackends()
+	g.Expect(backends).To(gomega.HaveLen(1))
+	g.Expect(backends[0].Name).To(gomega.Equal("kmip"))
+	g.Expect(cfg.Validate()).To(gomega.Succeed())
+}
+
+func TestInvalidKeyManagerBackends(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	cfg := Configuration{KeyManager: "vault"}
+
+	cfg.KeyManagers = []KeyManagerBackendConfig{{Name: "vault", Type: "vault"}, {Name: "vault", Type: "kmip"}}
+	g.Expect(cfg.validateKeyManagers()).To(gomega.HaveOccurred())
+
+	cfg.KeyManagers = []KeyManagerBackendConfig{{Name: "vault", Type: "vault"}, {Name: "hsm", Type: "tpm"}}
+	g.Expect(cfg.validateKeyManagers()).To(gomega.HaveOccurred())
+
+	cfg.KeyManagers = []KeyManagerBackendConfig{{Name: "hsm-1", Type: "kmip"}, {Name: "vault", Type: "vault"}}
+	g.Expect(cfg.validateKeyManagers()).To(gomega.HaveOccurred())
+
+	cfg.KeyManagers = []KeyManagerBackendConfig{{Name: "hsm", Type: "kmip"}}
+	g.Expect(cfg.validateKeyManagers()).To(gomega.HaveOccurred())
+
+	cfg.KeyManager = "HSM"
+	g.Expect(cfg.validateKeyManagers()).To(gomega.Succeed())
+}
+
+func TestVaultTransitKeyManager(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	setValidEnv()
+	setViperInit()
+	os.Setenv("KEY_MANAGERS", "vault:vault, transit:vault-transit")
+	os.Setenv("VAULT_CLIENT_TOKEN", "token")
+	os.Setenv("TRANSIT_CLIENT_TOKEN", "token")
+	defer func() {
+		os.Unsetenv("KEY_MANAGERS")
+		os.Unsetenv("VAULT_CLIENT_TOKEN")
+		os.Unsetenv("TRANSIT_CLIENT_TOKEN")
+		clearEnv()
+	}()
+
+	cfg := DefaultConfig()
+	cfg.KeyManager = "transit"
+	g.Expect(cfg.Validate()).To(gomega.Succeed())
+	backends := cfg.KeyManagerBackends()
+	g.Expect(backends).To(gomega.HaveLen(2))
+	g.Expect(backends[0].Vault.MountPath).To(gomega.Equal("keybroker"))
+	g.Expect(backends[1].Vault.MountPath).To(gomega.Equal("transit"))
+
+	// vault transit as the only key manager
+	cfg.KeyManagers = nil
+	cfg.KeyManager = "vault-transit"
+	cfg.Vault = backends[1].Vault
+	g.Expect(cfg.validateKeyManagers()).To(gomega.Succeed())
+	g.Expect(cfg.KeyManagerBackends()[0].Name).To(gomega.Equal("vault-transit"))
+
+	cfg.RepositoryEncryption.MasterKeySource = "vault"
+	g.Expect(cfg.validateKeyManagers()).To(gomega.HaveOccurred())
+}
+
+func TestPkcs11KeyManager(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	setValidEnv()
+	setViperInit()
+	os.Setenv("KEY_MANAGER", "pkcs11")
+	os.Setenv("PKCS11_MODULE_PATH", "/usr/lib/softhsm/libsofthsm2.so")
+	os.Setenv("PKCS11_SLOT", "1")
+	os.Setenv("PKCS11_PIN", "1234")
+	defer func() {
+		os.Unsetenv("PKCS11_MODULE_PATH")
+		os.Unsetenv("PKCS11_SLOT")
+		os.Unsetenv("PKCS11_PIN")
+		clearEnv()
+	}()
+
+	cfg := DefaultConfig()
+	g.Expect(cfg.Validate()).To(gomega.Succeed())
+	backends := cfg.KeyManagerBackends()
+	g.Expect(backends).To(gomega.HaveLen(1))
+	g.Expect(backends[0].Pkcs11.Slot).To(gomega.Equal(uint(1)))
+	g.Expect(backends[0].Pkcs11.LabelPrefix).To(gomega.Equal(constant.DefaultPkcs11LabelPrefix))
+
+	cfg.Pkcs11.Pin = ""
+	g.Expect(cfg.Validate()).To(gomega.HaveOccurred())
+}
+
+func TestPluginKeyManager(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	setValidEnv()
+	setViperInit()
+	os.Setenv("KEY_MANAGER", "plugin")
+	os.Setenv("PLUGIN_COMMAND", "/opt/kbs/bin/vault-plugin")
+	os.Setenv("PLUGIN_ARGS", "--log-level debug")
+	os.Setenv("PLUGIN_SOCKET_PATH", "/run/kbs/vault.sock")
+	defer func() {
+		os.Unsetenv("PLUGIN_COMMAND")
+		os.Unsetenv("PLUGIN_ARGS")
+		os.Unsetenv("PLUGIN_SOCKET_PATH")
+		clearEnv()
+	}()
+
+	cfg := DefaultConfig()
+	g.Expect(cfg.Validate()).To(gomega.Succeed())
+	backends := cfg.KeyManagerBackends()
+	g.Expect(backends).To(gomega.HaveLen(1))
+	g.Expect(backends[0].Plugin.Args).To(gomega.Equal([]string{"--log-level", "debug"}))
+	g.Expect(backends[0].Plugin.Timeout).To(gomega.Equal(constant.DefaultPluginTimeout))
+
+	cfg.Plugin.SocketPath = ""
+	g.Expect(cfg.Validate()).To(gomega.HaveOccurred())
+}
+
+func TestLocalKeyManager(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	setValidEnv()
+	setViperInit()
+	os.Setenv("KEY_MANAGER", "local")
+	os.Setenv("LOCAL_MASTER_KEY_PASSPHRASE", "passphrase")
+	defer func() {
+		os.Unsetenv("LOCAL_MASTER_KEY_PASSPHRASE")
+		clearEnv()
+	}()
+
+	cfg := DefaultConfig()
+	g.Expect(cfg.Validate()).To(gomega.Succeed())
+	backends := cfg.KeyManagerBackends()
+	g.Expect(backends).To(gomega.HaveLen(1))
+	g.Expect(backends[0].Local.KeystorePath).To(gomega.Equal(constant.DefaultLocalKeystorePath))
+	g.Expect(backends[0].Local.MasterKeyFile).To(gomega.Equal(constant.DefaultLocalMasterKeyPath))
+	g.Expect(backends[0].Local.MasterKeyPassphrase).To(gomega.Equal("passphrase"))
+
+	cfg.Local.KeystorePath = ""
+	g.Expect(cfg.Validate()).To(gomega.HaveOccurred())
+}
+
+func TestVaultConfigValidate(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	g.Expect((&VaultConfig{ClientToken: "token"}).Validate()).To(gomega.Succeed())
+	g.Expect((&VaultConfig{AuthMethod: "ldap"}).Validate()).To(gomega.HaveOccurred())
+
+	// kv engine settings
+	g.Expect((&VaultConfig{KVVersion: 3}).Validate()).To(gomega.HaveOccurred())
+	g.Expect((&VaultConfig{KVVersion: 1, KVSoftDelete: true}).Validate()).To(gomega.HaveOccurred())
+	g.Expect((&VaultConfig{KVVersion: 2, KVSoftDelete: true, MountPath: "secret", Namespace: "kbs"}).Validate()).To(gomega.Succeed())
+
+	// tls settings
+	g.Expect((&VaultConfig{CACertPath: "/etc/kbs/certs/vault/ca.pem"}).Validate()).To(gomega.HaveOccurred())
+	g.Expect((&VaultConfig{TLSEnabled: true, ClientCertPath: "/etc/kbs/certs/vault/client.pem"}).Validate()).To(gomega.HaveOccurred())
+	g.Expect((&VaultConfig{TLSEnabled: true, CACertPath: "/etc/kbs/certs/vault/ca.pem", TLSServerName: "vault"}).Validate()).To(gomega.Succeed())
+
+	// auth methods
+	g.Expect((&VaultConfig{AuthMethod: "AppRole", RoleID: "role"}).Validate()).To(gomega.HaveOccurred())
+	g.Expect((&VaultConfig{AuthMethod: "AppRole", RoleID: "role", SecretID: "secret"}).Validate()).To(gomega.Succeed())
+	g.Expect((&VaultConfig{AuthMethod: "kubernetes"}).Validate()).To(gomega.HaveOccurred())
+	g.Expect((&VaultConfig{AuthMethod: "kubernetes", Role: "kbs"}).Validate()).To(gomega.Succeed())
+	g.Expect((&VaultConfig{AuthMethod: "cert"}).Validate()).To(gomega.HaveOccurred())
+	g.Expect((&VaultConfig{AuthMethod: "cert", TLSEnabled: true, ClientCertPath: "/etc/kbs/certs/vault/client.pem", ClientKeyPath: "/etc/kbs/certs/vault/client.key"}).Validate()).To(gomega.Succeed())
+}
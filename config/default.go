@@ -9,6 +9,7 @@ package config
 import (
 	"github.com/spf13/viper"
 	"intel/kbs/v1/constant"
+	"strconv"
 	"strings"
 )
 
@@ -21,10 +22,15 @@ func init() {
 	viper.SetDefault(BearerTokenValidityInMinutes, constant.DefaultTokenExpiration)
 	viper.SetDefault(KeyManager, constant.DefaultKeyManager)
 	viper.SetDefault(HttpReadHeaderTimeout, constant.DefaultHttpReadHeaderTimeOut)
+	viper.SetDefault(ReportDataHash, constant.DefaultReportDataHash)
+	viper.SetDefault(SecretMaxSize, constant.DefaultSecretMaxSize)
 
 	// Set default value for vault config
 	viper.SetDefault(VaultServerPort, constant.DefaultVaultPort)
 
+	// set default repository encryption config
+	viper.SetDefault(RepositoryMasterKeyFile, constant.DefaultRepositoryMasterKeyPath)
+
 	// set default defender config
 	viper.SetDefault(AuthenticationDefendLockoutMinutes, constant.DefaultAuthDefendLockoutMins)
 	viper.SetDefault(AuthenticationDefendMaxAttempts, constant.DefaultAuthDefendMaxAttempts)
@@ -48,29 +54,202 @@ func DefaultConfig() *Configuration {
 		SanList:                             viper.GetString(SanList),
 		BearerTokenValidityInMinutes:        viper.GetInt(BearerTokenValidityInMinutes),
 		HttpReadHeaderTimeout:               viper.GetInt(HttpReadHeaderTimeout),
+		ReportDataHash:                      viper.GetString(ReportDataHash),
+		RequireIssuedNonce:                  viper.GetBool(RequireIssuedNonce),
+		SecretMaxSize:                       viper.GetInt(SecretMaxSize),
 		AuthenticationDefendMaxAttempts:     viper.GetInt(AuthenticationDefendMaxAttempts),
 		AuthenticationDefendIntervalMinutes: viper.GetInt(AuthenticationDefendIntervalMinutes),
 		AuthenticationDefendLockoutMinutes:  viper.GetInt(AuthenticationDefendLockoutMinutes),
+		RepositoryEncryption: RepositoryEncryptionConfig{
+			MasterKeySource:     viper.GetString(RepositoryMasterKeySource),
+			MasterKeyFile:       viper.GetString(RepositoryMasterKeyFile),
+			MasterKeyPassphrase: viper.GetString(RepositoryMasterKeyPassphrase),
+			MasterKeyKmipID:     viper.GetString(RepositoryMasterKeyKmipID),
+			SealExistingRecords: viper.GetBool(RepositorySealExistingRecords),
+		},
+	}
+
+	// the repository master key may be sourced from a backend other than the key manager
+	masterKeySource := strings.ToLower(cfg.RepositoryEncryption.MasterKeySource)
+	keyManager := strings.ToLower(cfg.KeyManager)
+	if keyManager == constant.VaultTransitKeyManager && masterKeySource != constant.VaultKeyManager {
+		cfg.Vault = defaultVaultConfig(constant.VaultKeyManager, constant.DefaultVaultTransitMountPath)
+	} else if keyManager == constant.VaultKeyManager || masterKeySource == constant.VaultKeyManager {
+		cfg.Vault = defaultVaultConfig(constant.VaultKeyManager, constant.DefaultVaultMountPath)
+	}
+	if (keyManager != constant.VaultKeyManager && keyManager != constant.VaultTransitKeyManager && keyManager != constant.Pkcs11KeyManager && keyManager != constant.PluginKeyManager && keyManager != constant.LocalKeyManager) || masterKeySource == constant.KmipKeyManager {
+		cfg.Kmip = defaultKmipConfig(constant.KmipKeyManager)
+	}
+	if keyManager == constant.Pkcs11KeyManager {
+		cfg.Pkcs11 = defaultPkcs11Config(constant.Pkcs11KeyManager)
+	}
+	if keyManager == constant.PluginKeyManager {
+		cfg.Plugin = defaultPluginConfig(constant.PluginKeyManager)
 	}
+	if keyManager == constant.LocalKeyManager {
+		cfg.Local = defaultLocalConfig(constant.LocalKeyManager)
+	}
+
+	cfg.KeyManagers = defaultKeyManagerBackends(viper.GetString(KeyManagers))
+	return cfg
+}
+
+// defaultKeyManagerBackends parses the named backends given as a comma separated list of
+// name:type pairs, e.g. "hsm:kmip,vault:vault,transit:vault-transit,softhsm:pkcs11,kms:plugin,dev:local".
+// The settings of each backend are read from keys prefixed with its name, so backends named
+// vault, kmip, pkcs11, plugin and local use the VAULT_*, KMIP_*, PKCS11_*, PLUGIN_* and LOCAL_*
+// settings.
+func defaultKeyManagerBackends(keyManagers string) []KeyManagerBackendConfig {
 
-	if strings.ToLower(cfg.KeyManager) == constant.VaultKeyManager {
-		cfg.Vault = VaultConfig{
-			ServerIP:    viper.GetString(VaultServerIP),
-			ServerPort:  viper.GetString(VaultServerPort),
-			ClientToken: viper.GetString(VaultClientToken),
+	var backends []KeyManagerBackendConfig
+	for _, entry := range strings.Split(keyManagers, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, backendType, _ := strings.Cut(entry, ":")
+		backend := KeyManagerBackendConfig{
+			Name: strings.ToLower(strings.TrimSpace(name)),
+			Type: strings.ToLower(strings.TrimSpace(backendType)),
 		}
-	} else {
-		cfg.Kmip = KmipConfig{
-			Version:                   viper.GetString(KmipVersion),
-			ServerIP:                  viper.GetString(KmipServerIP),
-			ServerPort:                viper.GetString(KmipServerPort),
-			Hostname:                  viper.GetString(KmipHostname),
-			Username:                  viper.GetString(KmipUsername),
-			Password:                  viper.GetString(KmipPassword),
-			ClientKeyFilePath:         viper.GetString(KmipClientKeyPath),
-			ClientCertificateFilePath: viper.GetString(KmipClientCertPath),
-			RootCertificateFilePath:   viper.GetString(KmipRootCertPath),
+		switch backend.Type {
+		case constant.VaultKeyManager:
+			backend.Vault = defaultVaultConfig(backend.Name, constant.DefaultVaultMountPath)
+		case constant.VaultTransitKeyManager:
+			backend.Vault = defaultVaultConfig(backend.Name, constant.DefaultVaultTransitMountPath)
+		case constant.KmipKeyManager:
+			backend.Kmip = defaultKmipConfig(backend.Name)
+		case constant.Pkcs11KeyManager:
+			backend.Pkcs11 = defaultPkcs11Config(backend.Name)
+		case constant.PluginKeyManager:
+			backend.Plugin = defaultPluginConfig(backend.Name)
+		case constant.LocalKeyManager:
+			backend.Local = defaultLocalConfig(backend.Name)
 		}
+		backends = append(backends, backend)
 	}
-	return cfg
+	return backends
+}
+
+// DefaultVaultConfig returns the vault configuration given by the VAULT_* settings, regardless of
+// the configured key manager
+func DefaultVaultConfig() VaultConfig {
+	return defaultVaultConfig(constant.VaultKeyManager, constant.DefaultVaultMountPath)
+}
+
+func defaultVaultConfig(name, defaultMountPath string) VaultConfig {
+	vaultConfig := VaultConfig{
+		ServerIP:    viper.GetString(backendSetting(name, VaultServerIP)),
+		ServerPort:  viper.GetString(backendSetting(name, VaultServerPort)),
+		ClientToken: viper.GetString(backendSetting(name, VaultClientToken)),
+
+		TLSEnabled:     viper.GetBool(backendSetting(name, VaultTLSEnabled)),
+		CACertPath:     viper.GetString(backendSetting(name, VaultCACertPath)),
+		ClientCertPath: viper.GetString(backendSetting(name, VaultClientCertPath)),
+		ClientKeyPath:  viper.GetString(backendSetting(name, VaultClientKeyPath)),
+		TLSServerName:  viper.GetString(backendSetting(name, VaultTLSServerName)),
+
+		AuthMethod:              viper.GetString(backendSetting(name, VaultAuthMethod)),
+		AuthMountPath:           viper.GetString(backendSetting(name, VaultAuthMountPath)),
+		RoleID:                  viper.GetString(backendSetting(name, VaultRoleID)),
+		SecretID:                viper.GetString(backendSetting(name, VaultSecretID)),
+		Role:                    viper.GetString(backendSetting(name, VaultRole)),
+		ServiceAccountTokenPath: viper.GetString(backendSetting(name, VaultServiceAccountTokenPath)),
+
+		MountPath:    viper.GetString(backendSetting(name, VaultMountPath)),
+		KVVersion:    viper.GetInt(backendSetting(name, VaultKVVersion)),
+		Namespace:    viper.GetString(backendSetting(name, VaultNamespace)),
+		KVSoftDelete: viper.GetBool(backendSetting(name, VaultKVSoftDelete)),
+	}
+	if vaultConfig.ServerPort == "" {
+		vaultConfig.ServerPort = strconv.Itoa(constant.DefaultVaultPort)
+	}
+	if vaultConfig.MountPath == "" {
+		vaultConfig.MountPath = defaultMountPath
+	}
+	if vaultConfig.KVVersion == 0 {
+		vaultConfig.KVVersion = constant.VaultKVVersion1
+	}
+	return vaultConfig
+}
+
+func defaultKmipConfig(name string) KmipConfig {
+	kmipConfig := KmipConfig{
+		Version:                   viper.GetString(backendSetting(name, KmipVersion)),
+		ServerIP:                  viper.GetString(backendSetting(name, KmipServerIP)),
+		ServerPort:                viper.GetString(backendSetting(name, KmipServerPort)),
+		Hostname:                  viper.GetString(backendSetting(name, KmipHostname)),
+		Username:                  viper.GetString(backendSetting(name, KmipUsername)),
+		Password:                  viper.GetString(backendSetting(name, KmipPassword)),
+		ClientKeyFilePath:         viper.GetString(backendSetting(name, KmipClientKeyPath)),
+		ClientCertificateFilePath: viper.GetString(backendSetting(name, KmipClientCertPath)),
+		RootCertificateFilePath:   viper.GetString(backendSetting(name, KmipRootCertPath)),
+
+		MaxConnections: viper.GetInt(backendSetting(name, KmipMaxConnections)),
+		IdleTimeout:    viper.GetInt(backendSetting(name, KmipIdleTimeout)),
+		RequestTimeout: viper.GetInt(backendSetting(name, KmipRequestTimeout)),
+		MaxBatchItems:  viper.GetInt(backendSetting(name, KmipMaxBatchItems)),
+		KeyWrapping:    viper.GetBool(backendSetting(name, KmipKeyWrapping)),
+	}
+	if kmipConfig.MaxConnections <= 0 {
+		kmipConfig.MaxConnections = constant.DefaultKmipMaxConnections
+	}
+	if kmipConfig.IdleTimeout <= 0 {
+		kmipConfig.IdleTimeout = constant.DefaultKmipIdleTimeout
+	}
+	if kmipConfig.RequestTimeout <= 0 {
+		kmipConfig.RequestTimeout = constant.DefaultKmipRequestTimeout
+	}
+	if kmipConfig.MaxBatchItems <= 0 {
+		kmipConfig.MaxBatchItems = constant.DefaultKmipMaxBatchItems
+	}
+	return kmipConfig
+}
+
+func defaultPkcs11Config(name string) Pkcs11Config {
+	pkcs11Config := Pkcs11Config{
+		ModulePath:  viper.GetString(backendSetting(name, Pkcs11ModulePath)),
+		Slot:        viper.GetUint(backendSetting(name, Pkcs11Slot)),
+		Pin:         viper.GetString(backendSetting(name, Pkcs11Pin)),
+		LabelPrefix: viper.GetString(backendSetting(name, Pkcs11LabelPrefix)),
+		KeyWrapping: viper.GetBool(backendSetting(name, Pkcs11KeyWrapping)),
+	}
+	if pkcs11Config.LabelPrefix == "" {
+		pkcs11Config.LabelPrefix = constant.DefaultPkcs11LabelPrefix
+	}
+	return pkcs11Config
+}
+
+func defaultPluginConfig(name string) PluginConfig {
+	pluginConfig := PluginConfig{
+		Command:    viper.GetString(backendSetting(name, PluginCommand)),
+		Args:       viper.GetStringSlice(backendSetting(name, PluginArgs)),
+		SocketPath: viper.GetString(backendSetting(name, PluginSocketPath)),
+		Timeout:    viper.GetInt(backendSetting(name, PluginTimeout)),
+	}
+	if pluginConfig.Timeout <= 0 {
+		pluginConfig.Timeout = constant.DefaultPluginTimeout
+	}
+	return pluginConfig
+}
+
+func defaultLocalConfig(name string) LocalConfig {
+	localConfig := LocalConfig{
+		KeystorePath:        viper.GetString(backendSetting(name, LocalKeystorePath)),
+		MasterKeyFile:       viper.GetString(backendSetting(name, LocalMasterKeyFile)),
+		MasterKeyPassphrase: viper.GetString(backendSetting(name, LocalMasterKeyPassphrase)),
+	}
+	if localConfig.KeystorePath == "" {
+		localConfig.KeystorePath = constant.DefaultLocalKeystorePath
+	}
+	if localConfig.MasterKeyFile == "" {
+		localConfig.MasterKeyFile = constant.DefaultLocalMasterKeyPath
+	}
+	return localConfig
+}
+
+// backendSetting returns the key of a vault or kmip setting for the named backend, e.g.
+// hsm.server-ip for the server-ip setting of a backend named hsm
+func backendSetting(name, setting string) string {
+	return name + setting[strings.Index(setting, "."):]
 }
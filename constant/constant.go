@@ -36,8 +36,11 @@ const (
 	// default location for JWT signing certificate and key
 	JWTSigningCertsPath      = ConfigDir + "certs/signing-keys/"
 	DefaultJWTSigningKeyPath = JWTSigningCertsPath + "jwt-signing.key"
-	DefaultKeyLength         = 3072
-	DefaultTokenExpiration   = 5
+	// the backup signing key is kept apart from the JWT signing key, so that rotating the JWT
+	// signing key does not make existing backups unverifiable
+	DefaultBackupSigningKeyPath = JWTSigningCertsPath + "backup-signing.key"
+	DefaultKeyLength            = 3072
+	DefaultTokenExpiration      = 5
 
 	// log constants
 	DefaultLogLevel = "info"
@@ -46,23 +49,86 @@ const (
 	DefaultHttpPort = 9443
 
 	// kmipmanager constants
-	KmipKeyManager   = "kmip"
-	VaultKeyManager  = "vault"
-	DefaultVaultPort = 8200
+	KmipKeyManager         = "kmip"
+	VaultKeyManager        = "vault"
+	VaultTransitKeyManager = "vault-transit"
+	Pkcs11KeyManager       = "pkcs11"
+	PluginKeyManager       = "plugin"
+	LocalKeyManager        = "local"
+	DefaultVaultPort       = 8200
+
+	// kmip connection pool constants, timeouts are in seconds
+	DefaultKmipMaxConnections = 4
+	DefaultKmipIdleTimeout    = 300
+	DefaultKmipRequestTimeout = 30
+	DefaultKmipMaxBatchItems  = 1
+	// maximum number of keys returned by kmip key discovery
+	KmipLocateMaxItems = 1000
+
+	// pkcs11 key manager constants
+	DefaultPkcs11LabelPrefix = "kbs-"
+
+	// key manager plugin constants, the timeout is in seconds
+	DefaultPluginTimeout = 30
+
+	// local key manager constants
+	DefaultLocalKeystorePath     = HomeDir + "local-keystore/"
+	DefaultLocalMasterKeyPath    = ConfigDir + "master-key/local-keystore.key"
+	LocalKeystoreMasterKeyLength = 32
+
+	// vault auth methods
+	VaultAuthToken                      = "token"
+	VaultAuthAppRole                    = "approle"
+	VaultAuthKubernetes                 = "kubernetes"
+	VaultAuthCert                       = "cert"
+	DefaultVaultServiceAccountTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+	// vault kv secrets engine constants
+	DefaultVaultMountPath        = "keybroker"
+	DefaultVaultTransitMountPath = "transit"
+	VaultKVVersion1              = 1
+	VaultKVVersion2              = 2
+
+	// repository encryption constants
+	MasterKeySourceFile            = "file"
+	DefaultRepositoryMasterKeyPath = ConfigDir + "master-key/repository.key"
+	RepositoryMasterKeyLength      = 32
 
 	// algorithm constants
 	CRYPTOALGAES = "AES"
 	CRYPTOALGRSA = "RSA"
 	CRYPTOALGEC  = "EC"
+	// HMAC keys of 256 and 384 bits are HMAC-SHA256 and HMAC-SHA384 keys
+	CRYPTOALGHMAC     = "HMAC"
+	CRYPTOALGCHACHA20 = "CHACHA20"
+	CRYPTOALGED25519  = "ED25519"
+	CRYPTOALGX25519   = "X25519"
+	// opaque secrets are stored as keys of the SECRET algorithm
+	CRYPTOALGSECRET = "SECRET"
+
+	// secp256k1 EC keys, the other EC curves are the NIST curves
+	CurveSecp256k1 = "secp256k1"
+
+	// maximum size of an opaque secret in bytes
+	DefaultSecretMaxSize = 65536
 
 	// kmip constants
 	KMIP14 = "1.4"
 	KMIP20 = "2.0"
+	KMIP21 = "2.1"
 
 	TCBStatusUpToDate = "OK"
 
-	// vault constants
-	VAULT_KEY_ROOT_PATH = "keybroker/"
+	// report data binding constants, the hash scheme of the TEE report data over the verifier
+	// nonce and the attester held data
+	ReportDataHashAuto               = "auto"
+	ReportDataHashSHA256             = "sha256"
+	ReportDataHashSHA512             = "sha512"
+	ReportDataHashNone               = "none"
+	DefaultReportDataHash            = ReportDataHashAuto
+	DefaultVerifierNonceValidityMins = 5
+	// no verifier nonces are issued while this many issued nonces are neither used nor expired
+	MaxIssuedVerifierNonces = 10000
 
 	MaxQueryParamsLength = 50
 	UUIDReg              = "[a-fA-F0-9]{8}-[a-fA-F0-9]{4}-4[a-fA-F0-9]{3}-[8|9|aA|bB][a-fA-F0-9]{3}-[a-fA-F0-9]{12}"
@@ -70,9 +136,14 @@ const (
 	HTTPHeaderKeyContentType           = "Content-Type"
 	HTTPHeaderValueApplicationJwt      = "application/jwt"
 	HTTPHeaderValueApplicationJson     = "application/json"
+	HTTPHeaderValueApplicationJose     = "application/jose"
+	HTTPHeaderValueApplicationJoseJson = "application/jose+json"
 	HTTPHeaderValueApplicationXPEMFile = "application/x-pem-file"
+	HTTPHeaderValueApplicationJwkJson  = "application/jwk+json"
+	HTTPHeaderValueApplicationOctet    = "application/octet-stream"
 	HTTPHeaderKeyAccept                = "Accept"
 	HTTPHeaderKeyAttestationType       = "Attestation-Type"
+	HTTPHeaderKeyEnvelopeVersion       = "Envelope-Version"
 
 	UserCredsMaxLen = 256
 	PasswordMinLen  = 8
@@ -89,3 +160,12 @@ const (
 	DefaultAuthDefendIntervalMins = 5
 	DefaultAuthDefendLockoutMins  = 15
 )
+
+// SymmetricAlgorithms are the algorithms of keys that are held and transferred as their raw value,
+// the symmetric key algorithms and opaque secrets
+var SymmetricAlgorithms = map[string]bool{
+	CRYPTOALGAES:      true,
+	CRYPTOALGHMAC:     true,
+	CRYPTOALGCHACHA20: true,
+	CRYPTOALGSECRET:   true,
+}
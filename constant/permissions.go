@@ -12,6 +12,15 @@ const (
 	KeySearch   = "keys:search"
 	KeyTransfer = "keys:transfer"
 	KeyUpdate   = "keys:update"
+	// KeyPublicKey only grants reading the public key of asymmetric keys, for verifiers of
+	// signatures made with keys released to workloads
+	KeyPublicKey = "keys:public_key"
+
+	SecretCreate   = "secrets:create"
+	SecretDelete   = "secrets:delete"
+	SecretSearch   = "secrets:search"
+	SecretTransfer = "secrets:transfer"
+	SecretUpdate   = "secrets:update"
 
 	KeyTransferPolicyCreate = "key_transfer_policies:create"
 	KeyTransferPolicyDelete = "key_transfer_policies:delete"
@@ -23,4 +32,8 @@ const (
 	UserUpdate = "users:update"
 )
 
-var AdminPermissions = []string{KeySearch, KeyCreate, KeyDelete, KeyTransfer, KeyUpdate, KeyTransferPolicyCreate, KeyTransferPolicySearch, KeyTransferPolicyDelete, UserDelete, UserSearch, UserCreate, UserUpdate}
+// SecretPermissions are granted to an existing admin user on start, since they were added after
+// admin users were first created
+var SecretPermissions = []string{SecretSearch, SecretCreate, SecretDelete, SecretTransfer, SecretUpdate}
+
+var AdminPermissions = []string{KeySearch, KeyCreate, KeyDelete, KeyTransfer, KeyUpdate, KeyPublicKey, SecretSearch, SecretCreate, SecretDelete, SecretTransfer, SecretUpdate, KeyTransferPolicyCreate, KeyTransferPolicySearch, KeyTransferPolicyDelete, UserDelete, UserSearch, UserCreate, UserUpdate}
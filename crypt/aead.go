@@ -0,0 +1,58 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package crypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// AeadCipher seals and opens data with AES-GCM. The random nonce is prepended to the
+// sealed output so that a sealed blob is self-contained.
+type AeadCipher struct {
+	aead cipher.AEAD
+}
+
+// NewAeadCipher creates an AeadCipher from a 128, 192 or 256 bit AES key
+func NewAeadCipher(key []byte) (*AeadCipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create AES cipher")
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create GCM cipher")
+	}
+	return &AeadCipher{aead: gcm}, nil
+}
+
+// Seal encrypts and authenticates plaintext, binding additionalData to the result
+func (c *AeadCipher) Seal(plaintext, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize(), c.aead.NonceSize()+len(plaintext)+c.aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, errors.Wrap(err, "Failed to generate nonce")
+	}
+	return c.aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// Open authenticates and decrypts data produced by Seal with the same additionalData
+func (c *AeadCipher) Open(sealed, additionalData []byte) ([]byte, error) {
+	nonceSize := c.aead.NonceSize()
+	if len(sealed) < nonceSize+c.aead.Overhead() {
+		return nil, errors.New("sealed data is too short")
+	}
+	plaintext, err := c.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], additionalData)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to authenticate sealed data")
+	}
+	return plaintext, nil
+}
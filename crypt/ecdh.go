@@ -0,0 +1,74 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package crypt
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+// JweAlgEcdhEsA256KW is ECDH-ES key agreement with the Concat KDF and AES-256 key wrap, RFC 7518
+// section 4.6
+const JweAlgEcdhEsA256KW = "ECDH-ES+A256KW"
+
+// EcdhEsWrapKey wraps key to publicKey with ECDH-ES+A256KW. An ephemeral key pair is generated on
+// the curve of publicKey, the key wrapping key is derived from the shared secret with the Concat
+// KDF and key is wrapped under it with AES key wrap. The PartyUInfo and PartyVInfo of the KDF are
+// empty. It returns the wrapped key and the ephemeral public key.
+func EcdhEsWrapKey(publicKey *ecdsa.PublicKey, key []byte) ([]byte, *ecdh.PublicKey, error) {
+
+	recipientKey, err := publicKey.ECDH()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Unsupported EC public key")
+	}
+	ephemeralKey, err := recipientKey.Curve().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Failed to generate ephemeral EC key")
+	}
+	sharedSecret, err := ephemeralKey.ECDH(recipientKey)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Failed to compute ECDH shared secret")
+	}
+	defer ZeroizeByteArray(sharedSecret)
+
+	kek := concatKdf(sharedSecret, []byte(JweAlgEcdhEsA256KW), 32)
+	defer ZeroizeByteArray(kek)
+	wrappedKey, err := WrapKey(kek, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return wrappedKey, ephemeralKey.PublicKey(), nil
+}
+
+// concatKdf derives a key of keyLen bytes from the shared secret with the Concat KDF of NIST SP
+// 800-56A and SHA-256, with the other info of RFC 7518 section 4.6.2 and empty party info
+func concatKdf(sharedSecret, algorithmID []byte, keyLen int) []byte {
+
+	otherInfo := make([]byte, 0, 16+len(algorithmID))
+	otherInfo = binary.BigEndian.AppendUint32(otherInfo, uint32(len(algorithmID)))
+	otherInfo = append(otherInfo, algorithmID...)
+	// PartyUInfo and PartyVInfo of length 0
+	otherInfo = binary.BigEndian.AppendUint32(otherInfo, 0)
+	otherInfo = binary.BigEndian.AppendUint32(otherInfo, 0)
+	otherInfo = binary.BigEndian.AppendUint32(otherInfo, uint32(keyLen*8))
+
+	key := make([]byte, 0, keyLen+sha256.Size)
+	for counter := uint32(1); len(key) < keyLen; counter++ {
+		hash := sha256.New()
+		_ = binary.Write(hash, binary.BigEndian, counter)
+		hash.Write(sharedSecret)
+		hash.Write(otherInfo)
+		key = hash.Sum(key)
+	}
+	ZeroizeByteArray(key[keyLen:])
+	return key[:keyLen]
+}
@@ -0,0 +1,115 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package crypt
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/mlkem"
+	"crypto/rand"
+	"crypto/sha256"
+	"io"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/hkdf"
+)
+
+// hybridKdfLabel prefixes the HKDF info of the hybrid key encapsulation
+const hybridKdfLabel = "KBS hybrid key encapsulation v1"
+
+// HybridPublicKey is a workload public key for hybrid key encapsulation, a classical X25519 or
+// NIST curve ECDH key together with an ML-KEM-768 encapsulation key
+type HybridPublicKey struct {
+	Classical *ecdh.PublicKey
+	MlKem     *mlkem.EncapsulationKey768
+}
+
+// NewHybridPublicKey returns the hybrid public key of a JWK Set holding exactly one X25519 or EC
+// key and one ML-KEM-768 key
+func NewHybridPublicKey(jwkSet *JwkSet) (*HybridPublicKey, error) {
+
+	hybridKey := &HybridPublicKey{}
+	for i := range jwkSet.Keys {
+		publicKey, err := jwkSet.Keys[i].PublicKey()
+		if err != nil {
+			return nil, err
+		}
+		switch publicKey := publicKey.(type) {
+		case *mlkem.EncapsulationKey768:
+			if hybridKey.MlKem != nil {
+				return nil, errors.New("JWK Set holds more than one ML-KEM key")
+			}
+			hybridKey.MlKem = publicKey
+		case *ecdh.PublicKey, *ecdsa.PublicKey:
+			if hybridKey.Classical != nil {
+				return nil, errors.New("JWK Set holds more than one ECDH key")
+			}
+			if ecdsaKey, ok := publicKey.(*ecdsa.PublicKey); ok {
+				if hybridKey.Classical, err = ecdsaKey.ECDH(); err != nil {
+					return nil, errors.Wrap(err, "Unsupported EC public key")
+				}
+			} else {
+				hybridKey.Classical = publicKey.(*ecdh.PublicKey)
+			}
+		default:
+			return nil, errors.Errorf("Key type %T is not supported for hybrid key encapsulation", publicKey)
+		}
+	}
+	if hybridKey.Classical == nil || hybridKey.MlKem == nil {
+		return nil, errors.New("JWK Set must hold an ECDH key and an ML-KEM-768 key")
+	}
+	return hybridKey, nil
+}
+
+// Name returns the name of the hybrid key encapsulation, e.g. ML-KEM-768+X25519
+func (hybridKey *HybridPublicKey) Name() string {
+	switch hybridKey.Classical.Curve() {
+	case ecdh.X25519():
+		return JwkAlgMlKem768 + "+" + JwkCurveX25519
+	case ecdh.P256():
+		return JwkAlgMlKem768 + "+" + JwkCurveP256
+	case ecdh.P384():
+		return JwkAlgMlKem768 + "+" + JwkCurveP384
+	default:
+		return JwkAlgMlKem768 + "+" + JwkCurveP521
+	}
+}
+
+// HybridEncapsulate derives a 256 bit key shared with the holder of the private keys of hybridKey.
+// An ML-KEM-768 shared secret is encapsulated to the ML-KEM key and an ECDH shared secret is
+// computed with an ephemeral key pair on the curve of the classical key. The key is derived from
+// both shared secrets with HKDF-SHA256, with the ML-KEM ciphertext and both ECDH public keys bound
+// in the info, so that it stays secret as long as either of the two is not broken. It returns the
+// key, the ML-KEM ciphertext and the ephemeral ECDH public key.
+func HybridEncapsulate(hybridKey *HybridPublicKey) ([]byte, []byte, *ecdh.PublicKey, error) {
+
+	mlkemSecret, mlkemCiphertext := hybridKey.MlKem.Encapsulate()
+	defer ZeroizeByteArray(mlkemSecret)
+
+	ephemeralKey, err := hybridKey.Classical.Curve().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "Failed to generate ephemeral ECDH key")
+	}
+	ecdhSecret, err := ephemeralKey.ECDH(hybridKey.Classical)
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "Failed to compute ECDH shared secret")
+	}
+	defer ZeroizeByteArray(ecdhSecret)
+
+	secret := append(append([]byte{}, mlkemSecret...), ecdhSecret...)
+	defer ZeroizeByteArray(secret)
+	info := []byte(hybridKdfLabel)
+	info = append(info, mlkemCiphertext...)
+	info = append(info, ephemeralKey.PublicKey().Bytes()...)
+	info = append(info, hybridKey.Classical.Bytes()...)
+
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, nil, info), key); err != nil {
+		return nil, nil, nil, errors.Wrap(err, "Failed to derive hybrid key")
+	}
+	return key, mlkemCiphertext, ephemeralKey.PublicKey(), nil
+}
@@ -0,0 +1,115 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package crypt
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// JWE algorithms used for key transfer responses, RFC 7518
+const (
+	JweAlgRsaOaep256 = "RSA-OAEP-256"
+	JweEncA256GCM    = "A256GCM"
+)
+
+// JweHeader is the protected header of a JWE
+type JweHeader struct {
+	Algorithm  string `json:"alg"`
+	Encryption string `json:"enc"`
+	KeyID      string `json:"kid,omitempty"`
+	// EphemeralPublicKey is set for ECDH-ES key agreement
+	EphemeralPublicKey *Jwk `json:"epk,omitempty"`
+}
+
+// Jwe is a JSON Web Encryption (RFC 7516) with its parts base64url encoded without padding
+type Jwe struct {
+	Protected    string `json:"protected"`
+	EncryptedKey string `json:"encrypted_key"`
+	Iv           string `json:"iv"`
+	Ciphertext   string `json:"ciphertext"`
+	Tag          string `json:"tag"`
+}
+
+// EncryptJwe encrypts plaintext under the 256 bit content encryption key cek with A256GCM and
+// wraps cek to publicKey with RSA-OAEP-256 for RSA keys or ECDH-ES+A256KW for EC keys
+func EncryptJwe(publicKey crypto.PublicKey, cek, plaintext []byte, keyID string) (*Jwe, error) {
+
+	if len(cek) != 32 {
+		return nil, errors.New("JWE content encryption key must be 256 bits long")
+	}
+	jweHeader := JweHeader{Encryption: JweEncA256GCM, KeyID: keyID}
+	var encryptedKey []byte
+	switch publicKey := publicKey.(type) {
+	case *rsa.PublicKey:
+		var err error
+		jweHeader.Algorithm = JweAlgRsaOaep256
+		encryptedKey, err = rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, cek, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to wrap JWE content encryption key")
+		}
+	case *ecdsa.PublicKey:
+		wrappedKey, ephemeralKey, err := EcdhEsWrapKey(publicKey, cek)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to wrap JWE content encryption key")
+		}
+		jweHeader.Algorithm = JweAlgEcdhEsA256KW
+		jweHeader.EphemeralPublicKey, err = NewEcJwk(ephemeralKey)
+		if err != nil {
+			return nil, err
+		}
+		encryptedKey = wrappedKey
+	default:
+		return nil, errors.Errorf("JWE recipient key type %T is not supported", publicKey)
+	}
+	header, err := json.Marshal(jweHeader)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to marshal JWE header")
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create AES cipher")
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create GCM cipher")
+	}
+	iv := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, errors.Wrap(err, "Failed to generate JWE initialization vector")
+	}
+
+	// the additional authenticated data is the encoded protected header, RFC 7516 section 5.1
+	protected := base64.RawURLEncoding.EncodeToString(header)
+	sealed := gcm.Seal(nil, iv, plaintext, []byte(protected))
+	tagOffset := len(sealed) - gcm.Overhead()
+
+	return &Jwe{
+		Protected:    protected,
+		EncryptedKey: base64.RawURLEncoding.EncodeToString(encryptedKey),
+		Iv:           base64.RawURLEncoding.EncodeToString(iv),
+		Ciphertext:   base64.RawURLEncoding.EncodeToString(sealed[:tagOffset]),
+		Tag:          base64.RawURLEncoding.EncodeToString(sealed[tagOffset:]),
+	}, nil
+}
+
+// Compact returns the JWE Compact Serialization
+func (jwe *Jwe) Compact() string {
+	return strings.Join([]string{jwe.Protected, jwe.EncryptedKey, jwe.Iv, jwe.Ciphertext, jwe.Tag}, ".")
+}
@@ -0,0 +1,304 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package crypt
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/mlkem"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+
+	"github.com/pkg/errors"
+)
+
+// JWK key types and curves, RFC 7518 section 6 and RFC 8037. AKP keys are the ML-KEM keys of the
+// JOSE post-quantum KEM draft, identified by their alg.
+const (
+	JwkKeyTypeEC  = "EC"
+	JwkKeyTypeRSA = "RSA"
+	JwkKeyTypeOKP = "OKP"
+	JwkKeyTypeAKP = "AKP"
+	JwkKeyTypeOct = "oct"
+
+	JwkCurveP256      = "P-256"
+	JwkCurveP384      = "P-384"
+	JwkCurveP521      = "P-521"
+	JwkCurveX25519    = "X25519"
+	JwkCurveEd25519   = "Ed25519"
+	JwkCurveSecp256k1 = "secp256k1"
+
+	JwkAlgMlKem768 = "ML-KEM-768"
+)
+
+// Jwk is a JSON Web Key (RFC 7517) of an RSA, EC, X25519 or ML-KEM-768 public key, or of an RSA,
+// EC, Ed25519 or X25519 private key or a symmetric key
+type Jwk struct {
+	KeyType   string `json:"kty"`
+	Algorithm string `json:"alg,omitempty"`
+	KeyID     string `json:"kid,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Pub       string `json:"pub,omitempty"`
+	D         string `json:"d,omitempty"`
+	P         string `json:"p,omitempty"`
+	Q         string `json:"q,omitempty"`
+	Dp        string `json:"dp,omitempty"`
+	Dq        string `json:"dq,omitempty"`
+	Qi        string `json:"qi,omitempty"`
+	K         string `json:"k,omitempty"`
+}
+
+// JwkSet is a JWK Set, RFC 7517 section 5
+type JwkSet struct {
+	Keys []Jwk `json:"keys"`
+}
+
+// NewEcJwk returns the JWK of an EC public key
+func NewEcJwk(publicKey *ecdh.PublicKey) (*Jwk, error) {
+
+	var curve string
+	switch publicKey.Curve() {
+	case ecdh.P256():
+		curve = JwkCurveP256
+	case ecdh.P384():
+		curve = JwkCurveP384
+	case ecdh.P521():
+		curve = JwkCurveP521
+	default:
+		return nil, errors.New("JWK curve is not supported")
+	}
+
+	// the public key is the uncompressed point 0x04 || X || Y
+	point := publicKey.Bytes()
+	size := (len(point) - 1) / 2
+	return &Jwk{
+		KeyType: JwkKeyTypeEC,
+		Curve:   curve,
+		X:       base64.RawURLEncoding.EncodeToString(point[1 : 1+size]),
+		Y:       base64.RawURLEncoding.EncodeToString(point[1+size:]),
+	}, nil
+}
+
+// NewOctJwk returns the JWK of a symmetric key
+func NewOctJwk(key []byte) *Jwk {
+	return &Jwk{
+		KeyType: JwkKeyTypeOct,
+		K:       base64.RawURLEncoding.EncodeToString(key),
+	}
+}
+
+// NewPublicJwk returns the JWK of an RSA or EC public key, RFC 7518 sections 6.2.1 and 6.3.1, of
+// a secp256k1 public key, RFC 8812, or of an Ed25519 or X25519 public key, RFC 8037
+func NewPublicJwk(publicKey crypto.PublicKey) (*Jwk, error) {
+
+	switch publicKey := publicKey.(type) {
+	case *rsa.PublicKey:
+		return &Jwk{
+			KeyType: JwkKeyTypeRSA,
+			N:       base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+			E:       base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+		}, nil
+
+	case *ecdsa.PublicKey:
+		if isSecp256k1(publicKey.Curve) {
+			point := secp256k1Point(publicKey)
+			return &Jwk{
+				KeyType: JwkKeyTypeEC,
+				Curve:   JwkCurveSecp256k1,
+				X:       base64.RawURLEncoding.EncodeToString(point[1:33]),
+				Y:       base64.RawURLEncoding.EncodeToString(point[33:]),
+			}, nil
+		}
+		ecdhKey, err := publicKey.ECDH()
+		if err != nil {
+			return nil, errors.Wrap(err, "Unsupported EC public key")
+		}
+		return NewEcJwk(ecdhKey)
+
+	case ed25519.PublicKey:
+		return &Jwk{
+			KeyType: JwkKeyTypeOKP,
+			Curve:   JwkCurveEd25519,
+			X:       base64.RawURLEncoding.EncodeToString(publicKey),
+		}, nil
+
+	case *ecdh.PublicKey:
+		if publicKey.Curve() != ecdh.X25519() {
+			return NewEcJwk(publicKey)
+		}
+		return &Jwk{
+			KeyType: JwkKeyTypeOKP,
+			Curve:   JwkCurveX25519,
+			X:       base64.RawURLEncoding.EncodeToString(publicKey.Bytes()),
+		}, nil
+
+	default:
+		return nil, errors.Errorf("JWK of public key type %T is not supported", publicKey)
+	}
+}
+
+// NewPrivateJwk returns the JWK of an RSA or EC private key, RFC 7518 sections 6.2.2 and 6.3.2,
+// of a secp256k1 private key, RFC 8812, or of an Ed25519 or X25519 private key, RFC 8037
+func NewPrivateJwk(privateKey crypto.PrivateKey) (*Jwk, error) {
+
+	switch privateKey := privateKey.(type) {
+	case *rsa.PrivateKey:
+		if len(privateKey.Primes) != 2 {
+			return nil, errors.New("JWK of multi-prime RSA keys is not supported")
+		}
+		privateKey.Precompute()
+		encode := func(i *big.Int) string {
+			return base64.RawURLEncoding.EncodeToString(i.Bytes())
+		}
+		return &Jwk{
+			KeyType: JwkKeyTypeRSA,
+			N:       encode(privateKey.N),
+			E:       encode(big.NewInt(int64(privateKey.E))),
+			D:       encode(privateKey.D),
+			P:       encode(privateKey.Primes[0]),
+			Q:       encode(privateKey.Primes[1]),
+			Dp:      encode(privateKey.Precomputed.Dp),
+			Dq:      encode(privateKey.Precomputed.Dq),
+			Qi:      encode(privateKey.Precomputed.Qinv),
+		}, nil
+
+	case *ecdsa.PrivateKey:
+		if isSecp256k1(privateKey.Curve) {
+			point := secp256k1Point(&privateKey.PublicKey)
+			return &Jwk{
+				KeyType: JwkKeyTypeEC,
+				Curve:   JwkCurveSecp256k1,
+				X:       base64.RawURLEncoding.EncodeToString(point[1:33]),
+				Y:       base64.RawURLEncoding.EncodeToString(point[33:]),
+				D:       base64.RawURLEncoding.EncodeToString(privateKey.D.FillBytes(make([]byte, 32))),
+			}, nil
+		}
+		ecdhKey, err := privateKey.ECDH()
+		if err != nil {
+			return nil, errors.Wrap(err, "Unsupported EC private key")
+		}
+		jwk, err := NewEcJwk(ecdhKey.PublicKey())
+		if err != nil {
+			return nil, err
+		}
+		jwk.D = base64.RawURLEncoding.EncodeToString(ecdhKey.Bytes())
+		return jwk, nil
+
+	case ed25519.PrivateKey:
+		return &Jwk{
+			KeyType: JwkKeyTypeOKP,
+			Curve:   JwkCurveEd25519,
+			X:       base64.RawURLEncoding.EncodeToString(privateKey.Public().(ed25519.PublicKey)),
+			D:       base64.RawURLEncoding.EncodeToString(privateKey.Seed()),
+		}, nil
+
+	case *ecdh.PrivateKey:
+		if privateKey.Curve() != ecdh.X25519() {
+			return nil, errors.New("JWK curve is not supported")
+		}
+		return &Jwk{
+			KeyType: JwkKeyTypeOKP,
+			Curve:   JwkCurveX25519,
+			X:       base64.RawURLEncoding.EncodeToString(privateKey.PublicKey().Bytes()),
+			D:       base64.RawURLEncoding.EncodeToString(privateKey.Bytes()),
+		}, nil
+
+	default:
+		return nil, errors.Errorf("JWK of private key type %T is not supported", privateKey)
+	}
+}
+
+// PublicKey returns the *rsa.PublicKey, *ecdsa.PublicKey, X25519 *ecdh.PublicKey or
+// *mlkem.EncapsulationKey768 of the JWK. The point of an EC key is checked to be on the curve.
+func (jwk *Jwk) PublicKey() (crypto.PublicKey, error) {
+
+	switch jwk.KeyType {
+	case JwkKeyTypeOKP:
+		if jwk.Curve != JwkCurveX25519 {
+			return nil, errors.Errorf("JWK curve %s is not supported", jwk.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, errors.Wrap(err, "Invalid JWK x coordinate")
+		}
+		publicKey, err := ecdh.X25519().NewPublicKey(x)
+		if err != nil {
+			return nil, errors.Wrap(err, "Invalid JWK X25519 key")
+		}
+		return publicKey, nil
+
+	case JwkKeyTypeAKP:
+		if jwk.Algorithm != JwkAlgMlKem768 {
+			return nil, errors.Errorf("JWK algorithm %s is not supported", jwk.Algorithm)
+		}
+		pub, err := base64.RawURLEncoding.DecodeString(jwk.Pub)
+		if err != nil {
+			return nil, errors.Wrap(err, "Invalid JWK public key")
+		}
+		encapsulationKey, err := mlkem.NewEncapsulationKey768(pub)
+		if err != nil {
+			return nil, errors.Wrap(err, "Invalid JWK ML-KEM-768 key")
+		}
+		return encapsulationKey, nil
+
+	case JwkKeyTypeRSA:
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, errors.Wrap(err, "Invalid JWK modulus")
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, errors.Wrap(err, "Invalid JWK exponent")
+		}
+		if len(n) == 0 || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("Invalid JWK RSA key")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+
+	case JwkKeyTypeEC:
+		var curve ecdh.Curve
+		var ellipticCurve elliptic.Curve
+		switch jwk.Curve {
+		case JwkCurveP256:
+			curve, ellipticCurve = ecdh.P256(), elliptic.P256()
+		case JwkCurveP384:
+			curve, ellipticCurve = ecdh.P384(), elliptic.P384()
+		case JwkCurveP521:
+			curve, ellipticCurve = ecdh.P521(), elliptic.P521()
+		default:
+			return nil, errors.Errorf("JWK curve %s is not supported", jwk.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, errors.Wrap(err, "Invalid JWK x coordinate")
+		}
+		y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+		if err != nil {
+			return nil, errors.Wrap(err, "Invalid JWK y coordinate")
+		}
+		size := (ellipticCurve.Params().BitSize + 7) / 8
+		if len(x) != size || len(y) != size {
+			return nil, errors.New("Invalid JWK EC point")
+		}
+		point := append(append([]byte{4}, x...), y...)
+		if _, err := curve.NewPublicKey(point); err != nil {
+			return nil, errors.Wrap(err, "Invalid JWK EC point")
+		}
+		return &ecdsa.PublicKey{Curve: ellipticCurve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+
+	default:
+		return nil, errors.Errorf("JWK key type %s is not supported", jwk.KeyType)
+	}
+}
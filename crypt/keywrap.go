@@ -0,0 +1,171 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package crypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+// keyWrapIV is the default initial value of RFC 3394
+var keyWrapIV = []byte{0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6}
+
+// keyWrapPaddingIV is the alternative initial value of RFC 5649
+var keyWrapPaddingIV = []byte{0xa6, 0x59, 0x59, 0xa6}
+
+// WrapKeyWithPadding wraps plaintext under kek with AES key wrap with padding (RFC 5649)
+func WrapKeyWithPadding(kek, plaintext []byte) ([]byte, error) {
+
+	if len(plaintext) == 0 {
+		return nil, errors.New("Key to wrap must not be empty")
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create AES cipher")
+	}
+
+	// the plaintext is padded to a multiple of 64 bits
+	n := (len(plaintext) + 7) / 8
+	padded := make([]byte, 8+n*8)
+	copy(padded, keyWrapPaddingIV)
+	binary.BigEndian.PutUint32(padded[4:8], uint32(len(plaintext)))
+	copy(padded[8:], plaintext)
+	defer ZeroizeByteArray(padded)
+
+	if n == 1 {
+		wrapped := make([]byte, 16)
+		block.Encrypt(wrapped, padded)
+		return wrapped, nil
+	}
+
+	return wrapBlocks(block, padded), nil
+}
+
+// WrapKey wraps plaintext under kek with AES key wrap (RFC 3394), the plaintext must be a
+// multiple of 64 bits long
+func WrapKey(kek, plaintext []byte) ([]byte, error) {
+
+	if len(plaintext) < 16 || len(plaintext)%8 != 0 {
+		return nil, errors.New("Key to wrap must be a multiple of 64 bits and at least 128 bits long")
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create AES cipher")
+	}
+
+	input := make([]byte, 8+len(plaintext))
+	copy(input, keyWrapIV)
+	copy(input[8:], plaintext)
+	defer ZeroizeByteArray(input)
+	return wrapBlocks(block, input), nil
+}
+
+// wrapBlocks runs the wrapping process of RFC 3394 section 2.2.1 on the initial value followed by
+// the 64 bit blocks of the key
+func wrapBlocks(block cipher.Block, input []byte) []byte {
+
+	n := len(input)/8 - 1
+	a := make([]byte, 8)
+	copy(a, input[:8])
+	r := make([]byte, n*8)
+	copy(r, input[8:])
+	b := make([]byte, 16)
+	defer ZeroizeByteArray(b)
+	for j := 0; j < 6; j++ {
+		for i := 0; i < n; i++ {
+			copy(b[:8], a)
+			copy(b[8:], r[i*8:(i+1)*8])
+			block.Encrypt(b, b)
+			t := uint64(n*j + i + 1)
+			binary.BigEndian.PutUint64(a, binary.BigEndian.Uint64(b[:8])^t)
+			copy(r[i*8:(i+1)*8], b[8:])
+		}
+	}
+	return append(a, r...)
+}
+
+// UnwrapKeyWithPadding unwraps a key wrapped under kek with AES key wrap with padding (RFC 5649)
+func UnwrapKeyWithPadding(kek, wrapped []byte) ([]byte, error) {
+
+	if len(wrapped) < 16 || len(wrapped)%8 != 0 {
+		return nil, errors.New("Wrapped key has invalid length")
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create AES cipher")
+	}
+
+	n := len(wrapped)/8 - 1
+	padded := make([]byte, 8+n*8)
+	if n == 1 {
+		block.Decrypt(padded, wrapped)
+	} else {
+		// unwrapping process of RFC 3394 section 2.2.2
+		a := make([]byte, 8)
+		copy(a, wrapped[:8])
+		r := padded[8:]
+		copy(r, wrapped[8:])
+		b := make([]byte, 16)
+		defer ZeroizeByteArray(b)
+		for j := 5; j >= 0; j-- {
+			for i := n - 1; i >= 0; i-- {
+				t := uint64(n*j + i + 1)
+				binary.BigEndian.PutUint64(b[:8], binary.BigEndian.Uint64(a)^t)
+				copy(b[8:], r[i*8:(i+1)*8])
+				block.Decrypt(b, b)
+				copy(a, b[:8])
+				copy(r[i*8:(i+1)*8], b[8:])
+			}
+		}
+		copy(padded, a)
+	}
+
+	// the integrity check of RFC 5649 section 3
+	length := int(binary.BigEndian.Uint32(padded[4:8]))
+	valid := subtle.ConstantTimeCompare(padded[:4], keyWrapPaddingIV)
+	if valid != 1 || length > n*8 || length <= n*8-8 {
+		ZeroizeByteArray(padded)
+		return nil, errors.New("Failed to unwrap key, integrity check failed")
+	}
+	if subtle.ConstantTimeCompare(padded[8+length:], make([]byte, n*8-length)) != 1 {
+		ZeroizeByteArray(padded)
+		return nil, errors.New("Failed to unwrap key, integrity check failed")
+	}
+	plaintext := make([]byte, length)
+	copy(plaintext, padded[8:8+length])
+	ZeroizeByteArray(padded)
+	return plaintext, nil
+}
+
+// WrapKeyForImport wraps key material the way PKCS#11 CKM_RSA_AES_KEY_WRAP does: an ephemeral
+// AES-256 key is encrypted to publicKey with RSA-OAEP SHA-256 and followed by the key material
+// wrapped under the ephemeral key with AES key wrap with padding.
+func WrapKeyForImport(publicKey *rsa.PublicKey, keyMaterial []byte) ([]byte, error) {
+
+	ephemeralKey, err := GetDerivedKey(32)
+	if err != nil {
+		return nil, err
+	}
+	defer ZeroizeByteArray(ephemeralKey)
+
+	wrappedEphemeralKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, ephemeralKey, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to wrap ephemeral key")
+	}
+	wrappedKey, err := WrapKeyWithPadding(ephemeralKey, keyMaterial)
+	if err != nil {
+		return nil, err
+	}
+	return append(wrappedEphemeralKey, wrappedKey...), nil
+}
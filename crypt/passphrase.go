@@ -0,0 +1,67 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package crypt
+
+import (
+	"crypto/rand"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	KdfScrypt = "scrypt"
+
+	defaultScryptN  = 1 << 15
+	defaultScryptR  = 8
+	defaultScryptP  = 1
+	scryptSaltSize  = 32
+	maxScryptNLimit = 1 << 20
+)
+
+// PassphraseKdf holds the parameters used to derive a key from a passphrase
+type PassphraseKdf struct {
+	Kdf  string `json:"kdf"`
+	Salt []byte `json:"salt"`
+	N    int    `json:"n"`
+	R    int    `json:"r"`
+	P    int    `json:"p"`
+}
+
+// NewPassphraseKdf returns scrypt parameters with the recommended cost and a random salt
+func NewPassphraseKdf() (*PassphraseKdf, error) {
+	salt := make([]byte, scryptSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, errors.Wrap(err, "Failed during rand initialization for salt value")
+	}
+	return &PassphraseKdf{
+		Kdf:  KdfScrypt,
+		Salt: salt,
+		N:    defaultScryptN,
+		R:    defaultScryptR,
+		P:    defaultScryptP,
+	}, nil
+}
+
+// DeriveKey derives a key of keySize bytes from passphrase
+func (pk *PassphraseKdf) DeriveKey(passphrase string, keySize int) ([]byte, error) {
+	if passphrase == "" {
+		return nil, errors.New("passphrase cannot be empty")
+	}
+	if pk.Kdf != KdfScrypt {
+		return nil, errors.Errorf("unsupported key derivation function %s", pk.Kdf)
+	}
+	// bound the cost so that a crafted file cannot exhaust memory
+	if pk.N > maxScryptNLimit || len(pk.Salt) == 0 {
+		return nil, errors.New("invalid scrypt parameters")
+	}
+	key, err := scrypt.Key([]byte(passphrase), pk.Salt, pk.N, pk.R, pk.P, keySize)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to derive key from passphrase")
+	}
+	return key, nil
+}
@@ -0,0 +1,224 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package crypt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/pkg/errors"
+)
+
+// crypto/x509 only encodes keys on the NIST curves, secp256k1 keys are encoded here with the
+// structures of RFC 5915 (SEC1), RFC 5958 (PKCS#8) and RFC 5480 (PKIX)
+var (
+	oidPublicKeyECDSA      = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidNamedCurveSecp256k1 = asn1.ObjectIdentifier{1, 3, 132, 0, 10}
+)
+
+type pkcs8PrivateKey struct {
+	Version    int
+	Algo       pkix.AlgorithmIdentifier
+	PrivateKey []byte
+}
+
+type sec1PrivateKey struct {
+	Version       int
+	PrivateKey    []byte
+	NamedCurveOID asn1.ObjectIdentifier `asn1:"optional,explicit,tag:0"`
+	PublicKey     asn1.BitString        `asn1:"optional,explicit,tag:1"`
+}
+
+type pkixPublicKey struct {
+	Algo      pkix.AlgorithmIdentifier
+	BitString asn1.BitString
+}
+
+// Secp256k1 returns the secp256k1 curve
+func Secp256k1() elliptic.Curve {
+	return secp256k1.S256()
+}
+
+// GenerateSecp256k1Key generates a secp256k1 private key
+func GenerateSecp256k1Key() (*ecdsa.PrivateKey, error) {
+	privateKey, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate secp256k1 key")
+	}
+	defer privateKey.Zero()
+	return privateKey.ToECDSA(), nil
+}
+
+func isSecp256k1(curve elliptic.Curve) bool {
+	return curve == secp256k1.S256()
+}
+
+// MarshalPKCS8PrivateKey returns the PKCS#8 DER form of a private key, including secp256k1 keys
+func MarshalPKCS8PrivateKey(privateKey crypto.PrivateKey) ([]byte, error) {
+	ecKey, ok := privateKey.(*ecdsa.PrivateKey)
+	if !ok || !isSecp256k1(ecKey.Curve) {
+		return x509.MarshalPKCS8PrivateKey(privateKey)
+	}
+
+	curveParameters, err := asn1.Marshal(oidNamedCurveSecp256k1)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal curve OID")
+	}
+	// the curve is in the algorithm identifier and left out of the SEC1 key
+	sec1Key, err := marshalSecp256k1PrivateKey(ecKey, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer ZeroizeByteArray(sec1Key)
+	return asn1.Marshal(pkcs8PrivateKey{
+		Algo: pkix.AlgorithmIdentifier{
+			Algorithm:  oidPublicKeyECDSA,
+			Parameters: asn1.RawValue{FullBytes: curveParameters},
+		},
+		PrivateKey: sec1Key,
+	})
+}
+
+// MarshalECPrivateKey returns the SEC1 DER form of an EC private key, including secp256k1 keys
+func MarshalECPrivateKey(privateKey *ecdsa.PrivateKey) ([]byte, error) {
+	if !isSecp256k1(privateKey.Curve) {
+		return x509.MarshalECPrivateKey(privateKey)
+	}
+	return marshalSecp256k1PrivateKey(privateKey, oidNamedCurveSecp256k1)
+}
+
+// MarshalPKIXPublicKey returns the PKIX DER form of a public key, including secp256k1 keys
+func MarshalPKIXPublicKey(publicKey crypto.PublicKey) ([]byte, error) {
+	ecKey, ok := publicKey.(*ecdsa.PublicKey)
+	if !ok || !isSecp256k1(ecKey.Curve) {
+		return x509.MarshalPKIXPublicKey(publicKey)
+	}
+
+	curveParameters, err := asn1.Marshal(oidNamedCurveSecp256k1)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal curve OID")
+	}
+	point := secp256k1Point(ecKey)
+	return asn1.Marshal(pkixPublicKey{
+		Algo: pkix.AlgorithmIdentifier{
+			Algorithm:  oidPublicKeyECDSA,
+			Parameters: asn1.RawValue{FullBytes: curveParameters},
+		},
+		BitString: asn1.BitString{Bytes: point, BitLength: 8 * len(point)},
+	})
+}
+
+// ParsePKIXPublicKey parses a public key in PKIX DER form, including secp256k1 keys
+func ParsePKIXPublicKey(keyDer []byte) (crypto.PublicKey, error) {
+	publicKey, err := x509.ParsePKIXPublicKey(keyDer)
+	if err == nil {
+		return publicKey, nil
+	}
+
+	var pkix pkixPublicKey
+	if rest, asn1Err := asn1.Unmarshal(keyDer, &pkix); asn1Err != nil || len(rest) > 0 {
+		return nil, err
+	}
+	var curve asn1.ObjectIdentifier
+	if !pkix.Algo.Algorithm.Equal(oidPublicKeyECDSA) {
+		return nil, err
+	}
+	if _, asn1Err := asn1.Unmarshal(pkix.Algo.Parameters.FullBytes, &curve); asn1Err != nil || !curve.Equal(oidNamedCurveSecp256k1) {
+		return nil, err
+	}
+	secp256k1Key, parseErr := secp256k1.ParsePubKey(pkix.BitString.RightAlign())
+	if parseErr != nil {
+		return nil, errors.Wrap(parseErr, "invalid secp256k1 public key")
+	}
+	return secp256k1Key.ToECDSA(), nil
+}
+
+// ParsePKCS8PrivateKey parses a private key in PKCS#8 DER form, including secp256k1 keys
+func ParsePKCS8PrivateKey(keyDer []byte) (crypto.PrivateKey, error) {
+	privateKey, err := x509.ParsePKCS8PrivateKey(keyDer)
+	if err == nil {
+		return privateKey, nil
+	}
+
+	var pkcs8 pkcs8PrivateKey
+	if rest, asn1Err := asn1.Unmarshal(keyDer, &pkcs8); asn1Err != nil || len(rest) > 0 {
+		return nil, err
+	}
+	var curve asn1.ObjectIdentifier
+	if !pkcs8.Algo.Algorithm.Equal(oidPublicKeyECDSA) {
+		return nil, err
+	}
+	if _, asn1Err := asn1.Unmarshal(pkcs8.Algo.Parameters.FullBytes, &curve); asn1Err != nil || !curve.Equal(oidNamedCurveSecp256k1) {
+		return nil, err
+	}
+	return parseSecp256k1PrivateKey(pkcs8.PrivateKey)
+}
+
+// ParseECPrivateKey parses an EC private key in SEC1 DER form, including secp256k1 keys
+func ParseECPrivateKey(keyDer []byte) (*ecdsa.PrivateKey, error) {
+	privateKey, err := x509.ParseECPrivateKey(keyDer)
+	if err == nil {
+		return privateKey, nil
+	}
+
+	var sec1 sec1PrivateKey
+	if rest, asn1Err := asn1.Unmarshal(keyDer, &sec1); asn1Err != nil || len(rest) > 0 || !sec1.NamedCurveOID.Equal(oidNamedCurveSecp256k1) {
+		return nil, err
+	}
+	return parseSecp256k1PrivateKey(keyDer)
+}
+
+// parseSecp256k1PrivateKey parses a secp256k1 private key in SEC1 DER form, with or without the
+// curve OID
+func parseSecp256k1PrivateKey(keyDer []byte) (*ecdsa.PrivateKey, error) {
+	var sec1 sec1PrivateKey
+	if _, err := asn1.Unmarshal(keyDer, &sec1); err != nil {
+		return nil, errors.Wrap(err, "failed to parse secp256k1 private key")
+	}
+	defer ZeroizeByteArray(sec1.PrivateKey)
+	if sec1.Version != 1 {
+		return nil, errors.Errorf("unknown EC private key version %d", sec1.Version)
+	}
+	if len(sec1.NamedCurveOID) > 0 && !sec1.NamedCurveOID.Equal(oidNamedCurveSecp256k1) {
+		return nil, errors.New("EC private key is not a secp256k1 key")
+	}
+
+	d := new(big.Int).SetBytes(sec1.PrivateKey)
+	if len(sec1.PrivateKey) > 32 || d.Sign() == 0 || d.Cmp(secp256k1.S256().N) >= 0 {
+		return nil, errors.New("invalid secp256k1 private key")
+	}
+	privateKey := secp256k1.PrivKeyFromBytes(sec1.PrivateKey)
+	defer privateKey.Zero()
+	return privateKey.ToECDSA(), nil
+}
+
+func marshalSecp256k1PrivateKey(privateKey *ecdsa.PrivateKey, curveOID asn1.ObjectIdentifier) ([]byte, error) {
+	d := privateKey.D.FillBytes(make([]byte, 32))
+	defer ZeroizeByteArray(d)
+	point := secp256k1Point(&privateKey.PublicKey)
+	return asn1.Marshal(sec1PrivateKey{
+		Version:       1,
+		PrivateKey:    d,
+		NamedCurveOID: curveOID,
+		PublicKey:     asn1.BitString{Bytes: point, BitLength: 8 * len(point)},
+	})
+}
+
+// secp256k1Point returns the uncompressed point 0x04 || X || Y of a secp256k1 public key
+func secp256k1Point(publicKey *ecdsa.PublicKey) []byte {
+	point := make([]byte, 65)
+	point[0] = 4
+	publicKey.X.FillBytes(point[1:33])
+	publicKey.Y.FillBytes(point[33:])
+	return point
+}
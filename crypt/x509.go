@@ -8,7 +8,9 @@ package crypt
 
 import (
 	"crypto"
+	"crypto/ecdsa"
 	"crypto/rand"
+	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/x509"
 	"encoding/pem"
@@ -25,7 +27,7 @@ func GetPrivateKeyFromPem(keyPem []byte) (crypto.PrivateKey, error) {
 		log.Error("failed to parse private key PEM")
 		return nil, errors.New("failed to decode PEM formatted private key")
 	}
-	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	key, err := ParsePKCS8PrivateKey(block.Bytes)
 	if err != nil {
 		log.WithError(err).Error("failed to parse private key")
 		return nil, errors.Wrap(err, "failed to parse private key")
@@ -33,6 +35,22 @@ func GetPrivateKeyFromPem(keyPem []byte) (crypto.PrivateKey, error) {
 	return key, nil
 }
 
+// ParsePrivateKeyDer parses a private key in PKCS#8, PKCS#1 (RSA) or SEC1 (EC) DER form, the
+// forms the key managers return private keys in
+func ParsePrivateKeyDer(keyDer []byte) (crypto.PrivateKey, error) {
+	if key, err := ParsePKCS8PrivateKey(keyDer); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(keyDer); err == nil {
+		return key, nil
+	}
+	key, err := ParseECPrivateKey(keyDer)
+	if err != nil {
+		return nil, errors.New("failed to parse private key as PKCS#8, PKCS#1 or SEC1")
+	}
+	return key, nil
+}
+
 // GetPublicKeyFromPem retrieve the public key from a public pem block
 func GetPublicKeyFromPem(keyPem []byte) (crypto.PublicKey, error) {
 	block, _ := pem.Decode(keyPem)
@@ -48,6 +66,22 @@ func GetPublicKeyFromPem(keyPem []byte) (crypto.PublicKey, error) {
 	return key, nil
 }
 
+// CheckWrappingPublicKey checks that keys can be wrapped to publicKey, which must be an RSA key,
+// an EC key on the P-256, P-384 or P-521 curve or a hybrid key
+func CheckWrappingPublicKey(publicKey crypto.PublicKey) error {
+	switch publicKey := publicKey.(type) {
+	case *rsa.PublicKey, *HybridPublicKey:
+		return nil
+	case *ecdsa.PublicKey:
+		if _, err := publicKey.ECDH(); err != nil {
+			return errors.Wrap(err, "unsupported EC public key")
+		}
+		return nil
+	default:
+		return errors.Errorf("public key type %T is not supported", publicKey)
+	}
+}
+
 // GetDerivedKey is used to get an AES key of given length using crypto hkdf function
 func GetDerivedKey(keySize int) ([]byte, error) {
 	hash := sha256.New
@@ -1,6 +1,9 @@
 package kbs
 
-import "intel/kbs/v1/service"
+import (
+	"intel/kbs/v1/model"
+	"intel/kbs/v1/service"
+)
 
 // TransferKey request payload
 // swagger:parameters TransferKeyRequest
@@ -18,6 +21,30 @@ type TransferKeyResponse struct {
 	Body service.TransferKeyResponse
 }
 
+// DataKey request payload
+// swagger:parameters DataKeyRequest
+type DataKeyRequest struct {
+	// in:body
+	// required: true
+	Body model.DataKeyRequest
+}
+
+// DataKey decrypt request payload
+// swagger:parameters DataKeyDecryptRequest
+type DataKeyDecryptRequest struct {
+	// in:body
+	// required: true
+	Body model.DataKeyDecryptRequest
+}
+
+// DataKey response payload
+// swagger:parameters DataKeyResponse
+type DataKeyResponse struct {
+	// in:body
+	// required: true
+	Body model.DataKeyResponse
+}
+
 // ---
 // swagger:operation POST /keys/{id}/transfer TransferKey TransferKey
 // ---
@@ -31,7 +58,7 @@ type TransferKeyResponse struct {
 //    |--------------------|-------------|
 //    | attestation_token  | Attestation token received from Intel Trust Authority. This is the only attribute required to retrieve the key in passport mode   |
 //    | quote              | TEE quote from workload. This attribute is required to retrieve the key in background mode. |
-//    | nonce              | Verifier nonce from Intel Trust Authority. This is a serialized Go struct "VerifierNonce" in the Intel Trust Authority connector. |
+//    | nonce              | Verifier nonce issued by the KBS from Intel Trust Authority. This is a serialized Go struct "VerifierNonce" in the Intel Trust Authority connector. |
 //    | user_data          | TEE held data in an attestation token. It is the public key created in the workload that is used to wrap the SWK key. |
 //    | nonce              | Verifier nonce from Intel Trust Authority. This is a serialized Go struct "VerifierNonce" in the Intel Trust Authority connector. |
 //
@@ -59,25 +86,39 @@ type TransferKeyResponse struct {
 //   enum:
 //     - application/json
 // - name: Accept
-//   description: Accept header.
+//   description: Accept header. The JOSE media types request the key as a JWE.
 //   in: header
 //   type: string
 //   required: true
 //   enum:
 //     - application/json
+//     - application/jose
+//     - application/jose+json
+// - name: Envelope-Version
+//   description: Version of the wrapped key envelope, 1 or 2. The version of the key transfer policy, or 2, is used when it is not set.
+//   in: header
+//   type: string
+//   required: false
+//   enum:
+//     - 1
+//     - 2
 // responses:
 //   '200':
 //     description: The key was successfully transferred.
 //     content:
 //       application/json
+//       application/jose
+//       application/jose+json
 //     schema:
 //       $ref: "#/definitions/TransferKeyResponse"
 //   '401':
-//     description: Failed to authenticate the attestation token.
+//     description: Failed to authenticate the attestation token, or the verifier nonce or report data of the token does not bind the user data to the attestation.
 //   '404':
 //     description: The key record was not found.
 //   '400':
 //     description: An invalid request body was provided.
+//   '406':
+//     description: The key cannot be returned in the requested format.
 //   '415':
 //     description: Invalid Accept Header in the request.
 //   '500':
@@ -93,3 +134,176 @@ type TransferKeyResponse struct {
 //			"wrapped_key": "DAAAABAAAAAwAAAAyKHZsencLdTeTMV1plalHIcKBDleJqk5L6mQUOpq/Xws1nes5N02g+Mt4qmq7dbDbhTYN4xZjMxuCVM3",
 //			"wrapped_swk": "h9wwWK4WV/STdq4vSzrVBgATkp+MOo8NMTL+W15S+M5EcyKI8geAyUkE0Cr4ss7U22Uc7I2ETjlajNZzMjcbcEFf5h7p9i22KY5HK12ww3FC6CMTMAK2FCsy4MPyzD1luiH8W/ezssd7sDbg2VlNQlYOZ4UG/vFBJ7/c74suwa31vyj3hPelQFhkN6yFKcvoYalb1VejdCWeJ0r6/8zOJjDZrEE9XqExQtaxLFmdmYvYy3Q02vVyz0nSeP38dlx+W7ifiLR2GEPjNYmWq+N+ToDdtvb/lJOiFoRZtATFQmzBptiMsyr8mkLKzEPdB6g6ghDsW7rGSHlj5YgC2d3VbqUcUoh5ZiW65sXhrzIQ9s4ON5MFLU5ECj9/9BqThHnBtqa0tVoLfbdvmNpUB+xO994WiIoZtfAJ3JhtlPPwHShw5lAvpH0X1OSklauH8Kb8UMP3EU0FO0J29aU3glm9/9do//NHYb3mIYpZ7r5VLy31UkB68e+3hnlHDzPCbea8"
 //		}
+
+// ---
+
+// swagger:operation POST /keys/{id}/datakey TransferKey GenerateDataKey
+// ---
+//
+// description: |
+//   Generates a random AES data key for envelope encryption and releases it to an attested workload.
+//   The data key is returned wrapped to the workload like a transferred key, together with the data key
+//   encrypted under the AES key {id}, which is never released. The workload stores the ciphertext with its
+//   data and recovers the data key with POST /keys/{id}/datakey/decrypt.
+//
+//   The attestation of the workload is the same as for POST /keys/{id}/transfer and is checked against the
+//   key transfer policy of the key. A request without an attestation token or quote returns a verifier nonce.
+//
+//    | Attribute          | Description |
+//    |--------------------|-------------|
+//    | key_length         | Length of the data key in bits, 128, 192 or 256. The default is 256. |
+//
+// consumes:
+// - application/json
+// produces:
+// - application/json
+// parameters:
+// - name: id
+//   description: The unique ID of the AES key that encrypts the data key.
+//   in: path
+//   required: true
+//   type: string
+//   format: uuid
+// - name: request body
+//   required: true
+//   in: body
+//   schema:
+//    "$ref": "#/definitions/DataKeyRequest"
+// - name: Content-Type
+//   description: Content-Type header.
+//   in: header
+//   type: string
+//   required: true
+//   enum:
+//     - application/json
+// - name: Accept
+//   description: Accept header.
+//   in: header
+//   type: string
+//   required: true
+//   enum:
+//     - application/json
+// - name: Envelope-Version
+//   description: Version of the wrapped key envelope of the data key released to the workload, 1 or 2.
+//   in: header
+//   type: string
+//   required: false
+//   enum:
+//     - 1
+//     - 2
+// responses:
+//   '200':
+//     description: The data key was successfully generated.
+//     content:
+//       application/json
+//     schema:
+//       $ref: "#/definitions/DataKeyResponse"
+//   '400':
+//     description: An invalid request body was provided, or the key is not an AES key.
+//   '401':
+//     description: Failed to authenticate the attestation token.
+//   '404':
+//     description: The key record was not found.
+//   '415':
+//     description: Invalid Accept Header in the request.
+//   '500':
+//     description: Internal server error.
+//
+// x-sample-call-endpoint: https://kbs.com:9443/kbs/v1/keys/ee37c360-7eae-4250-a677-6ee12adce8e2/datakey
+// x-sample-call-input: |
+//		{
+//			"attestation_token": "eyJhbGciOiJQUzM4NCIsImprdSI6Imh0dHBzOi8vYW1iZXItcG9jLXVzZXIxLnByb2plY3QtYW1iZXItc21hcy5jb20vY2VydHMiLCJraWQiOi...",
+//			"key_length": 256
+//		}
+// x-sample-call-output: |
+//		{
+//			"wrapped_key": "AgAAAKcAAAB7ImtleV9pZCI6ImVlMzdjMzYwLTdlYWUtNDI1MC1hNjc3LTZlZTEyYWRjZThlMiIs...",
+//			"wrapped_swk": "h9wwWK4WV/STdq4vSzrVBgATkp+MOo8NMTL+W15S+M5EcyKI8geAyUkE0Cr4ss7U22Uc7I2ETjlajNZzMjcbcEFf...",
+//			"envelope_version": 2,
+//			"ciphertext": "AgAAAKcAAAB7ImtleV9pZCI6ImVlMzdjMzYwLTdlYWUtNDI1MC1hNjc3LTZlZTEyYWRjZThlMiIs..."
+//		}
+
+// ---
+
+// swagger:operation POST /keys/{id}/datakey/decrypt TransferKey DecryptDataKey
+// ---
+//
+// description: |
+//   Decrypts a data key generated with POST /keys/{id}/datakey and releases it to an attested workload,
+//   wrapped to the workload like a transferred key. The ciphertext must have been returned for the key {id}.
+//
+//   The attestation of the workload is the same as for POST /keys/{id}/transfer and is checked against the
+//   key transfer policy of the key. A request without a body returns a verifier nonce.
+//
+//    | Attribute          | Description |
+//    |--------------------|-------------|
+//    | ciphertext         | The data key encrypted under the key, as returned when the data key was generated. |
+//
+// consumes:
+// - application/json
+// produces:
+// - application/json
+// parameters:
+// - name: id
+//   description: The unique ID of the AES key that encrypts the data key.
+//   in: path
+//   required: true
+//   type: string
+//   format: uuid
+// - name: request body
+//   required: true
+//   in: body
+//   schema:
+//    "$ref": "#/definitions/DataKeyDecryptRequest"
+// - name: Content-Type
+//   description: Content-Type header.
+//   in: header
+//   type: string
+//   required: true
+//   enum:
+//     - application/json
+// - name: Accept
+//   description: Accept header.
+//   in: header
+//   type: string
+//   required: true
+//   enum:
+//     - application/json
+// - name: Envelope-Version
+//   description: Version of the wrapped key envelope of the data key released to the workload, 1 or 2.
+//   in: header
+//   type: string
+//   required: false
+//   enum:
+//     - 1
+//     - 2
+// responses:
+//   '200':
+//     description: The data key was successfully decrypted.
+//     content:
+//       application/json
+//     schema:
+//       $ref: "#/definitions/DataKeyResponse"
+//   '400':
+//     description: An invalid request body was provided, or the ciphertext was not encrypted under the key.
+//   '401':
+//     description: Failed to authenticate the attestation token.
+//   '404':
+//     description: The key record was not found.
+//   '415':
+//     description: Invalid Accept Header in the request.
+//   '500':
+//     description: Internal server error.
+//
+// x-sample-call-endpoint: https://kbs.com:9443/kbs/v1/keys/ee37c360-7eae-4250-a677-6ee12adce8e2/datakey/decrypt
+// x-sample-call-input: |
+//		{
+//			"attestation_token": "eyJhbGciOiJQUzM4NCIsImprdSI6Imh0dHBzOi8vYW1iZXItcG9jLXVzZXIxLnByb2plY3QtYW1iZXItc21hcy5jb20vY2VydHMiLCJraWQiOi...",
+//			"ciphertext": "AgAAAKcAAAB7ImtleV9pZCI6ImVlMzdjMzYwLTdlYWUtNDI1MC1hNjc3LTZlZTEyYWRjZThlMiIs..."
+//		}
+// x-sample-call-output: |
+//		{
+//			"wrapped_key": "AgAAAKcAAAB7ImtleV9pZCI6ImVlMzdjMzYwLTdlYWUtNDI1MC1hNjc3LTZlZTEyYWRjZThlMiIs...",
+//			"wrapped_swk": "h9wwWK4WV/STdq4vSzrVBgATkp+MOo8NMTL+W15S+M5EcyKI8geAyUkE0Cr4ss7U22Uc7I2ETjlajNZzMjcbcEFf...",
+//			"envelope_version": 2
+//		}
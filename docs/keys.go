@@ -9,6 +9,8 @@ import (
 
 type KeyResponses []model.KeyResponse
 
+type KmipObjects []model.KmipObject
+
 // Key request payload
 // swagger:parameters KeyRequest
 type KeyRequest struct {
@@ -32,6 +34,13 @@ type KeyCollection struct {
 	Body KeyResponses
 }
 
+// KmipObjectCollection response payload
+// swagger:parameters KmipObjectCollection
+type KmipObjectCollection struct {
+	// in:body
+	Body KmipObjects
+}
+
 // KeyTransfer response payload
 // swagger:parameters KeyTransferResponse
 type KeyTransferResponse struct {
@@ -66,11 +75,11 @@ type KeyUpdateRequest struct {
 //
 //    | Attribute   | Description |
 //    |-------------|-------------|
-//    | algorithm   | The encryption algorithm used to create or register a key.  The supported algorithms are AES, RSA, and EC. |
-//    | key_length  | The key length used to create a key. Supported key lengths are 128,192,256 bits for AES and 2048,3072,4096,7680 bits for RSA. This parameter must be provided only for the AES and RSA algorithms. |
-//    | curve_type  | The elliptic curve used to create a key. The supported curves are secp256r1, secp384r1, prime256v1 and secp521r1. This parameter must be provided only for the EC algorithm. |
+//    | algorithm   | The algorithm used to create or register a key.  The supported algorithms are AES, HMAC, CHACHA20, RSA, EC, ED25519 and X25519. ED25519 and X25519 keys are not supported by the KMIP, PKCS#11 and vault transit key managers, HMAC and CHACHA20 keys are not supported by the PKCS#11 and vault transit key managers. |
+//    | key_length  | The key length used to create a key. Supported key lengths are 128,192,256 bits for AES, 256,384 bits for HMAC (HMAC-SHA256 and HMAC-SHA384), 256 bits for CHACHA20 and 2048,3072,4096,7680 bits for RSA. This parameter must be provided only for the AES, HMAC, CHACHA20 and RSA algorithms. |
+//    | curve_type  | The elliptic curve used to create a key. The supported curves are secp256r1, secp384r1, prime256v1, secp521r1 and secp256k1. This parameter must be provided only for the EC algorithm. |
 //    | key_data    | The Base64 encoded private key to be registered.  It is only supported if the key is created locally. |
-//    | kmip_key_id | The unique KMIP identifier of the key to be registered.  It is only supported if the key is created on a KMIP server. |
+//    | kmip_key_id | The unique KMIP identifier of the key to be registered.  It is only supported if the key is created on a KMIP server. The key must be Active and match the algorithm and key_length or curve_type of the request. Keys can be looked up with GET /keys/kmip-objects. |
 //
 // x-permissions: keys:create
 // security:
@@ -193,6 +202,62 @@ type KeyUpdateRequest struct {
 
 // ---
 
+// swagger:operation GET /keys/{id}/public-key Keys RetrievePublicKey
+// ---
+//
+// description: |
+//   Retrieves the public key of an RSA, EC, ED25519 or X25519 key, without attestation, so that signatures
+//   made with the key by a workload can be verified. The public key is returned in the first format of the
+//   Accept header that is supported: PEM, DER or JWK. application/json returns the JWK.
+//   It is supported by the vault, local and KMIP key managers.
+// x-permissions: keys:public_key
+// security:
+// - bearerToken: []
+// produces:
+// - application/x-pem-file
+// - application/octet-stream
+// - application/jwk+json
+// - application/json
+// parameters:
+// - name: id
+//   description: The unique ID of the key.
+//   in: path
+//   required: true
+//   type: string
+//   format: uuid
+// - name: Accept
+//   description: Accept header.
+//   in: header
+//   type: string
+//   required: true
+//   enum:
+//     - application/x-pem-file
+//     - application/octet-stream
+//     - application/jwk+json
+//     - application/json
+// responses:
+//   '200':
+//     description: The public key was successfully retrieved.
+//   '400':
+//     description: The key is not an asymmetric key or its key manager cannot return public keys.
+//   '401':
+//     description: The request was unauthorized.
+//   '404':
+//     description: The key record was not found.
+//   '415':
+//     description: Invalid Accept Header in the request.
+//   '500':
+//     description: Internal server error.
+//
+// x-sample-call-endpoint: https://kbs.com:9443/kbs/v1/keys/fc0cc779-22b6-4741-b0d9-e2e69635ad1e/public-key
+// x-sample-call-output: |
+//    -----BEGIN PUBLIC KEY-----
+//    MFkwEwYHKoZIzj0CAQYIKoZIzj0DAQcDQgAEjxpHX/QQTVg2xHgi3SHu+f73ojsI
+//    m+XOCXIoCERpp7OZ5NziWE4umvH/al2iHaH9fWWJjkc9rNwcq//UuJjeGQ==
+//    -----END PUBLIC KEY-----
+
+// ---
+
 // swagger:operation POST keys/{id} Keys TransferKey
 // ---
 //
@@ -304,19 +369,19 @@ type KeyUpdateRequest struct {
 //   in: query
 //   type: string
 //   required: false
-//   enum: [AES, RSA, EC, aes, rsa, ec]
+//   enum: [AES, RSA, EC, HMAC, CHACHA20, ED25519, X25519, aes, rsa, ec, hmac, chacha20, ed25519, x25519]
 // - name: keyLength
 //   description: Key length.
 //   in: query
 //   type: integer
 //   required: false
-//   enum: [128, 192, 256, 2048, 3072, 4096, 7680]
+//   enum: [128, 192, 256, 384, 2048, 3072, 4096, 7680]
 // - name: curveType
 //   description: Elliptic Curve name.
 //   in: query
 //   type: string
 //   required: false
-//   enum: [secp256r1, secp384r1, secp521r1, prime256v1]
+//   enum: [secp256r1, secp384r1, secp521r1, prime256v1, secp256k1]
 // - name: transferPolicyId
 //   description: Unique identifier of the transfer policy.
 //   in: query
@@ -363,6 +428,88 @@ type KeyUpdateRequest struct {
 
 // ---
 
+// swagger:operation GET /keys/kmip-objects Keys DiscoverKmipKeys
+// ---
+//
+// description: |
+//   Lists the AES, HMAC, ChaCha20, RSA and EC keys held by a KMIP key manager, so that existing keys can be
+//   registered with kmip_key_id. All keys are listed when no query parameter is provided.
+//   Keys that are already registered carry the key_id of the KBS key referencing them.
+//
+//   Returns - The collection of serialized KmipObject Go struct objects.
+// x-permissions: keys:search
+// security:
+// - bearerToken: []
+// produces:
+//  - application/json
+// parameters:
+// - name: keyManager
+//   description: Name of the key manager backend, the default backend is used when not provided.
+//   in: query
+//   type: string
+//   required: false
+// - name: name
+//   description: Name of the key on the KMIP server.
+//   in: query
+//   type: string
+//   required: false
+// - name: algorithm
+//   description: Key algorithm.
+//   in: query
+//   type: string
+//   required: false
+//   enum: [AES, RSA, EC, HMAC, CHACHA20, aes, rsa, ec, hmac, chacha20]
+// - name: keyLength
+//   description: Key length.
+//   in: query
+//   type: integer
+//   required: false
+// - name: Accept
+//   description: Accept header
+//   in: header
+//   type: string
+//   required: true
+//   enum:
+//     - application/json
+// responses:
+//   '200':
+//     description: Successfully listed the keys.
+//     content:
+//       application/json
+//     schema:
+//       $ref: "#/definitions/KmipObjects"
+//   '401':
+//     description: Request Unauthorized
+//   '400':
+//     description: Invalid values for request params or the key manager cannot list its keys
+//   '415':
+//     description: Invalid Accept Header in Request
+//   '500':
+//     description: Internal server error
+//
+// x-sample-call-endpoint: https://kbs.com:9443/kbs/v1/keys/kmip-objects?keyManager=hsm&algorithm=aes
+// x-sample-call-output: |
+//    [
+//        {
+//            "kmip_key_id": "1",
+//            "key_manager": "hsm",
+//            "names": ["payments-key"],
+//            "algorithm": "AES",
+//            "key_length": 256,
+//            "state": "Active",
+//            "key_id": "fc0cc779-22b6-4741-b0d9-e2e69635ad1e"
+//        },
+//        {
+//            "kmip_key_id": "2",
+//            "key_manager": "hsm",
+//            "algorithm": "AES",
+//            "key_length": 256,
+//            "state": "Active"
+//        }
+//    ]
+
+// ---
+
 // swagger:operation PUT /keys/{id} Keys UpdateKey
 // ---
 //
@@ -0,0 +1,433 @@
+/*
+ * Copyright(C) 2024 Intel Corporation. All Rights Reserved.
+ */
+package kbs
+
+import (
+	"intel/kbs/v1/model"
+)
+
+type SecretResponses []model.SecretResponse
+
+// Secret request payload
+// swagger:parameters SecretRequest
+type SecretRequest struct {
+	// in:body
+	// required: true
+	Body model.SecretRequest
+}
+
+// Secret response payload
+// swagger:parameters SecretResponse
+type SecretResponse struct {
+	// in:body
+	// required: true
+	Body model.SecretResponse
+}
+
+// SecretCollection response payload
+// swagger:parameters SecretCollection
+type SecretCollection struct {
+	// in:body
+	Body SecretResponses
+}
+
+// Secret update payload
+// swagger:parameters SecretUpdateRequest
+type SecretUpdateRequest struct {
+	// in:body
+	// required: true
+	Body model.SecretUpdateRequest
+}
+
+// ---
+// swagger:operation POST /secrets Secrets CreateSecret
+// ---
+//
+// description: |
+//   Stores an opaque secret, such as a password, a certificate bundle or a configuration blob.
+//
+//   The serialized SecretRequest Go struct object represents the content of the request body.
+//
+//    | Attribute          | Description |
+//    |--------------------|-------------|
+//    | data               | The Base64 encoded secret. The decoded secret must not be larger than SECRET_MAX_SIZE bytes, 64 KiB by default. |
+//    | content_type       | The media type of the secret, e.g. text/plain or application/json. |
+//    | transfer_policy_id | The unique identifier of the transfer policy to be applied to this secret. |
+//    | key_manager        | The name of the key manager backend that stores the secret. The default backend is used when not set. |
+//
+// x-permissions: secrets:create
+// security:
+// - bearerToken: []
+// produces:
+// - application/json
+// consumes:
+// - application/json
+// parameters:
+// - name: request body
+//   required: true
+//   in: body
+//   schema:
+//    "$ref": "#/definitions/SecretRequest"
+// - name: Content-Type
+//   description: Content-Type header.
+//   in: header
+//   type: string
+//   required: true
+//   enum:
+//     - application/json
+// - name: Accept
+//   description: Accept header.
+//   in: header
+//   type: string
+//   required: true
+//   enum:
+//     - application/json
+// responses:
+//   '201':
+//     description: The secret was successfully stored.
+//     content:
+//       application/json
+//     schema:
+//       $ref: "#/definitions/SecretResponse"
+//   '401':
+//     description: The request was unauthorized.
+//   '400':
+//     description: An invalid request body was provided.
+//   '413':
+//     description: The secret exceeds the maximum secret size.
+//   '415':
+//     description: Invalid Accept Header in the request.
+//   '500':
+//     description: Internal server error.
+//
+// x-sample-call-endpoint: https://kbs.com:9443/kbs/v1/secrets
+// x-sample-call-input: |
+//    {
+//        "data": "c2VjcmV0LWRhdGFiYXNlLXBhc3N3b3Jk",
+//        "content_type": "text/plain",
+//        "transfer_policy_id": "3ce27bbd-3c5f-4b15-8c0a-44310f0f83d9"
+//    }
+// x-sample-call-output: |
+//    {
+//        "id": "9e1a5c34-b2a4-4d2f-8e58-0c6f3e0f8a71",
+//        "content_type": "text/plain",
+//        "size": 24,
+//        "transfer_policy_id": "3ce27bbd-3c5f-4b15-8c0a-44310f0f83d9",
+//        "transfer_link": "/kbs/v1/secrets/9e1a5c34-b2a4-4d2f-8e58-0c6f3e0f8a71/transfer",
+//        "created_at": "2024-09-23T11:16:26.738467277Z"
+//    }
+
+// ---
+
+// swagger:operation GET /secrets/{id} Secrets RetrieveSecret
+// ---
+//
+// description: |
+//   Retrieves the metadata of a secret. The secret itself is only released wrapped, with a secret transfer.
+//   Returns - The serialized SecretResponse Go struct object that was retrieved.
+// x-permissions: secrets:search
+// security:
+// - bearerToken: []
+// produces:
+// - application/json
+// parameters:
+// - name: id
+//   description: The unique ID of the secret.
+//   in: path
+//   required: true
+//   type: string
+//   format: uuid
+// - name: Accept
+//   description: Accept header.
+//   in: header
+//   type: string
+//   required: true
+//   enum:
+//     - application/json
+// responses:
+//   '200':
+//     description: The secret was successfully retrieved.
+//     content:
+//       application/json
+//     schema:
+//       $ref: "#/definitions/SecretResponse"
+//   '401':
+//     description: The request was unauthorized.
+//   '404':
+//     description: The secret record was not found.
+//   '415':
+//     description: Invalid Accept Header in the request.
+//   '500':
+//     description: Internal server error.
+//
+// x-sample-call-endpoint: https://kbs.com:9443/kbs/v1/secrets/9e1a5c34-b2a4-4d2f-8e58-0c6f3e0f8a71
+// x-sample-call-output: |
+//    {
+//        "id": "9e1a5c34-b2a4-4d2f-8e58-0c6f3e0f8a71",
+//        "content_type": "text/plain",
+//        "size": 24,
+//        "transfer_policy_id": "3ce27bbd-3c5f-4b15-8c0a-44310f0f83d9",
+//        "transfer_link": "/kbs/v1/secrets/9e1a5c34-b2a4-4d2f-8e58-0c6f3e0f8a71/transfer",
+//        "created_at": "2024-09-23T11:16:26.738467277Z"
+//    }
+
+// ---
+
+// swagger:operation PUT /secrets/{id} Secrets UpdateSecret
+// ---
+//
+// description: |
+//   Updates a secret with the key transfer policy.
+//
+//   The serialized SecretUpdateRequest Go struct object represents the content of the request body.
+//
+//    | Attribute          | Description |
+//    |--------------------|-------------|
+//    | transfer_policy_id | The unique identifier of the transfer policy to be applied to this secret. |
+// x-permissions: secrets:update
+// security:
+// - bearerToken: []
+// produces:
+// - application/json
+// consumes:
+// - application/json
+// parameters:
+// - name: id
+//   description: Unique ID of the secret.
+//   in: path
+//   required: true
+//   type: string
+//   format: uuid
+// - name: request body
+//   required: true
+//   in: body
+//   schema:
+//    "$ref": "#/definitions/SecretUpdateRequest"
+// - name: Content-Type
+//   description: Content-Type header.
+//   in: header
+//   type: string
+//   required: true
+//   enum:
+//     - application/json
+// - name: Accept
+//   description: Accept header.
+//   in: header
+//   type: string
+//   required: true
+//   enum:
+//     - application/json
+// responses:
+//   '201':
+//     description: The secret was successfully updated.
+//     content:
+//       application/json
+//     schema:
+//       $ref: "#/definitions/SecretResponse"
+//   '400':
+//     description: An invalid request body was provided.
+//   '401':
+//     description: Request Unauthorized.
+//   '404':
+//     description: The secret record was not found.
+//   '415':
+//     description: Invalid Accept Header in the request.
+//   '500':
+//     description: Internal server error.
+//
+// x-sample-call-endpoint: https://kbs.com:9443/kbs/v1/secrets/9e1a5c34-b2a4-4d2f-8e58-0c6f3e0f8a71
+// x-sample-call-input: |
+//    {
+//        "transfer_policy_id": "3ce27bbd-3c5f-4b15-8c0a-44310f0f84f8"
+//    }
+
+// ---
+
+// swagger:operation DELETE /secrets/{id} Secrets DeleteSecret
+// ---
+//
+// description: |
+//   Deletes a secret.
+// x-permissions: secrets:delete
+// security:
+// - bearerToken: []
+// parameters:
+// - name: id
+//   description: Unique ID of the secret.
+//   in: path
+//   required: true
+//   type: string
+//   format: uuid
+// responses:
+//   '204':
+//     description: The secret was successfully deleted.
+//   '401':
+//     description: Request Unauthorized.
+//   '404':
+//     description: The secret record was not found.
+//   '500':
+//     description: Internal server error.
+//
+// x-sample-call-endpoint: https://kbs.com:9443/kbs/v1/secrets/9e1a5c34-b2a4-4d2f-8e58-0c6f3e0f8a71
+
+// ---
+
+// swagger:operation GET /secrets Secrets SearchSecrets
+// ---
+//
+// description: |
+//   Searches for secrets. All secrets are returned when no query parameter is provided.
+//   Returns - The collection of serialized SecretResponse Go struct objects.
+// x-permissions: secrets:search
+// security:
+// - bearerToken: []
+// produces:
+// - application/json
+// parameters:
+// - name: contentType
+//   description: The media type of the secret.
+//   in: query
+//   type: string
+//   required: false
+// - name: transferPolicyId
+//   description: Unique identifier of the transfer policy.
+//   in: query
+//   type: string
+//   format: uuid
+//   required: false
+// - name: Accept
+//   description: Accept header.
+//   in: header
+//   type: string
+//   required: true
+//   enum:
+//     - application/json
+// responses:
+//   '200':
+//     description: Successfully retrieved the secrets.
+//     content:
+//       application/json
+//     schema:
+//       $ref: "#/definitions/SecretResponses"
+//   '400':
+//     description: Invalid values for request params.
+//   '401':
+//     description: Request Unauthorized.
+//   '415':
+//     description: Invalid Accept Header in the request.
+//   '500':
+//     description: Internal server error.
+//
+// x-sample-call-endpoint: https://kbs.com:9443/kbs/v1/secrets?contentType=text/plain
+
+// ---
+
+// swagger:operation POST /secrets/{id} Secrets TransferSecret
+// ---
+//
+// description: |
+//   Releases a secret wrapped under an SWK, which is wrapped with the public key provided in the request.
+//   Returns - The serialized KeyTransferResponse Go struct object.
+// x-permissions: secrets:transfer
+// security:
+// - bearerToken: []
+// produces:
+// - application/json
+// consumes:
+// - application/x-pem-file
+// parameters:
+// - name: id
+//   description: Unique ID of the secret.
+//   in: path
+//   required: true
+//   type: string
+//   format: uuid
+// - name: Content-Type
+//   description: Content-Type header
+//   in: header
+//   type: string
+//   required: true
+//   enum:
+//     - application/x-pem-file
+// - name: Accept
+//   description: Accept header.
+//   in: header
+//   type: string
+//   required: true
+//   enum:
+//     - application/json
+// responses:
+//   '200':
+//     description: The secret was successfully transferred.
+//     content:
+//       application/json
+//     schema:
+//       $ref: "#/definitions/KeyTransferResponse"
+//   '404':
+//     description: The secret record was not found
+//   '415':
+//     description: Invalid Content-Type/Accept Header in the request.
+//   '500':
+//     description: Internal server error.
+//
+// x-sample-call-endpoint: https://kbs.com:9443/kbs/v1/secrets/9e1a5c34-b2a4-4d2f-8e58-0c6f3e0f8a71
+
+// ---
+
+// swagger:operation POST /secrets/{id}/transfer TransferKey TransferSecretWithEvidence
+// ---
+//
+// description: |
+//   Releases a secret to an attested workload. The request and the response are the same as
+//   those of the key transfer, POST /keys/{id}/transfer, and the secret is released under the
+//   key transfer policy of the secret. Secrets can be encoded as raw or jwk.
+// consumes:
+// - application/json
+// produces:
+// - application/json
+// parameters:
+// - name: id
+//   description: The unique ID of the secret.
+//   in: path
+//   required: true
+//   type: string
+//   format: uuid
+// - name: request body
+//   required: true
+//   in: body
+//   schema:
+//    "$ref": "#/definitions/TransferKeyRequest"
+// - name: Content-Type
+//   description: Content-Type header.
+//   in: header
+//   type: string
+//   required: true
+//   enum:
+//     - application/json
+// - name: Accept
+//   description: Accept header.
+//   in: header
+//   type: string
+//   required: true
+//   enum:
+//     - application/json
+// responses:
+//   '200':
+//     description: The secret was successfully transferred.
+//     content:
+//       application/json
+//     schema:
+//       $ref: "#/definitions/TransferKeyResponse"
+//   '400':
+//     description: An invalid request body was provided.
+//   '401':
+//     description: Failed to authenticate the attestation token.
+//   '404':
+//     description: The secret record was not found.
+//   '415':
+//     description: Invalid Accept Header in the request.
+//   '500':
+//     description: Internal server error.
+//
+// x-sample-call-endpoint: https://kbs.com:9443/kbs/v1/secrets/9e1a5c34-b2a4-4d2f-8e58-0c6f3e0f8a71/transfer
@@ -1,9 +1,10 @@
 // Copyright(C) 2023 Intel Corporation. All Rights Reserved.
 module intel/kbs/v1
 
-go 1.23.0
+go 1.24.0
 
 require (
+	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.2.0
 	github.com/gemalto/kmip-go v0.0.6
 	github.com/go-kit/kit v0.13.0
 	github.com/golang-jwt/jwt/v4 v4.5.2
@@ -12,6 +13,7 @@ require (
 	github.com/gorilla/mux v1.8.1
 	github.com/hashicorp/vault/api v1.16.0
 	github.com/intel/trustauthority-client v1.1.0
+	github.com/miekg/pkcs11 v1.1.1
 	github.com/onsi/gomega v1.27.10
 	github.com/pkg/errors v0.9.1
 	github.com/shaj13/go-guardian/v2 v2.11.6
@@ -28,7 +30,6 @@ require (
 	github.com/ansel1/merry/v2 v2.1.1 // indirect
 	github.com/cenkalti/backoff/v4 v4.3.0 // indirect
 	github.com/davecgh/go-spew v1.1.2-0.20180830191138-d8f796af33cc // indirect
-	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.2.0 // indirect
 	github.com/felixge/httpsnoop v1.0.3 // indirect
 	github.com/fsnotify/fsnotify v1.7.0 // indirect
 	github.com/gemalto/flume v0.13.1 // indirect
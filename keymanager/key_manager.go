@@ -7,41 +7,180 @@
 package keymanager
 
 import (
+	"context"
+	"crypto"
 	"intel/kbs/v1/vaultclient"
 	"strings"
 
 	"intel/kbs/v1/config"
 	"intel/kbs/v1/constant"
+	"intel/kbs/v1/crypt"
 	"intel/kbs/v1/kmipclient"
+	"intel/kbs/v1/kmsplugin"
+	"intel/kbs/v1/localkeystore"
 	"intel/kbs/v1/model"
 
+	"github.com/google/uuid"
 	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
 )
 
-func NewKeyManager(cfg *config.Configuration) (KeyManager, error) {
+// NewKeyManager creates a key manager that routes each key to one of the configured backends
+func NewKeyManager(cfg *config.Configuration) (*MultiKeyManager, error) {
 
-	if strings.ToLower(cfg.KeyManager) == constant.KmipKeyManager {
+	multiKeyManager := NewMultiKeyManager(cfg.DefaultKeyManagerBackend())
+	for _, backend := range cfg.KeyManagerBackends() {
+		keyManager, err := newBackendKeyManager(&backend)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to initialize key manager backend %s", backend.Name)
+		}
+		multiKeyManager.AddBackend(backend.Name, strings.ToLower(backend.Type), keyManager)
+	}
+	if _, _, err := multiKeyManager.Backend(""); err != nil {
+		return nil, err
+	}
+	return multiKeyManager, nil
+}
+
+func newBackendKeyManager(backend *config.KeyManagerBackendConfig) (KeyManager, error) {
+
+	if strings.ToLower(backend.Type) == constant.KmipKeyManager {
 		kmipClient := kmipclient.NewKmipClient()
-		err := kmipClient.InitializeClient(cfg.Kmip.Version, cfg.Kmip.ServerIP, cfg.Kmip.ServerPort, cfg.Kmip.Hostname, cfg.Kmip.Username, cfg.Kmip.Password, cfg.Kmip.ClientKeyFilePath, cfg.Kmip.ClientCertificateFilePath, cfg.Kmip.RootCertificateFilePath)
+		err := kmipClient.InitializeClient(&backend.Kmip)
 		if err != nil {
 			return nil, errors.Wrap(err, "Failed to initialize KmipManager")
 		}
+		if backend.Kmip.KeyWrapping {
+			return NewWrappingKmipManager(kmipClient), nil
+		}
 		return NewKmipManager(kmipClient), nil
-	} else if strings.ToLower(cfg.KeyManager) == constant.VaultKeyManager {
+	} else if strings.ToLower(backend.Type) == constant.VaultTransitKeyManager {
+		transitClient := vaultclient.NewTransitClient()
+		err := transitClient.InitializeClient(&backend.Vault)
+		if err != nil {
+			return nil, errors.Wrap(err, "keymanager/key_manager:NewKeyManager() Failed to initialize vault transit client")
+		}
+		return NewVaultTransitManager(transitClient), nil
+	} else if strings.ToLower(backend.Type) == constant.VaultKeyManager {
 		vaultClient := vaultclient.NewVaultClient()
-		err := vaultClient.InitializeClient(cfg.Vault.ServerIP, cfg.Vault.ServerPort, cfg.Vault.ClientToken)
+		err := vaultClient.InitializeClient(&backend.Vault)
 		if err != nil {
 			return nil, errors.Wrap(err, "keymanager/key_manager:NewKeyManager() Failed to initialize vault client")
 		}
-		return &VaultManager{vaultClient}, nil
+		return NewVaultManager(vaultClient), nil
+	} else if strings.ToLower(backend.Type) == constant.Pkcs11KeyManager {
+		return newPkcs11KeyManager(&backend.Pkcs11)
+	} else if strings.ToLower(backend.Type) == constant.PluginKeyManager {
+		pluginClient := kmsplugin.NewPluginClient()
+		err := pluginClient.InitializeClient(&backend.Plugin)
+		if err != nil {
+			return nil, errors.Wrap(err, "keymanager/key_manager:NewKeyManager() Failed to initialize key manager plugin")
+		}
+		capabilities, err := pluginClient.Capabilities()
+		if err != nil {
+			return nil, errors.Wrap(err, "keymanager/key_manager:NewKeyManager() Failed to get capabilities of key manager plugin")
+		}
+		pluginManager := NewPluginManager(pluginClient)
+		pluginManager.algorithms = capabilities.Algorithms
+		return pluginManager, nil
+	} else if strings.ToLower(backend.Type) == constant.LocalKeyManager {
+		log.Warnf("**************************************************************************************")
+		log.Warnf("Key manager backend %s keeps keys in a software keystore in %s.", backend.Name, backend.Local.KeystorePath)
+		log.Warnf("The keys are not protected by an HSM or KMS. Do not use it outside of development,")
+		log.Warnf("CI and edge deployments that accept this risk.")
+		log.Warnf("**************************************************************************************")
+		masterKey, err := LoadLocalKeystoreMasterKey(&backend.Local)
+		if err != nil {
+			return nil, errors.Wrap(err, "keymanager/key_manager:NewKeyManager() Failed to load local keystore master key")
+		}
+		defer crypt.ZeroizeByteArray(masterKey)
+		keyStore, err := localkeystore.NewLocalKeyStore(backend.Local.KeystorePath, masterKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "keymanager/key_manager:NewKeyManager() Failed to open local keystore")
+		}
+		return NewLocalManager(keyStore), nil
 	} else {
-		return nil, errors.Errorf("No Key Manager supported for provider: %s", cfg.KeyManager)
+		return nil, errors.Errorf("No Key Manager supported for provider: %s", backend.Type)
 	}
 }
 
 type KeyManager interface {
-	CreateKey(*model.KeyRequest) (*model.KeyAttributes, error)
-	DeleteKey(*model.KeyAttributes) error
-	RegisterKey(*model.KeyRequest) (*model.KeyAttributes, error)
-	TransferKey(*model.KeyAttributes) ([]byte, error)
+	CreateKey(context.Context, *model.KeyRequest) (*model.KeyAttributes, error)
+	DeleteKey(context.Context, *model.KeyAttributes) error
+	RegisterKey(context.Context, *model.KeyRequest) (*model.KeyAttributes, error)
+	TransferKey(context.Context, *model.KeyAttributes) ([]byte, error)
+}
+
+// KeyWrapper is implemented by key managers that release a key wrapped to a public key without
+// exposing the key material to the KBS. The wrapped key is the output of PKCS#11
+// CKM_RSA_AES_KEY_WRAP: an ephemeral AES key encrypted with RSA-OAEP SHA-256, followed by the key
+// wrapped under the ephemeral key with AES key wrap with padding.
+type KeyWrapper interface {
+	WrapKey(context.Context, *model.KeyAttributes, crypto.PublicKey) ([]byte, error)
+}
+
+// ErrKeyWrapNotSupported is returned when the key manager holding a key cannot wrap it
+var ErrKeyWrapNotSupported = errors.New("key manager does not support key wrapping")
+
+// ErrWrappingKeyNotSupported is returned when the key manager wraps keys but cannot wrap them to
+// the given public key, CKM_RSA_AES_KEY_WRAP needs an RSA public key
+var ErrWrappingKeyNotSupported = errors.New("key manager can only wrap keys to RSA public keys")
+
+// KeyEncrypter is implemented by key managers that encrypt and decrypt data under a key without
+// releasing the key to the KBS
+type KeyEncrypter interface {
+	Encrypt(context.Context, *model.KeyAttributes, []byte) ([]byte, error)
+	Decrypt(context.Context, *model.KeyAttributes, []byte) ([]byte, error)
+}
+
+// ErrEncryptNotSupported is returned when the key manager holding a key cannot encrypt with it
+var ErrEncryptNotSupported = errors.New("key manager does not support encryption")
+
+// KeyWrappingEnforcer is implemented by key managers that can be configured to release keys only
+// wrapped by the key manager. The KBS must not read such keys in plaintext.
+type KeyWrappingEnforcer interface {
+	KeyWrappingEnforced(*model.KeyAttributes) bool
+}
+
+// KeyDiscoverer is implemented by key managers that can list the keys held by their server, so
+// that existing keys can be registered with the KBS
+type KeyDiscoverer interface {
+	DiscoverKeys(context.Context, *model.KmipObjectFilterCriteria) ([]*model.KmipObject, error)
+}
+
+// ErrKeyDiscoveryNotSupported is returned when the key manager cannot list its keys
+var ErrKeyDiscoveryNotSupported = errors.New("key manager does not support key discovery")
+
+// PublicKeyReader is implemented by key managers that can return the public key of an asymmetric
+// key without releasing its private key
+type PublicKeyReader interface {
+	PublicKey(context.Context, *model.KeyAttributes) (crypto.PublicKey, error)
+}
+
+// ErrPublicKeyNotSupported is returned when the key manager holding a key cannot return its public key
+var ErrPublicKeyNotSupported = errors.New("key manager does not support public key retrieval")
+
+// ErrNoPublicKey is returned for the public key of symmetric keys
+var ErrNoPublicKey = errors.New("key has no public key")
+
+// KmipVersionReporter is implemented by key managers backed by a kmip server and reports the
+// protocol version negotiated with the server
+type KmipVersionReporter interface {
+	KmipVersion() string
+}
+
+// ErrInvalidKmipKey is returned when a key referenced by kmip_key_id does not exist on the kmip
+// server or does not match the key attributes of the request
+var ErrInvalidKmipKey = errors.New("kmip key cannot be registered")
+
+// newKeyID returns the ID requested for a re-imported key, or a new random ID
+func newKeyID(request *model.KeyRequest) (uuid.UUID, error) {
+	if request.KeyId != uuid.Nil {
+		return request.KeyId, nil
+	}
+	newUuid, err := uuid.NewRandom()
+	if err != nil {
+		return uuid.Nil, errors.Wrap(err, "failed to create new UUID")
+	}
+	return newUuid, nil
 }
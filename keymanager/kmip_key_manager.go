@@ -7,45 +7,79 @@
 package keymanager
 
 import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
 	"time"
 
 	"intel/kbs/v1/constant"
+	"intel/kbs/v1/crypt"
 	"intel/kbs/v1/kmipclient"
 	"intel/kbs/v1/model"
 
+	"github.com/gemalto/kmip-go/kmip14"
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
 )
 
 type KmipManager struct {
 	client kmipclient.KmipClient
+	// keyWrapping is set when the kmip server wraps keys released to workloads
+	keyWrapping bool
 }
 
 func NewKmipManager(c kmipclient.KmipClient) *KmipManager {
-	return &KmipManager{c}
+	return &KmipManager{client: c}
 }
 
-func (km *KmipManager) CreateKey(request *model.KeyRequest) (*model.KeyAttributes, error) {
+// NewWrappingKmipManager creates a KmipManager whose kmip server wraps keys released to
+// workloads, so that keys are never read in plaintext into the KBS
+func NewWrappingKmipManager(c kmipclient.KmipClient) *KmipManager {
+	return &KmipManager{client: c, keyWrapping: true}
+}
+
+// KmipVersion returns the kmip protocol version negotiated with the server
+func (km *KmipManager) KmipVersion() string {
+	return km.client.ProtocolVersion()
+}
+
+func (km *KmipManager) CreateKey(ctx context.Context, request *model.KeyRequest) (*model.KeyAttributes, error) {
 
 	keyAttributes := &model.KeyAttributes{
 		Algorithm: request.KeyInfo.Algorithm,
 	}
 
 	switch request.KeyInfo.Algorithm {
-	case constant.CRYPTOALGAES:
-		kmipId, err := km.client.CreateSymmetricKey(request.KeyInfo.KeyLength)
+	case constant.CRYPTOALGAES, constant.CRYPTOALGHMAC, constant.CRYPTOALGCHACHA20:
+		kmipId, err := km.client.CreateSymmetricKey(ctx, request.KeyInfo.Algorithm, request.KeyInfo.KeyLength)
 		if err != nil {
-			return nil, errors.Wrap(err, "failed to create AES key")
+			return nil, errors.Wrapf(err, "failed to create %s key", request.KeyInfo.Algorithm)
 		}
 		keyAttributes.KeyLength = request.KeyInfo.KeyLength
 		keyAttributes.KmipKeyID = kmipId
 	case constant.CRYPTOALGRSA:
-		kmipId, err := km.client.CreateAsymmetricKeyPair(constant.CRYPTOALGRSA, "", request.KeyInfo.KeyLength)
+		kmipId, err := km.client.CreateAsymmetricKeyPair(ctx, constant.CRYPTOALGRSA, "", request.KeyInfo.KeyLength)
 		if err != nil {
 			return nil, errors.Wrap(err, "failed to create RSA key pair")
 		}
 		keyAttributes.KeyLength = request.KeyInfo.KeyLength
 		keyAttributes.KmipKeyID = kmipId
+	case constant.CRYPTOALGEC:
+		if _, err := ellipticCurve(request.KeyInfo.CurveType); err != nil {
+			return nil, err
+		}
+		kmipId, err := km.client.CreateAsymmetricKeyPair(ctx, constant.CRYPTOALGEC, request.KeyInfo.CurveType, 0)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create EC key pair")
+		}
+		keyAttributes.CurveType = request.KeyInfo.CurveType
+		keyAttributes.KmipKeyID = kmipId
 	default:
 		return nil, errors.Errorf("%s algorithm is not supported", request.KeyInfo.Algorithm)
 	}
@@ -61,30 +95,41 @@ func (km *KmipManager) CreateKey(request *model.KeyRequest) (*model.KeyAttribute
 	return keyAttributes, nil
 }
 
-func (km *KmipManager) DeleteKey(attributes *model.KeyAttributes) error {
+func (km *KmipManager) DeleteKey(ctx context.Context, attributes *model.KeyAttributes) error {
 
 	if attributes.KmipKeyID == "" {
 		return errors.New("key is not created with KMIP key manager")
 	}
 
-	return km.client.DeleteKey(attributes.KmipKeyID)
+	return km.client.DeleteKey(ctx, attributes.KmipKeyID)
 }
 
-func (km *KmipManager) RegisterKey(request *model.KeyRequest) (*model.KeyAttributes, error) {
+func (km *KmipManager) RegisterKey(ctx context.Context, request *model.KeyRequest) (*model.KeyAttributes, error) {
 
-	if request.KeyInfo.KmipKeyID == "" {
-		return nil, errors.New("kmip_key_id cannot be empty for register operation in kmip mode")
+	kmipKeyID := request.KeyInfo.KmipKeyID
+	if kmipKeyID == "" {
+		if request.KeyInfo.KeyData == "" {
+			return nil, errors.New("kmip_key_id or key_data must be provided for register operation in kmip mode")
+		}
+		var err error
+		kmipKeyID, err = km.registerKeyData(ctx, request.KeyInfo)
+		if err != nil {
+			return nil, err
+		}
+	} else if err := km.validateKmipKey(ctx, request.KeyInfo); err != nil {
+		return nil, err
 	}
 
-	newUuid, err := uuid.NewRandom()
+	newUuid, err := newKeyID(request)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to create new UUID")
+		return nil, err
 	}
 	keyAttributes := &model.KeyAttributes{
 		ID:               newUuid,
 		Algorithm:        request.KeyInfo.Algorithm,
 		KeyLength:        request.KeyInfo.KeyLength,
-		KmipKeyID:        request.KeyInfo.KmipKeyID,
+		CurveType:        request.KeyInfo.CurveType,
+		KmipKeyID:        kmipKeyID,
 		TransferPolicyId: request.TransferPolicyID,
 		CreatedAt:        time.Now().UTC(),
 	}
@@ -92,15 +137,285 @@ func (km *KmipManager) RegisterKey(request *model.KeyRequest) (*model.KeyAttribu
 	return keyAttributes, nil
 }
 
-func (km *KmipManager) TransferKey(attributes *model.KeyAttributes) ([]byte, error) {
+// validateKmipKey checks that the key referenced by kmip_key_id exists on the kmip server, is
+// active and matches the algorithm and length or curve of the request
+func (km *KmipManager) validateKmipKey(ctx context.Context, keyInfo *model.KeyInfo) error {
+
+	attributes, err := km.client.GetAttributes(ctx, keyInfo.KmipKeyID)
+	if errors.Is(err, kmipclient.ErrObjectNotFound) {
+		return errors.Wrapf(ErrInvalidKmipKey, "kmip key %s does not exist", keyInfo.KmipKeyID)
+	} else if err != nil {
+		return errors.Wrapf(err, "failed to get attributes of kmip key %s", keyInfo.KmipKeyID)
+	}
+
+	if attributes.State != kmip14.StateActive {
+		return errors.Wrapf(ErrInvalidKmipKey, "kmip key %s is in %s state", keyInfo.KmipKeyID, attributes.State)
+	}
+	// secret data has no cryptographic algorithm or length to match
+	if keyInfo.Algorithm == constant.CRYPTOALGSECRET {
+		if attributes.ObjectType != kmip14.ObjectTypeSecretData {
+			return errors.Wrapf(ErrInvalidKmipKey, "kmip object %s is a %s, not secret data", keyInfo.KmipKeyID, attributes.ObjectType)
+		}
+		return nil
+	}
+	algorithm := kmipKeyAlgorithm(attributes)
+	if algorithm != keyInfo.Algorithm {
+		return errors.Wrapf(ErrInvalidKmipKey, "kmip key %s is a %s %s key", keyInfo.KmipKeyID, attributes.CryptographicAlgorithm, attributes.ObjectType)
+	}
+	if algorithm == constant.CRYPTOALGEC {
+		curve, err := ellipticCurve(keyInfo.CurveType)
+		if err != nil {
+			return err
+		}
+		if int(attributes.CryptographicLength) != curve.Params().BitSize {
+			return errors.Wrapf(ErrInvalidKmipKey, "kmip key %s is not on curve %s", keyInfo.KmipKeyID, keyInfo.CurveType)
+		}
+	} else if int(attributes.CryptographicLength) != keyInfo.KeyLength {
+		return errors.Wrapf(ErrInvalidKmipKey, "kmip key %s has length %d", keyInfo.KmipKeyID, attributes.CryptographicLength)
+	}
+	return nil
+}
+
+// kmipKeyAlgorithm returns the KBS algorithm of a kmip object, or an empty string when the object
+// is not a key the KBS can release
+func kmipKeyAlgorithm(attributes *kmipclient.ObjectAttributes) string {
+
+	switch {
+	case attributes.ObjectType == kmip14.ObjectTypeSymmetricKey && attributes.CryptographicAlgorithm == kmip14.CryptographicAlgorithmAES:
+		return constant.CRYPTOALGAES
+	case attributes.ObjectType == kmip14.ObjectTypeSymmetricKey && (attributes.CryptographicAlgorithm == kmip14.CryptographicAlgorithmHMAC_SHA256 || attributes.CryptographicAlgorithm == kmip14.CryptographicAlgorithmHMAC_SHA384):
+		return constant.CRYPTOALGHMAC
+	case attributes.ObjectType == kmip14.ObjectTypeSymmetricKey && attributes.CryptographicAlgorithm == kmip14.CryptographicAlgorithmChaCha20:
+		return constant.CRYPTOALGCHACHA20
+	case attributes.ObjectType == kmip14.ObjectTypePrivateKey && attributes.CryptographicAlgorithm == kmip14.CryptographicAlgorithmRSA:
+		return constant.CRYPTOALGRSA
+	case attributes.ObjectType == kmip14.ObjectTypePrivateKey && (attributes.CryptographicAlgorithm == kmip14.CryptographicAlgorithmECDSA || attributes.CryptographicAlgorithm == kmip14.CryptographicAlgorithmEC):
+		return constant.CRYPTOALGEC
+	default:
+		return ""
+	}
+}
+
+// DiscoverKeys lists the AES, HMAC, ChaCha20, RSA and EC keys on the kmip server that match the filter
+func (km *KmipManager) DiscoverKeys(ctx context.Context, criteria *model.KmipObjectFilterCriteria) ([]*model.KmipObject, error) {
+
+	filter := kmipclient.LocateFilter{
+		Name:                criteria.Name,
+		CryptographicLength: criteria.KeyLength,
+		MaximumItems:        constant.KmipLocateMaxItems,
+	}
+	switch criteria.Algorithm {
+	case "":
+	case constant.CRYPTOALGAES:
+		filter.ObjectType = kmip14.ObjectTypeSymmetricKey
+		filter.CryptographicAlgorithm = kmip14.CryptographicAlgorithmAES
+	case constant.CRYPTOALGHMAC:
+		// HMAC keys are recorded as either HMAC-SHA256 or HMAC-SHA384 keys, the algorithm is checked below
+		filter.ObjectType = kmip14.ObjectTypeSymmetricKey
+	case constant.CRYPTOALGCHACHA20:
+		filter.ObjectType = kmip14.ObjectTypeSymmetricKey
+		filter.CryptographicAlgorithm = kmip14.CryptographicAlgorithmChaCha20
+	case constant.CRYPTOALGRSA:
+		filter.ObjectType = kmip14.ObjectTypePrivateKey
+		filter.CryptographicAlgorithm = kmip14.CryptographicAlgorithmRSA
+	case constant.CRYPTOALGEC:
+		// servers record EC keys as either ECDSA or EC keys, the algorithm is checked below
+		filter.ObjectType = kmip14.ObjectTypePrivateKey
+	default:
+		return nil, errors.Errorf("%s algorithm is not supported", criteria.Algorithm)
+	}
+
+	located, err := km.client.Locate(ctx, filter)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to locate kmip keys")
+	}
+
+	objects := []*model.KmipObject{}
+	for i := range located {
+		algorithm := kmipKeyAlgorithm(&located[i])
+		if algorithm == "" || (criteria.Algorithm != "" && algorithm != criteria.Algorithm) {
+			continue
+		}
+		object := &model.KmipObject{
+			KmipKeyID: located[i].UniqueIdentifier,
+			Algorithm: algorithm,
+			KeyLength: int(located[i].CryptographicLength),
+			State:     located[i].State.String(),
+		}
+		if algorithm == constant.CRYPTOALGEC {
+			object.CurveType = curveType(object.KeyLength)
+		}
+		for _, name := range located[i].Name {
+			object.Names = append(object.Names, name.NameValue)
+		}
+		objects = append(objects, object)
+	}
+	return objects, nil
+}
+
+// curveType returns the name of the curve of an EC key of the given length
+func curveType(length int) string {
+	switch length {
+	case 256:
+		return "secp256r1"
+	case 384:
+		return "secp384r1"
+	case 521:
+		return "secp521r1"
+	default:
+		return ""
+	}
+}
+
+// KmipRegisterAlgorithms are the algorithms of keys that can be registered with key data in a
+// kmip backend. RSA keys are registered in PKCS#1 format and EC keys in PKCS#8 format.
+var KmipRegisterAlgorithms = map[string]bool{
+	constant.CRYPTOALGAES:      true,
+	constant.CRYPTOALGHMAC:     true,
+	constant.CRYPTOALGCHACHA20: true,
+	constant.CRYPTOALGSECRET:   true,
+	constant.CRYPTOALGRSA:      true,
+	constant.CRYPTOALGEC:       true,
+}
+
+// registerKeyData imports the key material of the request into the kmip server and returns its kmip ID
+func (km *KmipManager) registerKeyData(ctx context.Context, keyInfo *model.KeyInfo) (string, error) {
+
+	keyData, err := base64.StdEncoding.DecodeString(keyInfo.KeyData)
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to decode keydata")
+	}
+	defer crypt.ZeroizeByteArray(keyData)
+
+	switch keyInfo.Algorithm {
+	case constant.CRYPTOALGAES, constant.CRYPTOALGHMAC, constant.CRYPTOALGCHACHA20, constant.CRYPTOALGSECRET:
+		return km.client.RegisterKey(ctx, keyInfo.Algorithm, len(keyData)*8, keyData)
+	case constant.CRYPTOALGRSA:
+		private, err := crypt.GetPrivateKeyFromPem(keyData)
+		if err != nil {
+			return "", errors.Wrap(err, "Failed to decode private key")
+		}
+		rsaKey, ok := private.(*rsa.PrivateKey)
+		if !ok {
+			return "", errors.New("Private key in request is not RSA key")
+		}
+		defer crypt.ZeroizeRSAPrivateKey(rsaKey)
+		// keys created on the kmip server are returned in PKCS#1 format, registered keys must match
+		privateKeyBytes := x509.MarshalPKCS1PrivateKey(rsaKey)
+		defer crypt.ZeroizeByteArray(privateKeyBytes)
+		return km.client.RegisterKey(ctx, constant.CRYPTOALGRSA, rsaKey.N.BitLen(), privateKeyBytes)
+	case constant.CRYPTOALGEC:
+		private, err := crypt.GetPrivateKeyFromPem(keyData)
+		if err != nil {
+			return "", errors.Wrap(err, "Failed to decode private key")
+		}
+		ecKey, ok := private.(*ecdsa.PrivateKey)
+		if !ok {
+			return "", errors.New("Private key in request is not EC key")
+		}
+		// EC keys are returned by the kmip client in PKCS#8 format
+		privateKeyBytes, err := crypt.MarshalPKCS8PrivateKey(ecKey)
+		if err != nil {
+			return "", errors.Wrap(err, "Failed to marshal private key")
+		}
+		defer crypt.ZeroizeByteArray(privateKeyBytes)
+		return km.client.RegisterKey(ctx, constant.CRYPTOALGEC, ecKey.Curve.Params().BitSize, privateKeyBytes)
+	default:
+		return "", errors.Errorf("%s algorithm is not supported", keyInfo.Algorithm)
+	}
+}
+
+func (km *KmipManager) TransferKey(ctx context.Context, attributes *model.KeyAttributes) ([]byte, error) {
 
 	if attributes.KmipKeyID == "" {
 		return nil, errors.New("key is not created with KMIP key manager")
 	}
 
-	if attributes.Algorithm == constant.CRYPTOALGAES || attributes.Algorithm == constant.CRYPTOALGRSA {
-		return km.client.GetKey(attributes.KmipKeyID, attributes.Algorithm)
-	} else {
+	switch attributes.Algorithm {
+	case constant.CRYPTOALGAES, constant.CRYPTOALGHMAC, constant.CRYPTOALGCHACHA20, constant.CRYPTOALGRSA, constant.CRYPTOALGEC, constant.CRYPTOALGSECRET:
+		return km.client.GetKey(ctx, attributes.KmipKeyID, attributes.Algorithm)
+	default:
 		return nil, errors.Errorf("%s algorithm is not supported", attributes.Algorithm)
 	}
 }
+
+// WrapKey has the kmip server wrap the key under an ephemeral AES-256 key with AES key wrap with
+// padding, so that the key material is never in plaintext in the KBS. The ephemeral key is
+// wrapped to publicKey with RSA-OAEP SHA-256 and precedes the wrapped key.
+func (km *KmipManager) WrapKey(ctx context.Context, attributes *model.KeyAttributes, publicKey crypto.PublicKey) ([]byte, error) {
+
+	if !km.keyWrapping {
+		return nil, ErrKeyWrapNotSupported
+	}
+	rsaPublicKey, ok := publicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, ErrWrappingKeyNotSupported
+	}
+	if attributes.KmipKeyID == "" {
+		return nil, errors.New("key is not created with KMIP key manager")
+	}
+
+	wrappingKey, err := crypt.GetDerivedKey(32)
+	if err != nil {
+		return nil, err
+	}
+	defer crypt.ZeroizeByteArray(wrappingKey)
+	wrappedWrappingKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, rsaPublicKey, wrappingKey, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to wrap ephemeral key")
+	}
+
+	wrappingKeyID, err := km.client.RegisterWrappingKey(ctx, wrappingKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to register ephemeral key")
+	}
+	defer func() {
+		// the ephemeral key is destroyed even when the request was cancelled
+		if err := km.client.DeleteKey(context.WithoutCancel(ctx), wrappingKeyID); err != nil {
+			log.WithError(err).Warnf("Failed to delete ephemeral key %s from kmip server", wrappingKeyID)
+		}
+	}()
+
+	wrappedKey, err := km.client.GetWrappedKey(ctx, attributes.KmipKeyID, attributes.Algorithm, wrappingKeyID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get wrapped key")
+	}
+	return append(wrappedWrappingKey, wrappedKey...), nil
+}
+
+// KeyWrappingEnforced reports whether the kmip server wraps keys released to workloads
+func (km *KmipManager) KeyWrappingEnforced(*model.KeyAttributes) bool {
+	return km.keyWrapping
+}
+
+// PublicKey returns the public key linked to the private key on the kmip server. Registered private
+// keys have no linked public key, theirs is derived from the private key unless the kmip server
+// wraps keys, in which case the key material is never released in plaintext to the KBS.
+func (km *KmipManager) PublicKey(ctx context.Context, attributes *model.KeyAttributes) (crypto.PublicKey, error) {
+
+	if attributes.KmipKeyID == "" {
+		return nil, errors.New("key is not created with KMIP key manager")
+	}
+
+	publicKeyBytes, err := km.client.GetPublicKey(ctx, attributes.KmipKeyID)
+	if err == nil {
+		return crypt.ParsePKIXPublicKey(publicKeyBytes)
+	}
+	if !errors.Is(err, kmipclient.ErrNoLinkedPublicKey) {
+		return nil, errors.Wrap(err, "failed to get public key")
+	}
+	if km.keyWrapping {
+		return nil, errors.New("private key has no linked public key on the kmip server")
+	}
+
+	privateKeyBytes, err := km.client.GetKey(ctx, attributes.KmipKeyID, attributes.Algorithm)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get private key")
+	}
+	defer crypt.ZeroizeByteArray(privateKeyBytes)
+	privateKey, err := crypt.ParsePrivateKeyDer(privateKeyBytes)
+	if err != nil {
+		return nil, err
+	}
+	return publicKeyOf(attributes.Algorithm, privateKey)
+}
@@ -7,8 +7,23 @@
 package keymanager
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"reflect"
 	"testing"
 
+	"intel/kbs/v1/constant"
+
+	"github.com/gemalto/kmip-go"
+	"github.com/gemalto/kmip-go/kmip14"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/mock"
 	"intel/kbs/v1/kmipclient"
 	"intel/kbs/v1/model"
@@ -36,6 +51,15 @@ func TestKmipManagerCreateKey(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "create HMAC key",
+			args: args{
+				algorithm: "HMAC",
+				keyLength: 384,
+				funcName:  "CreateSymmetricKey",
+			},
+			wantErr: false,
+		},
 		{
 			name: "create asymmetric key",
 			args: args{
@@ -45,6 +69,15 @@ func TestKmipManagerCreateKey(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "create EC key",
+			args: args{
+				algorithm: "EC",
+				curveType: "secp384r1",
+				funcName:  "CreateAsymmetricKeyPair",
+			},
+			wantErr: false,
+		},
 		{
 			name: "negative test - algorithm not supported",
 			args: args{
@@ -54,6 +87,14 @@ func TestKmipManagerCreateKey(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "negative test - Ed25519 keys are not supported",
+			args: args{
+				algorithm: "ED25519",
+				funcName:  "CreateAsymmetricKeyPair",
+			},
+			wantErr: true,
+		},
 		{
 			name: "negative test - Curve type not supported",
 			args: args{
@@ -79,8 +120,8 @@ func TestKmipManagerCreateKey(t *testing.T) {
 
 			mockClient := kmipclient.NewMockKmipClient()
 			mockClient.On(tt.args.funcName, mock.Anything).Return("1", nil)
-			keyManager := &KmipManager{mockClient}
-			_, err := keyManager.CreateKey(keyRequest)
+			keyManager := &KmipManager{client: mockClient}
+			_, err := keyManager.CreateKey(context.Background(), keyRequest)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("CreateKey() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -122,8 +163,8 @@ func TestKmipManagerDeleteKey(t *testing.T) {
 			}
 			mockClient := kmipclient.NewMockKmipClient()
 			mockClient.On("DeleteKey", mock.Anything).Return(nil)
-			keyManager := &KmipManager{mockClient}
-			err := keyManager.DeleteKey(keyAttributes)
+			keyManager := &KmipManager{client: mockClient}
+			err := keyManager.DeleteKey(context.Background(), keyAttributes)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("DeleteKey() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -134,21 +175,49 @@ func TestKmipManagerDeleteKey(t *testing.T) {
 
 func TestKmipManagerRegisterKey(t *testing.T) {
 
+	activeAESKey := &kmipclient.ObjectAttributes{
+		UniqueIdentifier:       "1",
+		ObjectType:             kmip14.ObjectTypeSymmetricKey,
+		CryptographicAlgorithm: kmip14.CryptographicAlgorithmAES,
+		CryptographicLength:    256,
+		State:                  kmip14.StateActive,
+	}
 	type args struct {
 		algorithm string
+		keyLength int
+		curveType string
 		kmipKeyID string
 	}
 	tests := []struct {
-		name    string
-		args    args
-		wantErr bool
+		name       string
+		args       args
+		attributes *kmipclient.ObjectAttributes
+		getErr     error
+		wantErr    bool
 	}{
 		{
 			name: "register key",
 			args: args{
 				algorithm: "AES",
+				keyLength: 256,
+				kmipKeyID: "1",
+			},
+			attributes: activeAESKey,
+			wantErr:    false,
+		},
+		{
+			name: "register EC key",
+			args: args{
+				algorithm: "EC",
+				curveType: "secp384r1",
 				kmipKeyID: "1",
 			},
+			attributes: &kmipclient.ObjectAttributes{
+				ObjectType:             kmip14.ObjectTypePrivateKey,
+				CryptographicAlgorithm: kmip14.CryptographicAlgorithmECDSA,
+				CryptographicLength:    384,
+				State:                  kmip14.StateActive,
+			},
 			wantErr: false,
 		},
 		{
@@ -159,12 +228,75 @@ func TestKmipManagerRegisterKey(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "negative testing - kmip key does not exist",
+			args: args{
+				algorithm: "AES",
+				keyLength: 256,
+				kmipKeyID: "1",
+			},
+			attributes: activeAESKey,
+			getErr:     kmipclient.ErrObjectNotFound,
+			wantErr:    true,
+		},
+		{
+			name: "negative testing - key length does not match",
+			args: args{
+				algorithm: "AES",
+				keyLength: 128,
+				kmipKeyID: "1",
+			},
+			attributes: activeAESKey,
+			wantErr:    true,
+		},
+		{
+			name: "negative testing - algorithm does not match",
+			args: args{
+				algorithm: "RSA",
+				keyLength: 256,
+				kmipKeyID: "1",
+			},
+			attributes: activeAESKey,
+			wantErr:    true,
+		},
+		{
+			name: "negative testing - curve does not match",
+			args: args{
+				algorithm: "EC",
+				curveType: "secp256r1",
+				kmipKeyID: "1",
+			},
+			attributes: &kmipclient.ObjectAttributes{
+				ObjectType:             kmip14.ObjectTypePrivateKey,
+				CryptographicAlgorithm: kmip14.CryptographicAlgorithmECDSA,
+				CryptographicLength:    384,
+				State:                  kmip14.StateActive,
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative testing - kmip key is not active",
+			args: args{
+				algorithm: "AES",
+				keyLength: 256,
+				kmipKeyID: "1",
+			},
+			attributes: &kmipclient.ObjectAttributes{
+				ObjectType:             kmip14.ObjectTypeSymmetricKey,
+				CryptographicAlgorithm: kmip14.CryptographicAlgorithmAES,
+				CryptographicLength:    256,
+				State:                  kmip14.StateDeactivated,
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 
 			keyInfo := &model.KeyInfo{
 				Algorithm: tt.args.algorithm,
+				KeyLength: tt.args.keyLength,
+				CurveType: tt.args.curveType,
 				KmipKeyID: tt.args.kmipKeyID,
 			}
 
@@ -173,12 +305,150 @@ func TestKmipManagerRegisterKey(t *testing.T) {
 			}
 
 			mockClient := kmipclient.NewMockKmipClient()
-			keyManager := &KmipManager{mockClient}
-			_, err := keyManager.RegisterKey(keyRequest)
+			mockClient.On("GetAttributes", tt.args.kmipKeyID).Return(tt.attributes, tt.getErr)
+			keyManager := &KmipManager{client: mockClient}
+			_, err := keyManager.RegisterKey(context.Background(), keyRequest)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("RegisterKey() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
+			if err != nil && tt.attributes != nil && !errors.Is(err, ErrInvalidKmipKey) {
+				t.Errorf("RegisterKey() error = %v, want %v", err, ErrInvalidKmipKey)
+			}
+		})
+	}
+}
+
+func TestKmipManagerDiscoverKeys(t *testing.T) {
+
+	mockClient := kmipclient.NewMockKmipClient()
+	mockClient.On("Locate", kmipclient.LocateFilter{
+		Name:         "payments",
+		ObjectType:   kmip14.ObjectTypePrivateKey,
+		MaximumItems: constant.KmipLocateMaxItems,
+	}).Return([]kmipclient.ObjectAttributes{
+		{
+			UniqueIdentifier:       "3",
+			ObjectType:             kmip14.ObjectTypePrivateKey,
+			CryptographicAlgorithm: kmip14.CryptographicAlgorithmEC,
+			CryptographicLength:    521,
+			State:                  kmip14.StateActive,
+			Name:                   []kmip.Name{{NameValue: "payments"}},
+		},
+		{
+			UniqueIdentifier:       "4",
+			ObjectType:             kmip14.ObjectTypePrivateKey,
+			CryptographicAlgorithm: kmip14.CryptographicAlgorithmRSA,
+			CryptographicLength:    3072,
+			State:                  kmip14.StateActive,
+		},
+	}, nil)
+	keyManager := &KmipManager{client: mockClient}
+
+	objects, err := keyManager.DiscoverKeys(context.Background(), &model.KmipObjectFilterCriteria{Name: "payments", Algorithm: "EC"})
+	if err != nil {
+		t.Fatalf("DiscoverKeys() error = %v", err)
+	}
+	want := []*model.KmipObject{
+		{
+			KmipKeyID: "3",
+			Names:     []string{"payments"},
+			Algorithm: "EC",
+			KeyLength: 521,
+			CurveType: "secp521r1",
+			State:     "Active",
+		},
+	}
+	if !reflect.DeepEqual(objects, want) {
+		t.Errorf("DiscoverKeys() = %+v, want %+v", objects, want)
+	}
+}
+
+func TestKmipManagerRegisterKeyData(t *testing.T) {
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKeyBytes, _ := x509.MarshalPKCS8PrivateKey(rsaKey)
+	privateKeyPem := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateKeyBytes})
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKeyBytes, _ := x509.MarshalPKCS8PrivateKey(ecKey)
+	ecKeyPem := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: ecKeyBytes})
+
+	tests := []struct {
+		name      string
+		algorithm string
+		keyData   string
+		wantErr   bool
+	}{
+		{
+			name:      "register AES key data",
+			algorithm: "AES",
+			keyData:   base64.StdEncoding.EncodeToString(make([]byte, 32)),
+			wantErr:   false,
+		},
+		{
+			name:      "register RSA key data",
+			algorithm: "RSA",
+			keyData:   base64.StdEncoding.EncodeToString(privateKeyPem),
+			wantErr:   false,
+		},
+		{
+			name:      "register EC key data",
+			algorithm: "EC",
+			keyData:   base64.StdEncoding.EncodeToString(ecKeyPem),
+			wantErr:   false,
+		},
+		{
+			name:      "register ChaCha20 key data",
+			algorithm: "CHACHA20",
+			keyData:   base64.StdEncoding.EncodeToString(make([]byte, 32)),
+			wantErr:   false,
+		},
+		{
+			name:      "register secret data",
+			algorithm: "SECRET",
+			keyData:   base64.StdEncoding.EncodeToString([]byte("secret-database-password")),
+			wantErr:   false,
+		},
+		{
+			name:      "negative testing - EC key data is not an EC key",
+			algorithm: "EC",
+			keyData:   base64.StdEncoding.EncodeToString(privateKeyPem),
+			wantErr:   true,
+		},
+		{
+			name:      "negative testing - RSA key data is not PEM encoded",
+			algorithm: "RSA",
+			keyData:   base64.StdEncoding.EncodeToString(privateKeyBytes),
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			keyRequest := &model.KeyRequest{
+				KeyInfo: &model.KeyInfo{
+					Algorithm: tt.algorithm,
+					KeyData:   tt.keyData,
+				},
+			}
+
+			mockClient := kmipclient.NewMockKmipClient()
+			mockClient.On("RegisterKey", tt.algorithm, mock.Anything, mock.Anything).Return("1", nil)
+			keyManager := &KmipManager{client: mockClient}
+			keyAttributes, err := keyManager.RegisterKey(context.Background(), keyRequest)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("RegisterKey() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil && keyAttributes.KmipKeyID != "1" {
+				t.Errorf("RegisterKey() kmip key ID = %s, want 1", keyAttributes.KmipKeyID)
+			}
 		})
 	}
 }
@@ -210,6 +480,14 @@ func TestKmipManagerTransferKey(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "get EC key",
+			args: args{
+				algorithm: "EC",
+				kmipKeyID: "3",
+			},
+			wantErr: false,
+		},
 		{
 			name: "negative testing - algorithm not supported",
 			args: args{
@@ -229,8 +507,8 @@ func TestKmipManagerTransferKey(t *testing.T) {
 
 			mockClient := kmipclient.NewMockKmipClient()
 			mockClient.On("GetKey", mock.Anything).Return([]byte(""), nil)
-			keyManager := &KmipManager{mockClient}
-			_, err := keyManager.TransferKey(keyAttributes)
+			keyManager := &KmipManager{client: mockClient}
+			_, err := keyManager.TransferKey(context.Background(), keyAttributes)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("TransferKey() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -238,3 +516,98 @@ func TestKmipManagerTransferKey(t *testing.T) {
 		})
 	}
 }
+
+func TestKmipManagerWrapKey(t *testing.T) {
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyAttributes := &model.KeyAttributes{Algorithm: "AES", KeyLength: 256, KmipKeyID: "1"}
+
+	// key wrapping is not enabled
+	keyManager := &KmipManager{client: kmipclient.NewMockKmipClient()}
+	if _, err := keyManager.WrapKey(context.Background(), keyAttributes, &privateKey.PublicKey); err != ErrKeyWrapNotSupported {
+		t.Errorf("WrapKey() error = %v, want %v", err, ErrKeyWrapNotSupported)
+	}
+
+	mockClient := kmipclient.NewMockKmipClient()
+	// the ephemeral key is zeroized once the key is wrapped, so a copy is kept
+	var registeredKey []byte
+	mockClient.On("RegisterWrappingKey", mock.Anything).Run(func(args mock.Arguments) {
+		registeredKey = append([]byte(nil), args.Get(0).([]byte)...)
+	}).Return("2", nil)
+	mockClient.On("GetWrappedKey", "1", "AES", "2").Return([]byte("wrapped"), nil)
+	mockClient.On("DeleteKey", "2").Return(nil)
+	keyManager = &KmipManager{client: mockClient, keyWrapping: true}
+	wrapped, err := keyManager.WrapKey(context.Background(), keyAttributes, &privateKey.PublicKey)
+	if err != nil {
+		t.Fatalf("WrapKey() error = %v", err)
+	}
+	if len(wrapped) != privateKey.PublicKey.Size()+len("wrapped") || string(wrapped[privateKey.PublicKey.Size():]) != "wrapped" {
+		t.Errorf("WrapKey() returned unexpected wrapped key")
+	}
+
+	// the ephemeral key registered with the kmip server is the key wrapped to the public key
+	wrappingKey, err := rsa.DecryptOAEP(sha256.New(), nil, privateKey, wrapped[:privateKey.PublicKey.Size()], nil)
+	if err != nil {
+		t.Fatalf("Failed to unwrap ephemeral key: %v", err)
+	}
+	if string(wrappingKey) != string(registeredKey) {
+		t.Errorf("WrapKey() registered a different ephemeral key")
+	}
+	mockClient.AssertCalled(t, "DeleteKey", "2")
+}
+
+func TestKmipManagerPublicKey(t *testing.T) {
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKeyBytes, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKeyBytes, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyAttributes := &model.KeyAttributes{Algorithm: "EC", CurveType: "prime256v1", KmipKeyID: "1"}
+
+	// the public key linked to the private key
+	mockClient := kmipclient.NewMockKmipClient()
+	mockClient.On("GetPublicKey", "1").Return(publicKeyBytes, nil)
+	keyManager := &KmipManager{client: mockClient}
+	publicKey, err := keyManager.PublicKey(context.Background(), keyAttributes)
+	if err != nil {
+		t.Fatalf("PublicKey() error = %v", err)
+	}
+	if !privateKey.PublicKey.Equal(publicKey) {
+		t.Errorf("PublicKey() returned a different public key")
+	}
+
+	// registered private keys have no linked public key
+	mockClient = kmipclient.NewMockKmipClient()
+	mockClient.On("GetPublicKey", "1").Return([]byte(nil), kmipclient.ErrNoLinkedPublicKey)
+	mockClient.On("GetKey", "1").Return(privateKeyBytes, nil)
+	keyManager = &KmipManager{client: mockClient}
+	publicKey, err = keyManager.PublicKey(context.Background(), keyAttributes)
+	if err != nil {
+		t.Fatalf("PublicKey() error = %v", err)
+	}
+	if !privateKey.PublicKey.Equal(publicKey) {
+		t.Errorf("PublicKey() returned a different public key")
+	}
+
+	// the private key is not released when the kmip server wraps keys
+	keyManager = &KmipManager{client: mockClient, keyWrapping: true}
+	if _, err := keyManager.PublicKey(context.Background(), keyAttributes); err == nil {
+		t.Errorf("PublicKey() expected error for a key wrapping kmip server")
+	}
+
+	keyManager = &KmipManager{client: kmipclient.NewMockKmipClient()}
+	if _, err := keyManager.PublicKey(context.Background(), &model.KeyAttributes{Algorithm: "EC"}); err == nil {
+		t.Errorf("PublicKey() expected error for a key not created with KMIP key manager")
+	}
+}
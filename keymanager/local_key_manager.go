@@ -0,0 +1,22 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package keymanager
+
+import (
+	"intel/kbs/v1/localkeystore"
+)
+
+// LocalManager keeps keys in a sealed keystore on the local disk. Keys are generated, registered
+// and released by the KBS like keys of the vault key manager. It is meant for development, CI and
+// small edge deployments, the keys are only protected by the master key of the keystore.
+type LocalManager struct {
+	VaultManager
+}
+
+func NewLocalManager(ks localkeystore.LocalKeyStore) *LocalManager {
+	return &LocalManager{VaultManager{client: ks}}
+}
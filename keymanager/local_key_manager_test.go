@@ -0,0 +1,265 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package keymanager
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"intel/kbs/v1/config"
+	"intel/kbs/v1/crypt"
+	"intel/kbs/v1/localkeystore"
+	"intel/kbs/v1/model"
+)
+
+func newTestLocalManager(t *testing.T, dir string) *LocalManager {
+	masterKey, err := LoadLocalKeystoreMasterKey(&config.LocalConfig{MasterKeyFile: filepath.Join(dir, "master.key")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyStore, err := localkeystore.NewLocalKeyStore(filepath.Join(dir, "keystore"), masterKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewLocalManager(keyStore)
+}
+
+func TestLocalManagerCreateKey(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		keyInfo model.KeyInfo
+		wantErr bool
+	}{
+		{
+			name:    "create AES key",
+			keyInfo: model.KeyInfo{Algorithm: "AES", KeyLength: 256},
+		},
+		{
+			name:    "create RSA key",
+			keyInfo: model.KeyInfo{Algorithm: "RSA", KeyLength: 2048},
+		},
+		{
+			name:    "create EC key",
+			keyInfo: model.KeyInfo{Algorithm: "EC", CurveType: "secp384r1"},
+		},
+		{
+			name:    "create EC key on secp256k1",
+			keyInfo: model.KeyInfo{Algorithm: "EC", CurveType: "secp256k1"},
+		},
+		{
+			name:    "create HMAC key",
+			keyInfo: model.KeyInfo{Algorithm: "HMAC", KeyLength: 384},
+		},
+		{
+			name:    "create ChaCha20 key",
+			keyInfo: model.KeyInfo{Algorithm: "CHACHA20", KeyLength: 256},
+		},
+		{
+			name:    "create Ed25519 key",
+			keyInfo: model.KeyInfo{Algorithm: "ED25519"},
+		},
+		{
+			name:    "create X25519 key",
+			keyInfo: model.KeyInfo{Algorithm: "X25519"},
+		},
+		{
+			name:    "negative test - curve type not supported",
+			keyInfo: model.KeyInfo{Algorithm: "EC", CurveType: "primeinvalid"},
+			wantErr: true,
+		},
+		{
+			name:    "negative test - algorithm not supported",
+			keyInfo: model.KeyInfo{Algorithm: "DSA", KeyLength: 2048},
+			wantErr: true,
+		},
+	}
+	keyManager := newTestLocalManager(t, t.TempDir())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			keyInfo := tt.keyInfo
+			keyAttributes, err := keyManager.CreateKey(context.Background(), &model.KeyRequest{KeyInfo: &keyInfo})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CreateKey() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if keyAttributes.KeyData != "" || keyAttributes.PrivateKey != "" {
+				t.Errorf("CreateKey() returned key material")
+			}
+			key, err := keyManager.TransferKey(context.Background(), keyAttributes)
+			if err != nil || len(key) == 0 {
+				t.Errorf("TransferKey() = %x, %v", key, err)
+			}
+			if err := keyManager.DeleteKey(context.Background(), keyAttributes); err != nil {
+				t.Errorf("DeleteKey() error = %v", err)
+			}
+			if _, err := keyManager.TransferKey(context.Background(), keyAttributes); err == nil {
+				t.Errorf("TransferKey() of deleted key succeeded")
+			}
+		})
+	}
+}
+
+func TestLocalManagerRegisterKey(t *testing.T) {
+
+	dir := t.TempDir()
+	keyManager := newTestLocalManager(t, dir)
+	keyData := "urNoe6OU/2dqvYPP40FTVEgIPhIJ9Za4hu9keAwtfC4="
+	keyId := uuid.New()
+	keyAttributes, err := keyManager.RegisterKey(context.Background(), &model.KeyRequest{
+		KeyId:   keyId,
+		KeyInfo: &model.KeyInfo{Algorithm: "AES", KeyLength: 256, KeyData: keyData},
+	})
+	if err != nil || keyAttributes.ID != keyId {
+		t.Fatalf("RegisterKey() = %+v, %v", keyAttributes, err)
+	}
+
+	// the key is readable after the keystore is opened again with the same master key
+	keyManager = newTestLocalManager(t, dir)
+	key, err := keyManager.TransferKey(context.Background(), keyAttributes)
+	if err != nil || base64.StdEncoding.EncodeToString(key) != keyData {
+		t.Errorf("TransferKey() = %x, %v", key, err)
+	}
+	if bytes.Contains(readFile(t, filepath.Join(dir, "keystore", keyId.String())), key) {
+		t.Errorf("key material is stored in plaintext")
+	}
+
+	// a record moved to another key ID fails the integrity check
+	otherId := uuid.New()
+	if err := os.WriteFile(filepath.Join(dir, "keystore", otherId.String()), readFile(t, filepath.Join(dir, "keystore", keyId.String())), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keyManager.TransferKey(context.Background(), &model.KeyAttributes{ID: otherId, Algorithm: "AES"}); err == nil {
+		t.Errorf("TransferKey() of moved record succeeded")
+	}
+}
+
+func TestLocalManagerRegisterPrivateKey(t *testing.T) {
+
+	ed25519Key := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	x25519Key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secp256k1Key, err := crypt.GenerateSecp256k1Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		algorithm  string
+		privateKey crypto.PrivateKey
+		wantErr    bool
+	}{
+		{
+			name:       "register Ed25519 key",
+			algorithm:  "ED25519",
+			privateKey: ed25519Key,
+		},
+		{
+			name:       "register X25519 key",
+			algorithm:  "X25519",
+			privateKey: x25519Key,
+		},
+		{
+			name:       "register secp256k1 key",
+			algorithm:  "EC",
+			privateKey: secp256k1Key,
+		},
+		{
+			name:       "negative test - private key is not of the algorithm",
+			algorithm:  "X25519",
+			privateKey: ed25519Key,
+			wantErr:    true,
+		},
+	}
+	keyManager := newTestLocalManager(t, t.TempDir())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			privateKeyBytes, err := crypt.MarshalPKCS8PrivateKey(tt.privateKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			keyData := base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateKeyBytes}))
+			keyAttributes, err := keyManager.RegisterKey(context.Background(), &model.KeyRequest{
+				KeyInfo: &model.KeyInfo{Algorithm: tt.algorithm, KeyData: keyData},
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RegisterKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			key, err := keyManager.TransferKey(context.Background(), keyAttributes)
+			if err != nil || !bytes.Equal(key, privateKeyBytes) {
+				t.Errorf("TransferKey() = %x, %v", key, err)
+			}
+			publicKey, err := keyManager.PublicKey(context.Background(), keyAttributes)
+			if err != nil {
+				t.Fatalf("PublicKey() error = %v", err)
+			}
+			want, _ := publicKeyOf(tt.algorithm, tt.privateKey)
+			if !want.(interface{ Equal(crypto.PublicKey) bool }).Equal(publicKey) {
+				t.Errorf("PublicKey() returned a different public key")
+			}
+		})
+	}
+}
+
+func TestLoadLocalKeystoreMasterKey(t *testing.T) {
+
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "master.key")
+	masterKey, err := LoadLocalKeystoreMasterKey(&config.LocalConfig{MasterKeyFile: keyFile})
+	if err != nil || len(masterKey) != 32 {
+		t.Fatalf("LoadLocalKeystoreMasterKey() = %x, %v", masterKey, err)
+	}
+	reloaded, err := LoadLocalKeystoreMasterKey(&config.LocalConfig{MasterKeyFile: keyFile})
+	if err != nil || !bytes.Equal(reloaded, masterKey) {
+		t.Errorf("LoadLocalKeystoreMasterKey() = %x, %v, want %x", reloaded, err, masterKey)
+	}
+
+	if err := os.WriteFile(keyFile, []byte("short"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadLocalKeystoreMasterKey(&config.LocalConfig{MasterKeyFile: keyFile}); err == nil {
+		t.Errorf("LoadLocalKeystoreMasterKey() accepted a short key")
+	}
+
+	// a key file sealed under a passphrase cannot be opened with another passphrase
+	sealedFile := filepath.Join(dir, "sealed.key")
+	if _, err := LoadLocalKeystoreMasterKey(&config.LocalConfig{MasterKeyFile: sealedFile, MasterKeyPassphrase: "passphrase"}); err != nil {
+		t.Fatalf("LoadLocalKeystoreMasterKey() error = %v", err)
+	}
+	if _, err := LoadLocalKeystoreMasterKey(&config.LocalConfig{MasterKeyFile: sealedFile, MasterKeyPassphrase: "other"}); err == nil {
+		t.Errorf("LoadLocalKeystoreMasterKey() opened key file with wrong passphrase")
+	}
+}
+
+func readFile(t *testing.T, path string) []byte {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
@@ -0,0 +1,254 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package keymanager
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"intel/kbs/v1/config"
+	"intel/kbs/v1/constant"
+	"intel/kbs/v1/crypt"
+	"intel/kbs/v1/kmipclient"
+	"intel/kbs/v1/model"
+	"intel/kbs/v1/vaultclient"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const sealedKeyFileVersion = 1
+
+var (
+	// repositoryMasterKeyID is the well known ID under which the repository master key is kept in vault
+	repositoryMasterKeyID = uuid.NewSHA1(uuid.NameSpaceOID, []byte("intel/kbs/repository-master-key"))
+
+	sealedKeyFileAdditionalData = []byte("intel/kbs/sealed-key-file")
+)
+
+// sealedKeyFile is the on-disk format of a key sealed under a passphrase
+type sealedKeyFile struct {
+	Version int `json:"version"`
+	crypt.PassphraseKdf
+	SealedKey []byte `json:"sealed_key"`
+}
+
+// NewRepositoryMasterKey returns the key used to seal repository records at rest. It returns
+// nil when no master key source is configured.
+func NewRepositoryMasterKey(cfg *config.Configuration) ([]byte, error) {
+
+	switch strings.ToLower(cfg.RepositoryEncryption.MasterKeySource) {
+	case "":
+		return nil, nil
+	case constant.VaultKeyManager:
+		vaultClient := vaultclient.NewVaultClient()
+		err := vaultClient.InitializeClient(&cfg.Vault)
+		if err != nil {
+			return nil, errors.Wrap(err, "keymanager/master_key:NewRepositoryMasterKey() Failed to initialize vault client")
+		}
+		return getVaultMasterKey(vaultClient)
+	case constant.KmipKeyManager:
+		kmipClient := kmipclient.NewKmipClient()
+		err := kmipClient.InitializeClient(&cfg.Kmip)
+		if err != nil {
+			return nil, errors.Wrap(err, "keymanager/master_key:NewRepositoryMasterKey() Failed to initialize kmip client")
+		}
+		defer kmipClient.Close()
+		return getKmipMasterKey(kmipClient, cfg.RepositoryEncryption.MasterKeyKmipID)
+	case constant.MasterKeySourceFile:
+		return LoadOrCreateSealedKeyFile(cfg.RepositoryEncryption.MasterKeyFile, cfg.RepositoryEncryption.MasterKeyPassphrase)
+	default:
+		return nil, errors.Errorf("Unsupported repository master key source: %s", cfg.RepositoryEncryption.MasterKeySource)
+	}
+}
+
+// getVaultMasterKey reads the repository master key from vault, creating it on first use
+func getVaultMasterKey(client vaultclient.VaultClient) ([]byte, error) {
+
+	keyInfo, err := client.GetKey(repositoryMasterKeyID.String())
+	if err == nil {
+		var keyAttributes model.KeyAttributes
+		if err := json.Unmarshal(keyInfo, &keyAttributes); err != nil {
+			return nil, errors.Wrap(err, "Failed to unmarshal repository master key")
+		}
+		masterKey, err := base64.StdEncoding.DecodeString(keyAttributes.KeyData)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to decode repository master key")
+		}
+		if len(masterKey) != constant.RepositoryMasterKeyLength {
+			return nil, errors.New("Repository master key stored in vault has an invalid length")
+		}
+		return masterKey, nil
+	} else if !errors.Is(err, vaultclient.ErrKeyNotFound) {
+		return nil, errors.Wrap(err, "Failed to retrieve repository master key from vault")
+	}
+
+	masterKey, err := generateSymmetricKey(constant.RepositoryMasterKeyLength * 8)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not generate repository master key")
+	}
+	keyAttributes := &model.KeyAttributes{
+		ID:        repositoryMasterKeyID,
+		Algorithm: constant.CRYPTOALGAES,
+		KeyLength: constant.RepositoryMasterKeyLength * 8,
+		KeyData:   base64.StdEncoding.EncodeToString(masterKey),
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := client.CreateKey(keyAttributes); err != nil {
+		crypt.ZeroizeByteArray(masterKey)
+		return nil, errors.Wrap(err, "Failed to store repository master key in vault")
+	}
+	log.Infof("Created repository master key in vault with ID %s", repositoryMasterKeyID.String())
+	return masterKey, nil
+}
+
+// getKmipMasterKey reads the repository master key from an existing AES key on the kmip server
+func getKmipMasterKey(client kmipclient.KmipClient, kmipKeyID string) ([]byte, error) {
+
+	masterKey, err := client.GetKey(context.Background(), kmipKeyID, constant.CRYPTOALGAES)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to retrieve repository master key from kmip server")
+	}
+	if len(masterKey) != constant.RepositoryMasterKeyLength {
+		crypt.ZeroizeByteArray(masterKey)
+		return nil, errors.New("Repository master key on kmip server must be a 256 bit AES key")
+	}
+	return masterKey, nil
+}
+
+// LoadOrCreateSealedKeyFile returns the key sealed in the file at path under a key derived from
+// passphrase. A new random key is generated and sealed into path when the file does not exist.
+func LoadOrCreateSealedKeyFile(path, passphrase string) ([]byte, error) {
+
+	if passphrase == "" {
+		return nil, errors.New("Passphrase for sealed key file cannot be empty")
+	}
+
+	bytes, err := os.ReadFile(filepath.Clean(path))
+	if err == nil {
+		return openSealedKeyFile(bytes, passphrase)
+	} else if !os.IsNotExist(err) {
+		return nil, errors.Wrapf(err, "Unable to read sealed key file : %s", path)
+	}
+
+	key, err := generateSymmetricKey(constant.RepositoryMasterKeyLength * 8)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not generate key for sealed key file")
+	}
+
+	kdf, err := crypt.NewPassphraseKdf()
+	if err != nil {
+		return nil, err
+	}
+	keyFile := sealedKeyFile{
+		Version:       sealedKeyFileVersion,
+		PassphraseKdf: *kdf,
+	}
+
+	kek, err := keyFile.DeriveKey(passphrase, constant.RepositoryMasterKeyLength)
+	defer crypt.ZeroizeByteArray(kek)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := crypt.NewAeadCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	keyFile.SealedKey, err = aead.Seal(key, sealedKeyFileAdditionalData)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to seal key")
+	}
+
+	bytes, err = json.Marshal(keyFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to marshal sealed key file")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, errors.Wrapf(err, "Failed to create directory for sealed key file : %s", path)
+	}
+	if err := os.WriteFile(filepath.Clean(path), bytes, 0600); err != nil {
+		return nil, errors.Wrapf(err, "Failed to write sealed key file : %s", path)
+	}
+	log.Infof("Created sealed key file %s", path)
+	return key, nil
+}
+
+// LoadLocalKeystoreMasterKey returns the master key of a local keystore. The key file is sealed
+// under the passphrase when one is configured and holds the raw key otherwise. A new random key
+// file is created when it does not exist.
+func LoadLocalKeystoreMasterKey(localConfig *config.LocalConfig) ([]byte, error) {
+
+	if localConfig.MasterKeyPassphrase != "" {
+		return LoadOrCreateSealedKeyFile(localConfig.MasterKeyFile, localConfig.MasterKeyPassphrase)
+	}
+
+	path := filepath.Clean(localConfig.MasterKeyFile)
+	info, err := os.Stat(path)
+	if err == nil {
+		if info.Mode().Perm()&0077 != 0 {
+			log.Warnf("Local keystore master key file %s is accessible by other users", path)
+		}
+		key, err := os.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Unable to read local keystore master key file : %s", path)
+		}
+		if len(key) != constant.LocalKeystoreMasterKeyLength {
+			crypt.ZeroizeByteArray(key)
+			return nil, errors.Errorf("Local keystore master key file %s must hold a %d byte key", path, constant.LocalKeystoreMasterKeyLength)
+		}
+		return key, nil
+	} else if !os.IsNotExist(err) {
+		return nil, errors.Wrapf(err, "Unable to read local keystore master key file : %s", path)
+	}
+
+	key, err := generateSymmetricKey(constant.LocalKeystoreMasterKeyLength * 8)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not generate local keystore master key")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		crypt.ZeroizeByteArray(key)
+		return nil, errors.Wrapf(err, "Failed to create directory for local keystore master key file : %s", path)
+	}
+	if err := os.WriteFile(path, key, 0600); err != nil {
+		crypt.ZeroizeByteArray(key)
+		return nil, errors.Wrapf(err, "Failed to write local keystore master key file : %s", path)
+	}
+	log.Infof("Created local keystore master key file %s", path)
+	return key, nil
+}
+
+func openSealedKeyFile(bytes []byte, passphrase string) ([]byte, error) {
+
+	var keyFile sealedKeyFile
+	if err := json.Unmarshal(bytes, &keyFile); err != nil {
+		return nil, errors.Wrap(err, "Failed to unmarshal sealed key file")
+	}
+	if keyFile.Version != sealedKeyFileVersion {
+		return nil, errors.Errorf("Unsupported sealed key file version %d", keyFile.Version)
+	}
+
+	kek, err := keyFile.DeriveKey(passphrase, constant.RepositoryMasterKeyLength)
+	defer crypt.ZeroizeByteArray(kek)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := crypt.NewAeadCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	key, err := aead.Open(keyFile.SealedKey, sealedKeyFileAdditionalData)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to unseal key file, the passphrase may be incorrect")
+	}
+	return key, nil
+}
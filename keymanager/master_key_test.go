@@ -0,0 +1,79 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package keymanager
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	"intel/kbs/v1/config"
+	"intel/kbs/v1/model"
+	"intel/kbs/v1/vaultclient"
+)
+
+func TestLoadOrCreateSealedKeyFile(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	path := t.TempDir() + "/master-key/repository.key"
+
+	key, err := LoadOrCreateSealedKeyFile(path, "testPassphrase")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(key).To(gomega.HaveLen(32))
+
+	reloaded, err := LoadOrCreateSealedKeyFile(path, "testPassphrase")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(reloaded).To(gomega.Equal(key))
+
+	_, err = LoadOrCreateSealedKeyFile(path, "wrongPassphrase")
+	g.Expect(err).To(gomega.HaveOccurred())
+
+	_, err = LoadOrCreateSealedKeyFile(path, "")
+	g.Expect(err).To(gomega.HaveOccurred())
+}
+
+func TestNewRepositoryMasterKeyNotConfigured(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	key, err := NewRepositoryMasterKey(&config.Configuration{})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(key).To(gomega.BeNil())
+
+	cfg := &config.Configuration{RepositoryEncryption: config.RepositoryEncryptionConfig{MasterKeySource: "invalid"}}
+	_, err = NewRepositoryMasterKey(cfg)
+	g.Expect(err).To(gomega.HaveOccurred())
+}
+
+func TestGetVaultMasterKey(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	// master key is created on first use
+	mockClient := vaultclient.NewMockVaultClient()
+	mockClient.On("GetKey", repositoryMasterKeyID.String()).Return([]byte(nil), errors.Wrap(vaultclient.ErrKeyNotFound, "not found")).Once()
+	mockClient.On("CreateKey", mock.Anything).Return(nil).Once()
+	key, err := getVaultMasterKey(mockClient)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(key).To(gomega.HaveLen(32))
+
+	// existing master key is returned
+	keyInfo, _ := json.Marshal(model.KeyAttributes{
+		ID:        repositoryMasterKeyID,
+		Algorithm: "AES",
+		KeyData:   base64.StdEncoding.EncodeToString(key),
+	})
+	mockClient.On("GetKey", repositoryMasterKeyID.String()).Return(keyInfo, nil).Once()
+	existing, err := getVaultMasterKey(mockClient)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(existing).To(gomega.Equal(key))
+
+	// other vault errors are not treated as a missing key
+	mockClient.On("GetKey", repositoryMasterKeyID.String()).Return([]byte(nil), errors.New("connection refused")).Once()
+	_, err = getVaultMasterKey(mockClient)
+	g.Expect(err).To(gomega.HaveOccurred())
+}
@@ -7,6 +7,7 @@
 package keymanager
 
 import (
+	"context"
 	"github.com/stretchr/testify/mock"
 	"intel/kbs/v1/kmipclient"
 	"intel/kbs/v1/model"
@@ -20,22 +21,22 @@ type MockKmipManager struct {
 func NewMockKmipManager(c kmipclient.MockKmipClient) *MockKmipManager {
 	return &MockKmipManager{c, mock.Mock{}}
 }
-func (mock *MockKmipManager) CreateKey(request *model.KeyRequest) (*model.KeyAttributes, error) {
+func (mock *MockKmipManager) CreateKey(_ context.Context, request *model.KeyRequest) (*model.KeyAttributes, error) {
 	args := mock.Called(request)
 	return args.Get(0).(*model.KeyAttributes), args.Error(1)
 }
 
-func (mock *MockKmipManager) DeleteKey(attributes *model.KeyAttributes) error {
+func (mock *MockKmipManager) DeleteKey(_ context.Context, attributes *model.KeyAttributes) error {
 	args := mock.Called(attributes)
 	return args.Error(0)
 }
 
-func (mock *MockKmipManager) RegisterKey(request *model.KeyRequest) (*model.KeyAttributes, error) {
+func (mock *MockKmipManager) RegisterKey(_ context.Context, request *model.KeyRequest) (*model.KeyAttributes, error) {
 	args := mock.Called(request)
 	return args.Get(0).(*model.KeyAttributes), args.Error(1)
 }
 
-func (mock *MockKmipManager) TransferKey(attributes *model.KeyAttributes) ([]byte, error) {
+func (mock *MockKmipManager) TransferKey(_ context.Context, attributes *model.KeyAttributes) ([]byte, error) {
 	args := mock.Called(attributes)
 	return args.Get(0).([]byte), args.Error(1)
 }
@@ -0,0 +1,232 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package keymanager
+
+import (
+	"context"
+	"crypto"
+	"sort"
+
+	"intel/kbs/v1/constant"
+	"intel/kbs/v1/model"
+
+	"github.com/pkg/errors"
+)
+
+// MultiKeyManager routes key operations to one of several named key manager backends. New keys
+// go to the backend named in the request or to the default backend, and the backend name is
+// recorded in the key attributes so that later operations reach the backend owning the key.
+type MultiKeyManager struct {
+	backends       map[string]KeyManager
+	backendTypes   map[string]string
+	defaultBackend string
+}
+
+func NewMultiKeyManager(defaultBackend string) *MultiKeyManager {
+	return &MultiKeyManager{
+		backends:       map[string]KeyManager{},
+		backendTypes:   map[string]string{},
+		defaultBackend: defaultBackend,
+	}
+}
+
+// AddBackend registers km under name. backendType is the key manager type, i.e. vault or kmip.
+func (mkm *MultiKeyManager) AddBackend(name, backendType string, km KeyManager) {
+	mkm.backends[name] = km
+	mkm.backendTypes[name] = backendType
+}
+
+// Backend returns the key manager and type of the named backend, or of the default backend
+// when name is empty
+func (mkm *MultiKeyManager) Backend(name string) (KeyManager, string, error) {
+	if name == "" {
+		name = mkm.defaultBackend
+	}
+	km, ok := mkm.backends[name]
+	if !ok {
+		return nil, "", errors.Errorf("key manager backend %s is not configured", name)
+	}
+	return km, mkm.backendTypes[name], nil
+}
+
+// BackendNames returns the names of all backends in sorted order
+func (mkm *MultiKeyManager) BackendNames() []string {
+	names := make([]string, 0, len(mkm.backends))
+	for name := range mkm.backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// KmipVersions returns the kmip protocol version negotiated by each kmip backend
+func (mkm *MultiKeyManager) KmipVersions() map[string]string {
+	versions := map[string]string{}
+	for name, km := range mkm.backends {
+		if reporter, ok := km.(KmipVersionReporter); ok {
+			versions[name] = reporter.KmipVersion()
+		}
+	}
+	return versions
+}
+
+// BackendName returns the name of the backend owning the key. Records created before backends
+// were named belong to a backend of the type the KBS was configured with at the time, vault or
+// kmip, preferring the default backend and then the backend named after the type.
+func (mkm *MultiKeyManager) BackendName(attributes *model.KeyAttributes) string {
+	if attributes.KeyManager != "" {
+		return attributes.KeyManager
+	}
+	backendType := constant.VaultKeyManager
+	if attributes.KmipKeyID != "" {
+		backendType = constant.KmipKeyManager
+	}
+	if mkm.backendTypes[mkm.defaultBackend] == backendType {
+		return mkm.defaultBackend
+	}
+	if mkm.backendTypes[backendType] == backendType {
+		return backendType
+	}
+	for _, name := range mkm.BackendNames() {
+		if mkm.backendTypes[name] == backendType {
+			return name
+		}
+	}
+	return backendType
+}
+
+func (mkm *MultiKeyManager) CreateKey(ctx context.Context, request *model.KeyRequest) (*model.KeyAttributes, error) {
+	return mkm.withRequestBackend(ctx, request, KeyManager.CreateKey)
+}
+
+func (mkm *MultiKeyManager) RegisterKey(ctx context.Context, request *model.KeyRequest) (*model.KeyAttributes, error) {
+	return mkm.withRequestBackend(ctx, request, KeyManager.RegisterKey)
+}
+
+func (mkm *MultiKeyManager) DeleteKey(ctx context.Context, attributes *model.KeyAttributes) error {
+	km, _, err := mkm.Backend(mkm.BackendName(attributes))
+	if err != nil {
+		return err
+	}
+	return km.DeleteKey(ctx, attributes)
+}
+
+func (mkm *MultiKeyManager) TransferKey(ctx context.Context, attributes *model.KeyAttributes) ([]byte, error) {
+	km, _, err := mkm.Backend(mkm.BackendName(attributes))
+	if err != nil {
+		return nil, err
+	}
+	return km.TransferKey(ctx, attributes)
+}
+
+// WrapKey wraps the key with publicKey when the backend owning the key implements KeyWrapper
+func (mkm *MultiKeyManager) WrapKey(ctx context.Context, attributes *model.KeyAttributes, publicKey crypto.PublicKey) ([]byte, error) {
+	km, _, err := mkm.Backend(mkm.BackendName(attributes))
+	if err != nil {
+		return nil, err
+	}
+	keyWrapper, ok := km.(KeyWrapper)
+	if !ok {
+		return nil, ErrKeyWrapNotSupported
+	}
+	return keyWrapper.WrapKey(ctx, attributes, publicKey)
+}
+
+// Encrypt encrypts plaintext under the key when the backend owning the key implements KeyEncrypter
+func (mkm *MultiKeyManager) Encrypt(ctx context.Context, attributes *model.KeyAttributes, plaintext []byte) ([]byte, error) {
+	keyEncrypter, err := mkm.keyEncrypter(attributes)
+	if err != nil {
+		return nil, err
+	}
+	return keyEncrypter.Encrypt(ctx, attributes, plaintext)
+}
+
+// Decrypt decrypts ciphertext under the key when the backend owning the key implements KeyEncrypter
+func (mkm *MultiKeyManager) Decrypt(ctx context.Context, attributes *model.KeyAttributes, ciphertext []byte) ([]byte, error) {
+	keyEncrypter, err := mkm.keyEncrypter(attributes)
+	if err != nil {
+		return nil, err
+	}
+	return keyEncrypter.Decrypt(ctx, attributes, ciphertext)
+}
+
+func (mkm *MultiKeyManager) keyEncrypter(attributes *model.KeyAttributes) (KeyEncrypter, error) {
+	km, _, err := mkm.Backend(mkm.BackendName(attributes))
+	if err != nil {
+		return nil, err
+	}
+	keyEncrypter, ok := km.(KeyEncrypter)
+	if !ok {
+		return nil, ErrEncryptNotSupported
+	}
+	return keyEncrypter, nil
+}
+
+// KeyWrappingEnforced reports whether the backend owning the key only releases it wrapped
+func (mkm *MultiKeyManager) KeyWrappingEnforced(attributes *model.KeyAttributes) bool {
+	km, _, err := mkm.Backend(mkm.BackendName(attributes))
+	if err != nil {
+		return false
+	}
+	keyWrappingEnforcer, ok := km.(KeyWrappingEnforcer)
+	return ok && keyWrappingEnforcer.KeyWrappingEnforced(attributes)
+}
+
+// PublicKey returns the public key of the key when the backend owning the key implements PublicKeyReader
+func (mkm *MultiKeyManager) PublicKey(ctx context.Context, attributes *model.KeyAttributes) (crypto.PublicKey, error) {
+	km, _, err := mkm.Backend(mkm.BackendName(attributes))
+	if err != nil {
+		return nil, err
+	}
+	publicKeyReader, ok := km.(PublicKeyReader)
+	if !ok {
+		return nil, ErrPublicKeyNotSupported
+	}
+	return publicKeyReader.PublicKey(ctx, attributes)
+}
+
+// DiscoverKeys lists the keys of the backend named in the criteria, or of the default backend,
+// when the backend implements KeyDiscoverer
+func (mkm *MultiKeyManager) DiscoverKeys(ctx context.Context, criteria *model.KmipObjectFilterCriteria) ([]*model.KmipObject, error) {
+	name := criteria.KeyManager
+	if name == "" {
+		name = mkm.defaultBackend
+	}
+	km, _, err := mkm.Backend(name)
+	if err != nil {
+		return nil, err
+	}
+	keyDiscoverer, ok := km.(KeyDiscoverer)
+	if !ok {
+		return nil, ErrKeyDiscoveryNotSupported
+	}
+	objects, err := keyDiscoverer.DiscoverKeys(ctx, criteria)
+	if err != nil {
+		return nil, err
+	}
+	for _, object := range objects {
+		object.KeyManager = name
+	}
+	return objects, nil
+}
+
+func (mkm *MultiKeyManager) withRequestBackend(ctx context.Context, request *model.KeyRequest, operation func(KeyManager, context.Context, *model.KeyRequest) (*model.KeyAttributes, error)) (*model.KeyAttributes, error) {
+	name := request.KeyManager
+	if name == "" {
+		name = mkm.defaultBackend
+	}
+	km, _, err := mkm.Backend(name)
+	if err != nil {
+		return nil, err
+	}
+	keyAttributes, err := operation(km, ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	keyAttributes.KeyManager = name
+	return keyAttributes, nil
+}
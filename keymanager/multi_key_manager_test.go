@@ -0,0 +1,91 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package keymanager
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+	"intel/kbs/v1/kmipclient"
+	"intel/kbs/v1/model"
+)
+
+func TestMultiKeyManager(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	vaultKeyManager := NewMockKmipManager(kmipclient.MockKmipClient{})
+	hsmKeyManager := NewMockKmipManager(kmipclient.MockKmipClient{})
+	mkm := NewMultiKeyManager("vault")
+	mkm.AddBackend("vault", "vault", vaultKeyManager)
+	mkm.AddBackend("hsm", "kmip", hsmKeyManager)
+	g.Expect(mkm.BackendNames()).To(gomega.Equal([]string{"hsm", "vault"}))
+
+	vaultKey := &model.KeyAttributes{ID: uuid.New(), Algorithm: "AES", KeyLength: 256}
+	hsmKey := &model.KeyAttributes{ID: uuid.New(), Algorithm: "AES", KeyLength: 256, KmipKeyID: "1"}
+	vaultKeyManager.On("CreateKey", mock.Anything).Return(vaultKey, nil)
+	hsmKeyManager.On("CreateKey", mock.Anything).Return(hsmKey, nil)
+	hsmKeyManager.On("DeleteKey", mock.Anything).Return(nil)
+
+	// keys go to the default backend unless the request names one
+	created, err := mkm.CreateKey(context.Background(), &model.KeyRequest{KeyInfo: &model.KeyInfo{Algorithm: "AES", KeyLength: 256}})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(created.KeyManager).To(gomega.Equal("vault"))
+
+	created, err = mkm.CreateKey(context.Background(), &model.KeyRequest{KeyInfo: &model.KeyInfo{Algorithm: "AES", KeyLength: 256}, KeyManager: "hsm"})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(created.KeyManager).To(gomega.Equal("hsm"))
+	g.Expect(mkm.DeleteKey(context.Background(), created)).To(gomega.Succeed())
+	hsmKeyManager.AssertCalled(t, "DeleteKey", created)
+
+	_, err = mkm.CreateKey(context.Background(), &model.KeyRequest{KeyInfo: &model.KeyInfo{Algorithm: "AES", KeyLength: 256}, KeyManager: "unknown"})
+	g.Expect(err).To(gomega.HaveOccurred())
+	g.Expect(mkm.DeleteKey(context.Background(), &model.KeyAttributes{KeyManager: "unknown"})).NotTo(gomega.Succeed())
+}
+
+func TestBackendName(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	// the default backend is a vault transit backend, so legacy vault records must not resolve to it
+	mkm := NewMultiKeyManager("transit")
+	mkm.AddBackend("transit", "vault-transit", NewMockKmipManager(kmipclient.MockKmipClient{}))
+	mkm.AddBackend("secrets", "vault", NewMockKmipManager(kmipclient.MockKmipClient{}))
+	mkm.AddBackend("hsm", "kmip", NewMockKmipManager(kmipclient.MockKmipClient{}))
+	g.Expect(mkm.BackendName(&model.KeyAttributes{KeyManager: "transit"})).To(gomega.Equal("transit"))
+	g.Expect(mkm.BackendName(&model.KeyAttributes{KmipKeyID: "1"})).To(gomega.Equal("hsm"))
+	g.Expect(mkm.BackendName(&model.KeyAttributes{})).To(gomega.Equal("secrets"))
+
+	// the default backend and then the backend named after the type are preferred
+	mkm = NewMultiKeyManager("primary")
+	mkm.AddBackend("primary", "kmip", NewMockKmipManager(kmipclient.MockKmipClient{}))
+	mkm.AddBackend("backup", "kmip", NewMockKmipManager(kmipclient.MockKmipClient{}))
+	mkm.AddBackend("archive", "vault", NewMockKmipManager(kmipclient.MockKmipClient{}))
+	mkm.AddBackend("vault", "vault", NewMockKmipManager(kmipclient.MockKmipClient{}))
+	g.Expect(mkm.BackendName(&model.KeyAttributes{KmipKeyID: "1"})).To(gomega.Equal("primary"))
+	g.Expect(mkm.BackendName(&model.KeyAttributes{})).To(gomega.Equal("vault"))
+
+	// without a backend of the original type the key cannot be reached
+	mkm = NewMultiKeyManager("local")
+	mkm.AddBackend("local", "local", NewMockKmipManager(kmipclient.MockKmipClient{}))
+	_, _, err := mkm.Backend(mkm.BackendName(&model.KeyAttributes{}))
+	g.Expect(err).To(gomega.HaveOccurred())
+}
+
+func TestKmipVersions(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	mockClient := &kmipclient.MockKmipClient{}
+	mockClient.On("ProtocolVersion").Return("2.1")
+	mkm := NewMultiKeyManager("vault")
+	mkm.AddBackend("vault", "vault", NewMockKmipManager(kmipclient.MockKmipClient{}))
+	mkm.AddBackend("hsm", "kmip", NewKmipManager(mockClient))
+
+	// only backends backed by a kmip server report a protocol version
+	g.Expect(mkm.KmipVersions()).To(gomega.Equal(map[string]string{"hsm": "2.1"}))
+}
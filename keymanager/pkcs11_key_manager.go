@@ -0,0 +1,195 @@
+//go:build cgo
+
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package keymanager
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"intel/kbs/v1/config"
+	"intel/kbs/v1/constant"
+	"intel/kbs/v1/crypt"
+	"intel/kbs/v1/model"
+	"intel/kbs/v1/pkcs11client"
+)
+
+// Pkcs11Manager keeps keys on a PKCS#11 token, e.g. a network HSM. Keys are stored as sensitive
+// token objects with their key ID as CKA_ID and only leave the token wrapped under an ephemeral
+// AES key.
+type Pkcs11Manager struct {
+	client pkcs11client.Pkcs11Client
+	// keyWrapping is set when keys released to workloads are wrapped by the token
+	keyWrapping bool
+}
+
+func NewPkcs11Manager(c pkcs11client.Pkcs11Client) *Pkcs11Manager {
+	return &Pkcs11Manager{client: c}
+}
+
+// newPkcs11KeyManager connects to the PKCS#11 token of the backend
+func newPkcs11KeyManager(pkcs11Config *config.Pkcs11Config) (KeyManager, error) {
+	pkcs11Client := pkcs11client.NewPkcs11Client()
+	err := pkcs11Client.InitializeClient(pkcs11Config)
+	if err != nil {
+		return nil, errors.Wrap(err, "keymanager/key_manager:NewKeyManager() Failed to initialize PKCS#11 client")
+	}
+	pkcs11Manager := NewPkcs11Manager(pkcs11Client)
+	pkcs11Manager.keyWrapping = pkcs11Config.KeyWrapping
+	return pkcs11Manager, nil
+}
+
+func (pm *Pkcs11Manager) CreateKey(_ context.Context, request *model.KeyRequest) (*model.KeyAttributes, error) {
+
+	id, err := newKeyID(request)
+	if err != nil {
+		return nil, err
+	}
+
+	switch request.KeyInfo.Algorithm {
+	case constant.CRYPTOALGAES:
+		err = pm.client.GenerateSecretKey(id.String(), request.KeyInfo.KeyLength)
+	case constant.CRYPTOALGRSA:
+		err = pm.client.GenerateKeyPair(id.String(), constant.CRYPTOALGRSA, "", request.KeyInfo.KeyLength)
+	case constant.CRYPTOALGEC:
+		if _, err := ellipticCurve(request.KeyInfo.CurveType); err != nil {
+			return nil, err
+		}
+		err = pm.client.GenerateKeyPair(id.String(), constant.CRYPTOALGEC, request.KeyInfo.CurveType, 0)
+	default:
+		return nil, errors.Errorf("%s algorithm is not supported", request.KeyInfo.Algorithm)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create %s key", request.KeyInfo.Algorithm)
+	}
+	return newPkcs11KeyAttributes(request, id), nil
+}
+
+func (pm *Pkcs11Manager) DeleteKey(_ context.Context, attributes *model.KeyAttributes) error {
+	return pm.client.DeleteKey(attributes.ID.String())
+}
+
+func (pm *Pkcs11Manager) RegisterKey(_ context.Context, request *model.KeyRequest) (*model.KeyAttributes, error) {
+
+	if request.KeyInfo.KeyData == "" {
+		return nil, errors.New("key_data must be provided to register a key with a PKCS#11 token")
+	}
+	keyBytes, err := base64.StdEncoding.DecodeString(request.KeyInfo.KeyData)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to decode keydata")
+	}
+	defer crypt.ZeroizeByteArray(keyBytes)
+
+	// private keys are imported in PKCS#8 format, opaque secrets as generic secret keys
+	keyMaterial := keyBytes
+	switch request.KeyInfo.Algorithm {
+	case constant.CRYPTOALGAES, constant.CRYPTOALGSECRET:
+	case constant.CRYPTOALGRSA, constant.CRYPTOALGEC:
+		privateKey, err := crypt.GetPrivateKeyFromPem(keyBytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to decode private key")
+		}
+		if _, ok := privateKey.(*rsa.PrivateKey); ok != (request.KeyInfo.Algorithm == constant.CRYPTOALGRSA) {
+			return nil, errors.Errorf("Private key in request is not %s key", request.KeyInfo.Algorithm)
+		}
+		if _, ok := privateKey.(*ecdsa.PrivateKey); ok != (request.KeyInfo.Algorithm == constant.CRYPTOALGEC) {
+			return nil, errors.Errorf("Private key in request is not %s key", request.KeyInfo.Algorithm)
+		}
+		keyMaterial, err = crypt.MarshalPKCS8PrivateKey(privateKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to marshal private key")
+		}
+		defer crypt.ZeroizeByteArray(keyMaterial)
+	default:
+		return nil, errors.Errorf("%s algorithm is not supported", request.KeyInfo.Algorithm)
+	}
+
+	id, err := newKeyID(request)
+	if err != nil {
+		return nil, err
+	}
+	if err := pm.client.ImportKey(id.String(), request.KeyInfo.Algorithm, keyMaterial); err != nil {
+		return nil, err
+	}
+	return newPkcs11KeyAttributes(request, id), nil
+}
+
+// TransferKey has the token wrap the key under an ephemeral AES key, which is unwrapped in the
+// KBS. AES keys are returned as their value, private keys in PKCS#8 format.
+func (pm *Pkcs11Manager) TransferKey(_ context.Context, attributes *model.KeyAttributes) ([]byte, error) {
+
+	ephemeralKey, err := crypt.GetDerivedKey(32)
+	if err != nil {
+		return nil, err
+	}
+	defer crypt.ZeroizeByteArray(ephemeralKey)
+
+	wrappedKey, err := pm.client.WrapKey(attributes.ID.String(), attributes.Algorithm, ephemeralKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get wrapped key")
+	}
+	return crypt.UnwrapKeyWithPadding(ephemeralKey, wrappedKey)
+}
+
+// WrapKey has the token wrap the key under an ephemeral AES-256 key with AES key wrap with
+// padding, so that the key material is never in plaintext in the KBS. The ephemeral key is
+// wrapped to publicKey with RSA-OAEP SHA-256 and precedes the wrapped key.
+func (pm *Pkcs11Manager) WrapKey(_ context.Context, attributes *model.KeyAttributes, publicKey crypto.PublicKey) ([]byte, error) {
+
+	if !pm.keyWrapping {
+		return nil, ErrKeyWrapNotSupported
+	}
+	rsaPublicKey, ok := publicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, ErrWrappingKeyNotSupported
+	}
+
+	wrappingKey, err := crypt.GetDerivedKey(32)
+	if err != nil {
+		return nil, err
+	}
+	defer crypt.ZeroizeByteArray(wrappingKey)
+	wrappedWrappingKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, rsaPublicKey, wrappingKey, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to wrap ephemeral key")
+	}
+
+	wrappedKey, err := pm.client.WrapKey(attributes.ID.String(), attributes.Algorithm, wrappingKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get wrapped key")
+	}
+	return append(wrappedWrappingKey, wrappedKey...), nil
+}
+
+// KeyWrappingEnforced reports whether the token wraps keys released to workloads
+func (pm *Pkcs11Manager) KeyWrappingEnforced(*model.KeyAttributes) bool {
+	return pm.keyWrapping
+}
+
+func newPkcs11KeyAttributes(request *model.KeyRequest, id uuid.UUID) *model.KeyAttributes {
+	keyAttributes := &model.KeyAttributes{
+		ID:               id,
+		Algorithm:        request.KeyInfo.Algorithm,
+		TransferPolicyId: request.TransferPolicyID,
+		CreatedAt:        time.Now().UTC(),
+	}
+	if request.KeyInfo.Algorithm == constant.CRYPTOALGEC {
+		keyAttributes.CurveType = request.KeyInfo.CurveType
+	} else {
+		keyAttributes.KeyLength = request.KeyInfo.KeyLength
+	}
+	return keyAttributes
+}
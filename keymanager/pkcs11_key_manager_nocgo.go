@@ -0,0 +1,19 @@
+//go:build !cgo
+
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package keymanager
+
+import (
+	"intel/kbs/v1/config"
+	"intel/kbs/v1/pkcs11client"
+)
+
+// newPkcs11KeyManager fails when the KBS is built without cgo, the PKCS#11 module loader needs it
+func newPkcs11KeyManager(*config.Pkcs11Config) (KeyManager, error) {
+	return nil, pkcs11client.ErrNotSupported
+}
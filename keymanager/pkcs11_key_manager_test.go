@@ -0,0 +1,202 @@
+//go:build cgo
+
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package keymanager
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"intel/kbs/v1/crypt"
+	"intel/kbs/v1/model"
+	"intel/kbs/v1/pkcs11client"
+)
+
+func TestPkcs11ManagerCreateKey(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		keyInfo model.KeyInfo
+		wantErr bool
+	}{
+		{
+			name:    "create AES key",
+			keyInfo: model.KeyInfo{Algorithm: "AES", KeyLength: 256},
+		},
+		{
+			name:    "create RSA key",
+			keyInfo: model.KeyInfo{Algorithm: "RSA", KeyLength: 3072},
+		},
+		{
+			name:    "create EC key",
+			keyInfo: model.KeyInfo{Algorithm: "EC", CurveType: "secp384r1"},
+		},
+		{
+			name:    "negative test - curve type not supported",
+			keyInfo: model.KeyInfo{Algorithm: "EC", CurveType: "primeinvalid"},
+			wantErr: true,
+		},
+		{
+			name:    "negative test - algorithm not supported",
+			keyInfo: model.KeyInfo{Algorithm: "DES", KeyLength: 56},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			keyInfo := tt.keyInfo
+			mockClient := pkcs11client.NewMockPkcs11Client()
+			mockClient.On("GenerateSecretKey", mock.Anything, mock.Anything).Return(nil)
+			mockClient.On("GenerateKeyPair", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+			keyManager := NewPkcs11Manager(mockClient)
+			keyAttributes, err := keyManager.CreateKey(context.Background(), &model.KeyRequest{KeyInfo: &keyInfo})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CreateKey() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			switch keyInfo.Algorithm {
+			case "AES":
+				mockClient.AssertCalled(t, "GenerateSecretKey", keyAttributes.ID.String(), keyInfo.KeyLength)
+			default:
+				mockClient.AssertCalled(t, "GenerateKeyPair", keyAttributes.ID.String(), keyInfo.Algorithm, keyInfo.CurveType, keyInfo.KeyLength)
+			}
+		})
+	}
+}
+
+func TestPkcs11ManagerRegisterKey(t *testing.T) {
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		keyInfo model.KeyInfo
+		wantErr bool
+	}{
+		{
+			name:    "register AES key",
+			keyInfo: model.KeyInfo{Algorithm: "AES", KeyLength: 256, KeyData: "urNoe6OU/2dqvYPP40FTVEgIPhIJ9Za4hu9keAwtfC4="},
+		},
+		{
+			name:    "register RSA key",
+			keyInfo: model.KeyInfo{Algorithm: "RSA", KeyLength: 2048, KeyData: pemKeyData(t, rsaKey)},
+		},
+		{
+			name:    "register EC key",
+			keyInfo: model.KeyInfo{Algorithm: "EC", CurveType: "secp256r1", KeyData: pemKeyData(t, ecKey)},
+		},
+		{
+			name:    "negative test - key data missing",
+			keyInfo: model.KeyInfo{Algorithm: "AES", KeyLength: 256},
+			wantErr: true,
+		},
+		{
+			name:    "negative test - algorithm does not match key data",
+			keyInfo: model.KeyInfo{Algorithm: "RSA", KeyLength: 2048, KeyData: pemKeyData(t, ecKey)},
+			wantErr: true,
+		},
+		{
+			name:    "negative test - invalid key data",
+			keyInfo: model.KeyInfo{Algorithm: "RSA", KeyLength: 2048, KeyData: "aW52YWxpZA=="},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			keyInfo := tt.keyInfo
+			keyId := uuid.New()
+			mockClient := pkcs11client.NewMockPkcs11Client()
+			mockClient.On("ImportKey", keyId.String(), keyInfo.Algorithm, mock.Anything).Return(nil)
+			keyManager := NewPkcs11Manager(mockClient)
+			keyAttributes, err := keyManager.RegisterKey(context.Background(), &model.KeyRequest{KeyId: keyId, KeyInfo: &keyInfo})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("RegisterKey() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && keyAttributes.ID != keyId {
+				t.Errorf("RegisterKey() ID = %v, want %v", keyAttributes.ID, keyId)
+			}
+		})
+	}
+}
+
+func TestPkcs11ManagerTransferKey(t *testing.T) {
+
+	keyMaterial := []byte("0123456789abcdef0123456789abcdef")
+	keyAttributes := &model.KeyAttributes{ID: uuid.New(), Algorithm: "AES", KeyLength: 256}
+	mockClient := pkcs11client.NewMockPkcs11Client()
+	call := mockClient.On("WrapKey", keyAttributes.ID.String(), "AES", mock.Anything)
+	call.Run(func(args mock.Arguments) {
+		wrapped, err := crypt.WrapKeyWithPadding(args.Get(2).([]byte), keyMaterial)
+		call.ReturnArguments = mock.Arguments{wrapped, err}
+	})
+
+	keyManager := NewPkcs11Manager(mockClient)
+	key, err := keyManager.TransferKey(context.Background(), keyAttributes)
+	if err != nil || !bytes.Equal(key, keyMaterial) {
+		t.Errorf("TransferKey() = %x, %v", key, err)
+	}
+}
+
+func TestPkcs11ManagerWrapKey(t *testing.T) {
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyAttributes := &model.KeyAttributes{ID: uuid.New(), Algorithm: "AES", KeyLength: 256}
+	mockClient := pkcs11client.NewMockPkcs11Client()
+	mockClient.On("WrapKey", keyAttributes.ID.String(), "AES", mock.Anything).Return([]byte("wrapped"), nil)
+
+	keyManager := NewPkcs11Manager(mockClient)
+	if _, err := keyManager.WrapKey(context.Background(), keyAttributes, &privateKey.PublicKey); err != ErrKeyWrapNotSupported {
+		t.Errorf("WrapKey() error = %v, want %v", err, ErrKeyWrapNotSupported)
+	}
+
+	keyManager.keyWrapping = true
+	wrapped, err := keyManager.WrapKey(context.Background(), keyAttributes, &privateKey.PublicKey)
+	if err != nil || !bytes.HasSuffix(wrapped, []byte("wrapped")) {
+		t.Fatalf("WrapKey() = %q, %v", wrapped, err)
+	}
+	// the ephemeral key passed to the token is wrapped to the public key
+	wrappingKey, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, wrapped[:privateKey.Size()], nil)
+	if err != nil || len(wrappingKey) != 32 {
+		t.Errorf("WrapKey() wrapped ephemeral key of length %d, %v", len(wrappingKey), err)
+	}
+}
+
+func pemKeyData(t *testing.T, privateKey interface{}) string {
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
@@ -0,0 +1,125 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package keymanager
+
+import (
+	"context"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"intel/kbs/v1/kmsplugin"
+	"intel/kbs/v1/model"
+)
+
+// PluginManager delegates key operations to a key manager plugin that runs out of process
+type PluginManager struct {
+	client kmsplugin.PluginClient
+	// algorithms lists the key algorithms supported by the plugin, all algorithms are passed on
+	// to the plugin when it does not list any
+	algorithms []string
+}
+
+func NewPluginManager(c kmsplugin.PluginClient) *PluginManager {
+	return &PluginManager{client: c}
+}
+
+func (pm *PluginManager) CreateKey(_ context.Context, request *model.KeyRequest) (*model.KeyAttributes, error) {
+
+	if err := pm.checkAlgorithm(request); err != nil {
+		return nil, err
+	}
+	keyAttributes, err := pm.client.CreateKey(request)
+	if err != nil {
+		return nil, errors.Wrap(err, "plugin failed to create key")
+	}
+	return pluginKeyAttributes(keyAttributes, request)
+}
+
+func (pm *PluginManager) DeleteKey(_ context.Context, attributes *model.KeyAttributes) error {
+	if err := pm.client.DeleteKey(attributes); err != nil {
+		return errors.Wrap(err, "plugin failed to delete key")
+	}
+	return nil
+}
+
+func (pm *PluginManager) RegisterKey(_ context.Context, request *model.KeyRequest) (*model.KeyAttributes, error) {
+
+	if err := pm.checkAlgorithm(request); err != nil {
+		return nil, err
+	}
+	keyAttributes, err := pm.client.RegisterKey(request)
+	if err != nil {
+		return nil, errors.Wrap(err, "plugin failed to register key")
+	}
+	return pluginKeyAttributes(keyAttributes, request)
+}
+
+func (pm *PluginManager) TransferKey(_ context.Context, attributes *model.KeyAttributes) ([]byte, error) {
+	key, err := pm.client.TransferKey(attributes)
+	if err != nil {
+		return nil, errors.Wrap(err, "plugin failed to transfer key")
+	}
+	return key, nil
+}
+
+// pluginServer serves a key manager with kmsplugin.Serve. Plugin requests carry no context, so
+// the operations of the key manager are not cancelled.
+type pluginServer struct {
+	keyManager KeyManager
+}
+
+// NewPluginServer returns km as a key manager that can be served as a key manager plugin
+func NewPluginServer(km KeyManager) kmsplugin.KeyManager {
+	return &pluginServer{keyManager: km}
+}
+
+func (ps *pluginServer) CreateKey(request *model.KeyRequest) (*model.KeyAttributes, error) {
+	return ps.keyManager.CreateKey(context.Background(), request)
+}
+
+func (ps *pluginServer) DeleteKey(attributes *model.KeyAttributes) error {
+	return ps.keyManager.DeleteKey(context.Background(), attributes)
+}
+
+func (ps *pluginServer) RegisterKey(request *model.KeyRequest) (*model.KeyAttributes, error) {
+	return ps.keyManager.RegisterKey(context.Background(), request)
+}
+
+func (ps *pluginServer) TransferKey(attributes *model.KeyAttributes) ([]byte, error) {
+	return ps.keyManager.TransferKey(context.Background(), attributes)
+}
+
+func (pm *PluginManager) checkAlgorithm(request *model.KeyRequest) error {
+
+	if len(pm.algorithms) == 0 {
+		return nil
+	}
+	for _, algorithm := range pm.algorithms {
+		if strings.EqualFold(algorithm, request.KeyInfo.Algorithm) {
+			return nil
+		}
+	}
+	return errors.Errorf("%s algorithm is not supported by the key manager plugin", request.KeyInfo.Algorithm)
+}
+
+// pluginKeyAttributes checks the attributes returned by a plugin and removes key material, which
+// must not be saved by the KBS
+func pluginKeyAttributes(keyAttributes *model.KeyAttributes, request *model.KeyRequest) (*model.KeyAttributes, error) {
+
+	if keyAttributes.ID == uuid.Nil {
+		return nil, errors.New("plugin returned a key without ID")
+	}
+	if request.KeyId != uuid.Nil && keyAttributes.ID != request.KeyId {
+		return nil, errors.Errorf("plugin returned key %s instead of %s", keyAttributes.ID, request.KeyId)
+	}
+	keyAttributes.KeyData = ""
+	keyAttributes.PrivateKey = ""
+	keyAttributes.PublicKey = ""
+	keyAttributes.TransferPolicyId = request.TransferPolicyID
+	return keyAttributes, nil
+}
@@ -0,0 +1,145 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package keymanager
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	"intel/kbs/v1/config"
+	"intel/kbs/v1/kmsplugin"
+	"intel/kbs/v1/model"
+	"intel/kbs/v1/vaultclient"
+)
+
+// TestPluginManagerVaultPlugin serves the vault key manager as a plugin, as the reference plugin
+// does, and calls it through the plugin client
+func TestPluginManagerVaultPlugin(t *testing.T) {
+
+	keys := map[string][]byte{}
+	vaultClient := vaultclient.NewMockVaultClient()
+	vaultClient.On("CreateKey", mock.Anything).Run(func(args mock.Arguments) {
+		keyAttributes := args.Get(0).(*model.KeyAttributes)
+		keys[keyAttributes.ID.String()], _ = json.Marshal(keyAttributes)
+	}).Return(nil)
+	getKey := vaultClient.On("GetKey", mock.Anything)
+	getKey.Run(func(args mock.Arguments) {
+		getKey.ReturnArguments = mock.Arguments{keys[args.String(0)], nil}
+	})
+	vaultClient.On("DeleteKey", mock.Anything).Return(errors.New("key not found"))
+
+	socketPath := filepath.Join(t.TempDir(), "vault.sock")
+	capabilities := kmsplugin.Capabilities{Name: "vault", Algorithms: []string{"AES", "RSA", "EC"}}
+	go func() {
+		_ = kmsplugin.Serve(NewPluginServer(NewVaultManager(vaultClient)), capabilities, socketPath)
+	}()
+	for i := 0; i < 50; i++ {
+		if _, err := os.Stat(socketPath); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	pluginClient := kmsplugin.NewPluginClient()
+	if err := pluginClient.InitializeClient(&config.PluginConfig{SocketPath: socketPath, Timeout: 5}); err != nil {
+		t.Fatalf("InitializeClient() error = %v", err)
+	}
+	keyManager := NewPluginManager(pluginClient)
+	keyManager.algorithms = capabilities.Algorithms
+
+	transferPolicyId := uuid.New()
+	keyAttributes, err := keyManager.CreateKey(context.Background(), &model.KeyRequest{
+		KeyInfo:          &model.KeyInfo{Algorithm: "AES", KeyLength: 256},
+		TransferPolicyID: transferPolicyId,
+	})
+	if err != nil {
+		t.Fatalf("CreateKey() error = %v", err)
+	}
+	if keyAttributes.KeyData != "" || keyAttributes.TransferPolicyId != transferPolicyId {
+		t.Errorf("CreateKey() = %+v", keyAttributes)
+	}
+	key, err := keyManager.TransferKey(context.Background(), keyAttributes)
+	if err != nil || len(key) != 32 {
+		t.Errorf("TransferKey() = %x, %v", key, err)
+	}
+
+	// a re-imported key keeps its ID
+	keyData := "urNoe6OU/2dqvYPP40FTVEgIPhIJ9Za4hu9keAwtfC4="
+	keyId := uuid.New()
+	keyAttributes, err = keyManager.RegisterKey(context.Background(), &model.KeyRequest{
+		KeyId:   keyId,
+		KeyInfo: &model.KeyInfo{Algorithm: "AES", KeyLength: 256, KeyData: keyData},
+	})
+	if err != nil || keyAttributes.ID != keyId {
+		t.Fatalf("RegisterKey() = %+v, %v", keyAttributes, err)
+	}
+	key, err = keyManager.TransferKey(context.Background(), keyAttributes)
+	if err != nil || base64.StdEncoding.EncodeToString(key) != keyData {
+		t.Errorf("TransferKey() = %x, %v", key, err)
+	}
+
+	// errors of the key manager are returned by the plugin
+	if err := keyManager.DeleteKey(context.Background(), keyAttributes); err == nil || !strings.Contains(err.Error(), "key not found") {
+		t.Errorf("DeleteKey() error = %v", err)
+	}
+	if _, err := keyManager.CreateKey(context.Background(), &model.KeyRequest{KeyInfo: &model.KeyInfo{Algorithm: "ECBBBB"}}); err == nil {
+		t.Error("CreateKey() with unsupported algorithm succeeded")
+	}
+}
+
+func TestPluginManagerCreateKey(t *testing.T) {
+
+	keyId := uuid.New()
+	tests := []struct {
+		name       string
+		algorithms []string
+		returned   *model.KeyAttributes
+		wantErr    bool
+	}{
+		{
+			name:     "key material is removed",
+			returned: &model.KeyAttributes{ID: keyId, Algorithm: "AES", KeyLength: 256, KeyData: "a2V5"},
+		},
+		{
+			name:       "negative test - algorithm not supported by plugin",
+			algorithms: []string{"RSA"},
+			returned:   &model.KeyAttributes{ID: keyId, Algorithm: "AES", KeyLength: 256},
+			wantErr:    true,
+		},
+		{
+			name:     "negative test - plugin returned no ID",
+			returned: &model.KeyAttributes{Algorithm: "AES", KeyLength: 256},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			mockClient := kmsplugin.NewMockPluginClient()
+			mockClient.On("CreateKey", mock.Anything).Return(tt.returned, nil)
+			keyManager := NewPluginManager(mockClient)
+			keyManager.algorithms = tt.algorithms
+			keyAttributes, err := keyManager.CreateKey(context.Background(), &model.KeyRequest{KeyInfo: &model.KeyInfo{Algorithm: "AES", KeyLength: 256}})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CreateKey() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && (keyAttributes.ID != keyId || keyAttributes.KeyData != "") {
+				t.Errorf("CreateKey() = %+v", keyAttributes)
+			}
+		})
+	}
+}
@@ -7,11 +7,16 @@
 package keymanager
 
 import (
+	"context"
+	"crypto"
 	"fmt"
+	"intel/kbs/v1/constant"
 	"intel/kbs/v1/model"
 	"intel/kbs/v1/repository"
+	"intel/kbs/v1/repository/directory"
 
 	"github.com/google/uuid"
+	"github.com/pkg/errors"
 )
 
 type RemoteManager struct {
@@ -26,14 +31,15 @@ func NewRemoteManager(ks repository.KeyStore, km KeyManager) *RemoteManager {
 	}
 }
 
-func (rm *RemoteManager) CreateKey(request *model.KeyRequest) (*model.KeyResponse, error) {
+func (rm *RemoteManager) CreateKey(ctx context.Context, request *model.KeyRequest) (*model.KeyResponse, error) {
 
-	keyAttributes, err := rm.manager.CreateKey(request)
+	keyAttributes, err := rm.manager.CreateKey(ctx, request)
 	if err != nil {
 		return nil, err
 	}
 
 	keyAttributes.TransferLink = getTransferLink(keyAttributes.ID)
+	keyAttributes.KeyEncoding = request.KeyInfo.KeyEncoding
 	storedKey, err := rm.store.Create(keyAttributes)
 	if err != nil {
 		return nil, err
@@ -44,7 +50,7 @@ func (rm *RemoteManager) CreateKey(request *model.KeyRequest) (*model.KeyRespons
 
 func (rm *RemoteManager) RetrieveKey(keyId uuid.UUID) (*model.KeyResponse, error) {
 
-	keyAttributes, err := rm.store.Retrieve(keyId)
+	keyAttributes, err := rm.retrieve(keyId, false)
 	if err != nil {
 		return nil, err
 	}
@@ -52,14 +58,14 @@ func (rm *RemoteManager) RetrieveKey(keyId uuid.UUID) (*model.KeyResponse, error
 	return keyAttributes.ToKeyResponse(), nil
 }
 
-func (rm *RemoteManager) DeleteKey(keyId uuid.UUID) error {
+func (rm *RemoteManager) DeleteKey(ctx context.Context, keyId uuid.UUID) error {
 
-	keyAttributes, err := rm.store.Retrieve(keyId)
+	keyAttributes, err := rm.retrieve(keyId, false)
 	if err != nil {
 		return err
 	}
 
-	if err := rm.manager.DeleteKey(keyAttributes); err != nil {
+	if err := rm.manager.DeleteKey(ctx, keyAttributes); err != nil {
 		return err
 	}
 
@@ -75,6 +81,9 @@ func (rm *RemoteManager) SearchKeys(criteria *model.KeyFilterCriteria) ([]*model
 
 	var keyResponses = []*model.KeyResponse{}
 	for _, keyAttributes := range keyAttributesList {
+		if isSecret(&keyAttributes) {
+			continue
+		}
 		keyResponses = append(keyResponses, keyAttributes.ToKeyResponse())
 	}
 
@@ -83,7 +92,7 @@ func (rm *RemoteManager) SearchKeys(criteria *model.KeyFilterCriteria) ([]*model
 
 func (rm *RemoteManager) UpdateKey(keyUpdateRequest *model.KeyUpdateRequest) (*model.KeyResponse, error) {
 
-	keyAttributes, err := rm.store.Retrieve(keyUpdateRequest.KeyId)
+	keyAttributes, err := rm.retrieve(keyUpdateRequest.KeyId, false)
 	if err != nil {
 		return nil, err
 	}
@@ -96,14 +105,15 @@ func (rm *RemoteManager) UpdateKey(keyUpdateRequest *model.KeyUpdateRequest) (*m
 	return updatedKey.ToKeyResponse(), nil
 }
 
-func (rm *RemoteManager) RegisterKey(request *model.KeyRequest) (*model.KeyResponse, error) {
+func (rm *RemoteManager) RegisterKey(ctx context.Context, request *model.KeyRequest) (*model.KeyResponse, error) {
 
-	keyAttributes, err := rm.manager.RegisterKey(request)
+	keyAttributes, err := rm.manager.RegisterKey(ctx, request)
 	if err != nil {
 		return nil, err
 	}
 
 	keyAttributes.TransferLink = getTransferLink(keyAttributes.ID)
+	keyAttributes.KeyEncoding = request.KeyInfo.KeyEncoding
 	storedKey, err := rm.store.Create(keyAttributes)
 	if err != nil {
 		return nil, err
@@ -112,16 +122,275 @@ func (rm *RemoteManager) RegisterKey(request *model.KeyRequest) (*model.KeyRespo
 	return storedKey.ToKeyResponse(), nil
 }
 
-func (rm *RemoteManager) TransferKey(keyId uuid.UUID) ([]byte, error) {
+func (rm *RemoteManager) TransferKey(ctx context.Context, keyId uuid.UUID) ([]byte, error) {
+
+	keyAttributes, err := rm.retrieve(keyId, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return rm.manager.TransferKey(ctx, keyAttributes)
+}
+
+// WrapKey returns the key wrapped to publicKey by its key manager, or ErrKeyWrapNotSupported
+// when the key manager cannot wrap keys. Secrets are never wrapped by their key manager.
+func (rm *RemoteManager) WrapKey(ctx context.Context, keyId uuid.UUID, publicKey crypto.PublicKey) ([]byte, error) {
 
 	keyAttributes, err := rm.store.Retrieve(keyId)
 	if err != nil {
 		return nil, err
 	}
+	if isSecret(keyAttributes) {
+		return nil, ErrKeyWrapNotSupported
+	}
+
+	keyWrapper, ok := rm.manager.(KeyWrapper)
+	if !ok {
+		return nil, ErrKeyWrapNotSupported
+	}
+	return keyWrapper.WrapKey(ctx, keyAttributes, publicKey)
+}
+
+// Encrypt encrypts plaintext under the key inside its key manager, or returns
+// ErrEncryptNotSupported when the key manager cannot encrypt
+func (rm *RemoteManager) Encrypt(ctx context.Context, keyId uuid.UUID, plaintext []byte) ([]byte, error) {
+
+	keyAttributes, keyEncrypter, err := rm.keyEncrypter(keyId)
+	if err != nil {
+		return nil, err
+	}
+	return keyEncrypter.Encrypt(ctx, keyAttributes, plaintext)
+}
+
+// Decrypt decrypts a ciphertext returned by Encrypt inside the key manager of the key
+func (rm *RemoteManager) Decrypt(ctx context.Context, keyId uuid.UUID, ciphertext []byte) ([]byte, error) {
+
+	keyAttributes, keyEncrypter, err := rm.keyEncrypter(keyId)
+	if err != nil {
+		return nil, err
+	}
+	return keyEncrypter.Decrypt(ctx, keyAttributes, ciphertext)
+}
+
+func (rm *RemoteManager) keyEncrypter(keyId uuid.UUID) (*model.KeyAttributes, KeyEncrypter, error) {
+
+	keyAttributes, err := rm.retrieve(keyId, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyEncrypter, ok := rm.manager.(KeyEncrypter)
+	if !ok {
+		return nil, nil, ErrEncryptNotSupported
+	}
+	return keyAttributes, keyEncrypter, nil
+}
+
+// KeyWrappingEnforced reports whether the key manager of the key only releases it wrapped, in
+// which case the KBS must not transfer the key in plaintext
+func (rm *RemoteManager) KeyWrappingEnforced(keyId uuid.UUID) (bool, error) {
+
+	keyAttributes, err := rm.retrieve(keyId, false)
+	if err != nil {
+		return false, err
+	}
+	keyWrappingEnforcer, ok := rm.manager.(KeyWrappingEnforcer)
+	return ok && keyWrappingEnforcer.KeyWrappingEnforced(keyAttributes), nil
+}
+
+// PublicKey returns the public key of an asymmetric key from its key manager, ErrNoPublicKey for
+// symmetric keys or ErrPublicKeyNotSupported when the key manager cannot return public keys
+func (rm *RemoteManager) PublicKey(ctx context.Context, keyId uuid.UUID) (crypto.PublicKey, error) {
+
+	keyAttributes, err := rm.retrieve(keyId, false)
+	if err != nil {
+		return nil, err
+	}
+	if constant.SymmetricAlgorithms[keyAttributes.Algorithm] {
+		return nil, ErrNoPublicKey
+	}
+
+	publicKeyReader, ok := rm.manager.(PublicKeyReader)
+	if !ok {
+		return nil, ErrPublicKeyNotSupported
+	}
+	return publicKeyReader.PublicKey(ctx, keyAttributes)
+}
+
+// DiscoverKeys lists the keys held by the key manager that match the criteria. Keys that are
+// already registered carry the ID of the KBS key referencing them.
+func (rm *RemoteManager) DiscoverKeys(ctx context.Context, criteria *model.KmipObjectFilterCriteria) ([]*model.KmipObject, error) {
+
+	keyDiscoverer, ok := rm.manager.(KeyDiscoverer)
+	if !ok {
+		return nil, ErrKeyDiscoveryNotSupported
+	}
+	objects, err := keyDiscoverer.DiscoverKeys(ctx, criteria)
+	if err != nil {
+		return nil, err
+	}
+
+	keyAttributesList, err := rm.store.Search(nil)
+	if err != nil {
+		return nil, err
+	}
+	registered := map[string]map[string]uuid.UUID{}
+	for _, keyAttributes := range keyAttributesList {
+		if keyAttributes.KmipKeyID == "" {
+			continue
+		}
+		backend := keyAttributes.KeyManager
+		if multiKeyManager, ok := rm.manager.(*MultiKeyManager); ok {
+			backend = multiKeyManager.BackendName(&keyAttributes)
+		}
+		if registered[backend] == nil {
+			registered[backend] = map[string]uuid.UUID{}
+		}
+		registered[backend][keyAttributes.KmipKeyID] = keyAttributes.ID
+	}
+	for _, object := range objects {
+		if id, ok := registered[object.KeyManager][object.KmipKeyID]; ok {
+			object.KeyID = &id
+		}
+	}
+	return objects, nil
+}
+
+// KmipVersions returns the kmip protocol version negotiated by each kmip key manager backend
+func (rm *RemoteManager) KmipVersions() map[string]string {
+	switch km := rm.manager.(type) {
+	case *MultiKeyManager:
+		return km.KmipVersions()
+	case KmipVersionReporter:
+		return map[string]string{constant.KmipKeyManager: km.KmipVersion()}
+	default:
+		return map[string]string{}
+	}
+}
+
+// CreateSecret stores the opaque secret data in the key manager, as a key of the SECRET algorithm
+// whose length is the size of the data in bits
+func (rm *RemoteManager) CreateSecret(ctx context.Context, request *model.SecretRequest, data []byte) (*model.SecretResponse, error) {
+
+	keyRequest := &model.KeyRequest{
+		KeyId: request.SecretId,
+		KeyInfo: &model.KeyInfo{
+			Algorithm: constant.CRYPTOALGSECRET,
+			KeyLength: len(data) * 8,
+			KeyData:   request.Data,
+		},
+		TransferPolicyID: request.TransferPolicyID,
+		KeyManager:       request.KeyManager,
+	}
+	keyAttributes, err := rm.manager.RegisterKey(ctx, keyRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	keyAttributes.TransferLink = getSecretTransferLink(keyAttributes.ID)
+	keyAttributes.ContentType = request.ContentType
+	storedSecret, err := rm.store.Create(keyAttributes)
+	if err != nil {
+		return nil, err
+	}
+
+	return storedSecret.ToSecretResponse(), nil
+}
+
+func (rm *RemoteManager) RetrieveSecret(secretId uuid.UUID) (*model.SecretResponse, error) {
+
+	keyAttributes, err := rm.retrieve(secretId, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return keyAttributes.ToSecretResponse(), nil
+}
+
+func (rm *RemoteManager) DeleteSecret(ctx context.Context, secretId uuid.UUID) error {
+
+	keyAttributes, err := rm.retrieve(secretId, true)
+	if err != nil {
+		return err
+	}
+
+	if err := rm.manager.DeleteKey(ctx, keyAttributes); err != nil {
+		return err
+	}
+
+	return rm.store.Delete(secretId)
+}
+
+func (rm *RemoteManager) SearchSecrets(criteria *model.SecretFilterCriteria) ([]*model.SecretResponse, error) {
+
+	keyCriteria := &model.KeyFilterCriteria{Algorithm: constant.CRYPTOALGSECRET}
+	if criteria != nil {
+		keyCriteria.TransferPolicyId = criteria.TransferPolicyId
+	}
+	keyAttributesList, err := rm.store.Search(keyCriteria)
+	if err != nil {
+		return nil, err
+	}
+
+	var secretResponses = []*model.SecretResponse{}
+	for _, keyAttributes := range keyAttributesList {
+		if criteria != nil && criteria.ContentType != "" && keyAttributes.ContentType != criteria.ContentType {
+			continue
+		}
+		secretResponses = append(secretResponses, keyAttributes.ToSecretResponse())
+	}
+
+	return secretResponses, nil
+}
+
+func (rm *RemoteManager) UpdateSecret(secretUpdateRequest *model.SecretUpdateRequest) (*model.SecretResponse, error) {
+
+	keyAttributes, err := rm.retrieve(secretUpdateRequest.SecretId, true)
+	if err != nil {
+		return nil, err
+	}
+	keyAttributes.TransferPolicyId = secretUpdateRequest.TransferPolicyID
+	updatedSecret, err := rm.store.Update(keyAttributes)
+	if err != nil {
+		return nil, err
+	}
+
+	return updatedSecret.ToSecretResponse(), nil
+}
+
+// TransferSecret returns the opaque secret data held by the key manager
+func (rm *RemoteManager) TransferSecret(ctx context.Context, secretId uuid.UUID) ([]byte, error) {
+
+	keyAttributes, err := rm.retrieve(secretId, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return rm.manager.TransferKey(ctx, keyAttributes)
+}
+
+// retrieve returns the key attributes of a secret or of a key, a record of the other kind is
+// reported as not found
+func (rm *RemoteManager) retrieve(id uuid.UUID, secret bool) (*model.KeyAttributes, error) {
+
+	keyAttributes, err := rm.store.Retrieve(id)
+	if err != nil {
+		return nil, err
+	}
+	if isSecret(keyAttributes) != secret {
+		return nil, errors.New(directory.RecordNotFound)
+	}
+	return keyAttributes, nil
+}
 
-	return rm.manager.TransferKey(keyAttributes)
+// isSecret reports whether the key attributes are those of an opaque secret
+func isSecret(keyAttributes *model.KeyAttributes) bool {
+	return keyAttributes.Algorithm == constant.CRYPTOALGSECRET
 }
 
 func getTransferLink(keyId uuid.UUID) string {
 	return fmt.Sprintf("/kbs/v1/keys/%s/transfer", keyId.String())
 }
+
+func getSecretTransferLink(secretId uuid.UUID) string {
+	return fmt.Sprintf("/kbs/v1/secrets/%s/transfer", secretId.String())
+}
@@ -7,13 +7,19 @@
 package keymanager
 
 import (
+	"bytes"
+	"context"
+	"encoding/base64"
 	"testing"
 
+	"github.com/gemalto/kmip-go/kmip14"
 	"github.com/google/uuid"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/mock"
 	"intel/kbs/v1/kmipclient"
 	"intel/kbs/v1/model"
 	"intel/kbs/v1/repository"
+	"intel/kbs/v1/repository/directory"
 	"intel/kbs/v1/repository/mocks"
 )
 
@@ -82,7 +88,7 @@ func TestRemoteManagerCreateKey(t *testing.T) {
 				store:   tt.fields.store,
 				manager: tt.fields.manager,
 			}
-			_, err := rm.CreateKey(tt.args.request)
+			_, err := rm.CreateKey(context.Background(), tt.args.request)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("RemoteManager.CreateKey() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -204,7 +210,7 @@ func TestRemoteManagerDeleteKey(t *testing.T) {
 				store:   tt.fields.store,
 				manager: tt.fields.manager,
 			}
-			if err := rm.DeleteKey(tt.args.keyId); (err != nil) != tt.wantErr {
+			if err := rm.DeleteKey(context.Background(), tt.args.keyId); (err != nil) != tt.wantErr {
 				t.Errorf("RemoteManager.DeleteKey() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
@@ -271,6 +277,13 @@ func TestRemoteManagerRegisterKey(t *testing.T) {
 
 	mockClient := kmipclient.NewMockKmipClient()
 	mockClient.On("CreateSymmetricKey", mock.Anything, mock.Anything).Return("1", nil)
+	mockClient.On("GetAttributes", "1").Return(&kmipclient.ObjectAttributes{
+		UniqueIdentifier:       "1",
+		ObjectType:             kmip14.ObjectTypeSymmetricKey,
+		CryptographicAlgorithm: kmip14.CryptographicAlgorithmAES,
+		CryptographicLength:    256,
+		State:                  kmip14.StateActive,
+	}, nil)
 	keyManager := NewKmipManager(mockClient)
 
 	keyStore = mocks.NewFakeKeyStore()
@@ -314,7 +327,7 @@ func TestRemoteManagerRegisterKey(t *testing.T) {
 				store:   tt.fields.store,
 				manager: tt.fields.manager,
 			}
-			_, err := rm.RegisterKey(tt.args.request)
+			_, err := rm.RegisterKey(context.Background(), tt.args.request)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("RemoteManager.RegisterKey() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -323,6 +336,59 @@ func TestRemoteManagerRegisterKey(t *testing.T) {
 	}
 }
 
+func TestRemoteManagerDiscoverKeys(t *testing.T) {
+
+	keyStore := mocks.NewFakeKeyStore()
+	registeredID := uuid.New()
+	keyStore.KeyStore[registeredID] = &model.KeyAttributes{
+		ID:         registeredID,
+		Algorithm:  "AES",
+		KeyLength:  256,
+		KmipKeyID:  "5",
+		KeyManager: "hsm",
+	}
+
+	mockClient := kmipclient.NewMockKmipClient()
+	mockClient.On("Locate", mock.Anything).Return([]kmipclient.ObjectAttributes{
+		{
+			UniqueIdentifier:       "5",
+			ObjectType:             kmip14.ObjectTypeSymmetricKey,
+			CryptographicAlgorithm: kmip14.CryptographicAlgorithmAES,
+			CryptographicLength:    256,
+			State:                  kmip14.StateActive,
+		},
+		{
+			UniqueIdentifier:       "6",
+			ObjectType:             kmip14.ObjectTypeSymmetricKey,
+			CryptographicAlgorithm: kmip14.CryptographicAlgorithmAES,
+			CryptographicLength:    128,
+			State:                  kmip14.StateActive,
+		},
+	}, nil)
+	multiKeyManager := NewMultiKeyManager("hsm")
+	multiKeyManager.AddBackend("hsm", "kmip", NewKmipManager(mockClient))
+
+	rm := NewRemoteManager(keyStore, multiKeyManager)
+	objects, err := rm.DiscoverKeys(context.Background(), &model.KmipObjectFilterCriteria{})
+	if err != nil {
+		t.Fatalf("RemoteManager.DiscoverKeys() error = %v", err)
+	}
+	if len(objects) != 2 {
+		t.Fatalf("RemoteManager.DiscoverKeys() returned %d keys, want 2", len(objects))
+	}
+	if objects[0].KeyID == nil || *objects[0].KeyID != registeredID || objects[0].KeyManager != "hsm" {
+		t.Errorf("RemoteManager.DiscoverKeys() registered key = %+v, want key ID %s", objects[0], registeredID)
+	}
+	if objects[1].KeyID != nil {
+		t.Errorf("RemoteManager.DiscoverKeys() unregistered key has key ID %s", objects[1].KeyID)
+	}
+
+	rm = NewRemoteManager(keyStore, NewVaultTransitManager(nil))
+	if _, err := rm.DiscoverKeys(context.Background(), &model.KmipObjectFilterCriteria{}); err != ErrKeyDiscoveryNotSupported {
+		t.Errorf("RemoteManager.DiscoverKeys() error = %v, want %v", err, ErrKeyDiscoveryNotSupported)
+	}
+}
+
 func TestRemoteManagerTransferKey(t *testing.T) {
 
 	var keyStore *mocks.MockKeyStore
@@ -365,7 +431,7 @@ func TestRemoteManagerTransferKey(t *testing.T) {
 				store:   tt.fields.store,
 				manager: tt.fields.manager,
 			}
-			_, err := rm.TransferKey(tt.args.keyId)
+			_, err := rm.TransferKey(context.Background(), tt.args.keyId)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("RemoteManager.TransferKey() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -406,3 +472,76 @@ func TestNewRemoteManager(t *testing.T) {
 		})
 	}
 }
+
+func TestRemoteManagerSecrets(t *testing.T) {
+
+	remoteManager := NewRemoteManager(mocks.NewFakeKeyStore(), newTestLocalManager(t, t.TempDir()))
+	policyId := uuid.New()
+	data := []byte("secret-database-password")
+
+	request := &model.SecretRequest{
+		Data:             base64.StdEncoding.EncodeToString(data),
+		ContentType:      "text/plain",
+		TransferPolicyID: policyId,
+	}
+	secret, err := remoteManager.CreateSecret(context.Background(), request, data)
+	if err != nil {
+		t.Fatalf("CreateSecret() error = %v", err)
+	}
+	if secret.Size != len(data) || secret.ContentType != "text/plain" || secret.TransferLink != "/kbs/v1/secrets/"+secret.ID.String()+"/transfer" {
+		t.Errorf("CreateSecret() = %+v", secret)
+	}
+
+	if _, err := remoteManager.RetrieveSecret(secret.ID); err != nil {
+		t.Errorf("RetrieveSecret() error = %v", err)
+	}
+	transferred, err := remoteManager.TransferSecret(context.Background(), secret.ID)
+	if err != nil || !bytes.Equal(transferred, data) {
+		t.Errorf("TransferSecret() = %q, %v, want %q", transferred, err, data)
+	}
+	if _, err := remoteManager.WrapKey(context.Background(), secret.ID, nil); !errors.Is(err, ErrKeyWrapNotSupported) {
+		t.Errorf("WrapKey() error = %v, want ErrKeyWrapNotSupported", err)
+	}
+
+	// secrets are not visible through the key methods, keys not through the secret methods
+	if _, err := remoteManager.RetrieveKey(secret.ID); err == nil || err.Error() != directory.RecordNotFound {
+		t.Errorf("RetrieveKey() error = %v, want %s", err, directory.RecordNotFound)
+	}
+	if _, err := remoteManager.TransferKey(context.Background(), secret.ID); err == nil || err.Error() != directory.RecordNotFound {
+		t.Errorf("TransferKey() error = %v, want %s", err, directory.RecordNotFound)
+	}
+	keys, err := remoteManager.SearchKeys(nil)
+	if err != nil {
+		t.Fatalf("SearchKeys() error = %v", err)
+	}
+	for _, key := range keys {
+		if key.ID == secret.ID {
+			t.Errorf("SearchKeys() returned secret %s", secret.ID)
+		}
+	}
+	if _, err := remoteManager.RetrieveSecret(uuid.MustParse("ee37c360-7eae-4250-a677-6ee12adce8e2")); err == nil {
+		t.Error("RetrieveSecret() of a key should fail")
+	}
+
+	secrets, err := remoteManager.SearchSecrets(&model.SecretFilterCriteria{ContentType: "text/plain"})
+	if err != nil || len(secrets) != 1 || secrets[0].ID != secret.ID {
+		t.Errorf("SearchSecrets() = %v, %v, want secret %s", secrets, err, secret.ID)
+	}
+	secrets, err = remoteManager.SearchSecrets(&model.SecretFilterCriteria{ContentType: "application/json"})
+	if err != nil || len(secrets) != 0 {
+		t.Errorf("SearchSecrets() = %v, %v, want no secrets", secrets, err)
+	}
+
+	newPolicyId := uuid.New()
+	updated, err := remoteManager.UpdateSecret(&model.SecretUpdateRequest{SecretId: secret.ID, TransferPolicyID: newPolicyId})
+	if err != nil || updated.TransferPolicyID != newPolicyId {
+		t.Errorf("UpdateSecret() = %v, %v", updated, err)
+	}
+
+	if err := remoteManager.DeleteSecret(context.Background(), secret.ID); err != nil {
+		t.Errorf("DeleteSecret() error = %v", err)
+	}
+	if _, err := remoteManager.RetrieveSecret(secret.ID); err == nil {
+		t.Error("RetrieveSecret() of a deleted secret should fail")
+	}
+}
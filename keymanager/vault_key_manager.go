@@ -7,12 +7,14 @@
 package keymanager
 
 import (
+	"context"
 	"crypto"
+	"crypto/ecdh"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
-	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
 	log "github.com/sirupsen/logrus"
@@ -28,20 +30,32 @@ import (
 )
 
 type VaultManager struct {
-	client vaultclient.VaultClient
+	client keyMaterialStore
 }
 
-func (vm *VaultManager) CreateKey(request *model.KeyRequest) (*model.KeyAttributes, error) {
+// keyMaterialStore stores key attributes together with their key material, it is implemented by
+// the vault client and the local keystore
+type keyMaterialStore interface {
+	CreateKey(*model.KeyAttributes) error
+	DeleteKey(id string) error
+	GetKey(id string) ([]byte, error)
+}
+
+func NewVaultManager(c vaultclient.VaultClient) *VaultManager {
+	return &VaultManager{client: c}
+}
+
+func (vm *VaultManager) CreateKey(_ context.Context, request *model.KeyRequest) (*model.KeyAttributes, error) {
 	keyAttributes := &model.KeyAttributes{
 		Algorithm: request.KeyInfo.Algorithm,
 	}
 
 	var err error
-	if request.KeyInfo.Algorithm == constant.CRYPTOALGAES {
-		keyBytes, err := generateAESKey(request.KeyInfo.KeyLength)
+	if constant.SymmetricAlgorithms[request.KeyInfo.Algorithm] {
+		keyBytes, err := generateSymmetricKey(request.KeyInfo.KeyLength)
 		defer crypt.ZeroizeByteArray(keyBytes)
 		if err != nil {
-			return nil, errors.Wrap(err, "Could not generate AES key")
+			return nil, errors.Wrapf(err, "Could not generate %s key", request.KeyInfo.Algorithm)
 		}
 
 		keyAttributes.KeyLength = request.KeyInfo.KeyLength
@@ -49,26 +63,40 @@ func (vm *VaultManager) CreateKey(request *model.KeyRequest) (*model.KeyAttribut
 	} else {
 		var public crypto.PublicKey
 		var private crypto.PrivateKey
-		if request.KeyInfo.Algorithm == constant.CRYPTOALGRSA {
+		switch request.KeyInfo.Algorithm {
+		case constant.CRYPTOALGRSA:
 			private, public, err = generateRSAKeyPair(request.KeyInfo.KeyLength)
 			if err != nil {
 				return nil, errors.Wrap(err, "Could not generate RSA keypair")
 			}
 			keyAttributes.KeyLength = request.KeyInfo.KeyLength
-		} else {
+		case constant.CRYPTOALGEC:
 			private, public, err = generateECKeyPair(request.KeyInfo.CurveType)
 			if err != nil {
 				return nil, errors.Wrap(err, "Could not generate EC keypair")
 			}
 			keyAttributes.CurveType = request.KeyInfo.CurveType
+		case constant.CRYPTOALGED25519:
+			public, private, err = ed25519.GenerateKey(rand.Reader)
+			if err != nil {
+				return nil, errors.Wrap(err, "Could not generate Ed25519 keypair")
+			}
+		case constant.CRYPTOALGX25519:
+			x25519Key, err := ecdh.X25519().GenerateKey(rand.Reader)
+			if err != nil {
+				return nil, errors.Wrap(err, "Could not generate X25519 keypair")
+			}
+			private, public = x25519Key, x25519Key.PublicKey()
+		default:
+			return nil, errors.Errorf("%s algorithm is not supported", request.KeyInfo.Algorithm)
 		}
-		privateKeyBytes, err := x509.MarshalPKCS8PrivateKey(private)
+		privateKeyBytes, err := crypt.MarshalPKCS8PrivateKey(private)
 		defer crypt.ZeroizeByteArray(privateKeyBytes)
 		if err != nil {
 			return nil, errors.Wrap(err, "failed to marshal private key")
 		}
 
-		publicKeyBytes, err := x509.MarshalPKIXPublicKey(public)
+		publicKeyBytes, err := crypt.MarshalPKIXPublicKey(public)
 		defer crypt.ZeroizeByteArray(publicKeyBytes)
 		if err != nil {
 			return nil, errors.Wrap(err, "failed to marshal public key")
@@ -96,7 +124,7 @@ func (vm *VaultManager) CreateKey(request *model.KeyRequest) (*model.KeyAttribut
 	return keyAttributes, nil
 }
 
-func (vm *VaultManager) DeleteKey(attributes *model.KeyAttributes) error {
+func (vm *VaultManager) DeleteKey(_ context.Context, attributes *model.KeyAttributes) error {
 	err := vm.client.DeleteKey(attributes.ID.String())
 	if err != nil {
 		log.Errorf("Error while deleting key: %s", err.Error())
@@ -105,64 +133,52 @@ func (vm *VaultManager) DeleteKey(attributes *model.KeyAttributes) error {
 	return nil
 }
 
-func (vm *VaultManager) RegisterKey(request *model.KeyRequest) (*model.KeyAttributes, error) {
+func (vm *VaultManager) RegisterKey(_ context.Context, request *model.KeyRequest) (*model.KeyAttributes, error) {
 	if request.KeyInfo.KeyData == "" {
 		return nil, errors.New("key_string cannot be empty for register operation")
 	}
 
 	var key, publicKey, privateKey string
-	if request.KeyInfo.Algorithm == constant.CRYPTOALGAES {
+	// symmetric keys and opaque secrets are stored as their data
+	if constant.SymmetricAlgorithms[request.KeyInfo.Algorithm] {
 		key = request.KeyInfo.KeyData
 	} else {
 
-		var public crypto.PublicKey
-		var private crypto.PrivateKey
 		decodePrivateKey, err := base64.StdEncoding.DecodeString(request.KeyInfo.KeyData)
 		if err != nil {
 			return nil, errors.Wrap(err, "Failed to decode keydata")
 		}
-		private, err = crypt.GetPrivateKeyFromPem(decodePrivateKey)
+		private, err := crypt.GetPrivateKeyFromPem(decodePrivateKey)
 		if err != nil {
 			return nil, errors.Wrap(err, "Failed to decode private key")
 		}
-
-		if request.KeyInfo.Algorithm == constant.CRYPTOALGRSA {
-			rsaKey, ok := private.(*rsa.PrivateKey)
-			if !ok {
-				return nil, errors.Wrap(err, "Private key in request is not RSA key")
-			}
-
-			public = &rsaKey.PublicKey
-		} else {
-			ecKey, ok := private.(*ecdsa.PrivateKey)
-			if !ok {
-				return nil, errors.Wrap(err, "Private key in request is not EC key")
-			}
-
-			public = &ecKey.PublicKey
+		public, err := publicKeyOf(request.KeyInfo.Algorithm, private)
+		if err != nil {
+			return nil, err
 		}
 
-		privateKeyBytes, err := x509.MarshalPKCS8PrivateKey(private)
+		privateKeyBytes, err := crypt.MarshalPKCS8PrivateKey(private)
 		if err != nil {
 			return nil, errors.Wrap(err, "failed to marshal private key")
 		}
 		privateKey = base64.StdEncoding.EncodeToString(privateKeyBytes)
 
-		publicKeyBytes, err := x509.MarshalPKIXPublicKey(public)
+		publicKeyBytes, err := crypt.MarshalPKIXPublicKey(public)
 		if err != nil {
 			return nil, errors.Wrap(err, "failed to marshal public key")
 		}
 		publicKey = base64.StdEncoding.EncodeToString(publicKeyBytes)
 	}
 
-	newUuid, err := uuid.NewRandom()
+	newUuid, err := newKeyID(request)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to create new UUID")
+		return nil, err
 	}
 	keyAttributes := &model.KeyAttributes{
 		ID:         newUuid,
 		Algorithm:  request.KeyInfo.Algorithm,
 		KeyLength:  request.KeyInfo.KeyLength,
+		CurveType:  request.KeyInfo.CurveType,
 		KeyData:    key,
 		PublicKey:  publicKey,
 		PrivateKey: privateKey,
@@ -180,7 +196,7 @@ func (vm *VaultManager) RegisterKey(request *model.KeyRequest) (*model.KeyAttrib
 	return keyAttributes, nil
 }
 
-func (vm *VaultManager) TransferKey(attributes *model.KeyAttributes) ([]byte, error) {
+func (vm *VaultManager) TransferKey(_ context.Context, attributes *model.KeyAttributes) ([]byte, error) {
 	id := attributes.ID
 	var key string
 
@@ -194,18 +210,40 @@ func (vm *VaultManager) TransferKey(attributes *model.KeyAttributes) ([]byte, er
 		return nil, err
 	}
 
-	if attributes.Algorithm == constant.CRYPTOALGAES {
+	if constant.SymmetricAlgorithms[attributes.Algorithm] {
 		key = keyAttributes.KeyData
-	} else if attributes.Algorithm == constant.CRYPTOALGRSA {
-		key = keyAttributes.PrivateKey
 	} else {
-		key = attributes.PrivateKey
+		key = keyAttributes.PrivateKey
 	}
 
 	return base64.StdEncoding.DecodeString(key)
 }
 
-func generateAESKey(length int) ([]byte, error) {
+// PublicKey returns the public key stored with the private key
+func (vm *VaultManager) PublicKey(_ context.Context, attributes *model.KeyAttributes) (crypto.PublicKey, error) {
+
+	keyInfo, err := vm.client.GetKey(attributes.ID.String())
+	if err != nil {
+		return nil, err
+	}
+	var keyAttributes model.KeyAttributes
+	err = json.Unmarshal(keyInfo, &keyAttributes)
+	if err != nil {
+		return nil, err
+	}
+	if keyAttributes.PublicKey == "" {
+		return nil, ErrNoPublicKey
+	}
+
+	publicKeyBytes, err := base64.StdEncoding.DecodeString(keyAttributes.PublicKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode public key")
+	}
+	return crypt.ParsePKIXPublicKey(publicKeyBytes)
+}
+
+// generateSymmetricKey generates an AES, HMAC or ChaCha20 key of the length in bits
+func generateSymmetricKey(length int) ([]byte, error) {
 	return crypt.GetDerivedKey(length / 8)
 }
 
@@ -224,19 +262,17 @@ func generateRSAKeyPair(length int) (crypto.PrivateKey, crypto.PublicKey, error)
 }
 
 func generateECKeyPair(curveType string) (crypto.PrivateKey, crypto.PublicKey, error) {
-	var curve elliptic.Curve
-	switch curveType {
-	case "prime256v1", "secp256r1":
-		curve = elliptic.P256()
-	case "secp384r1":
-		curve = elliptic.P384()
-	case "secp521r1":
-		curve = elliptic.P521()
-	default:
-		return nil, nil, errors.New("unsupported curve type")
+	curve, err := ellipticCurve(curveType)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	private, err := ecdsa.GenerateKey(curve, rand.Reader)
+	var private *ecdsa.PrivateKey
+	if curveType == constant.CurveSecp256k1 {
+		private, err = crypt.GenerateSecp256k1Key()
+	} else {
+		private, err = ecdsa.GenerateKey(curve, rand.Reader)
+	}
 	if err != nil {
 		return nil, nil, err
 	}
@@ -248,3 +284,43 @@ func generateECKeyPair(curveType string) (crypto.PrivateKey, crypto.PublicKey, e
 
 	return private, public, nil
 }
+
+// ellipticCurve returns the curve of a supported EC curve type
+func ellipticCurve(curveType string) (elliptic.Curve, error) {
+	switch curveType {
+	case "prime256v1", "secp256r1":
+		return elliptic.P256(), nil
+	case "secp384r1":
+		return elliptic.P384(), nil
+	case "secp521r1":
+		return elliptic.P521(), nil
+	case constant.CurveSecp256k1:
+		return crypt.Secp256k1(), nil
+	default:
+		return nil, errors.New("unsupported curve type")
+	}
+}
+
+// publicKeyOf returns the public key of a private key of the algorithm, or an error when the
+// private key is of another algorithm
+func publicKeyOf(algorithm string, private crypto.PrivateKey) (crypto.PublicKey, error) {
+	switch private := private.(type) {
+	case *rsa.PrivateKey:
+		if algorithm == constant.CRYPTOALGRSA {
+			return &private.PublicKey, nil
+		}
+	case *ecdsa.PrivateKey:
+		if algorithm == constant.CRYPTOALGEC {
+			return &private.PublicKey, nil
+		}
+	case ed25519.PrivateKey:
+		if algorithm == constant.CRYPTOALGED25519 {
+			return private.Public(), nil
+		}
+	case *ecdh.PrivateKey:
+		if algorithm == constant.CRYPTOALGX25519 && private.Curve() == ecdh.X25519() {
+			return private.PublicKey(), nil
+		}
+	}
+	return nil, errors.Errorf("Private key in request is not %s key", algorithm)
+}
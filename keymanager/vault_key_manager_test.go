@@ -7,6 +7,7 @@
 package keymanager
 
 import (
+	"context"
 	"encoding/json"
 	"github.com/stretchr/testify/mock"
 	"intel/kbs/v1/model"
@@ -99,7 +100,7 @@ func TestVaultManagerCreateKey(t *testing.T) {
 			mockClient := vaultclient.NewMockVaultClient()
 			mockClient.On("CreateKey", mock.Anything).Return(nil)
 			keyManager := &VaultManager{mockClient}
-			_, err := keyManager.CreateKey(keyRequest)
+			_, err := keyManager.CreateKey(context.Background(), keyRequest)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("CreateKey() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -135,7 +136,7 @@ func TestVaultManagerDeleteKey(t *testing.T) {
 			mockClient := vaultclient.NewMockVaultClient()
 			mockClient.On("DeleteKey", mock.Anything).Return(nil)
 			keyManager := &VaultManager{mockClient}
-			err := keyManager.DeleteKey(keyAttributes)
+			err := keyManager.DeleteKey(context.Background(), keyAttributes)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("DeleteKey() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -192,7 +193,7 @@ func TestVaultManagerRegisterKey(t *testing.T) {
 			mockClient := vaultclient.NewMockVaultClient()
 			mockClient.On("CreateKey", mock.Anything).Return(nil)
 			keyManager := &VaultManager{mockClient}
-			_, err := keyManager.RegisterKey(keyRequest)
+			_, err := keyManager.RegisterKey(context.Background(), keyRequest)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("RegisterKey() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -241,7 +242,7 @@ func TestVaultManagerTransferKey(t *testing.T) {
 			mockClient := vaultclient.NewMockVaultClient()
 			mockClient.On("GetKey", mock.Anything).Return(keyAttr, nil)
 			keyManager := &VaultManager{mockClient}
-			_, err := keyManager.TransferKey(keyAttributes)
+			_, err := keyManager.TransferKey(context.Background(), keyAttributes)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("TransferKey() error = %v, wantErr %v", err, tt.wantErr)
 				return
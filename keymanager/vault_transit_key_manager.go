@@ -0,0 +1,176 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package keymanager
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"intel/kbs/v1/constant"
+	"intel/kbs/v1/crypt"
+	"intel/kbs/v1/model"
+	"intel/kbs/v1/vaultclient"
+)
+
+// VaultTransitManager keeps keys in a vault transit secrets engine. Keys are named after their
+// key ID and are released wrapped to the workload public key, so the KBS does not see the key
+// material during a key transfer.
+type VaultTransitManager struct {
+	client vaultclient.TransitClient
+}
+
+func NewVaultTransitManager(client vaultclient.TransitClient) *VaultTransitManager {
+	return &VaultTransitManager{client}
+}
+
+func (vtm *VaultTransitManager) CreateKey(_ context.Context, request *model.KeyRequest) (*model.KeyAttributes, error) {
+	keyType, err := transitKeyType(request.KeyInfo)
+	if err != nil {
+		return nil, err
+	}
+	id, err := newKeyID(request)
+	if err != nil {
+		return nil, err
+	}
+	if err := vtm.client.CreateKey(id.String(), keyType); err != nil {
+		return nil, err
+	}
+	return newTransitKeyAttributes(request, id), nil
+}
+
+func (vtm *VaultTransitManager) DeleteKey(_ context.Context, attributes *model.KeyAttributes) error {
+	return vtm.client.DeleteKey(attributes.ID.String())
+}
+
+func (vtm *VaultTransitManager) RegisterKey(_ context.Context, request *model.KeyRequest) (*model.KeyAttributes, error) {
+	if request.KeyInfo.KeyData == "" {
+		return nil, errors.New("key_data must be provided to register a key with vault transit")
+	}
+	keyType, err := transitKeyType(request.KeyInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	keyBytes, err := base64.StdEncoding.DecodeString(request.KeyInfo.KeyData)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to decode keydata")
+	}
+	defer crypt.ZeroizeByteArray(keyBytes)
+
+	// transit imports asymmetric keys in PKCS#8 format
+	keyMaterial := keyBytes
+	if request.KeyInfo.Algorithm != constant.CRYPTOALGAES {
+		privateKey, err := crypt.GetPrivateKeyFromPem(keyBytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to decode private key")
+		}
+		keyMaterial, err = x509.MarshalPKCS8PrivateKey(privateKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to marshal private key")
+		}
+		defer crypt.ZeroizeByteArray(keyMaterial)
+	}
+
+	id, err := newKeyID(request)
+	if err != nil {
+		return nil, err
+	}
+	if err := vtm.client.ImportKey(id.String(), keyType, keyMaterial); err != nil {
+		return nil, err
+	}
+	return newTransitKeyAttributes(request, id), nil
+}
+
+// TransferKey exports the plaintext key material for backup and key migration. Key transfers,
+// to workloads and to users, use WrapKey since KeyWrappingEnforced is set.
+func (vtm *VaultTransitManager) TransferKey(_ context.Context, attributes *model.KeyAttributes) ([]byte, error) {
+	exportType := vaultclient.TransitExportEncryptionKey
+	if attributes.Algorithm == constant.CRYPTOALGEC {
+		// transit ecdsa keys are signing keys only
+		exportType = vaultclient.TransitExportSigningKey
+	}
+	return vtm.client.ExportKey(attributes.ID.String(), exportType)
+}
+
+// KeyWrappingEnforced is always set, transit keys are released wrapped inside vault
+func (vtm *VaultTransitManager) KeyWrappingEnforced(*model.KeyAttributes) bool {
+	return true
+}
+
+func (vtm *VaultTransitManager) WrapKey(_ context.Context, attributes *model.KeyAttributes, publicKey crypto.PublicKey) ([]byte, error) {
+	rsaPublicKey, ok := publicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, ErrWrappingKeyNotSupported
+	}
+	return vtm.client.ExportWrappedKey(attributes.ID.String(), rsaPublicKey)
+}
+
+// Encrypt encrypts plaintext under an AES key inside vault
+func (vtm *VaultTransitManager) Encrypt(_ context.Context, attributes *model.KeyAttributes, plaintext []byte) ([]byte, error) {
+	if attributes.Algorithm != constant.CRYPTOALGAES {
+		return nil, ErrEncryptNotSupported
+	}
+	return vtm.client.Encrypt(attributes.ID.String(), plaintext)
+}
+
+// Decrypt decrypts a ciphertext returned by Encrypt inside vault
+func (vtm *VaultTransitManager) Decrypt(_ context.Context, attributes *model.KeyAttributes, ciphertext []byte) ([]byte, error) {
+	if attributes.Algorithm != constant.CRYPTOALGAES {
+		return nil, ErrEncryptNotSupported
+	}
+	return vtm.client.Decrypt(attributes.ID.String(), ciphertext)
+}
+
+func newTransitKeyAttributes(request *model.KeyRequest, id uuid.UUID) *model.KeyAttributes {
+	keyAttributes := &model.KeyAttributes{
+		ID:               id,
+		Algorithm:        request.KeyInfo.Algorithm,
+		TransferPolicyId: request.TransferPolicyID,
+		CreatedAt:        time.Now().UTC(),
+	}
+	if request.KeyInfo.Algorithm == constant.CRYPTOALGEC {
+		keyAttributes.CurveType = request.KeyInfo.CurveType
+	} else {
+		keyAttributes.KeyLength = request.KeyInfo.KeyLength
+	}
+	return keyAttributes
+}
+
+// transitKeyType returns the transit key type matching the algorithm and size of a key
+func transitKeyType(keyInfo *model.KeyInfo) (string, error) {
+	switch keyInfo.Algorithm {
+	case constant.CRYPTOALGAES:
+		switch keyInfo.KeyLength {
+		case 128:
+			return "aes128-gcm96", nil
+		case 256:
+			return "aes256-gcm96", nil
+		}
+	case constant.CRYPTOALGRSA:
+		switch keyInfo.KeyLength {
+		case 2048, 3072, 4096:
+			return "rsa-" + strconv.Itoa(keyInfo.KeyLength), nil
+		}
+	case constant.CRYPTOALGEC:
+		switch keyInfo.CurveType {
+		case "prime256v1", "secp256r1":
+			return "ecdsa-p256", nil
+		case "secp384r1":
+			return "ecdsa-p384", nil
+		case "secp521r1":
+			return "ecdsa-p521", nil
+		}
+	}
+	return "", errors.Errorf("%s key of length %d and curve %q is not supported by vault transit", keyInfo.Algorithm, keyInfo.KeyLength, keyInfo.CurveType)
+}
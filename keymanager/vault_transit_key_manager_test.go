@@ -0,0 +1,183 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package keymanager
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"intel/kbs/v1/model"
+	"intel/kbs/v1/vaultclient"
+)
+
+func TestVaultTransitManagerCreateKey(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		keyInfo     model.KeyInfo
+		wantKeyType string
+		wantErr     bool
+	}{
+		{
+			name:        "create AES key",
+			keyInfo:     model.KeyInfo{Algorithm: "AES", KeyLength: 256},
+			wantKeyType: "aes256-gcm96",
+		},
+		{
+			name:        "create RSA key",
+			keyInfo:     model.KeyInfo{Algorithm: "RSA", KeyLength: 3072},
+			wantKeyType: "rsa-3072",
+		},
+		{
+			name:        "create EC key",
+			keyInfo:     model.KeyInfo{Algorithm: "EC", CurveType: "secp384r1"},
+			wantKeyType: "ecdsa-p384",
+		},
+		{
+			name:    "negative test - AES key length not supported",
+			keyInfo: model.KeyInfo{Algorithm: "AES", KeyLength: 192},
+			wantErr: true,
+		},
+		{
+			name:    "negative test - curve type not supported",
+			keyInfo: model.KeyInfo{Algorithm: "EC", CurveType: "primeinvalid"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			keyInfo := tt.keyInfo
+			mockClient := vaultclient.NewMockTransitClient()
+			mockClient.On("CreateKey", mock.Anything, tt.wantKeyType).Return(nil)
+			keyManager := NewVaultTransitManager(mockClient)
+			keyAttributes, err := keyManager.CreateKey(context.Background(), &model.KeyRequest{KeyInfo: &keyInfo})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CreateKey() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr {
+				mockClient.AssertCalled(t, "CreateKey", keyAttributes.ID.String(), tt.wantKeyType)
+			}
+		})
+	}
+}
+
+func TestVaultTransitManagerRegisterKey(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		keyInfo model.KeyInfo
+		wantErr bool
+	}{
+		{
+			name:    "register AES key",
+			keyInfo: model.KeyInfo{Algorithm: "AES", KeyLength: 256, KeyData: "urNoe6OU/2dqvYPP40FTVEgIPhIJ9Za4hu9keAwtfC4="},
+		},
+		{
+			name:    "negative test - key data missing",
+			keyInfo: model.KeyInfo{Algorithm: "AES", KeyLength: 256, KmipKeyID: "1"},
+			wantErr: true,
+		},
+		{
+			name:    "negative test - invalid key data",
+			keyInfo: model.KeyInfo{Algorithm: "RSA", KeyLength: 2048, KeyData: "aW52YWxpZA=="},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			keyInfo := tt.keyInfo
+			keyId := uuid.New()
+			mockClient := vaultclient.NewMockTransitClient()
+			mockClient.On("ImportKey", keyId.String(), mock.Anything, mock.Anything).Return(nil)
+			keyManager := NewVaultTransitManager(mockClient)
+			keyAttributes, err := keyManager.RegisterKey(context.Background(), &model.KeyRequest{KeyId: keyId, KeyInfo: &keyInfo})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("RegisterKey() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && keyAttributes.ID != keyId {
+				t.Errorf("RegisterKey() ID = %v, want %v", keyAttributes.ID, keyId)
+			}
+		})
+	}
+}
+
+func TestVaultTransitManagerTransferKey(t *testing.T) {
+
+	keyAttributes := &model.KeyAttributes{ID: uuid.New(), Algorithm: "EC", CurveType: "secp256r1"}
+	mockClient := vaultclient.NewMockTransitClient()
+	mockClient.On("ExportKey", keyAttributes.ID.String(), vaultclient.TransitExportSigningKey).Return([]byte("key"), nil)
+	keyManager := NewVaultTransitManager(mockClient)
+	if _, err := keyManager.TransferKey(context.Background(), keyAttributes); err != nil {
+		t.Errorf("TransferKey() error = %v", err)
+	}
+}
+
+func TestVaultTransitManagerWrapKey(t *testing.T) {
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyAttributes := &model.KeyAttributes{ID: uuid.New(), Algorithm: "AES", KeyLength: 256}
+	mockClient := vaultclient.NewMockTransitClient()
+	mockClient.On("ExportWrappedKey", keyAttributes.ID.String(), &privateKey.PublicKey).Return([]byte("wrapped"), nil)
+
+	var keyManager KeyManager = NewVaultTransitManager(mockClient)
+	keyWrapper, ok := keyManager.(KeyWrapper)
+	if !ok {
+		t.Fatal("VaultTransitManager does not implement KeyWrapper")
+	}
+	wrapped, err := keyWrapper.WrapKey(context.Background(), keyAttributes, &privateKey.PublicKey)
+	if err != nil || string(wrapped) != "wrapped" {
+		t.Errorf("WrapKey() = %q, %v", wrapped, err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keyWrapper.WrapKey(context.Background(), keyAttributes, &ecKey.PublicKey); err != ErrWrappingKeyNotSupported {
+		t.Errorf("WrapKey() error = %v, want %v", err, ErrWrappingKeyNotSupported)
+	}
+}
+
+func TestVaultTransitManagerEncrypt(t *testing.T) {
+
+	keyAttributes := &model.KeyAttributes{ID: uuid.New(), Algorithm: "AES", KeyLength: 256}
+	mockClient := vaultclient.NewMockTransitClient()
+	mockClient.On("Encrypt", keyAttributes.ID.String(), []byte("plaintext")).Return([]byte("vault:v1:ciphertext"), nil)
+	mockClient.On("Decrypt", keyAttributes.ID.String(), []byte("vault:v1:ciphertext")).Return([]byte("plaintext"), nil)
+
+	var keyManager KeyManager = NewVaultTransitManager(mockClient)
+	keyEncrypter, ok := keyManager.(KeyEncrypter)
+	if !ok {
+		t.Fatal("VaultTransitManager does not implement KeyEncrypter")
+	}
+	ciphertext, err := keyEncrypter.Encrypt(context.Background(), keyAttributes, []byte("plaintext"))
+	if err != nil || string(ciphertext) != "vault:v1:ciphertext" {
+		t.Errorf("Encrypt() = %q, %v", ciphertext, err)
+	}
+	plaintext, err := keyEncrypter.Decrypt(context.Background(), keyAttributes, ciphertext)
+	if err != nil || string(plaintext) != "plaintext" {
+		t.Errorf("Decrypt() = %q, %v", plaintext, err)
+	}
+
+	ecAttributes := &model.KeyAttributes{ID: uuid.New(), Algorithm: "EC", CurveType: "secp256r1"}
+	if _, err := keyEncrypter.Encrypt(context.Background(), ecAttributes, []byte("plaintext")); err != ErrEncryptNotSupported {
+		t.Errorf("Encrypt() error = %v, want %v", err, ErrEncryptNotSupported)
+	}
+}
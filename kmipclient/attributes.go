@@ -0,0 +1,196 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package kmipclient
+
+import (
+	"context"
+
+	"github.com/gemalto/kmip-go"
+	"github.com/gemalto/kmip-go/kmip14"
+	"github.com/gemalto/kmip-go/kmip20"
+	"github.com/gemalto/kmip-go/ttlv"
+	"github.com/pkg/errors"
+)
+
+// attributeNames are the kmip 1.4 attributes read from the server to validate and discover keys
+var attributeNames = []string{
+	kmip14.TagObjectType.CanonicalName(),
+	kmip14.TagCryptographicAlgorithm.CanonicalName(),
+	kmip14.TagCryptographicLength.CanonicalName(),
+	kmip14.TagState.CanonicalName(),
+	kmip14.TagName.CanonicalName(),
+	kmip14.TagLink.CanonicalName(),
+}
+
+// LocateFilter selects the managed objects returned by Locate. Zero values match any object.
+type LocateFilter struct {
+	Name                   string
+	ObjectType             kmip14.ObjectType
+	CryptographicAlgorithm kmip14.CryptographicAlgorithm
+	CryptographicLength    int
+	MaximumItems           int
+}
+
+// GetAttributes retrieves the type, algorithm, length, state, names and links of a managed object
+func (kc *kmipClient) GetAttributes(ctx context.Context, keyID string) (*ObjectAttributes, error) {
+
+	batchItem, decoder, err := kc.SendRequest(ctx, kc.getAttributesPayload(keyID), kmip14.OperationGetAttributes)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to perform get attributes operation")
+	}
+
+	return kc.decodeAttributes(decoder, batchItem.ResponsePayload)
+}
+
+// Locate finds the managed objects matching the filter and retrieves their attributes. The
+// attributes are requested in batches of max-batch-items objects.
+func (kc *kmipClient) Locate(ctx context.Context, filter LocateFilter) ([]ObjectAttributes, error) {
+
+	var locateRequestPayload interface{}
+	if kc.isKMIP2() {
+		attributes := LocateAttributes{
+			ObjectType:             filter.ObjectType,
+			CryptographicAlgorithm: filter.CryptographicAlgorithm,
+			CryptographicLength:    int32(filter.CryptographicLength),
+		}
+		if filter.Name != "" {
+			attributes.Name = &kmip.Name{
+				NameValue: filter.Name,
+				NameType:  kmip14.NameTypeUninterpretedTextString,
+			}
+		}
+		locateRequestPayload = LocateRequestPayloadV2{
+			MaximumItems: int32(filter.MaximumItems),
+			Attributes:   attributes,
+		}
+	} else {
+		var attributes []kmip.Attribute
+		if filter.ObjectType != 0 {
+			attributes = append(attributes, kmip.NewAttributeFromTag(kmip14.TagObjectType, 0, filter.ObjectType))
+		}
+		if filter.CryptographicAlgorithm != 0 {
+			attributes = append(attributes, kmip.NewAttributeFromTag(kmip14.TagCryptographicAlgorithm, 0, filter.CryptographicAlgorithm))
+		}
+		if filter.CryptographicLength != 0 {
+			attributes = append(attributes, kmip.NewAttributeFromTag(kmip14.TagCryptographicLength, 0, int32(filter.CryptographicLength)))
+		}
+		if filter.Name != "" {
+			attributes = append(attributes, kmip.NewAttributeFromTag(kmip14.TagName, 0, kmip.Name{
+				NameValue: filter.Name,
+				NameType:  kmip14.NameTypeUninterpretedTextString,
+			}))
+		}
+		locateRequestPayload = LocateRequestPayload{
+			MaximumItems: int32(filter.MaximumItems),
+			Attribute:    attributes,
+		}
+	}
+
+	batchItem, decoder, err := kc.SendRequest(ctx, locateRequestPayload, kmip14.OperationLocate)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to perform locate operation")
+	}
+
+	var respPayload LocateResponsePayload
+	if batchItem.ResponsePayload != nil {
+		err = decoder.DecodeValue(&respPayload, batchItem.ResponsePayload.(ttlv.TTLV))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to decode locate response payload")
+		}
+	}
+	if len(respPayload.UniqueIdentifier) == 0 {
+		return []ObjectAttributes{}, nil
+	}
+
+	batchItems := make([]kmip.RequestBatchItem, len(respPayload.UniqueIdentifier))
+	for i, keyID := range respPayload.UniqueIdentifier {
+		batchItems[i] = kmip.RequestBatchItem{
+			Operation:      kmip14.OperationGetAttributes,
+			RequestPayload: kc.getAttributesPayload(keyID),
+		}
+	}
+	responseItems, decoder, err := kc.SendBatchRequest(ctx, batchItems)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to perform get attributes operation for located objects")
+	}
+
+	objects := make([]ObjectAttributes, 0, len(responseItems))
+	for i := range responseItems {
+		attributes, err := kc.decodeAttributes(decoder, responseItems[i].ResponsePayload)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, *attributes)
+	}
+	return objects, nil
+}
+
+func (kc *kmipClient) getAttributesPayload(keyID string) GetAttributesRequestPayload {
+
+	payload := GetAttributesRequestPayload{
+		UniqueIdentifier: kmip20.UniqueIdentifierValue{
+			Text: keyID,
+		},
+	}
+	// kmip 2.0 references attributes by tag, all attributes are returned instead
+	if !kc.isKMIP2() {
+		payload.AttributeName = attributeNames
+	}
+	return payload
+}
+
+// decodeAttributes decodes a get attributes response payload. Kmip 1.4 servers return a list of
+// named attributes, kmip 2.0 servers an attributes structure.
+func (kc *kmipClient) decodeAttributes(decoder *ttlv.Decoder, responsePayload interface{}) (*ObjectAttributes, error) {
+
+	payload, ok := responsePayload.(ttlv.TTLV)
+	if !ok {
+		return nil, errors.New("unexpected get attributes response payload")
+	}
+
+	if kc.isKMIP2() {
+		var respPayload GetAttributesResponsePayloadV2
+		if err := decoder.DecodeValue(&respPayload, payload); err != nil {
+			return nil, errors.Wrap(err, "failed to decode get attributes response payload")
+		}
+		respPayload.Attributes.UniqueIdentifier = respPayload.UniqueIdentifier
+		return &respPayload.Attributes, nil
+	}
+
+	var respPayload GetAttributesResponsePayload
+	if err := decoder.DecodeValue(&respPayload, payload); err != nil {
+		return nil, errors.Wrap(err, "failed to decode get attributes response payload")
+	}
+	attributes := &ObjectAttributes{
+		UniqueIdentifier: respPayload.UniqueIdentifier,
+	}
+	for _, attribute := range respPayload.Attribute {
+		var err error
+		switch attribute.AttributeName {
+		case kmip14.TagObjectType.CanonicalName():
+			err = decoder.DecodeValue(&attributes.ObjectType, attribute.AttributeValue)
+		case kmip14.TagCryptographicAlgorithm.CanonicalName():
+			err = decoder.DecodeValue(&attributes.CryptographicAlgorithm, attribute.AttributeValue)
+		case kmip14.TagCryptographicLength.CanonicalName():
+			err = decoder.DecodeValue(&attributes.CryptographicLength, attribute.AttributeValue)
+		case kmip14.TagState.CanonicalName():
+			err = decoder.DecodeValue(&attributes.State, attribute.AttributeValue)
+		case kmip14.TagName.CanonicalName():
+			var name kmip.Name
+			err = decoder.DecodeValue(&name, attribute.AttributeValue)
+			attributes.Name = append(attributes.Name, name)
+		case kmip14.TagLink.CanonicalName():
+			var link Link
+			err = decoder.DecodeValue(&link, attribute.AttributeValue)
+			attributes.Link = append(attributes.Link, link)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to decode %s attribute", attribute.AttributeName)
+		}
+	}
+	return attributes, nil
+}
@@ -7,12 +7,16 @@
 package kmipclient
 
 import (
-	"bufio"
+	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"net"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
+	"intel/kbs/v1/config"
 	"intel/kbs/v1/constant"
 
 	"github.com/gemalto/kmip-go"
@@ -22,21 +26,43 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// ErrObjectNotFound is returned when the requested object does not exist on the kmip server
+var ErrObjectNotFound = errors.New("object not found")
+
+// ErrNoLinkedPublicKey is returned for the public key of a private key that has no public key
+// object linked to it, such as a registered private key
+var ErrNoLinkedPublicKey = errors.New("private key has no linked public key")
+
+// ErrOperationFailed is returned when the kmip server processed a request but the operation failed
+var ErrOperationFailed = errors.New("kmip operation failed")
+
 type KmipClient interface {
-	InitializeClient(string, string, string, string, string, string, string, string, string) error
-	CreateSymmetricKey(int) (string, error)
-	CreateAsymmetricKeyPair(string, string, int) (string, error)
-	DeleteKey(string) error
-	GetKey(string, string) ([]byte, error)
-	SendRequest(interface{}, kmip14.Operation) (*kmip.ResponseBatchItem, *ttlv.Decoder, error)
+	InitializeClient(*config.KmipConfig) error
+	CreateSymmetricKey(context.Context, string, int) (string, error)
+	CreateAsymmetricKeyPair(context.Context, string, string, int) (string, error)
+	RegisterKey(context.Context, string, int, []byte) (string, error)
+	RegisterWrappingKey(context.Context, []byte) (string, error)
+	GetWrappedKey(context.Context, string, string, string) ([]byte, error)
+	DeleteKey(context.Context, string) error
+	GetKey(context.Context, string, string) ([]byte, error)
+	GetPublicKey(context.Context, string) ([]byte, error)
+	GetAttributes(context.Context, string) (*ObjectAttributes, error)
+	Locate(context.Context, LocateFilter) ([]ObjectAttributes, error)
+	SendRequest(context.Context, interface{}, kmip14.Operation) (*kmip.ResponseBatchItem, *ttlv.Decoder, error)
+	SendBatchRequest(context.Context, []kmip.RequestBatchItem) ([]kmip.ResponseBatchItem, *ttlv.Decoder, error)
+	ProtocolVersion() string
+	Close() error
 }
 
 type kmipClient struct {
-	KMIPVersion   string
-	Config        tls.Config
-	requestHeader kmip.RequestHeader
-	ServerIP      string
-	ServerPort    string
+	KMIPVersion    string
+	Config         tls.Config
+	requestHeader  kmip.RequestHeader
+	ServerIP       string
+	ServerPort     string
+	requestTimeout time.Duration
+	maxBatchItems  int
+	pool           *connectionPool
 }
 
 func NewKmipClient() KmipClient {
@@ -46,12 +72,19 @@ func NewKmipClient() KmipClient {
 var cipherSuites = []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384, tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384, tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_RSA_WITH_AES_128_CBC_SHA256}
 
 // InitializeClient initializes all the values required for establishing connection to kmip server
-func (kc *kmipClient) InitializeClient(version, serverIP, serverPort, hostname, username, password, clientKeyFilePath, clientCertificateFilePath, rootCertificateFilePath string) error {
-
-	if (version != constant.KMIP14) && (version != constant.KMIP20) {
-		return errors.Errorf("kmipclient/kmipclient:InitializeClient()Invalid Kmip version %s provided", version)
+func (kc *kmipClient) InitializeClient(kmipConfig *config.KmipConfig) error {
+
+	version := kmipConfig.Version
+	serverIP := kmipConfig.ServerIP
+	serverPort := kmipConfig.ServerPort
+	hostname := kmipConfig.Hostname
+	clientKeyFilePath := kmipConfig.ClientKeyFilePath
+	clientCertificateFilePath := kmipConfig.ClientCertificateFilePath
+	rootCertificateFilePath := kmipConfig.RootCertificateFilePath
+
+	if version != "" && !isSupportedVersion(version) {
+		return errors.Errorf("kmipclient/kmipclient:InitializeClient() Invalid Kmip version %s provided, supported versions are %s", version, strings.Join(supportedVersions, ", "))
 	}
-	kc.KMIPVersion = version
 
 	if serverIP == "" {
 		return errors.New("kmipclient/kmipclient:InitializeClient() KMIP server address is not provided")
@@ -75,25 +108,15 @@ func (kc *kmipClient) InitializeClient(version, serverIP, serverPort, hostname,
 		return errors.New("kmipclient/kmipclient:InitializeClient() KMIP root certificate is not provided")
 	}
 
-	protocolVersion := kmip.ProtocolVersion{}
-	if kc.KMIPVersion == constant.KMIP20 {
-		protocolVersion.ProtocolVersionMajor = 2
-		protocolVersion.ProtocolVersionMinor = 0
-	} else {
-		protocolVersion.ProtocolVersionMajor = 1
-		protocolVersion.ProtocolVersionMinor = 4
-	}
-
-	kc.requestHeader.ProtocolVersion = protocolVersion
 	kc.requestHeader.BatchCount = 1
 
-	if username != "" && password != "" {
+	if kmipConfig.Username != "" && kmipConfig.Password != "" {
 		credential := kmip.Credential{}
 
 		credential.CredentialType = kmip14.CredentialTypeUsernameAndPassword
 		credential.CredentialValue = kmip.UsernameAndPasswordCredentialValue{
-			Username: username,
-			Password: password,
+			Username: kmipConfig.Username,
+			Password: kmipConfig.Password,
 		}
 		kc.requestHeader.Authentication = &kmip.Authentication{
 			Credential: []kmip.Credential{
@@ -131,69 +154,192 @@ func (kc *kmipClient) InitializeClient(version, serverIP, serverPort, hostname,
 		MinVersion:               tls.VersionTLS12,
 	}
 
-	log.Info("kmipclient/kmipclient:InitializeClient() Kmip client initialized")
+	kc.requestTimeout = time.Duration(kmipConfig.RequestTimeout) * time.Second
+	if kc.requestTimeout <= 0 {
+		kc.requestTimeout = constant.DefaultKmipRequestTimeout * time.Second
+	}
+	kc.maxBatchItems = kmipConfig.MaxBatchItems
+	if kc.maxBatchItems <= 0 {
+		kc.maxBatchItems = constant.DefaultKmipMaxBatchItems
+	}
+	maxConnections := kmipConfig.MaxConnections
+	if maxConnections <= 0 {
+		maxConnections = constant.DefaultKmipMaxConnections
+	}
+	idleTimeout := time.Duration(kmipConfig.IdleTimeout) * time.Second
+	if idleTimeout <= 0 {
+		idleTimeout = constant.DefaultKmipIdleTimeout * time.Second
+	}
+	if kc.pool != nil {
+		kc.pool.close()
+	}
+	kc.pool = newConnectionPool(kc.dial, maxConnections, idleTimeout)
+
+	if err := kc.negotiateVersion(context.Background(), version); err != nil {
+		kc.pool.close()
+		return errors.Wrap(err, "kmipclient/kmipclient:InitializeClient() Failed to negotiate kmip protocol version")
+	}
+
+	log.Infof("kmipclient/kmipclient:InitializeClient() Kmip client initialized with protocol version %s", kc.KMIPVersion)
 	return nil
 }
 
-// SendRequest perform send request message to kmip server and receive response messages
-func (kc *kmipClient) SendRequest(requestPayload interface{}, Operation kmip14.Operation) (*kmip.ResponseBatchItem, *ttlv.Decoder, error) {
+// ProtocolVersion returns the kmip protocol version negotiated with the server
+func (kc *kmipClient) ProtocolVersion() string {
+	return kc.KMIPVersion
+}
 
-	conn, err := tls.Dial("tcp", kc.ServerIP+":"+kc.ServerPort, &kc.Config)
-	if err != nil {
-		return nil, nil, err
+// dial opens a TLS connection to the kmip server. The server certificate is verified against the
+// root certificate and the kmip hostname during the handshake.
+func (kc *kmipClient) dial(ctx context.Context) (net.Conn, error) {
+
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: kc.requestTimeout},
+		Config:    &kc.Config,
+	}
+	return dialer.DialContext(ctx, "tcp", net.JoinHostPort(kc.ServerIP, kc.ServerPort))
+}
+
+// Close closes the idle connections to the kmip server and stops their reaper. Requests sent after
+// Close fail with ErrClientClosed.
+func (kc *kmipClient) Close() error {
+	if kc.pool != nil {
+		kc.pool.close()
 	}
-	defer conn.Close()
+	return nil
+}
 
-	_, err = conn.ConnectionState().PeerCertificates[0].Verify(x509.VerifyOptions{Roots: kc.Config.RootCAs})
+// SendRequest perform send request message to kmip server and receive response messages. The
+// request is aborted when ctx is cancelled.
+func (kc *kmipClient) SendRequest(ctx context.Context, requestPayload interface{}, Operation kmip14.Operation) (*kmip.ResponseBatchItem, *ttlv.Decoder, error) {
+
+	batchItems, decoder, err := kc.SendBatchRequest(ctx, []kmip.RequestBatchItem{
+		{
+			Operation:      Operation,
+			RequestPayload: requestPayload,
+		},
+	})
 	if err != nil {
 		return nil, nil, err
 	}
+	return &batchItems[0], decoder, nil
+}
+
+// SendBatchRequest sends the batch items to the kmip server and returns their responses in the
+// same order. The items are split into request messages of at most max-batch-items items, which
+// the server processes in order. The request fails if any item fails.
+func (kc *kmipClient) SendBatchRequest(ctx context.Context, batchItems []kmip.RequestBatchItem) ([]kmip.ResponseBatchItem, *ttlv.Decoder, error) {
+
+	if kc.pool == nil {
+		return nil, nil, errors.New("kmipclient/kmipclient:SendBatchRequest() Kmip client is not initialized")
+	}
+	responseItems := make([]kmip.ResponseBatchItem, 0, len(batchItems))
+	for start := 0; start < len(batchItems); start += kc.maxBatchItems {
+		end := start + kc.maxBatchItems
+		if end > len(batchItems) {
+			end = len(batchItems)
+		}
+		items, err := kc.sendMessage(ctx, batchItems[start:end])
+		if err != nil {
+			return nil, nil, err
+		}
+		responseItems = append(responseItems, items...)
+	}
+
+	// the response payloads are already read, the decoder is only used to decode them
+	return responseItems, ttlv.NewDecoder(strings.NewReader("")), nil
+}
+
+// sendMessage sends a single request message on a pooled connection
+func (kc *kmipClient) sendMessage(ctx context.Context, batchItems []kmip.RequestBatchItem) ([]kmip.ResponseBatchItem, error) {
+
+	operations := make([]string, len(batchItems))
+	for i := range batchItems {
+		operations[i] = batchItems[i].Operation.String()
+	}
+	operation := strings.Join(operations, ",")
 
+	header := kc.requestHeader
+	header.BatchCount = len(batchItems)
+	header.BatchOrderOption = len(batchItems) > 1
 	message := kmip.RequestMessage{
-		RequestHeader: kc.requestHeader,
-		BatchItem: []kmip.RequestBatchItem{
-			{
-				Operation:      Operation,
-				RequestPayload: requestPayload,
-			},
-		},
+		RequestHeader: header,
+		BatchItem:     batchItems,
 	}
 
 	requestMessage, err := ttlv.Marshal(message)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	log.Debugf("kmipclient/kmipclient:SendRequest() Request Message for operation %s \n%s", Operation.String(), requestMessage)
+	log.Debugf("kmipclient/kmipclient:SendRequest() Request Message for operation %s \n%s", operation, requestMessage)
 
-	_, err = conn.Write(requestMessage)
+	c, err := kc.pool.get(ctx)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
-
-	decoder := ttlv.NewDecoder(bufio.NewReader(conn))
-	response, err := decoder.NextTTLV()
+	response, err := kc.roundTrip(ctx, c, requestMessage)
 	if err != nil {
-		return nil, nil, err
+		kc.pool.discard(c)
+		return nil, err
 	}
 
 	var responseMessage kmip.ResponseMessage
-	err = decoder.DecodeValue(&responseMessage, response)
+	err = c.decoder.DecodeValue(&responseMessage, response)
+	kc.pool.put(c)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
 	responseTTLV, err := ttlv.Marshal(responseMessage)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	log.Debugf("kmipclient/kmipclient:SendRequest() Response Message for operation %s \n%s", Operation.String(), responseTTLV)
+	log.Debugf("kmipclient/kmipclient:SendRequest() Response Message for operation %s \n%s", operation, responseTTLV)
 
-	if responseMessage.BatchItem[0].ResultStatus != kmip14.ResultStatusSuccess {
-		return nil, nil, errors.Errorf("request message is failed with reason %s", responseMessage.BatchItem[0].ResultMessage)
+	if len(responseMessage.BatchItem) != len(batchItems) {
+		return nil, errors.Errorf("response message has %d batch items, expected %d", len(responseMessage.BatchItem), len(batchItems))
 	}
-	log.Infof("kmipclient/kmipclient:SendRequest() The KMIP operation %s was executed with no errors", Operation.String())
+	for _, batchItem := range responseMessage.BatchItem {
+		if batchItem.ResultStatus != kmip14.ResultStatusSuccess {
+			if batchItem.ResultReason == kmip14.ResultReasonItemNotFound {
+				return nil, errors.Wrapf(ErrObjectNotFound, "request message is failed with reason %s", batchItem.ResultMessage)
+			}
+			return nil, errors.Wrapf(ErrOperationFailed, "request message is failed with reason %s", batchItem.ResultMessage)
+		}
+	}
+	log.Infof("kmipclient/kmipclient:SendRequest() The KMIP operation %s was executed with no errors", operation)
+
+	return responseMessage.BatchItem, nil
+}
 
-	return &responseMessage.BatchItem[0], decoder, nil
+// roundTrip writes a request message and reads the response within the request timeout. The
+// connection deadline is moved to now when ctx is cancelled, which aborts the pending I/O.
+func (kc *kmipClient) roundTrip(ctx context.Context, c *connection, requestMessage []byte) (ttlv.TTLV, error) {
+
+	deadline := time.Now().Add(kc.requestTimeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	stop := context.AfterFunc(ctx, func() {
+		_ = c.conn.SetDeadline(time.Now())
+	})
+
+	_, err := c.conn.Write(requestMessage)
+	var response ttlv.TTLV
+	if err == nil {
+		response, err = c.decoder.NextTTLV()
+	}
+	if !stop() {
+		// ctx was cancelled, the connection deadline may have been moved
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return response, c.conn.SetDeadline(time.Time{})
 }
@@ -7,25 +7,34 @@
 package kmipclient
 
 import (
+	"context"
+	"crypto/x509"
+
 	"github.com/gemalto/kmip-go"
 	"github.com/gemalto/kmip-go/kmip14"
 	"github.com/gemalto/kmip-go/kmip20"
 	"github.com/gemalto/kmip-go/ttlv"
 	"github.com/pkg/errors"
 	"intel/kbs/v1/constant"
+	"intel/kbs/v1/crypt"
 )
 
-// CreateSymmetricKey creates a symmetric key on kmip server
-func (kc *kmipClient) CreateSymmetricKey(length int) (string, error) {
+// CreateSymmetricKey creates an AES, HMAC or ChaCha20 key on kmip server
+func (kc *kmipClient) CreateSymmetricKey(ctx context.Context, algorithm string, length int) (string, error) {
+
+	cryptographicAlgorithm, usageMask, err := symmetricAlgorithm(algorithm, length)
+	if err != nil {
+		return "", err
+	}
 
 	var createRequestPayLoad interface{}
-	if kc.KMIPVersion == constant.KMIP20 {
+	if kc.isKMIP2() {
 		createRequestPayLoad = CreateRequestPayload{
 			ObjectType: kmip20.ObjectTypeSymmetricKey,
 			Attributes: Attributes{
-				CryptographicAlgorithm: kmip14.CryptographicAlgorithmAES,
+				CryptographicAlgorithm: cryptographicAlgorithm,
 				CryptographicLength:    int32(length),
-				CryptographicUsageMask: kmip14.CryptographicUsageMaskEncrypt | kmip14.CryptographicUsageMaskDecrypt,
+				CryptographicUsageMask: usageMask,
 			},
 		}
 	} else {
@@ -35,7 +44,7 @@ func (kc *kmipClient) CreateSymmetricKey(length int) (string, error) {
 				Attribute: []kmip.Attribute{
 					{
 						AttributeName:  "Cryptographic Algorithm",
-						AttributeValue: kmip14.CryptographicAlgorithmAES,
+						AttributeValue: cryptographicAlgorithm,
 					},
 					{
 						AttributeName:  "Cryptographic Length",
@@ -43,14 +52,14 @@ func (kc *kmipClient) CreateSymmetricKey(length int) (string, error) {
 					},
 					{
 						AttributeName:  "Cryptographic Usage Mask",
-						AttributeValue: kmip14.CryptographicUsageMaskEncrypt | kmip14.CryptographicUsageMaskDecrypt,
+						AttributeValue: usageMask,
 					},
 				},
 			},
 		}
 	}
 
-	batchItem, decoder, err := kc.SendRequest(createRequestPayLoad, kmip14.OperationCreate)
+	batchItem, decoder, err := kc.SendRequest(ctx, createRequestPayLoad, kmip14.OperationCreate)
 	if err != nil {
 		return "", errors.Wrap(err, "failed to perform create symmetric key operation")
 	}
@@ -64,42 +73,95 @@ func (kc *kmipClient) CreateSymmetricKey(length int) (string, error) {
 	return respPayload.UniqueIdentifier, nil
 }
 
-// CreateAsymmetricKeyPair creates a asymmetric key on kmip server
-func (kc *kmipClient) CreateAsymmetricKeyPair(algorithm, curveType string, length int) (string, error) {
+// symmetricAlgorithm returns the kmip algorithm and usage mask of a symmetric key. HMAC keys are
+// HMAC-SHA256 or HMAC-SHA384 keys, by their length.
+func symmetricAlgorithm(algorithm string, length int) (kmip14.CryptographicAlgorithm, kmip14.CryptographicUsageMask, error) {
+
+	switch algorithm {
+	case constant.CRYPTOALGAES:
+		return kmip14.CryptographicAlgorithmAES, kmip14.CryptographicUsageMaskEncrypt | kmip14.CryptographicUsageMaskDecrypt, nil
+	case constant.CRYPTOALGCHACHA20:
+		return kmip14.CryptographicAlgorithmChaCha20, kmip14.CryptographicUsageMaskEncrypt | kmip14.CryptographicUsageMaskDecrypt, nil
+	case constant.CRYPTOALGHMAC:
+		usageMask := kmip14.CryptographicUsageMaskMACGenerate | kmip14.CryptographicUsageMaskMACVerify
+		switch length {
+		case 256:
+			return kmip14.CryptographicAlgorithmHMAC_SHA256, usageMask, nil
+		case 384:
+			return kmip14.CryptographicAlgorithmHMAC_SHA384, usageMask, nil
+		}
+		return 0, 0, errors.Errorf("unsupported %d HMAC key length provided", length)
+	default:
+		return 0, 0, errors.Errorf("unsupported %s algorithm provided", algorithm)
+	}
+}
+
+// CreateAsymmetricKeyPair creates a asymmetric key on kmip server. RSA key pairs are created with
+// the given length, EC key pairs on the given curve.
+func (kc *kmipClient) CreateAsymmetricKeyPair(ctx context.Context, algorithm, curveType string, length int) (string, error) {
+
+	cryptographicAlgorithm := kmip14.CryptographicAlgorithmRSA
+	privateKeyUsageMask := kmip14.CryptographicUsageMaskDecrypt
+	publicKeyUsageMask := kmip14.CryptographicUsageMaskEncrypt
+	var recommendedCurve kmip14.RecommendedCurve
+	switch algorithm {
+	case constant.CRYPTOALGRSA:
+	case constant.CRYPTOALGEC:
+		var err error
+		recommendedCurve, length, err = ecCurve(curveType)
+		if err != nil {
+			return "", err
+		}
+		cryptographicAlgorithm = kmip14.CryptographicAlgorithmECDSA
+		privateKeyUsageMask = kmip14.CryptographicUsageMaskSign
+		publicKeyUsageMask = kmip14.CryptographicUsageMaskVerify
+	default:
+		return "", errors.Errorf("unsupported %s algorithm provided", algorithm)
+	}
 
 	var createKeyPairRequestPayLoad interface{}
-	if kc.KMIPVersion == constant.KMIP20 {
+	if kc.isKMIP2() {
 		createKeyPairRequestPayLoad = CreateKeyPairRequestPayload{
 			CommonAttributes: CommonAttributes{
-				CryptographicAlgorithm: kmip14.CryptographicAlgorithmRSA,
+				CryptographicAlgorithm: cryptographicAlgorithm,
 				CryptographicLength:    int32(length),
+				RecommendedCurve:       recommendedCurve,
 			},
 			PrivateKeyAttributes: PrivateKeyAttributes{
-				CryptographicUsageMask: kmip14.CryptographicUsageMaskDecrypt,
+				CryptographicUsageMask: privateKeyUsageMask,
 			},
 			PublicKeyAttributes: PublicKeyAttributes{
-				CryptographicUsageMask: kmip14.CryptographicUsageMaskEncrypt,
+				CryptographicUsageMask: publicKeyUsageMask,
 			},
 		}
 	} else {
+		commonAttributes := []kmip.Attribute{
+			{
+				AttributeName:  "Cryptographic Algorithm",
+				AttributeValue: cryptographicAlgorithm,
+			},
+			{
+				AttributeName:  "Cryptographic Length",
+				AttributeValue: int32(length),
+			},
+		}
+		if algorithm == constant.CRYPTOALGEC {
+			commonAttributes = append(commonAttributes, kmip.Attribute{
+				AttributeName: "Cryptographic Domain Parameters",
+				AttributeValue: CryptographicDomainParameters{
+					RecommendedCurve: recommendedCurve,
+				},
+			})
+		}
 		createKeyPairRequestPayLoad = kmip.CreateKeyPairRequestPayload{
 			CommonTemplateAttribute: &kmip.TemplateAttribute{
-				Attribute: []kmip.Attribute{
-					{
-						AttributeName:  "Cryptographic Algorithm",
-						AttributeValue: kmip14.CryptographicAlgorithmRSA,
-					},
-					{
-						AttributeName:  "Cryptographic Length",
-						AttributeValue: int32(length),
-					},
-				},
+				Attribute: commonAttributes,
 			},
 			PrivateKeyTemplateAttribute: &kmip.TemplateAttribute{
 				Attribute: []kmip.Attribute{
 					{
 						AttributeName:  "Cryptographic Usage Mask",
-						AttributeValue: kmip14.CryptographicUsageMaskDecrypt,
+						AttributeValue: privateKeyUsageMask,
 					},
 				},
 			},
@@ -107,14 +169,14 @@ func (kc *kmipClient) CreateAsymmetricKeyPair(algorithm, curveType string, lengt
 				Attribute: []kmip.Attribute{
 					{
 						AttributeName:  "Cryptographic Usage Mask",
-						AttributeValue: kmip14.CryptographicUsageMaskEncrypt,
+						AttributeValue: publicKeyUsageMask,
 					},
 				},
 			},
 		}
 	}
 
-	batchItem, decoder, err := kc.SendRequest(createKeyPairRequestPayLoad, kmip14.OperationCreateKeyPair)
+	batchItem, decoder, err := kc.SendRequest(ctx, createKeyPairRequestPayLoad, kmip14.OperationCreateKeyPair)
 	if err != nil {
 		return "", errors.Wrap(err, "failed to perform create keypair operation")
 	}
@@ -128,8 +190,125 @@ func (kc *kmipClient) CreateAsymmetricKeyPair(algorithm, curveType string, lengt
 	return respPayload.PrivateKeyUniqueIdentifier, nil
 }
 
-// GetKey retrieves a key from kmip server
-func (kc *kmipClient) GetKey(keyID, algorithm string) ([]byte, error) {
+// RegisterKey registers existing key material on kmip server. AES, HMAC and ChaCha20 keys are
+// registered in raw format, RSA private keys in PKCS#1 DER format and EC private keys in PKCS#8 DER format. The
+// length of EC keys is the size of their curve. Opaque secrets are registered as secret data.
+func (kc *kmipClient) RegisterKey(ctx context.Context, algorithm string, length int, keyMaterial []byte) (string, error) {
+
+	var objectType kmip14.ObjectType
+	var usageMask kmip14.CryptographicUsageMask
+	keyBlock := kmip.KeyBlock{
+		KeyValue: kmip.KeyValue{
+			KeyMaterial: keyMaterial,
+		},
+		CryptographicLength: length,
+	}
+	switch algorithm {
+	case constant.CRYPTOALGAES, constant.CRYPTOALGHMAC, constant.CRYPTOALGCHACHA20:
+		var err error
+		keyBlock.CryptographicAlgorithm, usageMask, err = symmetricAlgorithm(algorithm, length)
+		if err != nil {
+			return "", err
+		}
+		objectType = kmip14.ObjectTypeSymmetricKey
+		keyBlock.KeyFormatType = kmip14.KeyFormatTypeRaw
+	case constant.CRYPTOALGRSA:
+		objectType = kmip14.ObjectTypePrivateKey
+		usageMask = kmip14.CryptographicUsageMaskDecrypt
+		keyBlock.KeyFormatType = kmip14.KeyFormatTypePKCS_1
+		keyBlock.CryptographicAlgorithm = kmip14.CryptographicAlgorithmRSA
+	case constant.CRYPTOALGEC:
+		objectType = kmip14.ObjectTypePrivateKey
+		usageMask = kmip14.CryptographicUsageMaskSign
+		keyBlock.KeyFormatType = kmip14.KeyFormatTypePKCS_8
+		keyBlock.CryptographicAlgorithm = kmip14.CryptographicAlgorithmECDSA
+	case constant.CRYPTOALGSECRET:
+		// secret data has neither a cryptographic algorithm nor a length
+		objectType = kmip14.ObjectTypeSecretData
+		keyBlock.KeyFormatType = kmip14.KeyFormatTypeOpaque
+		keyBlock.CryptographicLength = 0
+	default:
+		return "", errors.Errorf("unsupported %s algorithm provided", algorithm)
+	}
+
+	return kc.register(ctx, objectType, usageMask, keyBlock)
+}
+
+// RegisterWrappingKey registers an AES key on kmip server that can only be used to wrap keys
+func (kc *kmipClient) RegisterWrappingKey(ctx context.Context, keyMaterial []byte) (string, error) {
+
+	keyBlock := kmip.KeyBlock{
+		KeyFormatType: kmip14.KeyFormatTypeRaw,
+		KeyValue: kmip.KeyValue{
+			KeyMaterial: keyMaterial,
+		},
+		CryptographicAlgorithm: kmip14.CryptographicAlgorithmAES,
+		CryptographicLength:    len(keyMaterial) * 8,
+	}
+	return kc.register(ctx, kmip14.ObjectTypeSymmetricKey, kmip14.CryptographicUsageMaskWrapKey, keyBlock)
+}
+
+func (kc *kmipClient) register(ctx context.Context, objectType kmip14.ObjectType, usageMask kmip14.CryptographicUsageMask, keyBlock kmip.KeyBlock) (string, error) {
+
+	var registerRequestPayLoad interface{}
+	if kc.isKMIP2() {
+		payload := RegisterRequestPayload{
+			ObjectType: kmip20.ObjectType(objectType),
+			Attributes: Attributes{
+				CryptographicAlgorithm: keyBlock.CryptographicAlgorithm,
+				CryptographicLength:    int32(keyBlock.CryptographicLength),
+				CryptographicUsageMask: usageMask,
+			},
+		}
+		switch objectType {
+		case kmip14.ObjectTypeSymmetricKey:
+			payload.SymmetricKey = &kmip.SymmetricKey{KeyBlock: keyBlock}
+		case kmip14.ObjectTypeSecretData:
+			payload.SecretData = &kmip.SecretData{SecretDataType: kmip14.SecretDataTypeSeed, KeyBlock: keyBlock}
+		default:
+			payload.PrivateKey = &kmip.PrivateKey{KeyBlock: keyBlock}
+		}
+		registerRequestPayLoad = payload
+	} else {
+		payload := kmip.RegisterRequestPayload{
+			ObjectType: objectType,
+		}
+		if usageMask != 0 {
+			payload.TemplateAttribute.Attribute = []kmip.Attribute{
+				{
+					AttributeName:  "Cryptographic Usage Mask",
+					AttributeValue: usageMask,
+				},
+			}
+		}
+		switch objectType {
+		case kmip14.ObjectTypeSymmetricKey:
+			payload.SymmetricKey = &kmip.SymmetricKey{KeyBlock: keyBlock}
+		case kmip14.ObjectTypeSecretData:
+			payload.SecretData = &kmip.SecretData{SecretDataType: kmip14.SecretDataTypeSeed, KeyBlock: keyBlock}
+		default:
+			payload.PrivateKey = &kmip.PrivateKey{KeyBlock: keyBlock}
+		}
+		registerRequestPayLoad = payload
+	}
+
+	batchItem, decoder, err := kc.SendRequest(ctx, registerRequestPayLoad, kmip14.OperationRegister)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to perform register key operation")
+	}
+
+	var respPayload RegisterResponsePayload
+	err = decoder.DecodeValue(&respPayload, batchItem.ResponsePayload.(ttlv.TTLV))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to decode register key response payload")
+	}
+
+	return respPayload.UniqueIdentifier, nil
+}
+
+// GetKey retrieves a key from kmip server. RSA private keys are returned in PKCS#1 DER format,
+// EC private keys in PKCS#8 DER format and secret data as its opaque value.
+func (kc *kmipClient) GetKey(ctx context.Context, keyID, algorithm string) ([]byte, error) {
 
 	getRequestPayLoad := GetRequestPayload{
 		UniqueIdentifier: kmip20.UniqueIdentifierValue{
@@ -137,7 +316,7 @@ func (kc *kmipClient) GetKey(keyID, algorithm string) ([]byte, error) {
 		},
 	}
 
-	batchItem, decoder, err := kc.SendRequest(getRequestPayLoad, kmip14.OperationGet)
+	batchItem, decoder, err := kc.SendRequest(ctx, getRequestPayLoad, kmip14.OperationGet)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to perform get key operation")
 	}
@@ -151,7 +330,10 @@ func (kc *kmipClient) GetKey(keyID, algorithm string) ([]byte, error) {
 	var keyValue KeyValue
 
 	switch algorithm {
-	case constant.CRYPTOALGAES:
+	case constant.CRYPTOALGAES, constant.CRYPTOALGHMAC, constant.CRYPTOALGCHACHA20:
+		if respPayload.ObjectType != kmip14.ObjectTypeSymmetricKey {
+			return nil, errors.Errorf("unsupported object type %s", respPayload.ObjectType)
+		}
 		err = decoder.DecodeValue(&keyValue, respPayload.SymmetricKey.KeyBlock.KeyValue.(ttlv.TTLV))
 		if err != nil {
 			return nil, errors.Wrap(err, "failed to decode symmetric keyblock")
@@ -165,6 +347,23 @@ func (kc *kmipClient) GetKey(keyID, algorithm string) ([]byte, error) {
 		} else {
 			return nil, errors.Errorf("unsupported object type %s", respPayload.ObjectType)
 		}
+	case constant.CRYPTOALGEC:
+		if respPayload.ObjectType != kmip14.ObjectTypePrivateKey {
+			return nil, errors.Errorf("unsupported object type %s", respPayload.ObjectType)
+		}
+		err = decoder.DecodeValue(&keyValue, respPayload.PrivateKey.KeyBlock.KeyValue.(ttlv.TTLV))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to decode private keyblock")
+		}
+		return ecPrivateKeyToPKCS8(respPayload.PrivateKey.KeyBlock.KeyFormatType, keyValue.KeyMaterial)
+	case constant.CRYPTOALGSECRET:
+		if respPayload.ObjectType != kmip14.ObjectTypeSecretData {
+			return nil, errors.Errorf("unsupported object type %s", respPayload.ObjectType)
+		}
+		err = decoder.DecodeValue(&keyValue, respPayload.SecretData.KeyBlock.KeyValue.(ttlv.TTLV))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to decode secret data keyblock")
+		}
 	default:
 		return nil, errors.Errorf("unsupported %s algorithm provided", algorithm)
 	}
@@ -172,8 +371,170 @@ func (kc *kmipClient) GetKey(keyID, algorithm string) ([]byte, error) {
 	return keyValue.KeyMaterial, nil
 }
 
+// GetPublicKey retrieves the public key linked to a private key from kmip server in PKIX DER
+// format, or ErrNoLinkedPublicKey when the private key has no linked public key
+func (kc *kmipClient) GetPublicKey(ctx context.Context, keyID string) ([]byte, error) {
+
+	attributes, err := kc.GetAttributes(ctx, keyID)
+	if err != nil {
+		return nil, err
+	}
+	publicKeyID := ""
+	for _, link := range attributes.Link {
+		if link.LinkType == kmip14.LinkTypePublicKeyLink {
+			publicKeyID = link.LinkedObjectIdentifier
+			break
+		}
+	}
+	if publicKeyID == "" {
+		return nil, ErrNoLinkedPublicKey
+	}
+
+	getRequestPayLoad := GetRequestPayload{
+		UniqueIdentifier: kmip20.UniqueIdentifierValue{
+			Text: publicKeyID,
+		},
+		KeyFormatType: kmip14.KeyFormatTypeX_509,
+	}
+
+	batchItem, decoder, err := kc.SendRequest(ctx, getRequestPayLoad, kmip14.OperationGet)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to perform get public key operation")
+	}
+
+	var respPayload GetResponsePayload
+	err = decoder.DecodeValue(&respPayload, batchItem.ResponsePayload.(ttlv.TTLV))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode get public key response payload")
+	}
+	if respPayload.ObjectType != kmip14.ObjectTypePublicKey {
+		return nil, errors.Errorf("unsupported object type %s", respPayload.ObjectType)
+	}
+
+	var keyValue KeyValue
+	err = decoder.DecodeValue(&keyValue, respPayload.PublicKey.KeyBlock.KeyValue.(ttlv.TTLV))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode public keyblock")
+	}
+
+	// servers that ignore the requested format return RSA public keys in PKCS#1 format
+	switch respPayload.PublicKey.KeyBlock.KeyFormatType {
+	case kmip14.KeyFormatTypeX_509:
+		return keyValue.KeyMaterial, nil
+	case kmip14.KeyFormatTypePKCS_1:
+		publicKey, err := x509.ParsePKCS1PublicKey(keyValue.KeyMaterial)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse RSA public key")
+		}
+		return x509.MarshalPKIXPublicKey(publicKey)
+	default:
+		return nil, errors.Errorf("unsupported public key format %s", respPayload.PublicKey.KeyBlock.KeyFormatType)
+	}
+}
+
+// ecPrivateKeyToPKCS8 converts an EC private key returned by the kmip server to PKCS#8 DER format
+func ecPrivateKeyToPKCS8(format kmip14.KeyFormatType, keyMaterial []byte) ([]byte, error) {
+
+	switch format {
+	case kmip14.KeyFormatTypePKCS_8:
+		return keyMaterial, nil
+	case kmip14.KeyFormatTypeECPrivateKey:
+		privateKey, err := crypt.ParseECPrivateKey(keyMaterial)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse EC private key")
+		}
+		privateKeyBytes, err := crypt.MarshalPKCS8PrivateKey(privateKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to marshal EC private key")
+		}
+		return privateKeyBytes, nil
+	default:
+		return nil, errors.Errorf("unsupported EC private key format %s", format)
+	}
+}
+
+// ecCurve returns the kmip curve and the key length of an EC curve type
+func ecCurve(curveType string) (kmip14.RecommendedCurve, int, error) {
+
+	switch curveType {
+	case "prime256v1", "secp256r1":
+		return kmip14.RecommendedCurveP_256, 256, nil
+	case "secp384r1":
+		return kmip14.RecommendedCurveP_384, 384, nil
+	case "secp521r1":
+		return kmip14.RecommendedCurveP_521, 521, nil
+	case constant.CurveSecp256k1:
+		return kmip14.RecommendedCurveSECP256K1, 256, nil
+	default:
+		return 0, 0, errors.Errorf("unsupported %s curve type provided", curveType)
+	}
+}
+
+// GetWrappedKey retrieves a key from kmip server wrapped under the wrapping key with AES key wrap
+// with padding (RFC 5649). The key material is wrapped without TTLV encoding. Private keys are
+// requested in PKCS#8 format.
+func (kc *kmipClient) GetWrappedKey(ctx context.Context, keyID, algorithm, wrappingKeyID string) ([]byte, error) {
+
+	getRequestPayLoad := GetRequestPayload{
+		UniqueIdentifier: kmip20.UniqueIdentifierValue{
+			Text: keyID,
+		},
+		KeyWrappingSpecification: &KeyWrappingSpecification{
+			WrappingMethod: kmip14.WrappingMethodEncrypt,
+			EncryptionKeyInformation: EncryptionKeyInformation{
+				UniqueIdentifier: kmip20.UniqueIdentifierValue{
+					Text: wrappingKeyID,
+				},
+				CryptographicParameters: &kmip.CryptographicParameters{
+					BlockCipherMode: kmip14.BlockCipherModeAESKeyWrapPadding,
+				},
+			},
+			EncodingOption: kmip14.EncodingOptionNoEncoding,
+		},
+	}
+	switch algorithm {
+	case constant.CRYPTOALGAES, constant.CRYPTOALGHMAC, constant.CRYPTOALGCHACHA20:
+	case constant.CRYPTOALGRSA, constant.CRYPTOALGEC:
+		getRequestPayLoad.KeyFormatType = kmip14.KeyFormatTypePKCS_8
+	default:
+		return nil, errors.Errorf("unsupported %s algorithm provided", algorithm)
+	}
+
+	batchItem, decoder, err := kc.SendRequest(ctx, getRequestPayLoad, kmip14.OperationGet)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to perform get wrapped key operation")
+	}
+
+	var respPayload GetResponsePayload
+	err = decoder.DecodeValue(&respPayload, batchItem.ResponsePayload.(ttlv.TTLV))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode get wrapped key response payload")
+	}
+
+	var keyBlock kmip.KeyBlock
+	switch respPayload.ObjectType {
+	case kmip14.ObjectTypeSymmetricKey:
+		keyBlock = respPayload.SymmetricKey.KeyBlock
+	case kmip14.ObjectTypePrivateKey:
+		keyBlock = respPayload.PrivateKey.KeyBlock
+	default:
+		return nil, errors.Errorf("unsupported object type %s", respPayload.ObjectType)
+	}
+	if keyBlock.KeyWrappingData == nil {
+		// never return key material that the server did not wrap
+		return nil, errors.New("kmip server returned the key without wrapping it")
+	}
+	// the key value of a key wrapped without encoding is a byte string
+	wrappedKey, ok := keyBlock.KeyValue.([]byte)
+	if !ok {
+		return nil, errors.New("unexpected wrapped key value in get response")
+	}
+
+	return wrappedKey, nil
+}
+
 // DeleteKey deletes a key from kmip server
-func (kc *kmipClient) DeleteKey(keyID string) error {
+func (kc *kmipClient) DeleteKey(ctx context.Context, keyID string) error {
 
 	deleteRequestPayLoad := DeleteRequest{
 		UniqueIdentifier: kmip20.UniqueIdentifierValue{
@@ -181,7 +542,7 @@ func (kc *kmipClient) DeleteKey(keyID string) error {
 		},
 	}
 
-	_, _, err := kc.SendRequest(deleteRequestPayLoad, kmip14.OperationDestroy)
+	_, _, err := kc.SendRequest(ctx, deleteRequestPayLoad, kmip14.OperationDestroy)
 	if err != nil {
 		return errors.Wrap(err, "failed to perform delete key operation")
 	}
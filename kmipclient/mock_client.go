@@ -7,10 +7,13 @@
 package kmipclient
 
 import (
+	"context"
+
 	"github.com/gemalto/kmip-go"
 	"github.com/gemalto/kmip-go/kmip14"
 	"github.com/gemalto/kmip-go/ttlv"
 	"github.com/stretchr/testify/mock"
+	"intel/kbs/v1/config"
 )
 
 // MockKmipClient is a mock of KmipClient interface
@@ -24,37 +27,91 @@ func NewMockKmipClient() *MockKmipClient {
 }
 
 // InitializeClient mocks base method
-func (m *MockKmipClient) InitializeClient(version, serverIP, serverPort, hostname, username, password, clientKey, clientCert, rootCert string) error {
-	args := m.Called(version, serverIP, serverPort, clientKey, clientCert, rootCert, username, password)
+func (m *MockKmipClient) InitializeClient(kmipConfig *config.KmipConfig) error {
+	args := m.Called(kmipConfig)
 	return args.Error(0)
 }
 
 // CreateSymmetricKey mocks base method
-func (m *MockKmipClient) CreateSymmetricKey(length int) (string, error) {
+func (m *MockKmipClient) CreateSymmetricKey(ctx context.Context, algorithm string, length int) (string, error) {
 	args := m.Called(length)
 	return args.Get(0).(string), args.Error(1)
 }
 
 // CreateAsymmetricKeyPair mocks base method
-func (m *MockKmipClient) CreateAsymmetricKeyPair(algorithm, curveType string, length int) (string, error) {
+func (m *MockKmipClient) CreateAsymmetricKeyPair(ctx context.Context, algorithm, curveType string, length int) (string, error) {
 	args := m.Called(length)
 	return args.Get(0).(string), args.Error(1)
 }
 
+// RegisterKey mocks base method
+func (m *MockKmipClient) RegisterKey(ctx context.Context, algorithm string, length int, keyMaterial []byte) (string, error) {
+	args := m.Called(algorithm, length, keyMaterial)
+	return args.Get(0).(string), args.Error(1)
+}
+
+// RegisterWrappingKey mocks base method
+func (m *MockKmipClient) RegisterWrappingKey(ctx context.Context, keyMaterial []byte) (string, error) {
+	args := m.Called(keyMaterial)
+	return args.Get(0).(string), args.Error(1)
+}
+
+// GetWrappedKey mocks base method
+func (m *MockKmipClient) GetWrappedKey(ctx context.Context, id, algorithm, wrappingKeyID string) ([]byte, error) {
+	args := m.Called(id, algorithm, wrappingKeyID)
+	return args.Get(0).([]byte), args.Error(1)
+}
+
 // DeleteSymmetricKey mocks base method
-func (m *MockKmipClient) DeleteKey(id string) error {
+func (m *MockKmipClient) DeleteKey(ctx context.Context, id string) error {
 	args := m.Called(id)
 	return args.Error(0)
 }
 
 // GetSymmetricKey mocks base method
-func (m *MockKmipClient) GetKey(id string, algorithm string) ([]byte, error) {
+func (m *MockKmipClient) GetKey(ctx context.Context, id string, algorithm string) ([]byte, error) {
+	args := m.Called(id)
+	return args.Get(0).([]byte), args.Error(1)
+}
+
+// GetPublicKey mocks base method
+func (m *MockKmipClient) GetPublicKey(ctx context.Context, id string) ([]byte, error) {
 	args := m.Called(id)
 	return args.Get(0).([]byte), args.Error(1)
 }
 
+// GetAttributes mocks base method
+func (m *MockKmipClient) GetAttributes(ctx context.Context, id string) (*ObjectAttributes, error) {
+	args := m.Called(id)
+	return args.Get(0).(*ObjectAttributes), args.Error(1)
+}
+
+// Locate mocks base method
+func (m *MockKmipClient) Locate(ctx context.Context, filter LocateFilter) ([]ObjectAttributes, error) {
+	args := m.Called(filter)
+	return args.Get(0).([]ObjectAttributes), args.Error(1)
+}
+
 // SendRequest mocks base method
-func (m *MockKmipClient) SendRequest(requestPayload interface{}, Operation kmip14.Operation) (*kmip.ResponseBatchItem, *ttlv.Decoder, error) {
+func (m *MockKmipClient) SendRequest(ctx context.Context, requestPayload interface{}, Operation kmip14.Operation) (*kmip.ResponseBatchItem, *ttlv.Decoder, error) {
 	args := m.Called(requestPayload, Operation)
 	return args.Get(0).(*kmip.ResponseBatchItem), args.Get(1).(*ttlv.Decoder), args.Error(2)
 }
+
+// SendBatchRequest mocks base method
+func (m *MockKmipClient) SendBatchRequest(ctx context.Context, batchItems []kmip.RequestBatchItem) ([]kmip.ResponseBatchItem, *ttlv.Decoder, error) {
+	args := m.Called(ctx, batchItems)
+	return args.Get(0).([]kmip.ResponseBatchItem), args.Get(1).(*ttlv.Decoder), args.Error(2)
+}
+
+// ProtocolVersion mocks base method
+func (m *MockKmipClient) ProtocolVersion() string {
+	args := m.Called()
+	return args.String(0)
+}
+
+// Close mocks base method
+func (m *MockKmipClient) Close() error {
+	args := m.Called()
+	return args.Error(0)
+}
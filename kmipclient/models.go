@@ -10,9 +10,10 @@ import (
 	"github.com/gemalto/kmip-go"
 	"github.com/gemalto/kmip-go/kmip14"
 	"github.com/gemalto/kmip-go/kmip20"
+	"github.com/gemalto/kmip-go/ttlv"
 )
 
-// CreateRequestPayload used to construct create symmetric key request message
+// CreateRequestPayload used to construct create symmetric key request message in kmip 2.0 and 2.1
 type CreateRequestPayload struct {
 	ObjectType kmip20.ObjectType
 	Attributes Attributes
@@ -20,9 +21,9 @@ type CreateRequestPayload struct {
 
 // Attributes payload requires in create request
 type Attributes struct {
-	CryptographicAlgorithm kmip14.CryptographicAlgorithm
-	CryptographicLength    int32
-	CryptographicUsageMask kmip14.CryptographicUsageMask
+	CryptographicAlgorithm kmip14.CryptographicAlgorithm `ttlv:",omitempty"`
+	CryptographicLength    int32                         `ttlv:",omitempty"`
+	CryptographicUsageMask kmip14.CryptographicUsageMask `ttlv:",omitempty"`
 }
 
 // CreateResponsePayload to receive response message for create operation
@@ -30,7 +31,7 @@ type CreateResponsePayload struct {
 	UniqueIdentifier string
 }
 
-// CreateKeyPairRequestPayload used to construct asymmetric key request message
+// CreateKeyPairRequestPayload used to construct asymmetric key request message in kmip 2.0 and 2.1
 type CreateKeyPairRequestPayload struct {
 	CommonAttributes     CommonAttributes
 	PrivateKeyAttributes PrivateKeyAttributes
@@ -41,6 +42,7 @@ type CreateKeyPairRequestPayload struct {
 type CommonAttributes struct {
 	CryptographicAlgorithm kmip14.CryptographicAlgorithm
 	CryptographicLength    int32
+	RecommendedCurve       kmip14.RecommendedCurve `ttlv:",omitempty"`
 }
 
 // PrivateKeyAttributes payload represents usage mask for private key
@@ -59,9 +61,38 @@ type CreateKeyPairResponsePayload struct {
 	PublicKeyUniqueIdentifier  string
 }
 
+// RegisterRequestPayload used to construct register key request message in kmip 2.0 and 2.1
+type RegisterRequestPayload struct {
+	ObjectType   kmip20.ObjectType
+	Attributes   Attributes
+	SymmetricKey *kmip.SymmetricKey
+	PrivateKey   *kmip.PrivateKey
+	SecretData   *kmip.SecretData
+}
+
+// RegisterResponsePayload to receive response message for register operation
+type RegisterResponsePayload struct {
+	UniqueIdentifier string
+}
+
 // GetRequestPayload used to construct GET request operation
 type GetRequestPayload struct {
-	UniqueIdentifier kmip20.UniqueIdentifierValue
+	UniqueIdentifier         kmip20.UniqueIdentifierValue
+	KeyFormatType            kmip14.KeyFormatType      `ttlv:",omitempty"`
+	KeyWrappingSpecification *KeyWrappingSpecification `ttlv:",omitempty"`
+}
+
+// KeyWrappingSpecification payload requests a key wrapped under another key in GET request
+type KeyWrappingSpecification struct {
+	WrappingMethod           kmip14.WrappingMethod
+	EncryptionKeyInformation EncryptionKeyInformation
+	EncodingOption           kmip14.EncodingOption `ttlv:",omitempty"`
+}
+
+// EncryptionKeyInformation payload identifies the wrapping key in a key wrapping specification
+type EncryptionKeyInformation struct {
+	UniqueIdentifier        kmip20.UniqueIdentifierValue
+	CryptographicParameters *kmip.CryptographicParameters
 }
 
 // DeleteRequest payload used to construct DELETE request operation
@@ -75,9 +106,86 @@ type GetResponsePayload struct {
 	UniqueIdentifier string
 	SymmetricKey     kmip.SymmetricKey
 	PrivateKey       kmip.PrivateKey
+	PublicKey        kmip.PublicKey
+	SecretData       kmip.SecretData
 }
 
 // KeyValue payload to hold actual key value
 type KeyValue struct {
 	KeyMaterial []byte
 }
+
+// CryptographicDomainParameters attribute selects the curve of an EC key pair
+type CryptographicDomainParameters struct {
+	RecommendedCurve kmip14.RecommendedCurve
+}
+
+// GetAttributesRequestPayload used to construct GET ATTRIBUTES request operation. All attributes
+// are returned when no attribute name is given.
+type GetAttributesRequestPayload struct {
+	UniqueIdentifier kmip20.UniqueIdentifierValue
+	AttributeName    []string `ttlv:",omitempty"`
+}
+
+// GetAttributesResponsePayload to receive response of GET ATTRIBUTES operation in kmip 1.4
+type GetAttributesResponsePayload struct {
+	UniqueIdentifier string
+	Attribute        []AttributeTTLV
+}
+
+// AttributeTTLV holds an attribute of a kmip 1.4 response, its value is decoded once its name is known
+type AttributeTTLV struct {
+	AttributeName  string
+	AttributeIndex int `ttlv:",omitempty"`
+	AttributeValue ttlv.TTLV
+}
+
+// GetAttributesResponsePayloadV2 to receive response of GET ATTRIBUTES operation in kmip 2.0 and 2.1
+type GetAttributesResponsePayloadV2 struct {
+	UniqueIdentifier string
+	Attributes       ObjectAttributes
+}
+
+// ObjectAttributes holds the attributes of a managed object used to validate and discover keys
+type ObjectAttributes struct {
+	UniqueIdentifier       string
+	ObjectType             kmip14.ObjectType
+	CryptographicAlgorithm kmip14.CryptographicAlgorithm
+	CryptographicLength    int32
+	State                  kmip14.State
+	Name                   []kmip.Name
+	Link                   []Link
+}
+
+// Link attribute references a managed object related to another, such as the public key of a
+// private key
+type Link struct {
+	LinkType               kmip14.LinkType
+	LinkedObjectIdentifier string
+}
+
+// LocateRequestPayload used to construct LOCATE request operation in kmip 1.4
+type LocateRequestPayload struct {
+	MaximumItems int32 `ttlv:",omitempty"`
+	Attribute    []kmip.Attribute
+}
+
+// LocateRequestPayloadV2 used to construct LOCATE request operation in kmip 2.0 and 2.1
+type LocateRequestPayloadV2 struct {
+	MaximumItems int32 `ttlv:",omitempty"`
+	Attributes   LocateAttributes
+}
+
+// LocateAttributes payload holds the attributes that located objects must match in kmip 2.0 and 2.1
+type LocateAttributes struct {
+	ObjectType             kmip14.ObjectType             `ttlv:",omitempty"`
+	CryptographicAlgorithm kmip14.CryptographicAlgorithm `ttlv:",omitempty"`
+	CryptographicLength    int32                         `ttlv:",omitempty"`
+	Name                   *kmip.Name                    `ttlv:",omitempty"`
+}
+
+// LocateResponsePayload to receive response of LOCATE operation
+type LocateResponsePayload struct {
+	LocatedItems     int32 `ttlv:",omitempty"`
+	UniqueIdentifier []string
+}
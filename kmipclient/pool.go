@@ -0,0 +1,235 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package kmipclient
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gemalto/kmip-go/ttlv"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// idle connections are probed before reuse once they have been idle for healthCheckIdleTime
+	healthCheckIdleTime = 5 * time.Second
+	healthCheckTimeout  = time.Millisecond
+
+	dialAttempts       = 5
+	dialInitialBackoff = 100 * time.Millisecond
+	dialMaxBackoff     = 5 * time.Second
+)
+
+// ErrClientClosed is returned for requests sent after the kmip client was closed
+var ErrClientClosed = errors.New("kmip client is closed")
+
+// connection is a TLS connection to the kmip server that is reused across requests
+type connection struct {
+	conn      net.Conn
+	decoder   *ttlv.Decoder
+	idleSince time.Time
+}
+
+// connectionPool keeps up to maxConnections long-lived TLS connections to the kmip server. A
+// connection is used by one request at a time.
+type connectionPool struct {
+	dial        func(ctx context.Context) (net.Conn, error)
+	idleTimeout time.Duration
+	// idle holds the connections that are not in use
+	idle chan *connection
+	// slots holds one entry for every open connection
+	slots chan struct{}
+	// done is closed when the pool is closed, which stops the idle connection reaper
+	done chan struct{}
+	// mu serializes the pool close with the connections returned to idle
+	mu     sync.Mutex
+	closed bool
+}
+
+func newConnectionPool(dial func(ctx context.Context) (net.Conn, error), maxConnections int, idleTimeout time.Duration) *connectionPool {
+	pool := &connectionPool{
+		dial:        dial,
+		idleTimeout: idleTimeout,
+		idle:        make(chan *connection, maxConnections),
+		slots:       make(chan struct{}, maxConnections),
+		done:        make(chan struct{}),
+	}
+	go pool.closeIdleConnections()
+	return pool
+}
+
+// get returns a healthy idle connection, or a new connection when less than maxConnections are
+// open. It waits for a connection to be released otherwise.
+func (p *connectionPool) get(ctx context.Context) (*connection, error) {
+
+	for {
+		select {
+		case <-p.done:
+			return nil, ErrClientClosed
+		case c := <-p.idle:
+			if p.healthy(c) {
+				return c, nil
+			}
+			p.discard(c)
+			continue
+		default:
+		}
+
+		select {
+		case c := <-p.idle:
+			if p.healthy(c) {
+				return c, nil
+			}
+			p.discard(c)
+		case <-p.done:
+			return nil, ErrClientClosed
+		case p.slots <- struct{}{}:
+			conn, err := p.dialWithBackoff(ctx)
+			if err != nil {
+				<-p.slots
+				return nil, err
+			}
+			return &connection{conn: conn, decoder: ttlv.NewDecoder(conn)}, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// put returns a connection to the pool once its request has completed. The connection is closed
+// when the pool was closed during the request.
+func (p *connectionPool) put(c *connection) {
+	c.idleSince = time.Now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		p.discard(c)
+		return
+	}
+	p.idle <- c
+}
+
+// discard closes a connection that failed or timed out
+func (p *connectionPool) discard(c *connection) {
+	if err := c.conn.Close(); err != nil {
+		log.WithError(err).Debug("kmipclient/pool:discard() Failed to close kmip connection")
+	}
+	<-p.slots
+}
+
+// healthy reports whether an idle connection can be reused. Connections that have been idle for
+// a while are probed with a short read, which times out unless the server closed the connection.
+func (p *connectionPool) healthy(c *connection) bool {
+
+	idleTime := time.Since(c.idleSince)
+	if idleTime > p.idleTimeout {
+		return false
+	}
+	if idleTime < healthCheckIdleTime {
+		return true
+	}
+	if err := c.conn.SetReadDeadline(time.Now().Add(healthCheckTimeout)); err != nil {
+		return false
+	}
+	_, err := c.conn.Read(make([]byte, 1))
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		log.WithError(err).Info("kmipclient/pool:healthy() Discarding kmip connection closed by the server")
+		return false
+	}
+	return c.conn.SetReadDeadline(time.Time{}) == nil
+}
+
+// dialWithBackoff connects to the kmip server, retrying with exponential backoff
+func (p *connectionPool) dialWithBackoff(ctx context.Context) (net.Conn, error) {
+
+	backoff := dialInitialBackoff
+	for attempt := 1; ; attempt++ {
+		conn, err := p.dial(ctx)
+		if err == nil {
+			return conn, nil
+		}
+		if attempt == dialAttempts || ctx.Err() != nil {
+			return nil, errors.Wrapf(err, "failed to connect to kmip server after %d attempts", attempt)
+		}
+		log.WithError(err).Warnf("kmipclient/pool:dialWithBackoff() Failed to connect to kmip server, retrying in %s", backoff)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+		backoff *= 2
+		if backoff > dialMaxBackoff {
+			backoff = dialMaxBackoff
+		}
+	}
+}
+
+// closeIdleConnections periodically closes connections that have been idle for idleTimeout, until
+// the pool is closed
+func (p *connectionPool) closeIdleConnections() {
+
+	ticker := time.NewTicker(p.idleTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.discardIdle(func(c *connection) bool {
+				return time.Since(c.idleSince) > p.idleTimeout
+			})
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// discardIdle closes the idle connections for which expired returns true and keeps the others
+func (p *connectionPool) discardIdle(expired func(*connection) bool) {
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var keep []*connection
+	for {
+		select {
+		case c := <-p.idle:
+			if expired(c) {
+				p.discard(c)
+			} else {
+				keep = append(keep, c)
+			}
+		default:
+			for _, c := range keep {
+				p.idle <- c
+			}
+			return
+		}
+	}
+}
+
+// close stops the idle connection reaper and closes the idle connections. Connections in use are
+// closed when they are returned to the pool.
+func (p *connectionPool) close() {
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	close(p.done)
+	p.mu.Unlock()
+
+	p.discardIdle(func(*connection) bool {
+		return true
+	})
+}
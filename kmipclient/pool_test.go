@@ -0,0 +1,231 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package kmipclient
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// pipeDialer opens in-memory connections and keeps their server side
+type pipeDialer struct {
+	mu      sync.Mutex
+	servers []net.Conn
+	err     error
+	dials   int
+}
+
+func (d *pipeDialer) dial(context.Context) (net.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.dials++
+	if d.err != nil {
+		return nil, d.err
+	}
+	client, server := net.Pipe()
+	d.servers = append(d.servers, server)
+	return client, nil
+}
+
+func (d *pipeDialer) dialCount() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.dials
+}
+
+func (d *pipeDialer) server(i int) net.Conn {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.servers[i]
+}
+
+// closedByClient reports whether the client side of a connection was closed
+func closedByClient(server net.Conn, timeout time.Duration) bool {
+	if err := server.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		// the deadline cannot be set on a closed pipe
+		return true
+	}
+	_, err := server.Read(make([]byte, 1))
+	var netErr net.Error
+	return !errors.As(err, &netErr) || !netErr.Timeout()
+}
+
+func TestConnectionPoolMaxConnections(t *testing.T) {
+
+	dialer := &pipeDialer{}
+	pool := newConnectionPool(dialer.dial, 2, time.Minute)
+	defer pool.close()
+
+	first, err := pool.get(context.Background())
+	if err != nil {
+		t.Fatalf("get() error = %v", err)
+	}
+	if _, err := pool.get(context.Background()); err != nil {
+		t.Fatalf("get() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := pool.get(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("get() error = %v, want %v when all connections are in use", err, context.DeadlineExceeded)
+	}
+
+	released := make(chan *connection)
+	go func() {
+		c, err := pool.get(context.Background())
+		if err != nil {
+			t.Errorf("get() error = %v", err)
+		}
+		released <- c
+	}()
+	time.Sleep(50 * time.Millisecond)
+	pool.put(first)
+
+	select {
+	case c := <-released:
+		if c != first {
+			t.Errorf("get() returned a new connection, want the released connection")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("get() did not return after a connection was released")
+	}
+	if dialer.dialCount() != 2 {
+		t.Errorf("dial count = %d, want 2", dialer.dialCount())
+	}
+}
+
+func TestConnectionPoolHealthCheck(t *testing.T) {
+
+	dialer := &pipeDialer{}
+	pool := newConnectionPool(dialer.dial, 2, time.Minute)
+	defer pool.close()
+
+	c, err := pool.get(context.Background())
+	if err != nil {
+		t.Fatalf("get() error = %v", err)
+	}
+	pool.put(c)
+	c.idleSince = time.Now().Add(-2 * healthCheckIdleTime)
+
+	// an open connection is reused after the probe times out
+	reused, err := pool.get(context.Background())
+	if err != nil {
+		t.Fatalf("get() error = %v", err)
+	}
+	if reused != c {
+		t.Fatal("get() did not reuse the healthy idle connection")
+	}
+	pool.put(reused)
+	reused.idleSince = time.Now().Add(-2 * healthCheckIdleTime)
+
+	// a connection closed by the server is discarded
+	if err := dialer.server(0).Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	fresh, err := pool.get(context.Background())
+	if err != nil {
+		t.Fatalf("get() error = %v", err)
+	}
+	if fresh == c {
+		t.Fatal("get() reused a connection closed by the server")
+	}
+	if dialer.dialCount() != 2 {
+		t.Errorf("dial count = %d, want 2", dialer.dialCount())
+	}
+	if len(pool.slots) != 1 {
+		t.Errorf("open connections = %d, want 1", len(pool.slots))
+	}
+}
+
+func TestConnectionPoolDialBackoff(t *testing.T) {
+
+	dialer := &pipeDialer{err: errors.New("connection refused")}
+	pool := newConnectionPool(dialer.dial, 2, time.Minute)
+	defer pool.close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := pool.get(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("get() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("get() returned after %s, want the backoff to stop when ctx is done", elapsed)
+	}
+	if dialer.dialCount() != 1 {
+		t.Errorf("dial count = %d, want 1", dialer.dialCount())
+	}
+	if len(pool.slots) != 0 {
+		t.Errorf("open connections = %d, want 0 after the dial failed", len(pool.slots))
+	}
+}
+
+func TestConnectionPoolIdleReaper(t *testing.T) {
+
+	dialer := &pipeDialer{}
+	pool := newConnectionPool(dialer.dial, 2, 100*time.Millisecond)
+	defer pool.close()
+
+	c, err := pool.get(context.Background())
+	if err != nil {
+		t.Fatalf("get() error = %v", err)
+	}
+	pool.put(c)
+
+	if !closedByClient(dialer.server(0), time.Second) {
+		t.Fatal("idle connection was not closed after the idle timeout")
+	}
+	if len(pool.slots) != 0 {
+		t.Errorf("open connections = %d, want 0", len(pool.slots))
+	}
+}
+
+func TestConnectionPoolClose(t *testing.T) {
+
+	dialer := &pipeDialer{}
+	pool := newConnectionPool(dialer.dial, 2, time.Minute)
+
+	idle, err := pool.get(context.Background())
+	if err != nil {
+		t.Fatalf("get() error = %v", err)
+	}
+	inUse, err := pool.get(context.Background())
+	if err != nil {
+		t.Fatalf("get() error = %v", err)
+	}
+	pool.put(idle)
+
+	pool.close()
+	pool.close()
+
+	select {
+	case <-pool.done:
+	default:
+		t.Fatal("close() did not stop the idle connection reaper")
+	}
+	if !closedByClient(dialer.server(0), time.Second) {
+		t.Error("close() did not close the idle connection")
+	}
+	if closedByClient(dialer.server(1), 50*time.Millisecond) {
+		t.Error("close() closed a connection in use")
+	}
+	pool.put(inUse)
+	if !closedByClient(dialer.server(1), time.Second) {
+		t.Error("put() did not close a connection returned after close()")
+	}
+	if _, err := pool.get(context.Background()); err != ErrClientClosed {
+		t.Errorf("get() error = %v, want %v", err, ErrClientClosed)
+	}
+	if len(pool.slots) != 0 {
+		t.Errorf("open connections = %d, want 0", len(pool.slots))
+	}
+}
@@ -0,0 +1,109 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package kmipclient
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"intel/kbs/v1/constant"
+
+	"github.com/gemalto/kmip-go"
+	"github.com/gemalto/kmip-go/kmip14"
+	"github.com/gemalto/kmip-go/ttlv"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// supportedVersions are the kmip protocol versions of the client, highest first
+var supportedVersions = []string{constant.KMIP21, constant.KMIP20, constant.KMIP14}
+
+func isSupportedVersion(version string) bool {
+	for _, supported := range supportedVersions {
+		if version == supported {
+			return true
+		}
+	}
+	return false
+}
+
+func protocolVersion(version string) kmip.ProtocolVersion {
+	var protocolVersion kmip.ProtocolVersion
+	_, _ = fmt.Sscanf(version, "%d.%d", &protocolVersion.ProtocolVersionMajor, &protocolVersion.ProtocolVersionMinor)
+	return protocolVersion
+}
+
+func versionString(protocolVersion kmip.ProtocolVersion) string {
+	return fmt.Sprintf("%d.%d", protocolVersion.ProtocolVersionMajor, protocolVersion.ProtocolVersionMinor)
+}
+
+// negotiateVersion selects the highest protocol version supported by both the client and the
+// server with Discover Versions. A configured version is the highest version offered to the
+// server, and is used as is when the server does not implement Discover Versions.
+func (kc *kmipClient) negotiateVersion(ctx context.Context, configuredVersion string) error {
+
+	// supportedVersions is ordered highest first, versions above the configured version are skipped
+	var offered []kmip.ProtocolVersion
+	for _, version := range supportedVersions {
+		if version == configuredVersion {
+			offered = nil
+		}
+		offered = append(offered, protocolVersion(version))
+	}
+
+	// every server supporting one of the offered versions accepts a request in the lowest of them
+	kc.KMIPVersion = versionString(offered[len(offered)-1])
+	kc.requestHeader.ProtocolVersion = offered[len(offered)-1]
+
+	discoverVersionsPayload := kmip.DiscoverVersionsRequestPayload{
+		ProtocolVersion: offered,
+	}
+	batchItem, decoder, err := kc.SendRequest(ctx, discoverVersionsPayload, kmip14.OperationDiscoverVersions)
+	if errors.Is(err, ErrOperationFailed) && configuredVersion != "" {
+		log.WithError(err).Warnf("kmipclient/version:negotiateVersion() Kmip server does not support version discovery, using configured version %s", configuredVersion)
+		kc.KMIPVersion = configuredVersion
+		kc.requestHeader.ProtocolVersion = protocolVersion(configuredVersion)
+		return nil
+	} else if err != nil {
+		return errors.Wrap(err, "failed to perform discover versions operation")
+	}
+
+	var respPayload kmip.DiscoverVersionsResponsePayload
+	if batchItem.ResponsePayload != nil {
+		err = decoder.DecodeValue(&respPayload, batchItem.ResponsePayload.(ttlv.TTLV))
+		if err != nil {
+			return errors.Wrap(err, "failed to decode discover versions response payload")
+		}
+	}
+
+	// the server returns the offered versions it supports, offered is ordered highest first
+	for _, version := range offered {
+		for _, serverVersion := range respPayload.ProtocolVersion {
+			if version == serverVersion {
+				kc.KMIPVersion = versionString(version)
+				kc.requestHeader.ProtocolVersion = version
+				return nil
+			}
+		}
+	}
+	return errors.Errorf("kmip server does not support any of the protocol versions %s", versionStrings(offered))
+}
+
+func versionStrings(versions []kmip.ProtocolVersion) string {
+	s := make([]string, len(versions))
+	for i, version := range versions {
+		s[i] = versionString(version)
+	}
+	return strings.Join(s, ", ")
+}
+
+// isKMIP2 reports whether the negotiated version is kmip 2.0 or later. Kmip 2.0 replaced template
+// attributes with the Attributes structure, kmip 2.1 requests are encoded like kmip 2.0 requests.
+func (kc *kmipClient) isKMIP2() bool {
+	return protocolVersion(kc.KMIPVersion).ProtocolVersionMajor >= 2
+}
@@ -0,0 +1,230 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package kmsplugin
+
+import (
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"intel/kbs/v1/config"
+	"intel/kbs/v1/model"
+)
+
+// pluginStartPollInterval is the interval in which the socket of a starting plugin is polled
+const pluginStartPollInterval = 100 * time.Millisecond
+
+// PluginClient calls a key manager plugin
+type PluginClient interface {
+	InitializeClient(*config.PluginConfig) error
+	Capabilities() (*Capabilities, error)
+	Health() (*Health, error)
+	CreateKey(*model.KeyRequest) (*model.KeyAttributes, error)
+	DeleteKey(*model.KeyAttributes) error
+	RegisterKey(*model.KeyRequest) (*model.KeyAttributes, error)
+	TransferKey(*model.KeyAttributes) ([]byte, error)
+}
+
+type pluginClient struct {
+	socketPath string
+	timeout    time.Duration
+
+	mu sync.Mutex
+	// client is nil until the first call and after a connection failure
+	client *rpc.Client
+}
+
+func NewPluginClient() PluginClient {
+	return &pluginClient{}
+}
+
+// InitializeClient starts the plugin when a command is configured and connects to its socket
+func (pc *pluginClient) InitializeClient(pluginConfig *config.PluginConfig) error {
+
+	if pluginConfig.SocketPath == "" {
+		return errors.New("kmsplugin/client:InitializeClient() Plugin socket path is not provided")
+	}
+	pc.socketPath = pluginConfig.SocketPath
+	pc.timeout = time.Duration(pluginConfig.Timeout) * time.Second
+
+	if pluginConfig.Command != "" {
+		if err := pc.startPlugin(pluginConfig.Command, pluginConfig.Args); err != nil {
+			return err
+		}
+	}
+
+	if err := pc.connect(); err != nil {
+		return errors.Wrapf(err, "kmsplugin/client:InitializeClient() Failed to connect to plugin on %s", pc.socketPath)
+	}
+	log.Infof("kmsplugin/client:InitializeClient() Connected to plugin on %s", pc.socketPath)
+	return nil
+}
+
+// startPlugin starts the plugin command with the socket path in its environment and waits until
+// the plugin listens on the socket
+func (pc *pluginClient) startPlugin(command string, args []string) error {
+
+	// a socket left behind by a previous plugin process must not be mistaken for the new plugin
+	if err := os.Remove(pc.socketPath); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "kmsplugin/client:startPlugin() Failed to remove stale socket %s", pc.socketPath)
+	}
+
+	cmd := exec.Command(command, args...)
+	cmd.Env = append(os.Environ(), SocketPathEnv+"="+pc.socketPath)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return errors.Wrapf(err, "kmsplugin/client:startPlugin() Failed to start plugin %s", command)
+	}
+	exited := make(chan error, 1)
+	go func() {
+		err := cmd.Wait()
+		log.WithError(err).Errorf("kmsplugin/client:startPlugin() Plugin %s exited", command)
+		exited <- err
+	}()
+
+	deadline := time.Now().Add(pc.timeout)
+	for {
+		if _, err := os.Stat(pc.socketPath); err == nil {
+			return nil
+		}
+		select {
+		case err := <-exited:
+			return errors.Errorf("kmsplugin/client:startPlugin() Plugin %s exited on startup: %v", command, err)
+		case <-time.After(pluginStartPollInterval):
+		}
+		if time.Now().After(deadline) {
+			return errors.Errorf("kmsplugin/client:startPlugin() Plugin %s did not listen on %s within %s", command, pc.socketPath, pc.timeout)
+		}
+	}
+}
+
+// connect dials the plugin and checks that it implements the protocol version of the KBS
+func (pc *pluginClient) connect() error {
+
+	capabilities, err := pc.Capabilities()
+	if err != nil {
+		return err
+	}
+	if capabilities.ProtocolVersion != ProtocolVersion {
+		return errors.Errorf("plugin %s implements protocol version %d, version %d is required", capabilities.Name, capabilities.ProtocolVersion, ProtocolVersion)
+	}
+	health, err := pc.Health()
+	if err != nil {
+		return err
+	}
+	if !health.Healthy {
+		return errors.Errorf("plugin %s is not healthy: %s", capabilities.Name, health.Message)
+	}
+	return nil
+}
+
+// call calls a method of the plugin service. The connection is re-established on the next call
+// when it fails, calls are not retried since they may have been executed by the plugin.
+func (pc *pluginClient) call(method string, args, reply interface{}) error {
+
+	client, err := pc.rpcClient()
+	if err != nil {
+		return err
+	}
+
+	call := client.Go(ServiceName+"."+method, args, reply, make(chan *rpc.Call, 1))
+	timer := time.NewTimer(pc.timeout)
+	defer timer.Stop()
+	select {
+	case <-call.Done:
+		err = call.Error
+	case <-timer.C:
+		err = errors.Errorf("plugin call %s timed out after %s", method, pc.timeout)
+	}
+	if err == nil {
+		return nil
+	}
+
+	var serverError rpc.ServerError
+	if errors.As(err, &serverError) {
+		return errors.New(string(serverError))
+	}
+	pc.reset(client)
+	return errors.Wrapf(err, "plugin call %s failed", method)
+}
+
+func (pc *pluginClient) rpcClient() (*rpc.Client, error) {
+
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if pc.client != nil {
+		return pc.client, nil
+	}
+	conn, err := net.DialTimeout("unix", pc.socketPath, pc.timeout)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to connect to plugin on %s", pc.socketPath)
+	}
+	pc.client = jsonrpc.NewClient(conn)
+	return pc.client, nil
+}
+
+// reset closes a failed connection unless it has already been replaced
+func (pc *pluginClient) reset(client *rpc.Client) {
+
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if pc.client == client {
+		_ = client.Close()
+		pc.client = nil
+	}
+}
+
+func (pc *pluginClient) Capabilities() (*Capabilities, error) {
+	var capabilities Capabilities
+	if err := pc.call("Capabilities", &Empty{}, &capabilities); err != nil {
+		return nil, err
+	}
+	return &capabilities, nil
+}
+
+func (pc *pluginClient) Health() (*Health, error) {
+	var health Health
+	if err := pc.call("Health", &Empty{}, &health); err != nil {
+		return nil, err
+	}
+	return &health, nil
+}
+
+func (pc *pluginClient) CreateKey(request *model.KeyRequest) (*model.KeyAttributes, error) {
+	var keyAttributes model.KeyAttributes
+	if err := pc.call("CreateKey", &KeyRequest{KeyID: request.KeyId, Request: request}, &keyAttributes); err != nil {
+		return nil, err
+	}
+	return &keyAttributes, nil
+}
+
+func (pc *pluginClient) DeleteKey(attributes *model.KeyAttributes) error {
+	return pc.call("DeleteKey", attributes, &Empty{})
+}
+
+func (pc *pluginClient) RegisterKey(request *model.KeyRequest) (*model.KeyAttributes, error) {
+	var keyAttributes model.KeyAttributes
+	if err := pc.call("RegisterKey", &KeyRequest{KeyID: request.KeyId, Request: request}, &keyAttributes); err != nil {
+		return nil, err
+	}
+	return &keyAttributes, nil
+}
+
+func (pc *pluginClient) TransferKey(attributes *model.KeyAttributes) ([]byte, error) {
+	var reply TransferKeyReply
+	if err := pc.call("TransferKey", attributes, &reply); err != nil {
+		return nil, err
+	}
+	return reply.KeyMaterial, nil
+}
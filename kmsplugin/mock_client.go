@@ -0,0 +1,80 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package kmsplugin
+
+import (
+	"github.com/stretchr/testify/mock"
+	"intel/kbs/v1/config"
+	"intel/kbs/v1/model"
+)
+
+// MockPluginClient is a mock of PluginClient interface
+type MockPluginClient struct {
+	mock.Mock
+}
+
+// NewMockPluginClient creates a new mock instance
+func NewMockPluginClient() *MockPluginClient {
+	return &MockPluginClient{}
+}
+
+// InitializeClient mocks base method
+func (m *MockPluginClient) InitializeClient(pluginConfig *config.PluginConfig) error {
+	args := m.Called(pluginConfig)
+	return args.Error(0)
+}
+
+// Capabilities mocks base method
+func (m *MockPluginClient) Capabilities() (*Capabilities, error) {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*Capabilities), args.Error(1)
+}
+
+// Health mocks base method
+func (m *MockPluginClient) Health() (*Health, error) {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*Health), args.Error(1)
+}
+
+// CreateKey mocks base method
+func (m *MockPluginClient) CreateKey(request *model.KeyRequest) (*model.KeyAttributes, error) {
+	args := m.Called(request)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.KeyAttributes), args.Error(1)
+}
+
+// DeleteKey mocks base method
+func (m *MockPluginClient) DeleteKey(attributes *model.KeyAttributes) error {
+	args := m.Called(attributes)
+	return args.Error(0)
+}
+
+// RegisterKey mocks base method
+func (m *MockPluginClient) RegisterKey(request *model.KeyRequest) (*model.KeyAttributes, error) {
+	args := m.Called(request)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.KeyAttributes), args.Error(1)
+}
+
+// TransferKey mocks base method
+func (m *MockPluginClient) TransferKey(attributes *model.KeyAttributes) ([]byte, error) {
+	args := m.Called(attributes)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]byte), args.Error(1)
+}
@@ -0,0 +1,60 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+// Package kmsplugin implements the protocol between the KBS and key managers that run out of
+// process. A plugin serves JSON-RPC 1.0 (net/rpc/jsonrpc) on a Unix socket. The methods of the
+// service mirror the KeyManager interface of the KBS, plus Capabilities and Health calls.
+package kmsplugin
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+	"intel/kbs/v1/model"
+)
+
+// ProtocolVersion is incremented on incompatible changes of the plugin protocol. The KBS rejects
+// plugins that implement another version.
+const ProtocolVersion = 1
+
+// ServiceName is the name of the service served by a plugin, e.g. the CreateKey method is
+// called as KeyManagerV1.CreateKey
+var ServiceName = fmt.Sprintf("KeyManagerV%d", ProtocolVersion)
+
+// SocketPathEnv is the environment variable that tells a plugin started by the KBS the path of
+// the socket to listen on
+const SocketPathEnv = "KBS_PLUGIN_SOCKET"
+
+// Empty is the argument or reply of calls that carry no data
+type Empty struct{}
+
+// Capabilities describes a plugin, it is requested by the KBS when it connects to the plugin
+type Capabilities struct {
+	ProtocolVersion int    `json:"protocol_version"`
+	Name            string `json:"name"`
+	// Algorithms lists the key algorithms supported by the plugin, i.e. AES, RSA or EC, and SECRET
+	// when the plugin stores opaque secrets
+	Algorithms []string `json:"algorithms"`
+}
+
+// Health is the health of a plugin and of the key manager behind it
+type Health struct {
+	Healthy bool   `json:"healthy"`
+	Message string `json:"message,omitempty"`
+}
+
+// KeyRequest is the argument of CreateKey and RegisterKey. KeyID is set when a key is re-imported
+// under its original ID, e.g. on restore, and is nil otherwise.
+type KeyRequest struct {
+	KeyID   uuid.UUID         `json:"key_id"`
+	Request *model.KeyRequest `json:"request"`
+}
+
+// TransferKeyReply is the reply of TransferKey. AES keys are returned as their value, private
+// keys in PKCS#8 or PKCS#1 format.
+type TransferKeyReply struct {
+	KeyMaterial []byte `json:"key_material"`
+}
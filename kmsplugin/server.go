@@ -0,0 +1,125 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package kmsplugin
+
+import (
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"intel/kbs/v1/model"
+)
+
+// KeyManager is implemented by the key manager a plugin serves. It has the methods of the
+// KeyManager interface of the KBS, so in-tree key managers can be served as they are.
+type KeyManager interface {
+	CreateKey(*model.KeyRequest) (*model.KeyAttributes, error)
+	DeleteKey(*model.KeyAttributes) error
+	RegisterKey(*model.KeyRequest) (*model.KeyAttributes, error)
+	TransferKey(*model.KeyAttributes) ([]byte, error)
+}
+
+// HealthChecker is implemented by key managers that can report the health of their backend
+type HealthChecker interface {
+	Health() error
+}
+
+// Serve serves keyManager on a Unix socket at socketPath until the listener fails. The socket is
+// only accessible by the user running the plugin, key material is exchanged in plaintext over it.
+func Serve(keyManager KeyManager, capabilities Capabilities, socketPath string) error {
+
+	if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "kmsplugin/server:Serve() Failed to remove stale socket %s", socketPath)
+	}
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return errors.Wrapf(err, "kmsplugin/server:Serve() Failed to listen on %s", socketPath)
+	}
+	defer listener.Close()
+	if err := os.Chmod(socketPath, 0600); err != nil {
+		return errors.Wrapf(err, "kmsplugin/server:Serve() Failed to restrict permissions of %s", socketPath)
+	}
+
+	server := rpc.NewServer()
+	capabilities.ProtocolVersion = ProtocolVersion
+	if err := server.RegisterName(ServiceName, &service{keyManager: keyManager, capabilities: capabilities}); err != nil {
+		return errors.Wrap(err, "kmsplugin/server:Serve() Failed to register plugin service")
+	}
+
+	log.Infof("kmsplugin/server:Serve() Plugin %s listening on %s", capabilities.Name, socketPath)
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return errors.Wrap(err, "kmsplugin/server:Serve() Failed to accept connection")
+		}
+		go server.ServeCodec(jsonrpc.NewServerCodec(conn))
+	}
+}
+
+// service exposes a key manager through net/rpc
+type service struct {
+	keyManager   KeyManager
+	capabilities Capabilities
+}
+
+func (s *service) Capabilities(_ *Empty, reply *Capabilities) error {
+	*reply = s.capabilities
+	return nil
+}
+
+func (s *service) Health(_ *Empty, reply *Health) error {
+	reply.Healthy = true
+	if checker, ok := s.keyManager.(HealthChecker); ok {
+		if err := checker.Health(); err != nil {
+			reply.Healthy = false
+			reply.Message = err.Error()
+		}
+	}
+	return nil
+}
+
+func (s *service) CreateKey(args *KeyRequest, reply *model.KeyAttributes) error {
+	if args.Request == nil || args.Request.KeyInfo == nil {
+		return errors.New("key request must be provided")
+	}
+	args.Request.KeyId = args.KeyID
+	keyAttributes, err := s.keyManager.CreateKey(args.Request)
+	if err != nil {
+		return err
+	}
+	*reply = *keyAttributes
+	return nil
+}
+
+func (s *service) DeleteKey(args *model.KeyAttributes, _ *Empty) error {
+	return s.keyManager.DeleteKey(args)
+}
+
+func (s *service) RegisterKey(args *KeyRequest, reply *model.KeyAttributes) error {
+	if args.Request == nil || args.Request.KeyInfo == nil {
+		return errors.New("key request must be provided")
+	}
+	args.Request.KeyId = args.KeyID
+	keyAttributes, err := s.keyManager.RegisterKey(args.Request)
+	if err != nil {
+		return err
+	}
+	*reply = *keyAttributes
+	return nil
+}
+
+func (s *service) TransferKey(args *model.KeyAttributes, reply *TransferKeyReply) error {
+	keyMaterial, err := s.keyManager.TransferKey(args)
+	if err != nil {
+		return err
+	}
+	reply.KeyMaterial = keyMaterial
+	return nil
+}
@@ -0,0 +1,158 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+// Package localkeystore keeps key material in a directory on the local disk. Each key is a
+// separate record sealed with AES-256-GCM under the master key of the keystore.
+package localkeystore
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"intel/kbs/v1/constant"
+	"intel/kbs/v1/crypt"
+	"intel/kbs/v1/model"
+)
+
+// recordHeader prefixes every record of the keystore and is bound to the record as additional
+// data together with the key ID
+var recordHeader = []byte("KBSL\x01")
+
+// ErrKeyNotFound is returned when the requested key does not exist in the keystore
+var ErrKeyNotFound = errors.New("key not found")
+
+// LocalKeyStore stores key attributes together with their key material. GetKey returns the key
+// attributes in JSON, like the vault client.
+type LocalKeyStore interface {
+	CreateKey(*model.KeyAttributes) error
+	DeleteKey(id string) error
+	GetKey(id string) ([]byte, error)
+}
+
+type localKeyStore struct {
+	dir  string
+	aead *crypt.AeadCipher
+	// mu serializes the creation and deletion of records
+	mu sync.Mutex
+}
+
+// NewLocalKeyStore opens the keystore in dir, creating the directory when it does not exist
+func NewLocalKeyStore(dir string, masterKey []byte) (LocalKeyStore, error) {
+
+	if len(masterKey) != constant.LocalKeystoreMasterKeyLength {
+		return nil, errors.Errorf("localkeystore/keystore:NewLocalKeyStore() Master key must be %d bytes long", constant.LocalKeystoreMasterKeyLength)
+	}
+	aead, err := crypt.NewAeadCipher(masterKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "localkeystore/keystore:NewLocalKeyStore() Failed to create keystore cipher")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrapf(err, "localkeystore/keystore:NewLocalKeyStore() Failed to create keystore directory %s", dir)
+	}
+	return &localKeyStore{dir: dir, aead: aead}, nil
+}
+
+func (ks *localKeyStore) CreateKey(keyAttributes *model.KeyAttributes) error {
+
+	id := keyAttributes.ID.String()
+	data, err := json.Marshal(keyAttributes)
+	defer crypt.ZeroizeByteArray(data)
+	if err != nil {
+		return errors.Wrap(err, "localkeystore/keystore:CreateKey() Failed to marshal key attributes")
+	}
+	sealed, err := ks.aead.Seal(data, additionalData(id))
+	if err != nil {
+		return errors.Wrapf(err, "localkeystore/keystore:CreateKey() Failed to seal key %s", id)
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	path := filepath.Join(ks.dir, id)
+	if _, err := os.Stat(path); err == nil {
+		return errors.Errorf("localkeystore/keystore:CreateKey() Key %s already exists", id)
+	}
+	// the record is written to a temporary file first so that a partially written record is
+	// never read
+	tmpFile, err := os.CreateTemp(ks.dir, "."+id+"-*")
+	if err != nil {
+		return errors.Wrapf(err, "localkeystore/keystore:CreateKey() Failed to create record of key %s", id)
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err := tmpFile.Write(append(append([]byte{}, recordHeader...), sealed...)); err != nil {
+		_ = tmpFile.Close()
+		return errors.Wrapf(err, "localkeystore/keystore:CreateKey() Failed to write record of key %s", id)
+	}
+	if err := tmpFile.Sync(); err != nil {
+		_ = tmpFile.Close()
+		return errors.Wrapf(err, "localkeystore/keystore:CreateKey() Failed to write record of key %s", id)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return errors.Wrapf(err, "localkeystore/keystore:CreateKey() Failed to write record of key %s", id)
+	}
+	if err := os.Rename(tmpFile.Name(), path); err != nil {
+		return errors.Wrapf(err, "localkeystore/keystore:CreateKey() Failed to store record of key %s", id)
+	}
+	return nil
+}
+
+func (ks *localKeyStore) DeleteKey(id string) error {
+
+	path, err := ks.recordPath(id)
+	if err != nil {
+		return err
+	}
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if err := os.Remove(path); err != nil {
+		if os.IsNotExist(err) {
+			return ErrKeyNotFound
+		}
+		return errors.Wrapf(err, "localkeystore/keystore:DeleteKey() Unable to remove record of key %s", id)
+	}
+	return nil
+}
+
+func (ks *localKeyStore) GetKey(id string) ([]byte, error) {
+
+	path, err := ks.recordPath(id)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrKeyNotFound
+		}
+		return nil, errors.Wrapf(err, "localkeystore/keystore:GetKey() Unable to read record of key %s", id)
+	}
+	if !bytes.HasPrefix(data, recordHeader) {
+		return nil, errors.Errorf("localkeystore/keystore:GetKey() Record of key %s is not a keystore record", id)
+	}
+	keyInfo, err := ks.aead.Open(data[len(recordHeader):], additionalData(id))
+	if err != nil {
+		return nil, errors.Wrapf(err, "localkeystore/keystore:GetKey() Record of key %s failed integrity check", id)
+	}
+	return keyInfo, nil
+}
+
+// recordPath returns the path of the record of a key, the ID is checked so that it cannot
+// reference a file outside of the keystore
+func (ks *localKeyStore) recordPath(id string) (string, error) {
+	keyId, err := uuid.Parse(id)
+	if err != nil {
+		return "", errors.Wrapf(err, "localkeystore/keystore: Invalid key ID %s", id)
+	}
+	return filepath.Join(ks.dir, keyId.String()), nil
+}
+
+func additionalData(id string) []byte {
+	return append(append([]byte{}, recordHeader...), []byte(id)...)
+}
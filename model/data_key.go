@@ -0,0 +1,34 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package model
+
+// DataKeyRequest requests a data key generated by the KBS for envelope encryption. The
+// attestation of the workload is provided as for a key transfer.
+type DataKeyRequest struct {
+	KeyTransferRequest
+	// Length of the data key in bits, 128, 192 or 256. The default is 256.
+	// example: 256
+	KeyLength int `json:"key_length,omitempty"`
+}
+
+// DataKeyDecryptRequest requests the data key of a ciphertext returned with a generated data key.
+// The attestation of the workload is provided as for a key transfer.
+type DataKeyDecryptRequest struct {
+	KeyTransferRequest
+	// The data key encrypted under the master key, as returned when the data key was generated
+	// example: AgAAAFsAAAB7ImtleV9pZCI6ImZjMGNjNzc5LTIyYjYtNDc0MS1iMGQ5LWUyZTY5NjM1YWQxZSIs...
+	Ciphertext []byte `json:"ciphertext,omitempty"`
+}
+
+// DataKeyResponse holds the data key wrapped to the workload like a transferred key, and for
+// generated data keys the data key encrypted under the master key
+type DataKeyResponse struct {
+	*KeyTransferResponse
+	// Ciphertext is the data key encrypted under the master key in a version 2 wrapped key
+	// envelope, to be stored with the data encrypted under the data key
+	Ciphertext []byte `json:"ciphertext,omitempty"`
+}
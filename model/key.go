@@ -13,11 +13,16 @@ import (
 )
 
 type KeyRequest struct {
-	KeyInfo *KeyInfo `json:"key_information"`
+	// Set internally to preserve the ID of a key that is re-imported, e.g. on restore
+	KeyId   uuid.UUID `json:"-"`
+	KeyInfo *KeyInfo  `json:"key_information"`
 	// Universal Unique IDentifier of the Key Transfer Policy
 	// required: true
 	// example: 4110594b-a753-4457-7d7f-3e52b62f2ed8
 	TransferPolicyID uuid.UUID `json:"transfer_policy_id,omitempty"`
+	// Name of the key manager backend that holds the key, the default backend is used when not set
+	// example: hsm
+	KeyManager string `json:"key_manager,omitempty"`
 }
 
 type KeyUpdateRequest struct {
@@ -39,31 +44,37 @@ type KeyResponse struct {
 	// example: 4110594b-a753-4457-7d7f-3e52b62f2ed8
 	TransferPolicyID uuid.UUID `json:"transfer_policy_id,omitempty"`
 	TransferLink     string    `json:"transfer_link"`
-	CreatedAt        time.Time `json:"created_at"`
+	// Name of the key manager backend that holds the key
+	// example: hsm
+	KeyManager string    `json:"key_manager,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
 }
 
 type KeyInfo struct {
-	// Denotes the Encryption Algorithm (AES, RSA or EC) used while creating the key
+	// Denotes the Algorithm (AES, HMAC, CHACHA20, RSA, EC, ED25519 or X25519) used while creating the key
 	// required: true
 	// example: rsa
 	Algorithm string `json:"algorithm"`
-	// Denotes the key length in bits used while creating the key
-	// required: true
+	// Denotes the key length in bits used while creating AES, HMAC, ChaCha20 and RSA keys
 	// example: 3072
 	KeyLength int `json:"key_length,omitempty"`
 	// Denotes the curve type used while creating the EC key
 	// example: secp384r1
 	CurveType string `json:"curve_type,omitempty"`
-	// Denotes the private key(RSA/EC) or AES key in base64 string
+	// Denotes the private key (RSA/EC/Ed25519/X25519) or the AES, HMAC or ChaCha20 key in base64 string
 	// example: YG2UtIG6OtaPjIIHQXJGxRmR0ozqiF3iQoVztc74ijo=
 	KeyData string `json:"key_data,omitempty"`
 	// KMIP Key ID, if the key is already created in KMIP Backend
 	// example: 7110194b-a703-4657-9d7f-3e02b62f2ed8
 	KmipKeyID string `json:"kmip_key_id,omitempty"`
+	// Encoding the key is transferred in unless the transfer request asks for another, raw or
+	// jwk for AES, HMAC and ChaCha20 keys and pkcs1 (RSA), sec1 (EC), pkcs8 or jwk for private keys
+	// example: pkcs8
+	KeyEncoding string `json:"key_encoding,omitempty"`
 }
 
 type KeyFilterCriteria struct {
-	// Denotes the Encryption Algorithm (AES, RSA or EC) used while creating the key
+	// Denotes the Algorithm (AES, HMAC, CHACHA20, RSA, EC, ED25519 or X25519) used while creating the key
 	// example: rsa
 	Algorithm string
 	// Denotes the key length in bits used while creating the key
@@ -21,6 +21,9 @@ type KeyAttributes struct {
 	PublicKey        string    `json:"public_key,omitempty"`
 	PrivateKey       string    `json:"private_key,omitempty"`
 	KmipKeyID        string    `json:"kmip_key_id,omitempty"`
+	KeyManager       string    `json:"key_manager,omitempty"`
+	KeyEncoding      string    `json:"key_encoding,omitempty"`
+	ContentType      string    `json:"content_type,omitempty"`
 	TransferPolicyId uuid.UUID `json:"transfer_policy_id,omitempty"`
 	TransferLink     string    `json:"transfer_link,omitempty"`
 	CreatedAt        time.Time `json:"created_at,omitempty"`
@@ -29,10 +32,11 @@ type KeyAttributes struct {
 func (ka *KeyAttributes) ToKeyResponse() *KeyResponse {
 
 	keyInfo := KeyInfo{
-		Algorithm: ka.Algorithm,
-		KeyLength: ka.KeyLength,
-		CurveType: ka.CurveType,
-		KmipKeyID: ka.KmipKeyID,
+		Algorithm:   ka.Algorithm,
+		KeyLength:   ka.KeyLength,
+		CurveType:   ka.CurveType,
+		KmipKeyID:   ka.KmipKeyID,
+		KeyEncoding: ka.KeyEncoding,
 	}
 
 	keyResponse := KeyResponse{
@@ -40,8 +44,25 @@ func (ka *KeyAttributes) ToKeyResponse() *KeyResponse {
 		KeyInfo:          &keyInfo,
 		TransferPolicyID: ka.TransferPolicyId,
 		TransferLink:     ka.TransferLink,
+		KeyManager:       ka.KeyManager,
 		CreatedAt:        ka.CreatedAt,
 	}
 
 	return &keyResponse
 }
+
+// ToSecretResponse returns the response of a secret, whose size is held in KeyLength in bits
+func (ka *KeyAttributes) ToSecretResponse() *SecretResponse {
+
+	secretResponse := SecretResponse{
+		ID:               ka.ID,
+		ContentType:      ka.ContentType,
+		Size:             ka.KeyLength / 8,
+		TransferPolicyID: ka.TransferPolicyId,
+		TransferLink:     ka.TransferLink,
+		KeyManager:       ka.KeyManager,
+		CreatedAt:        ka.CreatedAt,
+	}
+
+	return &secretResponse
+}
@@ -7,6 +7,7 @@
 package model
 
 import (
+	"github.com/google/uuid"
 	itaConnector "github.com/intel/trustauthority-client/go-connector"
 )
 
@@ -26,9 +27,81 @@ type KeyTransferRequest struct {
 	// Log of all events that get extended to RTMRs (runtime-extendable measurement registers) . RTMR event log is available through ACPI.
 	// example: [ { "rtmr": {  "index":1....
 	EventLog []byte `json:"event_log,omitempty"`
+	// Encoding of the transferred key, raw or jwk for AES keys and pkcs1 (RSA), sec1 (EC), pkcs8
+	// or jwk for private keys. The encoding of the key is used when it is not set.
+	// example: pkcs8
+	KeyEncoding string `json:"key_encoding,omitempty"`
+}
+
+// WrapAlgorithmAESKWP marks a wrapped key that is wrapped under the SWK with AES key wrap with
+// padding (RFC 5649) instead of AES-GCM
+const WrapAlgorithmAESKWP = "AES-KWP"
+
+// SWKWrapAlgorithmECDHES marks an SWK that is wrapped to an EC workload key with ECDH-ES+A256KW
+// (RFC 7518 section 4.6) instead of RSA-OAEP
+const SWKWrapAlgorithmECDHES = "ECDH-ES+A256KW"
+
+// Formats of the key transfer response. The legacy format returns the key wrapped under the SWK
+// with AES-GCM in a custom binary layout, the jwe format returns a JWE with RSA-OAEP-256 and
+// A256GCM, or ECDH-ES+A256KW and A256GCM for EC workload keys.
+const (
+	KeyTransferFormatLegacy = "legacy"
+	KeyTransferFormatJWE    = "jwe"
+)
+
+// Key encapsulations of the SWK. With classical encapsulation the SWK is generated and wrapped
+// to the workload key, with hybrid-mlkem768 it is derived from an ML-KEM-768 and an ECDH shared
+// secret and is not returned.
+const (
+	KeyEncapsulationClassical      = "classical"
+	KeyEncapsulationHybridMLKEM768 = "hybrid-mlkem768"
+)
+
+// Versions of the envelope of the wrapped key. Version 1 is the IV and the AES-GCM ciphertext
+// preceded by their lengths. Version 2 prepends the envelope version and the wrapped key
+// metadata, which are authenticated as additional data of AES-GCM.
+const (
+	EnvelopeVersion1 = 1
+	EnvelopeVersion2 = 2
+)
+
+// Encodings of the key in the wrapped key envelope
+const (
+	KeyEncodingRaw   = "raw"
+	KeyEncodingPKCS1 = "pkcs1"
+	KeyEncodingPKCS8 = "pkcs8"
+	KeyEncodingSEC1  = "sec1"
+	KeyEncodingJWK   = "jwk"
+)
+
+// WrappedKeyMetadata describes the key in a version 2 wrapped key envelope
+type WrappedKeyMetadata struct {
+	KeyID uuid.UUID `json:"key_id"`
+	// KeyVersion is 1, keys are not versioned yet
+	KeyVersion  int       `json:"key_version"`
+	Algorithm   string    `json:"algorithm"`
+	KeyEncoding string    `json:"key_encoding"`
+	PolicyID    uuid.UUID `json:"policy_id"`
+	// EncryptedKey is the key a data key is sealed under, encrypted by the key manager of the
+	// master key. It is empty for data keys sealed under the master key itself.
+	EncryptedKey []byte `json:"encrypted_key,omitempty"`
 }
 
 type KeyTransferResponse struct {
 	WrappedKey []byte `json:"wrapped_key"`
 	WrappedSWK []byte `json:"wrapped_swk,omitempty"`
+	// WrapAlgorithm is empty for keys wrapped with AES-GCM
+	WrapAlgorithm string `json:"wrap_algorithm,omitempty"`
+	// SWKWrapAlgorithm is empty for SWKs wrapped with RSA-OAEP
+	SWKWrapAlgorithm string `json:"swk_wrap_algorithm,omitempty"`
+	// EphemeralPublicKey is the ephemeral ECDH public key in PKIX, ASN.1 DER form for SWKs
+	// wrapped with ECDH-ES
+	EphemeralPublicKey []byte `json:"ephemeral_public_key,omitempty"`
+	// KeyEncapsulation names the hybrid key encapsulation the SWK is derived with, e.g.
+	// ML-KEM-768+X25519, and is empty for wrapped SWKs
+	KeyEncapsulation string `json:"key_encapsulation,omitempty"`
+	// MLKEMCiphertext is the ML-KEM-768 ciphertext of the hybrid key encapsulation
+	MLKEMCiphertext []byte `json:"mlkem_ciphertext,omitempty"`
+	// EnvelopeVersion is the version of the wrapped key envelope, it is empty for version 1
+	EnvelopeVersion int `json:"envelope_version,omitempty"`
 }
@@ -27,6 +27,17 @@ type KeyTransferPolicy struct {
 	SGX *SgxPolicy `json:"sgx,omitempty"`
 	// List of TDX TD Attributes that are part of TDX Policy
 	TDX *TdxPolicy `json:"tdx,omitempty"`
+	// Format of the key transfer response when the workload does not ask for one in the Accept
+	// header, legacy (default) or jwe
+	// example: jwe
+	ResponseFormat string `json:"response_format,omitempty"`
+	// Key encapsulation of the SWK, classical (default) or hybrid-mlkem768
+	// example: hybrid-mlkem768
+	KeyEncapsulation string `json:"key_encapsulation,omitempty"`
+	// Version of the wrapped key envelope when the workload does not ask for one in the
+	// Envelope-Version header, 1 or 2 (default)
+	// example: 2
+	EnvelopeVersion int `json:"envelope_version,omitempty"`
 }
 
 type SgxPolicy struct {
@@ -0,0 +1,53 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package model
+
+import "github.com/google/uuid"
+
+// KmipObject is a key found on a kmip server that can be registered with the KBS
+type KmipObject struct {
+	// Identifier of the key on the kmip server, used as kmip_key_id to register the key
+	// required: true
+	// example: 1
+	KmipKeyID string `json:"kmip_key_id"`
+	// Name of the key manager backend holding the key
+	// example: hsm
+	KeyManager string `json:"key_manager"`
+	// Names of the key on the kmip server
+	// example: ["payments-key"]
+	Names []string `json:"names,omitempty"`
+	// Encryption algorithm of the key (AES, HMAC, CHACHA20, RSA or EC)
+	// example: AES
+	Algorithm string `json:"algorithm"`
+	// Length of the key in bits
+	// example: 256
+	KeyLength int `json:"key_length,omitempty"`
+	// Curve of an EC key
+	// example: secp384r1
+	CurveType string `json:"curve_type,omitempty"`
+	// State of the key on the kmip server, only Active keys can be registered
+	// example: Active
+	State string `json:"state"`
+	// Universal Unique IDentifier of the KBS key that references this key, not set when the key is not registered
+	// example: 4110594b-a753-4457-7d7f-3e52b6252ed6
+	KeyID *uuid.UUID `json:"key_id,omitempty"`
+}
+
+type KmipObjectFilterCriteria struct {
+	// Name of the key manager backend to search, the default backend is used when not set
+	// example: hsm
+	KeyManager string
+	// Name of the key on the kmip server
+	// example: payments-key
+	Name string
+	// Encryption algorithm of the key (AES, HMAC, CHACHA20, RSA or EC)
+	// example: AES
+	Algorithm string
+	// Length of the key in bits
+	// example: 256
+	KeyLength int
+}
@@ -0,0 +1,71 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type SecretRequest struct {
+	SecretId uuid.UUID `json:"-"`
+	// Opaque secret data in base64 string
+	// required: true
+	// example: c2VjcmV0LWRhdGFiYXNlLXBhc3N3b3Jk
+	Data string `json:"data"`
+	// Media type of the secret data
+	// required: true
+	// example: text/plain
+	ContentType string `json:"content_type"`
+	// Universal Unique IDentifier of the Key Transfer Policy
+	// required: true
+	// example: 4110594b-a753-4457-7d7f-3e52b62f2ed8
+	TransferPolicyID uuid.UUID `json:"transfer_policy_id,omitempty"`
+	// Name of the key manager backend that holds the secret, the default backend is used when not set
+	// example: hsm
+	KeyManager string `json:"key_manager,omitempty"`
+}
+
+type SecretUpdateRequest struct {
+	SecretId uuid.UUID `json:"-"`
+	// Universal Unique IDentifier of the Key Transfer Policy
+	// required: true
+	// example: 4110594b-a753-4457-7d7f-3e52b6252ed6
+	TransferPolicyID uuid.UUID `json:"transfer_policy_id"`
+}
+
+type SecretResponse struct {
+	// Universal Unique IDentifier of the Secret created
+	// required: true
+	// example: 2a6b8c5e-6f1d-4a3b-9c7e-5d4f3e2a1b0c
+	ID uuid.UUID `json:"id"`
+	// Media type of the secret data
+	// example: text/plain
+	ContentType string `json:"content_type"`
+	// Size of the secret data in bytes
+	// example: 24
+	Size int `json:"size"`
+	// Universal Unique IDentifier of the Key Transfer Policy
+	// required: true
+	// example: 4110594b-a753-4457-7d7f-3e52b62f2ed8
+	TransferPolicyID uuid.UUID `json:"transfer_policy_id,omitempty"`
+	TransferLink     string    `json:"transfer_link"`
+	// Name of the key manager backend that holds the secret
+	// example: hsm
+	KeyManager string    `json:"key_manager,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type SecretFilterCriteria struct {
+	// Media type of the secret data
+	// example: text/plain
+	ContentType string
+	// Universal Unique IDentifier of the Key Transfer Policy
+	// example: 4110594b-a753-4457-7d7f-3e52b62f2ed8
+	TransferPolicyId uuid.UUID
+}
@@ -0,0 +1,116 @@
+//go:build cgo
+
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package pkcs11client
+
+import (
+	"intel/kbs/v1/config"
+
+	"github.com/miekg/pkcs11"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+type pkcs11Client struct {
+	ctx         *pkcs11.Ctx
+	slot        uint
+	labelPrefix string
+	// loginSession stays open for the lifetime of the client, the login state of a token is
+	// shared by all sessions of the application
+	loginSession pkcs11.SessionHandle
+}
+
+func NewPkcs11Client() Pkcs11Client {
+	return &pkcs11Client{}
+}
+
+// InitializeClient loads the PKCS#11 module and logs in to the token in the configured slot
+func (pc *pkcs11Client) InitializeClient(pkcs11Config *config.Pkcs11Config) error {
+
+	if pkcs11Config.ModulePath == "" {
+		return errors.New("pkcs11client/client:InitializeClient() PKCS#11 module path is not provided")
+	}
+	if pkcs11Config.Pin == "" {
+		return errors.New("pkcs11client/client:InitializeClient() PKCS#11 user PIN is not provided")
+	}
+
+	ctx := pkcs11.New(pkcs11Config.ModulePath)
+	if ctx == nil {
+		return errors.Errorf("pkcs11client/client:InitializeClient() Failed to load PKCS#11 module %s", pkcs11Config.ModulePath)
+	}
+	// backends sharing a module share its initialization
+	if err := ctx.Initialize(); err != nil && !isError(err, pkcs11.CKR_CRYPTOKI_ALREADY_INITIALIZED) {
+		ctx.Destroy()
+		return errors.Wrap(err, "pkcs11client/client:InitializeClient() Failed to initialize PKCS#11 module")
+	}
+
+	session, err := ctx.OpenSession(pkcs11Config.Slot, pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION)
+	if err != nil {
+		return errors.Wrapf(err, "pkcs11client/client:InitializeClient() Failed to open session on slot %d", pkcs11Config.Slot)
+	}
+	if err := ctx.Login(session, pkcs11.CKU_USER, pkcs11Config.Pin); err != nil && !isError(err, pkcs11.CKR_USER_ALREADY_LOGGED_IN) {
+		_ = ctx.CloseSession(session)
+		return errors.Wrapf(err, "pkcs11client/client:InitializeClient() Failed to log in to the token on slot %d", pkcs11Config.Slot)
+	}
+
+	pc.ctx = ctx
+	pc.slot = pkcs11Config.Slot
+	pc.labelPrefix = pkcs11Config.LabelPrefix
+	pc.loginSession = session
+	log.Infof("pkcs11client/client:InitializeClient() PKCS#11 client initialized with slot %d", pc.slot)
+	return nil
+}
+
+// withSession runs fn in a new session. Sessions must not be used concurrently, so every
+// operation opens its own session. Session objects such as ephemeral keys are destroyed when the
+// session is closed.
+func (pc *pkcs11Client) withSession(fn func(session pkcs11.SessionHandle) error) error {
+
+	if pc.ctx == nil {
+		return errors.New("pkcs11client/client:withSession() PKCS#11 client is not initialized")
+	}
+	session, err := pc.ctx.OpenSession(pc.slot, pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION)
+	if err != nil {
+		return errors.Wrap(err, "failed to open PKCS#11 session")
+	}
+	defer func() {
+		if err := pc.ctx.CloseSession(session); err != nil {
+			log.WithError(err).Warn("pkcs11client/client:withSession() Failed to close PKCS#11 session")
+		}
+	}()
+	return fn(session)
+}
+
+// findObjects returns the objects matching the template
+func (pc *pkcs11Client) findObjects(session pkcs11.SessionHandle, template []*pkcs11.Attribute) ([]pkcs11.ObjectHandle, error) {
+
+	if err := pc.ctx.FindObjectsInit(session, template); err != nil {
+		return nil, errors.Wrap(err, "failed to initialize PKCS#11 object search")
+	}
+	var objects []pkcs11.ObjectHandle
+	for {
+		found, _, err := pc.ctx.FindObjects(session, 16)
+		if err != nil {
+			_ = pc.ctx.FindObjectsFinal(session)
+			return nil, errors.Wrap(err, "failed to search PKCS#11 objects")
+		}
+		if len(found) == 0 {
+			break
+		}
+		objects = append(objects, found...)
+	}
+	if err := pc.ctx.FindObjectsFinal(session); err != nil {
+		return nil, errors.Wrap(err, "failed to finish PKCS#11 object search")
+	}
+	return objects, nil
+}
+
+func isError(err error, code uint) bool {
+	var pkcs11Err pkcs11.Error
+	return errors.As(err, &pkcs11Err) && uint(pkcs11Err) == code
+}
@@ -0,0 +1,32 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package pkcs11client
+
+import (
+	"intel/kbs/v1/config"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNotSupported is returned when the KBS is built without cgo, which the PKCS#11 module
+// loader requires
+var ErrNotSupported = errors.New("pkcs11 not supported in this build")
+
+// ErrKeyNotFound is returned when the token holds no key with the requested name
+var ErrKeyNotFound = errors.New("key not found")
+
+// Pkcs11Client manages keys on a PKCS#11 token. Keys are identified by their name, which is stored
+// as the CKA_ID of the key objects. The key objects are labelled with the label prefix followed by
+// the name.
+type Pkcs11Client interface {
+	InitializeClient(*config.Pkcs11Config) error
+	GenerateSecretKey(name string, length int) error
+	GenerateKeyPair(name, algorithm, curveType string, length int) error
+	ImportKey(name, algorithm string, keyMaterial []byte) error
+	DeleteKey(name string) error
+	WrapKey(name, algorithm string, wrappingKey []byte) ([]byte, error)
+}
@@ -0,0 +1,271 @@
+//go:build cgo
+
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package pkcs11client
+
+import (
+	"encoding/asn1"
+
+	"intel/kbs/v1/constant"
+	"intel/kbs/v1/crypt"
+
+	"github.com/miekg/pkcs11"
+	"github.com/pkg/errors"
+)
+
+// rsaPublicExponent is the public exponent 65537 of generated RSA keys
+var rsaPublicExponent = []byte{0x01, 0x00, 0x01}
+
+// GenerateSecretKey generates an AES key of the given length in bits on the token
+func (pc *pkcs11Client) GenerateSecretKey(name string, length int) error {
+
+	template := append(pc.keyTemplate(name, constant.CRYPTOALGAES),
+		pkcs11.NewAttribute(pkcs11.CKA_VALUE_LEN, length/8),
+	)
+	return pc.withSession(func(session pkcs11.SessionHandle) error {
+		_, err := pc.ctx.GenerateKey(session, []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_AES_KEY_GEN, nil)}, template)
+		if err != nil {
+			return errors.Wrapf(err, "failed to generate AES key %s", name)
+		}
+		return nil
+	})
+}
+
+// GenerateKeyPair generates a key pair on the token. RSA key pairs are generated with the given
+// length, EC key pairs on the given curve.
+func (pc *pkcs11Client) GenerateKeyPair(name, algorithm, curveType string, length int) error {
+
+	publicTemplate := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PUBLIC_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_ID, []byte(name)),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, pc.labelPrefix+name),
+		pkcs11.NewAttribute(pkcs11.CKA_VERIFY, true),
+	}
+	var mechanism *pkcs11.Mechanism
+	switch algorithm {
+	case constant.CRYPTOALGRSA:
+		mechanism = pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS_KEY_PAIR_GEN, nil)
+		publicTemplate = append(publicTemplate,
+			pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_RSA),
+			pkcs11.NewAttribute(pkcs11.CKA_MODULUS_BITS, length),
+			pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, rsaPublicExponent),
+			pkcs11.NewAttribute(pkcs11.CKA_ENCRYPT, true),
+		)
+	case constant.CRYPTOALGEC:
+		params, err := ecParams(curveType)
+		if err != nil {
+			return err
+		}
+		mechanism = pkcs11.NewMechanism(pkcs11.CKM_EC_KEY_PAIR_GEN, nil)
+		publicTemplate = append(publicTemplate,
+			pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_EC),
+			pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, params),
+		)
+	default:
+		return errors.Errorf("unsupported %s algorithm provided", algorithm)
+	}
+
+	privateTemplate := pc.keyTemplate(name, algorithm)
+	return pc.withSession(func(session pkcs11.SessionHandle) error {
+		_, _, err := pc.ctx.GenerateKeyPair(session, []*pkcs11.Mechanism{mechanism}, publicTemplate, privateTemplate)
+		if err != nil {
+			return errors.Wrapf(err, "failed to generate %s key pair %s", algorithm, name)
+		}
+		return nil
+	})
+}
+
+// ImportKey imports an AES key, a PKCS#8 private key or an opaque secret into the token. The key material is
+// wrapped under an ephemeral key and unwrapped by the token, so that it is only stored as a
+// sensitive key.
+func (pc *pkcs11Client) ImportKey(name, algorithm string, keyMaterial []byte) error {
+
+	ephemeralKey, err := crypt.GetDerivedKey(32)
+	if err != nil {
+		return err
+	}
+	defer crypt.ZeroizeByteArray(ephemeralKey)
+	wrappedKey, err := crypt.WrapKeyWithPadding(ephemeralKey, keyMaterial)
+	if err != nil {
+		return err
+	}
+
+	template := pc.keyTemplate(name, algorithm)
+	return pc.withSession(func(session pkcs11.SessionHandle) error {
+		unwrappingKey, err := pc.createSessionKey(session, ephemeralKey, pkcs11.CKA_UNWRAP)
+		if err != nil {
+			return err
+		}
+		_, err = pc.ctx.UnwrapKey(session, []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_AES_KEY_WRAP_PAD, nil)}, unwrappingKey, wrappedKey, template)
+		if err != nil {
+			return errors.Wrapf(err, "failed to import %s key %s", algorithm, name)
+		}
+		return nil
+	})
+}
+
+// DeleteKey destroys the key objects with the given name, i.e. the secret key or both keys of a
+// key pair
+func (pc *pkcs11Client) DeleteKey(name string) error {
+
+	return pc.withSession(func(session pkcs11.SessionHandle) error {
+		objects, err := pc.findObjects(session, []*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+			pkcs11.NewAttribute(pkcs11.CKA_ID, []byte(name)),
+		})
+		if err != nil {
+			return err
+		}
+		if len(objects) == 0 {
+			return errors.Wrapf(ErrKeyNotFound, "failed to delete key %s", name)
+		}
+		for _, object := range objects {
+			if err := pc.ctx.DestroyObject(session, object); err != nil {
+				return errors.Wrapf(err, "failed to delete key %s", name)
+			}
+		}
+		return nil
+	})
+}
+
+// WrapKey returns the key wrapped under wrappingKey with AES key wrap with padding. AES keys are
+// wrapped as their value, private keys in PKCS#8 format.
+func (pc *pkcs11Client) WrapKey(name, algorithm string, wrappingKey []byte) ([]byte, error) {
+
+	var wrappedKey []byte
+	err := pc.withSession(func(session pkcs11.SessionHandle) error {
+		key, err := pc.findKey(session, name, algorithm)
+		if err != nil {
+			return err
+		}
+		wrappingKeyHandle, err := pc.createSessionKey(session, wrappingKey, pkcs11.CKA_WRAP)
+		if err != nil {
+			return err
+		}
+		wrappedKey, err = pc.ctx.WrapKey(session, []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_AES_KEY_WRAP_PAD, nil)}, wrappingKeyHandle, key)
+		if err != nil {
+			return errors.Wrapf(err, "failed to wrap key %s", name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return wrappedKey, nil
+}
+
+// findKey returns the secret key or private key with the given name
+func (pc *pkcs11Client) findKey(session pkcs11.SessionHandle, name, algorithm string) (pkcs11.ObjectHandle, error) {
+
+	class, keyType, err := keyClass(algorithm)
+	if err != nil {
+		return 0, err
+	}
+	objects, err := pc.findObjects(session, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, class),
+		pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, keyType),
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_ID, []byte(name)),
+	})
+	if err != nil {
+		return 0, err
+	}
+	switch len(objects) {
+	case 0:
+		return 0, errors.Wrapf(ErrKeyNotFound, "%s key %s does not exist", algorithm, name)
+	case 1:
+		return objects[0], nil
+	default:
+		return 0, errors.Errorf("token holds %d %s keys with ID %s", len(objects), algorithm, name)
+	}
+}
+
+// keyTemplate returns the attributes of a secret key or private key stored on the token. Keys are
+// sensitive, so that they can only leave the token wrapped.
+func (pc *pkcs11Client) keyTemplate(name, algorithm string) []*pkcs11.Attribute {
+
+	class, keyType, _ := keyClass(algorithm)
+	template := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, class),
+		pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, keyType),
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_PRIVATE, true),
+		pkcs11.NewAttribute(pkcs11.CKA_SENSITIVE, true),
+		pkcs11.NewAttribute(pkcs11.CKA_EXTRACTABLE, true),
+		pkcs11.NewAttribute(pkcs11.CKA_ID, []byte(name)),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, pc.labelPrefix+name),
+	}
+	switch algorithm {
+	case constant.CRYPTOALGAES:
+		template = append(template,
+			pkcs11.NewAttribute(pkcs11.CKA_ENCRYPT, true),
+			pkcs11.NewAttribute(pkcs11.CKA_DECRYPT, true),
+		)
+	case constant.CRYPTOALGRSA:
+		template = append(template,
+			pkcs11.NewAttribute(pkcs11.CKA_DECRYPT, true),
+			pkcs11.NewAttribute(pkcs11.CKA_SIGN, true),
+		)
+	case constant.CRYPTOALGEC:
+		template = append(template, pkcs11.NewAttribute(pkcs11.CKA_SIGN, true))
+	}
+	return template
+}
+
+// createSessionKey creates an ephemeral AES session key with the given usage, e.g. CKA_WRAP
+func (pc *pkcs11Client) createSessionKey(session pkcs11.SessionHandle, key []byte, usage uint) (pkcs11.ObjectHandle, error) {
+
+	handle, err := pc.ctx.CreateObject(session, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_SECRET_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_AES),
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, false),
+		pkcs11.NewAttribute(pkcs11.CKA_SENSITIVE, true),
+		pkcs11.NewAttribute(pkcs11.CKA_EXTRACTABLE, false),
+		pkcs11.NewAttribute(usage, true),
+		pkcs11.NewAttribute(pkcs11.CKA_VALUE, key),
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to create ephemeral key")
+	}
+	return handle, nil
+}
+
+// keyClass returns the object class and key type of the key of an algorithm
+func keyClass(algorithm string) (uint, uint, error) {
+	switch algorithm {
+	case constant.CRYPTOALGAES:
+		return pkcs11.CKO_SECRET_KEY, pkcs11.CKK_AES, nil
+	case constant.CRYPTOALGSECRET:
+		return pkcs11.CKO_SECRET_KEY, pkcs11.CKK_GENERIC_SECRET, nil
+	case constant.CRYPTOALGRSA:
+		return pkcs11.CKO_PRIVATE_KEY, pkcs11.CKK_RSA, nil
+	case constant.CRYPTOALGEC:
+		return pkcs11.CKO_PRIVATE_KEY, pkcs11.CKK_EC, nil
+	default:
+		return 0, 0, errors.Errorf("unsupported %s algorithm provided", algorithm)
+	}
+}
+
+// ecParams returns the DER encoded object identifier of a named curve
+func ecParams(curveType string) ([]byte, error) {
+	var oid asn1.ObjectIdentifier
+	switch curveType {
+	case "prime256v1", "secp256r1":
+		oid = asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}
+	case "secp384r1":
+		oid = asn1.ObjectIdentifier{1, 3, 132, 0, 34}
+	case "secp521r1":
+		oid = asn1.ObjectIdentifier{1, 3, 132, 0, 35}
+	case constant.CurveSecp256k1:
+		oid = asn1.ObjectIdentifier{1, 3, 132, 0, 10}
+	default:
+		return nil, errors.Errorf("unsupported curve type %s provided", curveType)
+	}
+	return asn1.Marshal(oid)
+}
@@ -0,0 +1,61 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package pkcs11client
+
+import (
+	"github.com/stretchr/testify/mock"
+	"intel/kbs/v1/config"
+)
+
+// MockPkcs11Client is a mock of Pkcs11Client interface
+type MockPkcs11Client struct {
+	mock.Mock
+}
+
+// NewMockPkcs11Client creates a new mock instance
+func NewMockPkcs11Client() *MockPkcs11Client {
+	return &MockPkcs11Client{}
+}
+
+// InitializeClient mocks base method
+func (m *MockPkcs11Client) InitializeClient(pkcs11Config *config.Pkcs11Config) error {
+	args := m.Called(pkcs11Config)
+	return args.Error(0)
+}
+
+// GenerateSecretKey mocks base method
+func (m *MockPkcs11Client) GenerateSecretKey(name string, length int) error {
+	args := m.Called(name, length)
+	return args.Error(0)
+}
+
+// GenerateKeyPair mocks base method
+func (m *MockPkcs11Client) GenerateKeyPair(name, algorithm, curveType string, length int) error {
+	args := m.Called(name, algorithm, curveType, length)
+	return args.Error(0)
+}
+
+// ImportKey mocks base method
+func (m *MockPkcs11Client) ImportKey(name, algorithm string, keyMaterial []byte) error {
+	args := m.Called(name, algorithm, keyMaterial)
+	return args.Error(0)
+}
+
+// DeleteKey mocks base method
+func (m *MockPkcs11Client) DeleteKey(name string) error {
+	args := m.Called(name)
+	return args.Error(0)
+}
+
+// WrapKey mocks base method
+func (m *MockPkcs11Client) WrapKey(name, algorithm string, wrappingKey []byte) ([]byte, error) {
+	args := m.Called(name, algorithm, wrappingKey)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]byte), args.Error(1)
+}
@@ -7,7 +7,6 @@
 package directory
 
 import (
-	"encoding/json"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -23,16 +22,17 @@ const (
 )
 
 type keyStore struct {
-	dir string
+	dir   string
+	codec recordCodec
 }
 
-func NewKeyStore(dir string) *keyStore {
-	return &keyStore{dir}
+func NewKeyStore(dir string, sealer RecordSealer) *keyStore {
+	return &keyStore{dir, recordCodec{kind: KeyRecordKind, sealer: sealer}}
 }
 
 func (ks *keyStore) Create(key *model.KeyAttributes) (*model.KeyAttributes, error) {
 
-	bytes, err := json.Marshal(key)
+	bytes, err := ks.codec.encode(key.ID, key)
 	if err != nil {
 		return nil, errors.Wrap(err, "directory/key_store:Create() Failed to marshal key attributes")
 	}
@@ -57,7 +57,7 @@ func (ks *keyStore) Retrieve(id uuid.UUID) (*model.KeyAttributes, error) {
 	}
 
 	var key model.KeyAttributes
-	err = json.Unmarshal(bytes, &key)
+	err = ks.codec.decode(id, bytes, &key)
 	if err != nil {
 		return nil, errors.Wrap(err, "directory/key_store:Retrieve() Failed to unmarshal key attributes")
 	}
@@ -108,7 +108,7 @@ func (ks *keyStore) Search(criteria *model.KeyFilterCriteria) ([]model.KeyAttrib
 
 func (ks *keyStore) Update(keyUpdated *model.KeyAttributes) (*model.KeyAttributes, error) {
 
-	bytes, err := json.Marshal(keyUpdated)
+	bytes, err := ks.codec.encode(keyUpdated.ID, keyUpdated)
 	if err != nil {
 		return nil, errors.Wrap(err, "directory/key_store:Update() Failed to marshal key attributes")
 	}
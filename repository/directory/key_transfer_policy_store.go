@@ -7,7 +7,6 @@
 package directory
 
 import (
-	"encoding/json"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -20,22 +19,28 @@ import (
 )
 
 type keyTransferPolicyStore struct {
-	dir string
+	dir   string
+	codec recordCodec
 }
 
-func NewKeyTransferPolicyStore(dir string) *keyTransferPolicyStore {
-	return &keyTransferPolicyStore{dir}
+func NewKeyTransferPolicyStore(dir string, sealer RecordSealer) *keyTransferPolicyStore {
+	return &keyTransferPolicyStore{dir, recordCodec{kind: KeyTransferPolicyRecordKind, sealer: sealer}}
 }
 
 func (ktps *keyTransferPolicyStore) Create(policy *model.KeyTransferPolicy) (*model.KeyTransferPolicy, error) {
 
-	newUuid, err := uuid.NewRandom()
-	if err != nil {
-		return nil, errors.Wrap(err, "directory/key_transfer_policy_store:Create() failed to create new UUID")
+	// an ID is only preset when an existing policy is restored
+	if policy.ID == uuid.Nil {
+		newUuid, err := uuid.NewRandom()
+		if err != nil {
+			return nil, errors.Wrap(err, "directory/key_transfer_policy_store:Create() failed to create new UUID")
+		}
+		policy.ID = newUuid
+	}
+	if policy.CreatedAt.IsZero() {
+		policy.CreatedAt = time.Now().UTC()
 	}
-	policy.ID = newUuid
-	policy.CreatedAt = time.Now().UTC()
-	bytes, err := json.Marshal(policy)
+	bytes, err := ktps.codec.encode(policy.ID, policy)
 	if err != nil {
 		return nil, errors.Wrap(err, "directory/key_transfer_policy_store:Create() Failed to marshal key transfer policy")
 	}
@@ -60,7 +65,7 @@ func (ktps *keyTransferPolicyStore) Retrieve(id uuid.UUID) (*model.KeyTransferPo
 	}
 
 	var policy model.KeyTransferPolicy
-	err = json.Unmarshal(bytes, &policy)
+	err = ktps.codec.decode(id, bytes, &policy)
 	if err != nil {
 		return nil, errors.Wrap(err, "directory/key_transfer_policy_store:Retrieve() Failed to unmarshal key transfer policy")
 	}
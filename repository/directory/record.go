@@ -0,0 +1,143 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package directory
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// record kinds bound to sealed records
+const (
+	KeyRecordKind               = "keys"
+	KeyTransferPolicyRecordKind = "key-transfer-policies"
+	UserRecordKind              = "users"
+)
+
+// sealedRecordHeader prefixes every record written by a store that has a RecordSealer
+var sealedRecordHeader = []byte("KBSR\x01")
+
+// RecordSealer provides authenticated encryption of records at rest
+type RecordSealer interface {
+	Seal(plaintext, additionalData []byte) ([]byte, error)
+	Open(sealed, additionalData []byte) ([]byte, error)
+}
+
+// recordCodec converts records to and from their on-disk representation. When a sealer
+// is configured, records are sealed with the record kind and ID bound as additional data
+// so that a record cannot be modified, or moved to another file, without detection.
+type recordCodec struct {
+	kind   string
+	sealer RecordSealer
+}
+
+func (rc recordCodec) additionalData(id uuid.UUID) []byte {
+	return append(append([]byte{}, sealedRecordHeader...), []byte(rc.kind+"/"+id.String())...)
+}
+
+func (rc recordCodec) encode(id uuid.UUID, record interface{}) ([]byte, error) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	if rc.sealer == nil {
+		return data, nil
+	}
+
+	sealed, err := rc.sealer.Seal(data, rc.additionalData(id))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to seal %s record %s", rc.kind, id.String())
+	}
+	return append(append([]byte{}, sealedRecordHeader...), sealed...), nil
+}
+
+func (rc recordCodec) decode(id uuid.UUID, data []byte, record interface{}) error {
+	if rc.sealer != nil {
+		if !bytes.HasPrefix(data, sealedRecordHeader) {
+			return errors.Errorf("%s record %s is not sealed", rc.kind, id.String())
+		}
+		plaintext, err := rc.sealer.Open(data[len(sealedRecordHeader):], rc.additionalData(id))
+		if err != nil {
+			return errors.Wrapf(err, "%s record %s failed integrity check", rc.kind, id.String())
+		}
+		data = plaintext
+	}
+	return json.Unmarshal(data, record)
+}
+
+// CountUnsealedRecords returns the number of plaintext records found in dir
+func CountUnsealedRecords(dir string) (int, error) {
+	files, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, errors.Wrapf(err, "directory/record:CountUnsealedRecords() Error in reading the directory : %s", dir)
+	}
+
+	unsealedCount := 0
+	for _, file := range files {
+		data, err := os.ReadFile(filepath.Clean(filepath.Join(dir, file.Name())))
+		if err != nil {
+			return unsealedCount, errors.Wrapf(err, "directory/record:CountUnsealedRecords() Unable to read file : %s", file.Name())
+		}
+		if !bytes.HasPrefix(data, sealedRecordHeader) {
+			unsealedCount++
+		}
+	}
+	return unsealedCount, nil
+}
+
+// SealRecords seals every plaintext record found in dir. Records that are already
+// sealed are left untouched. It returns the number of records that were sealed.
+func SealRecords(dir, kind string, sealer RecordSealer) (int, error) {
+	if sealer == nil {
+		return 0, errors.New("directory/record:SealRecords() record sealer is not configured")
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, errors.Wrapf(err, "directory/record:SealRecords() Error in reading the directory : %s", dir)
+	}
+
+	codec := recordCodec{kind: kind, sealer: sealer}
+	sealedCount := 0
+	for _, file := range files {
+		id, err := uuid.Parse(file.Name())
+		if err != nil {
+			return sealedCount, errors.Wrapf(err, "directory/record:SealRecords() Error in parsing file name : %s", file.Name())
+		}
+
+		path := filepath.Clean(filepath.Join(dir, file.Name()))
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return sealedCount, errors.Wrapf(err, "directory/record:SealRecords() Unable to read file : %s", file.Name())
+		}
+		if bytes.HasPrefix(data, sealedRecordHeader) {
+			continue
+		}
+
+		var record json.RawMessage
+		if err := json.Unmarshal(data, &record); err != nil {
+			return sealedCount, errors.Wrapf(err, "directory/record:SealRecords() File %s does not contain a valid record", file.Name())
+		}
+
+		sealed, err := codec.encode(id, record)
+		if err != nil {
+			return sealedCount, err
+		}
+		if err := os.WriteFile(path, sealed, 0600); err != nil {
+			return sealedCount, errors.Wrapf(err, "directory/record:SealRecords() Failed to write sealed record : %s", file.Name())
+		}
+		sealedCount++
+	}
+	return sealedCount, nil
+}
@@ -8,7 +8,6 @@ package directory
 
 import (
 	"crypto/subtle"
-	"encoding/json"
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
 	"intel/kbs/v1/model"
@@ -19,11 +18,12 @@ import (
 )
 
 type userStore struct {
-	dir string
+	dir   string
+	codec recordCodec
 }
 
-func NewUserStore(dir string) *userStore {
-	return &userStore{dir}
+func NewUserStore(dir string, sealer RecordSealer) *userStore {
+	return &userStore{dir, recordCodec{kind: UserRecordKind, sealer: sealer}}
 }
 
 func (u *userStore) Create(user *model.UserInfo) (*model.UserInfo, error) {
@@ -32,8 +32,10 @@ func (u *userStore) Create(user *model.UserInfo) (*model.UserInfo, error) {
 		user.ID = uuid.New()
 	}
 
-	user.CreatedAt = time.Now().UTC()
-	bytes, err := json.Marshal(user)
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = time.Now().UTC()
+	}
+	bytes, err := u.codec.encode(user.ID, user)
 	if err != nil {
 		return nil, errors.Wrap(err, "directory/user_store:Create() Failed to marshal user attributes")
 	}
@@ -58,7 +60,7 @@ func (u *userStore) Retrieve(userID uuid.UUID) (*model.UserInfo, error) {
 	}
 
 	var user model.UserInfo
-	err = json.Unmarshal(bytes, &user)
+	err = u.codec.decode(userID, bytes, &user)
 	if err != nil {
 		return nil, errors.Wrap(err, "directory/user_store:Retrieve() Failed to unmarshal user attributes")
 	}
@@ -122,7 +124,7 @@ func (u *userStore) Update(user *model.UserInfo) (*model.UserInfo, error) {
 		return nil, errors.Wrapf(err, "directory/user_store:Update() Error in updating user with ID : %s", user.ID)
 	}
 	user.UpdatedAt = time.Now().UTC()
-	bytes, err := json.Marshal(user)
+	bytes, err := u.codec.encode(user.ID, user)
 	if err != nil {
 		return nil, errors.Wrap(err, "directory/user_store:Update() Failed to marshal user attributes")
 	}
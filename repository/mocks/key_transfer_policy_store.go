@@ -22,6 +22,9 @@ type MockKeyTransferPolicyStore struct {
 
 // Create inserts a KeyTransferPolicy into the store
 func (store *MockKeyTransferPolicyStore) Create(p *model.KeyTransferPolicy) (*model.KeyTransferPolicy, error) {
+	if p.ID == uuid.Nil {
+		p.ID = uuid.New()
+	}
 	store.KeyTransferPolicyStore[p.ID] = p
 	return p, nil
 }
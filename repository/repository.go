@@ -45,10 +45,12 @@ type Repository struct {
 	UserStore              UserStore
 }
 
-func NewDirectoryRepository(basePath string) *Repository {
+// NewDirectoryRepository creates a file based repository rooted at basePath. Records are
+// sealed with the given sealer when it is not nil.
+func NewDirectoryRepository(basePath string, sealer directory.RecordSealer) *Repository {
 	return &Repository{
-		KeyStore:               directory.NewKeyStore(basePath + constant.KeysDir),
-		KeyTransferPolicyStore: directory.NewKeyTransferPolicyStore(basePath + constant.KeysTransferPolicyDir),
-		UserStore:              directory.NewUserStore(basePath + constant.UserDir),
+		KeyStore:               directory.NewKeyStore(basePath+constant.KeysDir, sealer),
+		KeyTransferPolicyStore: directory.NewKeyTransferPolicyStore(basePath+constant.KeysTransferPolicyDir, sealer),
+		UserStore:              directory.NewUserStore(basePath+constant.UserDir, sealer),
 	}
 }
@@ -8,10 +8,7 @@ package kbs
 
 import (
 	"context"
-	"crypto/rsa"
 	"crypto/tls"
-	"crypto/x509"
-	"encoding/pem"
 	"fmt"
 	jwtStrategy "github.com/shaj13/go-guardian/v2/auth/strategies/jwt"
 	"intel/kbs/v1/clients/ita"
@@ -21,13 +18,11 @@ import (
 	"net/url"
 	"os"
 	"os/signal"
-	"path/filepath"
 	"syscall"
 	"time"
 
 	"intel/kbs/v1/constant"
 	"intel/kbs/v1/keymanager"
-	"intel/kbs/v1/repository"
 	"intel/kbs/v1/service"
 	httpTransport "intel/kbs/v1/transport/http"
 
@@ -57,6 +52,7 @@ func (app *App) startServer() error {
 		"TrustAuthorityBaseUrl":               configuration.TrustAuthorityBaseUrl,
 		"TrustAuthorityApiUrl":                configuration.TrustAuthorityApiUrl,
 		"KeyManager":                          configuration.KeyManager,
+		"RepositoryMasterKeySource":           configuration.RepositoryEncryption.MasterKeySource,
 		"BearerTokenValidityInMinutes":        configuration.BearerTokenValidityInMinutes,
 		"HttpReadHeaderTimeout":               configuration.HttpReadHeaderTimeout,
 		"AuthenticationDefendLockoutMinutes":  configuration.AuthenticationDefendLockoutMinutes,
@@ -71,7 +67,10 @@ func (app *App) startServer() error {
 	}
 
 	// Create repository layer and remote manager
-	repository := repository.NewDirectoryRepository(constant.HomeDir)
+	repository, err := app.newRepository()
+	if err != nil {
+		return err
+	}
 	remoteManager := keymanager.NewRemoteManager(repository.KeyStore, keyManager)
 
 	itaApiServername, err := url.Parse(config.TrustAuthorityApiUrl)
@@ -104,34 +103,10 @@ func (app *App) startServer() error {
 		return errors.New(msg)
 	}
 
-	if _, err := os.Stat(constant.DefaultJWTSigningKeyPath); errors.Is(err, os.ErrNotExist) {
-		// create JWT signing key
-		csk := tasks.CreateSigningKey{
-			JWTSigningKeyPath: constant.DefaultJWTSigningKeyPath,
-		}
-		err := csk.CreateJWTSigningKey()
-		if err != nil {
-			log.WithError(err).Error("Error while creating JWT signing key")
-			return err
-		}
-	}
-
-	bytes, err := os.ReadFile(filepath.Clean(constant.DefaultJWTSigningKeyPath))
-	if err != nil {
-		log.WithError(err).Error("Error while reading JWT signing key")
-		return err
-	}
-
-	block, _ := pem.Decode(bytes)
-	if block == nil {
-		return errors.New("Error while pem decoding JWT signing key")
-	}
-
-	privKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	signingKey, err := loadJWTSigningKey()
 	if err != nil {
 		return err
 	}
-	signingKey := privKey.(*rsa.PrivateKey)
 
 	jwtKeeper := jwtStrategy.StaticSecret{
 		ID:        "secret-id",
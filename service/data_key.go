@@ -0,0 +1,263 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package service
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"intel/kbs/v1/constant"
+	"intel/kbs/v1/crypt"
+	"intel/kbs/v1/keymanager"
+	"intel/kbs/v1/model"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultDataKeyLength is the length in bits of data keys generated without a key length
+const defaultDataKeyLength = 256
+
+// sealingKeyLength is the length in bytes of the keys data keys are sealed under when the key
+// manager of the master key encrypts them
+const sealingKeyLength = 32
+
+// DataKeyRequest requests a data key under the AES master key KeyId. KeyLength is the length of
+// a generated data key and Ciphertext the encrypted data key to decrypt.
+type DataKeyRequest struct {
+	TransferKeyRequest
+	KeyLength  int
+	Ciphertext []byte
+}
+
+// dataKeyFunc returns the data key released to the workload and, for generated data keys, the
+// data key sealed with the metadata
+type dataKeyFunc func(metadata *model.WrappedKeyMetadata) ([]byte, []byte, int, error)
+
+func (mw loggingMiddleware) GenerateDataKey(ctx context.Context, req DataKeyRequest) (*TransferKeyResponse, error) {
+	var err error
+	defer func(begin time.Time) {
+		logrus.Tracef("GenerateDataKey took %s since %s", time.Since(begin), begin)
+		if err != nil {
+			logrus.WithError(err)
+		}
+	}(time.Now())
+	resp, err := mw.next.GenerateDataKey(ctx, req)
+	return resp, err
+}
+
+// GenerateDataKey releases a random data key to an attested workload, together with the data key
+// encrypted under the master key for the workload to store with its data. The master key is
+// never released.
+func (svc service) GenerateDataKey(ctx context.Context, req DataKeyRequest) (*TransferKeyResponse, error) {
+
+	keyLength := req.KeyLength
+	if keyLength == 0 {
+		keyLength = defaultDataKeyLength
+	}
+	return svc.releaseDataKey(ctx, req, func(metadata *model.WrappedKeyMetadata) ([]byte, []byte, int, error) {
+		sealingKey, status, err := svc.newSealingKey(ctx, req.KeyId, metadata)
+		if err != nil {
+			return nil, nil, status, err
+		}
+		defer crypt.ZeroizeByteArray(sealingKey)
+
+		dataKey, err := crypt.GetDerivedKey(keyLength / 8)
+		if err != nil {
+			logrus.WithError(err).Error("Failed to generate data key")
+			return nil, nil, http.StatusInternalServerError, &HandledError{Message: "Failed to generate data key"}
+		}
+		sealedKey, status, err := sealKeyWithSwk(dataKey, sealingKey, metadata)
+		if err != nil {
+			crypt.ZeroizeByteArray(dataKey)
+			return nil, nil, status, err
+		}
+		return dataKey, sealedKey.WrappedKey, http.StatusOK, nil
+	})
+}
+
+func (mw loggingMiddleware) DecryptDataKey(ctx context.Context, req DataKeyRequest) (*TransferKeyResponse, error) {
+	var err error
+	defer func(begin time.Time) {
+		logrus.Tracef("DecryptDataKey took %s since %s", time.Since(begin), begin)
+		if err != nil {
+			logrus.WithError(err)
+		}
+	}(time.Now())
+	resp, err := mw.next.DecryptDataKey(ctx, req)
+	return resp, err
+}
+
+// DecryptDataKey releases the data key of a ciphertext returned by GenerateDataKey to an attested
+// workload
+func (svc service) DecryptDataKey(ctx context.Context, req DataKeyRequest) (*TransferKeyResponse, error) {
+
+	return svc.releaseDataKey(ctx, req, func(_ *model.WrappedKeyMetadata) ([]byte, []byte, int, error) {
+		sealingKey, status, err := svc.sealingKey(ctx, req.KeyId, req.Ciphertext)
+		if err != nil {
+			return nil, nil, status, err
+		}
+		defer crypt.ZeroizeByteArray(sealingKey)
+
+		dataKey, metadata, err := openSealedKey(req.Ciphertext, sealingKey)
+		if err != nil {
+			logrus.WithError(err).Error("Failed to decrypt data key")
+			return nil, nil, http.StatusBadRequest, &HandledError{Message: "Failed to decrypt data key"}
+		}
+		if metadata.KeyID != req.KeyId || metadata.Algorithm != constant.CRYPTOALGAES {
+			crypt.ZeroizeByteArray(dataKey)
+			logrus.Error("Data key is not encrypted under the key")
+			return nil, nil, http.StatusBadRequest, &HandledError{Message: "Failed to decrypt data key"}
+		}
+		return dataKey, nil, http.StatusOK, nil
+	})
+}
+
+// releaseDataKey attests the workload against the key transfer policy of the master key and
+// returns the data key of dataKey wrapped to the workload as a transferred AES key. Data keys are
+// always returned in the legacy response format.
+func (svc service) releaseDataKey(ctx context.Context, req DataKeyRequest, dataKey dataKeyFunc) (*TransferKeyResponse, error) {
+
+	key, err := svc.remoteManager.RetrieveKey(req.KeyId)
+	if err != nil {
+		if err.Error() == RecordNotFound {
+			logrus.WithError(err).Error("Key with specified id doesn't exist")
+			return nil, &HandledError{Code: http.StatusNotFound, Message: "Key with specified id does not exist"}
+		} else {
+			logrus.WithError(err).Error("Key retrieval failed")
+			return nil, &HandledError{Code: http.StatusInternalServerError, Message: "Failed to retrieve key"}
+		}
+	}
+	if key.KeyInfo.Algorithm != constant.CRYPTOALGAES {
+		logrus.Errorf("Data keys cannot be encrypted under %s keys", key.KeyInfo.Algorithm)
+		return nil, &HandledError{Code: http.StatusBadRequest, Message: "Data keys can only be encrypted under AES keys"}
+	}
+
+	transferPolicy, err := svc.repository.KeyTransferPolicyStore.Retrieve(key.TransferPolicyID)
+	if err != nil {
+		logrus.WithError(err).Error("Key transfer policy retrieve failed")
+		return nil, &HandledError{Code: http.StatusInternalServerError, Message: "Failed to retrieve key transfer policy for the key"}
+	}
+
+	tokenClaims, nonceResp, err := svc.attestWithEvidence(req.TransferKeyRequest, transferPolicy)
+	if err != nil || nonceResp != nil {
+		return nonceResp, err
+	}
+	if err := validateAttestationTokenClaims(tokenClaims, transferPolicy); err != nil {
+		logrus.WithError(err).Errorf("Failed to validate Token claims against Key transfer policy attributes")
+		return nil, &HandledError{Code: http.StatusUnauthorized, Message: "Token claims validation against key-transfer-policy failed"}
+	}
+
+	keyEncoding := req.KeyTransferRequest.KeyEncoding
+	if keyEncoding != "" && !isKeyEncodingAllowed(constant.CRYPTOALGAES, keyEncoding) {
+		logrus.Errorf("Key encoding %s is not supported for data keys", keyEncoding)
+		return nil, &HandledError{Code: http.StatusBadRequest, Message: "Key encoding is not supported for the key algorithm"}
+	}
+	publicKey, status, err := getWorkloadPublicKey(tokenClaims.AttesterHeldData, transferPolicy, model.KeyTransferFormatLegacy)
+	if err != nil {
+		return nil, &HandledError{Code: status, Message: err.Error()}
+	}
+
+	metadata := &model.WrappedKeyMetadata{
+		KeyID:       req.KeyId,
+		KeyVersion:  1,
+		Algorithm:   constant.CRYPTOALGAES,
+		KeyEncoding: model.KeyEncodingRaw,
+		PolicyID:    transferPolicy.ID,
+	}
+	plainDataKey, ciphertext, status, err := dataKey(metadata)
+	if err != nil {
+		return nil, &HandledError{Code: status, Message: err.Error()}
+	}
+	defer crypt.ZeroizeByteArray(plainDataKey)
+
+	keyByte, err := encodeKey(constant.CRYPTOALGAES, plainDataKey, keyEncoding, req.KeyId)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to encode data key")
+		return nil, &HandledError{Code: http.StatusInternalServerError, Message: "Failed to encode data key"}
+	}
+	defer crypt.ZeroizeByteArray(keyByte)
+
+	transferResponse, status, err := wrapKeyToWorkload(publicKey, constant.CRYPTOALGAES, keyByte, keyEncoding, req.KeyId, transferPolicy,
+		model.KeyTransferFormatLegacy, transferEnvelopeVersion(req.TransferKeyRequest, transferPolicy))
+	if err != nil {
+		return nil, &HandledError{Code: status, Message: err.Error()}
+	}
+
+	resp := &TransferKeyResponse{
+		KeyTransferResponse: transferResponse.(*model.KeyTransferResponse),
+		Ciphertext:          ciphertext,
+	}
+	return resp, nil
+}
+
+// newSealingKey returns the key a generated data key is sealed under. When the key manager of the
+// master key encrypts, the data key is sealed under a random key that is encrypted by the key
+// manager and kept in the metadata, so that the master key stays in its key manager. Otherwise
+// the data key is sealed under the master key itself.
+func (svc service) newSealingKey(ctx context.Context, keyId uuid.UUID, metadata *model.WrappedKeyMetadata) ([]byte, int, error) {
+
+	sealingKey, err := crypt.GetDerivedKey(sealingKeyLength)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to generate data key sealing key")
+		return nil, http.StatusInternalServerError, &HandledError{Message: "Failed to generate data key"}
+	}
+	encryptedKey, err := svc.remoteManager.Encrypt(ctx, keyId, sealingKey)
+	if err == nil {
+		metadata.EncryptedKey = encryptedKey
+		return sealingKey, http.StatusOK, nil
+	}
+	crypt.ZeroizeByteArray(sealingKey)
+	if !errors.Is(err, keymanager.ErrEncryptNotSupported) {
+		logrus.WithError(err).Error("Failed to encrypt data key sealing key with the key manager")
+		return nil, http.StatusInternalServerError, &HandledError{Message: "Failed to encrypt data key"}
+	}
+	return svc.masterSealingKey(ctx, keyId)
+}
+
+// sealingKey returns the key the data key of a ciphertext returned by GenerateDataKey is sealed
+// under. The envelope metadata read here is authenticated when the ciphertext is opened.
+func (svc service) sealingKey(ctx context.Context, keyId uuid.UUID, ciphertext []byte) ([]byte, int, error) {
+
+	metadata, err := sealedKeyMetadata(ciphertext)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to decrypt data key")
+		return nil, http.StatusBadRequest, &HandledError{Message: "Failed to decrypt data key"}
+	}
+	if len(metadata.EncryptedKey) == 0 {
+		return svc.masterSealingKey(ctx, keyId)
+	}
+	sealingKey, err := svc.remoteManager.Decrypt(ctx, keyId, metadata.EncryptedKey)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to decrypt data key sealing key with the key manager")
+		return nil, http.StatusBadRequest, &HandledError{Message: "Failed to decrypt data key"}
+	}
+	return sealingKey, http.StatusOK, nil
+}
+
+// masterSealingKey returns the master key read from its key manager into the KBS. Key managers
+// that only release keys wrapped keep their keys out of the KBS, so their keys cannot seal data
+// keys.
+func (svc service) masterSealingKey(ctx context.Context, keyId uuid.UUID) ([]byte, int, error) {
+
+	keyWrappingEnforced, err := svc.remoteManager.KeyWrappingEnforced(keyId)
+	if err != nil {
+		logrus.WithError(err).Error("Key retrieval failed")
+		return nil, http.StatusInternalServerError, &HandledError{Message: "Failed to retrieve key"}
+	}
+	if keyWrappingEnforced {
+		logrus.Error("Data keys cannot be encrypted under keys of a key manager that enforces key wrapping")
+		return nil, http.StatusBadRequest, &HandledError{Message: "Data keys cannot be encrypted under keys that are only released wrapped"}
+	}
+	masterKey, status, err := getSecretKey(ctx, svc.remoteManager, keyId)
+	if err != nil {
+		return nil, status, err
+	}
+	return masterKey.([]byte), http.StatusOK, nil
+}
@@ -0,0 +1,217 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"intel/kbs/v1/constant"
+	"intel/kbs/v1/keymanager"
+	"intel/kbs/v1/model"
+	"net/http"
+	"strings"
+	"testing"
+
+	jwtlib "github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+)
+
+// newAttesterHeldDataToken returns the SGX test token with the attester held data replaced by
+// the public key of the workload
+func newAttesterHeldDataToken(t *testing.T, publicKey *rsa.PublicKey) string {
+	parts := strings.Split(sgxToken, ".")
+	payload, err := jwtlib.DecodeSegment(parts[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := map[string]interface{}{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		t.Fatal(err)
+	}
+	publicKeyDer, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims["attester_held_data"] = base64.StdEncoding.EncodeToString(publicKeyDer)
+	payload, err = json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts[1] = jwtlib.EncodeSegment(payload)
+	return strings.Join(parts, ".")
+}
+
+// unwrapDataKey unwraps a data key released to the workload
+func unwrapDataKey(g *gomega.WithT, privateKey *rsa.PrivateKey, resp *TransferKeyResponse) []byte {
+	swk, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, resp.KeyTransferResponse.WrappedSWK, nil)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	dataKey, _, err := openSealedKey(resp.KeyTransferResponse.WrappedKey, swk)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	return dataKey
+}
+
+// encryptingKeyManager encrypts with a key that never leaves it, like a vault transit backend
+type encryptingKeyManager struct {
+	keymanager.KeyManager
+	key []byte
+}
+
+func (km *encryptingKeyManager) TransferKey(context.Context, *model.KeyAttributes) ([]byte, error) {
+	return nil, errors.New("key is not exportable")
+}
+
+func (km *encryptingKeyManager) Encrypt(_ context.Context, _ *model.KeyAttributes, plaintext []byte) ([]byte, error) {
+	ciphertext, nonce, err := AesEncrypt(plaintext, km.key, nil)
+	return append(nonce, ciphertext...), err
+}
+
+func (km *encryptingKeyManager) Decrypt(_ context.Context, _ *model.KeyAttributes, ciphertext []byte) ([]byte, error) {
+	return AesDecrypt(ciphertext[12:], km.key, ciphertext[:12], nil)
+}
+
+// wrappingKeyManager only releases keys wrapped, like a kmip backend with key wrapping
+type wrappingKeyManager struct {
+	keymanager.KeyManager
+}
+
+func (km *wrappingKeyManager) KeyWrappingEnforced(*model.KeyAttributes) bool {
+	return true
+}
+
+func TestDataKeyGenerateAndDecrypt(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	svc := LoggingMiddleware()(newSecretTestService(t))
+
+	masterKey, err := svc.CreateKey(context.Background(), model.KeyRequest{
+		KeyInfo:          &model.KeyInfo{Algorithm: constant.CRYPTOALGAES, KeyLength: 256},
+		TransferPolicyID: sgxPolicyId,
+	})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	otherKey, err := svc.CreateKey(context.Background(), model.KeyRequest{
+		KeyInfo:          &model.KeyInfo{Algorithm: constant.CRYPTOALGAES, KeyLength: 256},
+		TransferPolicyID: sgxPolicyId,
+	})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 3072)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	token := newAttesterHeldDataToken(t, &privateKey.PublicKey)
+	jwtToken := parseJWTToken(sgxToken, []byte(""))
+	itaClientConnector.On("VerifyToken", mock.Anything).Return(jwtToken, nil).Times(5)
+
+	newRequest := func(keyId uuid.UUID) DataKeyRequest {
+		return DataKeyRequest{
+			TransferKeyRequest: TransferKeyRequest{
+				KeyId:              keyId,
+				KeyTransferRequest: &model.KeyTransferRequest{AttestationToken: token},
+			},
+		}
+	}
+
+	resp, err := svc.GenerateDataKey(context.Background(), newRequest(masterKey.ID))
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(resp.KeyTransferResponse.EnvelopeVersion).To(gomega.Equal(model.EnvelopeVersion2))
+	g.Expect(resp.Ciphertext).NotTo(gomega.BeEmpty())
+	dataKey := unwrapDataKey(g, privateKey, resp)
+	g.Expect(dataKey).To(gomega.HaveLen(defaultDataKeyLength / 8))
+
+	decryptReq := newRequest(masterKey.ID)
+	decryptReq.Ciphertext = resp.Ciphertext
+	decryptResp, err := svc.DecryptDataKey(context.Background(), decryptReq)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(decryptResp.Ciphertext).To(gomega.BeEmpty())
+	g.Expect(unwrapDataKey(g, privateKey, decryptResp)).To(gomega.Equal(dataKey))
+
+	// the ciphertext is authenticated
+	tampered := append([]byte{}, resp.Ciphertext...)
+	tampered[len(tampered)-1] ^= 1
+	decryptReq.Ciphertext = tampered
+	_, err = svc.DecryptDataKey(context.Background(), decryptReq)
+	g.Expect(err.(*HandledError).Code).To(gomega.Equal(http.StatusBadRequest))
+
+	// the data key is bound to its master key
+	decryptReq = newRequest(otherKey.ID)
+	decryptReq.Ciphertext = resp.Ciphertext
+	_, err = svc.DecryptDataKey(context.Background(), decryptReq)
+	g.Expect(err.(*HandledError).Code).To(gomega.Equal(http.StatusBadRequest))
+
+	generateReq := newRequest(masterKey.ID)
+	generateReq.KeyLength = 128
+	resp, err = svc.GenerateDataKey(context.Background(), generateReq)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(unwrapDataKey(g, privateKey, resp)).To(gomega.HaveLen(16))
+}
+
+func TestDataKeyNegative(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	svc := LoggingMiddleware()(newSecretTestService(t))
+
+	_, err := svc.GenerateDataKey(context.Background(), DataKeyRequest{
+		TransferKeyRequest: TransferKeyRequest{KeyId: uuid.New(), KeyTransferRequest: &model.KeyTransferRequest{}},
+	})
+	g.Expect(err.(*HandledError).Code).To(gomega.Equal(http.StatusNotFound))
+
+	// data keys are only encrypted under AES keys
+	ecKey, err := svc.CreateKey(context.Background(), model.KeyRequest{
+		KeyInfo:          &model.KeyInfo{Algorithm: constant.CRYPTOALGEC, CurveType: "prime256v1"},
+		TransferPolicyID: sgxPolicyId,
+	})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	_, err = svc.GenerateDataKey(context.Background(), DataKeyRequest{
+		TransferKeyRequest: TransferKeyRequest{KeyId: ecKey.ID, KeyTransferRequest: &model.KeyTransferRequest{}},
+	})
+	g.Expect(err.(*HandledError).Code).To(gomega.Equal(http.StatusBadRequest))
+}
+
+func TestDataKeyKeyManagerEncrypt(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	svc := newSecretTestService(t)
+	secretKeyStore := svc.repository.KeyStore
+	localManager := keymanager.NewLocalManager(nil)
+	svc.remoteManager = keymanager.NewRemoteManager(secretKeyStore, &encryptingKeyManager{KeyManager: localManager, key: make([]byte, 32)})
+
+	masterKey, err := secretKeyStore.Create(&model.KeyAttributes{ID: uuid.New(), Algorithm: constant.CRYPTOALGAES, KeyLength: 256, TransferPolicyId: sgxPolicyId})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 3072)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	token := newAttesterHeldDataToken(t, &privateKey.PublicKey)
+	jwtToken := parseJWTToken(sgxToken, []byte(""))
+	itaClientConnector.On("VerifyToken", mock.Anything).Return(jwtToken, nil).Times(3)
+
+	request := DataKeyRequest{
+		TransferKeyRequest: TransferKeyRequest{
+			KeyId:              masterKey.ID,
+			KeyTransferRequest: &model.KeyTransferRequest{AttestationToken: token},
+		},
+	}
+	resp, err := svc.GenerateDataKey(context.Background(), request)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	metadata, err := sealedKeyMetadata(resp.Ciphertext)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(metadata.EncryptedKey).NotTo(gomega.BeEmpty())
+	dataKey := unwrapDataKey(g, privateKey, resp)
+
+	request.Ciphertext = resp.Ciphertext
+	decryptResp, err := svc.DecryptDataKey(context.Background(), request)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(unwrapDataKey(g, privateKey, decryptResp)).To(gomega.Equal(dataKey))
+
+	// keys of key managers that enforce key wrapping are not read into the KBS
+	svc.remoteManager = keymanager.NewRemoteManager(secretKeyStore, &wrappingKeyManager{KeyManager: localManager})
+	request.Ciphertext = nil
+	_, err = svc.GenerateDataKey(context.Background(), request)
+	g.Expect(err.(*HandledError).Code).To(gomega.Equal(http.StatusBadRequest))
+}
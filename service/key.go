@@ -8,15 +8,21 @@ package service
 
 import (
 	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
 	"crypto/sha512"
 	"github.com/sirupsen/logrus"
 	"intel/kbs/v1/constant"
+	"intel/kbs/v1/crypt"
+	"intel/kbs/v1/keymanager"
 	"net/http"
 	"time"
 
 	"intel/kbs/v1/model"
 
 	"github.com/google/uuid"
+	"github.com/pkg/errors"
 )
 
 const (
@@ -37,7 +43,7 @@ func (mw loggingMiddleware) CreateKey(ctx context.Context, req model.KeyRequest)
 	return resp, err
 }
 
-func (svc service) CreateKey(_ context.Context, keyCreateReq model.KeyRequest) (*model.KeyResponse, error) {
+func (svc service) CreateKey(ctx context.Context, keyCreateReq model.KeyRequest) (*model.KeyResponse, error) {
 
 	if keyCreateReq.TransferPolicyID != uuid.Nil {
 		_, err := svc.repository.KeyTransferPolicyStore.Retrieve(keyCreateReq.TransferPolicyID)
@@ -51,12 +57,17 @@ func (svc service) CreateKey(_ context.Context, keyCreateReq model.KeyRequest) (
 		}
 	}
 
+	if keyCreateReq.KeyManager != "" && !svc.isKeyManagerBackend(keyCreateReq.KeyManager) {
+		log.Errorf("Key manager %s is not configured", keyCreateReq.KeyManager)
+		return nil, &HandledError{Code: http.StatusBadRequest, Message: "Key manager with specified name is not configured"}
+	}
+
 	var err error
 	var createdKey *model.KeyResponse
 	if keyCreateReq.KeyInfo.KeyData == "" && keyCreateReq.KeyInfo.KmipKeyID == "" {
 
 		log.Debug("Create key request received")
-		createdKey, err = svc.remoteManager.CreateKey(&keyCreateReq)
+		createdKey, err = svc.remoteManager.CreateKey(ctx, &keyCreateReq)
 		if err != nil {
 			log.WithError(err).Error("Key create failed")
 			return nil, &HandledError{Code: http.StatusInternalServerError, Message: "Failed to create key"}
@@ -64,8 +75,11 @@ func (svc service) CreateKey(_ context.Context, keyCreateReq model.KeyRequest) (
 	} else {
 
 		log.Debug("Register key request received")
-		createdKey, err = svc.remoteManager.RegisterKey(&keyCreateReq)
-		if err != nil {
+		createdKey, err = svc.remoteManager.RegisterKey(ctx, &keyCreateReq)
+		if errors.Is(err, keymanager.ErrInvalidKmipKey) {
+			log.WithError(err).Error("Key register failed, kmip key is invalid")
+			return nil, &HandledError{Code: http.StatusBadRequest, Message: err.Error()}
+		} else if err != nil {
 			log.WithError(err).Error("Key register failed")
 			return nil, &HandledError{Code: http.StatusInternalServerError, Message: "Failed to register key"}
 		}
@@ -73,6 +87,19 @@ func (svc service) CreateKey(_ context.Context, keyCreateReq model.KeyRequest) (
 	return createdKey, nil
 }
 
+// isKeyManagerBackend reports whether name is one of the configured key manager backends
+func (svc service) isKeyManagerBackend(name string) bool {
+	if svc.config == nil {
+		return false
+	}
+	for _, backend := range svc.config.KeyManagerBackends() {
+		if backend.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
 func (mw loggingMiddleware) SearchKeys(ctx context.Context, kfc *model.KeyFilterCriteria) ([]*model.KeyResponse, error) {
 	var err error
 	defer func(begin time.Time) {
@@ -95,6 +122,37 @@ func (svc service) SearchKeys(_ context.Context, filter *model.KeyFilterCriteria
 	return keys, nil
 }
 
+func (mw loggingMiddleware) DiscoverKmipKeys(ctx context.Context, criteria *model.KmipObjectFilterCriteria) ([]*model.KmipObject, error) {
+	var err error
+	defer func(begin time.Time) {
+		log.Tracef("DiscoverKmipKeys took %s since %s", time.Since(begin), begin)
+		if err != nil {
+			log.WithError(err)
+		}
+	}(time.Now())
+	resp, err := mw.next.DiscoverKmipKeys(ctx, criteria)
+	return resp, err
+}
+
+func (svc service) DiscoverKmipKeys(ctx context.Context, criteria *model.KmipObjectFilterCriteria) ([]*model.KmipObject, error) {
+
+	if criteria.KeyManager != "" && !svc.isKeyManagerBackend(criteria.KeyManager) {
+		log.Errorf("Key manager %s is not configured", criteria.KeyManager)
+		return nil, &HandledError{Code: http.StatusBadRequest, Message: "Key manager with specified name is not configured"}
+	}
+
+	objects, err := svc.remoteManager.DiscoverKeys(ctx, criteria)
+	if err != nil {
+		if errors.Is(err, keymanager.ErrKeyDiscoveryNotSupported) {
+			log.WithError(err).Error("Key manager does not support key discovery")
+			return nil, &HandledError{Code: http.StatusBadRequest, Message: "Key manager does not support key discovery"}
+		}
+		log.WithError(err).Error("Kmip key discovery failed")
+		return nil, &HandledError{Code: http.StatusInternalServerError, Message: "Failed to discover kmip keys"}
+	}
+	return objects, nil
+}
+
 func (mw loggingMiddleware) DeleteKey(ctx context.Context, id uuid.UUID) (interface{}, error) {
 	var err error
 	defer func(begin time.Time) {
@@ -107,8 +165,8 @@ func (mw loggingMiddleware) DeleteKey(ctx context.Context, id uuid.UUID) (interf
 	return resp, err
 }
 
-func (svc service) DeleteKey(_ context.Context, keyId uuid.UUID) (interface{}, error) {
-	err := svc.remoteManager.DeleteKey(keyId)
+func (svc service) DeleteKey(ctx context.Context, keyId uuid.UUID) (interface{}, error) {
+	err := svc.remoteManager.DeleteKey(ctx, keyId)
 	if err != nil {
 		if err.Error() == RecordNotFound {
 			log.Error("Key with specified id could not be located")
@@ -148,6 +206,47 @@ func (svc service) RetrieveKey(_ context.Context, keyId uuid.UUID) (interface{},
 	return key, nil
 }
 
+// PublicKeyResponse holds the public key of an asymmetric key, which the transport encodes in the
+// requested format
+type PublicKeyResponse struct {
+	KeyID     uuid.UUID
+	PublicKey crypto.PublicKey
+}
+
+func (mw loggingMiddleware) RetrievePublicKey(ctx context.Context, id uuid.UUID) (*PublicKeyResponse, error) {
+	var err error
+	defer func(begin time.Time) {
+		log.Tracef("RetrievePublicKey took %s since %s", time.Since(begin), begin)
+		if err != nil {
+			log.WithError(err)
+		}
+	}(time.Now())
+	resp, err := mw.next.RetrievePublicKey(ctx, id)
+	return resp, err
+}
+
+func (svc service) RetrievePublicKey(ctx context.Context, keyId uuid.UUID) (*PublicKeyResponse, error) {
+	publicKey, err := svc.remoteManager.PublicKey(ctx, keyId)
+	if err != nil {
+		switch {
+		case err.Error() == RecordNotFound:
+			log.Error("Key with specified id could not be located")
+			return nil, &HandledError{Code: http.StatusNotFound, Message: "Key with specified id does not exist"}
+		case errors.Is(err, keymanager.ErrNoPublicKey):
+			log.Error("Key with specified id is not an asymmetric key")
+			return nil, &HandledError{Code: http.StatusBadRequest, Message: "Key with specified id is not an asymmetric key"}
+		case errors.Is(err, keymanager.ErrPublicKeyNotSupported):
+			log.Error("Key manager of the key does not support public key retrieval")
+			return nil, &HandledError{Code: http.StatusBadRequest, Message: "Key manager of the key does not support public key retrieval"}
+		default:
+			log.WithError(err).Error("Public key retrieve failed")
+			return nil, &HandledError{Code: http.StatusInternalServerError, Message: "Failed to retrieve public key"}
+		}
+	}
+
+	return &PublicKeyResponse{KeyID: keyId, PublicKey: publicKey}, nil
+}
+
 func (mw loggingMiddleware) UpdateKey(ctx context.Context, request model.KeyUpdateRequest) (*model.KeyResponse, error) {
 	var err error
 	defer func(begin time.Time) {
@@ -200,23 +299,104 @@ func (mw loggingMiddleware) TransferKey(ctx context.Context, req TransferKeyRequ
 	return resp, err
 }
 
-func (svc service) TransferKey(_ context.Context, req TransferKeyRequest) (*TransferKeyResponse, error) {
-	secretKey, status, err := getSecretKey(svc.remoteManager, req.KeyId)
+func (svc service) TransferKey(ctx context.Context, req TransferKeyRequest) (*TransferKeyResponse, error) {
+	keyWrappingEnforced, err := svc.remoteManager.KeyWrappingEnforced(req.KeyId)
 	if err != nil {
-		return nil, &HandledError{Code: status, Message: err.Error()}
+		if err.Error() == RecordNotFound {
+			log.WithError(err).Error("Key with specified id doesn't exist")
+			return nil, &HandledError{Code: http.StatusNotFound, Message: "Key with specified id does not exist"}
+		}
+		log.WithError(err).Error("Key retrieval failed")
+		return nil, &HandledError{Code: http.StatusInternalServerError, Message: "Failed to retrieve key"}
+	}
+	if keyWrappingEnforced {
+		return svc.transferKeyWrappedByKeyManager(ctx, req)
 	}
 
-	// Wrap secret key with public key
-	wrappedKey, status, err := wrapKey(req.PublicKey, secretKey.([]byte), sha512.New384(), nil)
+	secretKey, status, err := getSecretKey(ctx, svc.remoteManager, req.KeyId)
 	if err != nil {
 		return nil, &HandledError{Code: status, Message: err.Error()}
 	}
+	defer crypt.ZeroizeByteArray(secretKey.([]byte))
 
-	transferResponse := &model.KeyTransferResponse{
-		WrappedKey: wrappedKey.([]byte),
+	// the key is transferred in the encoding of its definition
+	key, err := svc.remoteManager.RetrieveKey(req.KeyId)
+	if err != nil {
+		log.WithError(err).Error("Key retrieval failed")
+		return nil, &HandledError{Code: http.StatusInternalServerError, Message: "Failed to retrieve key"}
+	}
+	keyByte, err := encodeKey(key.KeyInfo.Algorithm, secretKey.([]byte), key.KeyInfo.KeyEncoding, req.KeyId)
+	if err != nil {
+		log.WithError(err).Error("Failed to encode secret key")
+		return nil, &HandledError{Code: http.StatusInternalServerError, Message: "Failed to encode secret key"}
 	}
+	defer crypt.ZeroizeByteArray(keyByte)
+
+	var transferResponse *model.KeyTransferResponse
+	switch publicKey := req.PublicKey.(type) {
+	case *rsa.PublicKey:
+		// Wrap secret key with public key
+		wrappedKey, status, err := wrapKey(publicKey, keyByte, sha512.New384(), nil)
+		if err != nil {
+			return nil, &HandledError{Code: status, Message: err.Error()}
+		}
+		transferResponse = &model.KeyTransferResponse{
+			WrappedKey: wrappedKey.([]byte),
+		}
+
+	case *ecdsa.PublicKey:
+		// EC public keys cannot encrypt, the key is wrapped under an SWK that is wrapped to the
+		// public key with ECDH-ES
+		swk, err := CreateSwk()
+		defer crypt.ZeroizeByteArray(swk)
+		if err != nil {
+			log.Error("Error in creating SWK key")
+			return nil, &HandledError{Code: http.StatusInternalServerError, Message: "Error in creating SWK key"}
+		}
+		wrappedResponse, status, err := wrapKeyWithSwk(publicKey, keyByte, swk, nil)
+		if err != nil {
+			return nil, &HandledError{Code: status, Message: err.Error()}
+		}
+		transferResponse = wrappedResponse.(*model.KeyTransferResponse)
+
+	default:
+		log.Errorf("Public key type %T is not supported", req.PublicKey)
+		return nil, &HandledError{Code: http.StatusBadRequest, Message: "Public key type is not supported"}
+	}
+
 	resp := &TransferKeyResponse{
 		KeyTransferResponse: transferResponse,
 	}
 	return resp, nil
 }
+
+// transferKeyWrappedByKeyManager returns the key wrapped to the public key of the request by its
+// key manager, for key managers that must not release keys in plaintext to the KBS. Key managers
+// wrap keys to RSA public keys only.
+func (svc service) transferKeyWrappedByKeyManager(ctx context.Context, req TransferKeyRequest) (*TransferKeyResponse, error) {
+	key, err := svc.remoteManager.RetrieveKey(req.KeyId)
+	if err != nil {
+		log.WithError(err).Error("Key retrieval failed")
+		return nil, &HandledError{Code: http.StatusInternalServerError, Message: "Failed to retrieve key"}
+	}
+	// key managers wrap private keys in PKCS#8 and AES keys raw
+	keyEncoding := key.KeyInfo.KeyEncoding
+	if keyEncoding != "" && keyEncoding != model.KeyEncodingPKCS8 && keyEncoding != model.KeyEncodingRaw {
+		log.Errorf("Key wrapped by its key manager cannot be returned in %s encoding", keyEncoding)
+		return nil, &HandledError{Code: http.StatusNotAcceptable, Message: "Key wrapped by its key manager cannot be returned in the encoding of the key"}
+	}
+
+	transferResponse, status, err := getKeyWrappedByKeyManager(ctx, svc.remoteManager, req.KeyId, req.PublicKey)
+	if err != nil {
+		return nil, &HandledError{Code: status, Message: err.Error()}
+	}
+	if transferResponse == nil {
+		log.Error("Key manager enforces key wrapping but cannot wrap the key")
+		return nil, &HandledError{Code: http.StatusInternalServerError, Message: "Failed to transfer Key"}
+	}
+
+	resp := &TransferKeyResponse{
+		KeyTransferResponse: transferResponse.(*model.KeyTransferResponse),
+	}
+	return resp, nil
+}
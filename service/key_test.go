@@ -8,19 +8,26 @@ package service
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"encoding/json"
 	"intel/kbs/v1/clients/ita"
+	"intel/kbs/v1/config"
+	"intel/kbs/v1/constant"
 	"intel/kbs/v1/keymanager"
 	"intel/kbs/v1/kmipclient"
 	"intel/kbs/v1/model"
 	"intel/kbs/v1/repository"
 	"intel/kbs/v1/repository/mocks"
+	"intel/kbs/v1/vaultclient"
+	"net/http"
 	"testing"
 
 	"github.com/google/uuid"
 	"github.com/onsi/gomega"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -40,7 +47,7 @@ var svcInstance Service = service{
 		KeyTransferPolicyStore: keyTransPolicyStore,
 	},
 	remoteManager: kRemoteManager,
-	config:        nil,
+	config:        &config.Configuration{ReportDataHash: constant.ReportDataHashAuto},
 }
 var key = []byte{0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07}
 
@@ -365,3 +372,151 @@ func TestKeyUpdateNegative(t *testing.T) {
 	_, err = svc.UpdateKey(context.Background(), keyUpdateReq)
 	g.Expect(err).To(gomega.HaveOccurred())
 }
+
+func TestKeyCreateUnknownKeyManager(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	svc := LoggingMiddleware()(svcInstance)
+	request := model.KeyRequest{
+		KeyInfo: &model.KeyInfo{
+			Algorithm: "AES",
+			KeyLength: 256,
+		},
+		KeyManager: "unknown",
+	}
+	_, err := svc.CreateKey(context.Background(), request)
+	g.Expect(err).To(gomega.HaveOccurred())
+	g.Expect(err.(*HandledError).Code).To(gomega.Equal(400))
+}
+
+func TestKeyRegisterInvalidKmipKey(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	keyManager := keymanager.NewMockKmipManager(kmipClient)
+	keyManager.On("RegisterKey", mock.Anything).Return((*model.KeyAttributes)(nil), errors.Wrap(keymanager.ErrInvalidKmipKey, "kmip key 6 has length 128"))
+	svc := service{
+		repository:    &repository.Repository{KeyStore: keyStore},
+		remoteManager: keymanager.NewRemoteManager(keyStore, keyManager),
+	}
+	request := model.KeyRequest{
+		KeyInfo: &model.KeyInfo{
+			Algorithm: "AES",
+			KeyLength: 256,
+			KmipKeyID: "6",
+		},
+	}
+	_, err := svc.CreateKey(context.Background(), request)
+	g.Expect(err).To(gomega.HaveOccurred())
+	g.Expect(err.(*HandledError).Code).To(gomega.Equal(400))
+}
+
+func TestDiscoverKmipKeys(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	svc := LoggingMiddleware()(svcInstance)
+	_, err := svc.DiscoverKmipKeys(context.Background(), &model.KmipObjectFilterCriteria{KeyManager: "unknown"})
+	g.Expect(err).To(gomega.HaveOccurred())
+	g.Expect(err.(*HandledError).Code).To(gomega.Equal(400))
+
+	// the mock key manager cannot list its keys
+	_, err = svc.DiscoverKmipKeys(context.Background(), &model.KmipObjectFilterCriteria{})
+	g.Expect(err).To(gomega.HaveOccurred())
+	g.Expect(err.(*HandledError).Code).To(gomega.Equal(400))
+}
+
+func TestKeyRetrievePublicKey(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	svc := LoggingMiddleware()(newSecretTestService(t))
+
+	ecKey, err := svc.CreateKey(context.Background(), model.KeyRequest{
+		KeyInfo:          &model.KeyInfo{Algorithm: "EC", CurveType: "prime256v1"},
+		TransferPolicyID: sgxPolicyId,
+	})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	resp, err := svc.RetrievePublicKey(context.Background(), ecKey.ID)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(resp.KeyID).To(gomega.Equal(ecKey.ID))
+	g.Expect(resp.PublicKey).To(gomega.BeAssignableToTypeOf(&ecdsa.PublicKey{}))
+
+	aesKey, err := svc.CreateKey(context.Background(), model.KeyRequest{
+		KeyInfo:          &model.KeyInfo{Algorithm: "AES", KeyLength: 256},
+		TransferPolicyID: sgxPolicyId,
+	})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	_, err = svc.RetrievePublicKey(context.Background(), aesKey.ID)
+	g.Expect(err.(*HandledError).Code).To(gomega.Equal(http.StatusBadRequest))
+
+	secret, err := svc.CreateSecret(context.Background(), model.SecretRequest{Data: "c2VjcmV0", ContentType: "text/plain"})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	_, err = svc.RetrievePublicKey(context.Background(), secret.ID)
+	g.Expect(err.(*HandledError).Code).To(gomega.Equal(http.StatusNotFound))
+	_, err = svc.RetrievePublicKey(context.Background(), uuid.New())
+	g.Expect(err.(*HandledError).Code).To(gomega.Equal(http.StatusNotFound))
+}
+
+// wrappingKmipManager is a kmip key manager with key wrapping that fails the test when a key
+// is read from it in plaintext
+type wrappingKmipManager struct {
+	*keymanager.KmipManager
+	t *testing.T
+}
+
+func (km *wrappingKmipManager) TransferKey(context.Context, *model.KeyAttributes) ([]byte, error) {
+	km.t.Error("TransferKey called on a kmip key manager with key wrapping")
+	return nil, errors.New("key wrapping is enforced")
+}
+
+func TestKeyTransferKeyWrapping(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	mockClient := kmipclient.NewMockKmipClient()
+	mockClient.On("RegisterWrappingKey", mock.Anything).Return("2", nil)
+	mockClient.On("GetWrappedKey", "1", constant.CRYPTOALGAES, "2").Return([]byte("wrapped"), nil)
+	mockClient.On("DeleteKey", "2").Return(nil)
+	store := mocks.NewFakeKeyStore()
+	keyAttributes, err := store.Create(&model.KeyAttributes{ID: uuid.New(), Algorithm: constant.CRYPTOALGAES, KeyLength: 256, KmipKeyID: "1"})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	svc := LoggingMiddleware()(service{
+		repository:    &repository.Repository{KeyStore: store},
+		remoteManager: keymanager.NewRemoteManager(store, &wrappingKmipManager{KmipManager: keymanager.NewWrappingKmipManager(mockClient), t: t}),
+	})
+
+	keyPair, err := rsa.GenerateKey(rand.Reader, 2048)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	resp, err := svc.TransferKey(context.Background(), TransferKeyRequest{KeyId: keyAttributes.ID, PublicKey: &keyPair.PublicKey})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(resp.KeyTransferResponse.WrapAlgorithm).To(gomega.Equal(model.WrapAlgorithmAESKWP))
+	g.Expect(resp.KeyTransferResponse.WrappedSWK).To(gomega.HaveLen(keyPair.PublicKey.Size()))
+	g.Expect(resp.KeyTransferResponse.WrappedKey).To(gomega.Equal([]byte("wrapped")))
+
+	// the kmip server wraps keys to RSA public keys only
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	_, err = svc.TransferKey(context.Background(), TransferKeyRequest{KeyId: keyAttributes.ID, PublicKey: &ecKey.PublicKey})
+	g.Expect(err.(*HandledError).Code).To(gomega.Equal(http.StatusBadRequest))
+	mockClient.AssertNotCalled(t, "GetKey", mock.Anything, mock.Anything)
+}
+
+func TestKeyTransferVaultTransit(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	keyPair, err := rsa.GenerateKey(rand.Reader, 2048)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	store := mocks.NewFakeKeyStore()
+	keyAttributes, err := store.Create(&model.KeyAttributes{ID: uuid.New(), Algorithm: constant.CRYPTOALGAES, KeyLength: 256})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	wrapped := append(make([]byte, keyPair.PublicKey.Size()), []byte("wrapped")...)
+	mockClient := vaultclient.NewMockTransitClient()
+	mockClient.On("ExportWrappedKey", keyAttributes.ID.String(), &keyPair.PublicKey).Return(wrapped, nil)
+
+	svc := LoggingMiddleware()(service{
+		repository:    &repository.Repository{KeyStore: store},
+		remoteManager: keymanager.NewRemoteManager(store, keymanager.NewVaultTransitManager(mockClient)),
+	})
+	resp, err := svc.TransferKey(context.Background(), TransferKeyRequest{KeyId: keyAttributes.ID, PublicKey: &keyPair.PublicKey})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(resp.KeyTransferResponse.WrapAlgorithm).To(gomega.Equal(model.WrapAlgorithmAESKWP))
+	g.Expect(resp.KeyTransferResponse.WrappedKey).To(gomega.Equal([]byte("wrapped")))
+	mockClient.AssertNotCalled(t, "ExportKey", mock.Anything, mock.Anything)
+}
@@ -7,15 +7,20 @@
 package service
 
 import (
+	"bytes"
 	"context"
+	"crypto"
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/ecdsa"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
+	"crypto/x509"
 	"encoding/base64"
 	"encoding/binary"
-	"encoding/pem"
+	"encoding/json"
+	"fmt"
 	itaConnector "github.com/intel/trustauthority-client/go-connector"
 	"github.com/sirupsen/logrus"
 	"hash"
@@ -23,6 +28,8 @@ import (
 	"io"
 	"math/big"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 
 	"intel/kbs/v1/constant"
@@ -31,25 +38,46 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
+	"golang.org/x/crypto/cryptobyte"
+	cryptobyte_asn1 "golang.org/x/crypto/cryptobyte/asn1"
 )
 
 const (
 	ivSize   = 4
 	tagSize  = 4
 	wrapSize = 4
+
+	// asn1Sequence is the first byte of a PKIX, ASN.1 DER public key
+	asn1Sequence = 0x30
 )
 
+// issuedNoncesLock serializes the lookup and removal of an issued verifier nonce, so that a nonce
+// is consumed by a single key transfer
+var issuedNoncesLock sync.Mutex
+
 type TransferKeyRequest struct {
-	KeyId              uuid.UUID
-	PublicKey          *rsa.PublicKey
+	KeyId uuid.UUID
+	// PublicKey is the *rsa.PublicKey, *ecdsa.PublicKey or *crypt.HybridPublicKey the key is
+	// wrapped to
+	PublicKey          crypto.PublicKey
 	AttestationType    string
 	KeyTransferRequest *model.KeyTransferRequest
+	// ResponseFormat is the format requested by the workload, the format of the key transfer
+	// policy is used when it is empty
+	ResponseFormat string
+	// EnvelopeVersion is the wrapped key envelope version requested by the workload, the version
+	// of the key transfer policy is used when it is 0
+	EnvelopeVersion int
 }
 
 type TransferKeyResponse struct {
 	AttestationType     string
 	Nonce               *itaConnector.VerifierNonce
 	KeyTransferResponse *model.KeyTransferResponse
+	// KeyTransferJwe is set instead of KeyTransferResponse for the jwe response format
+	KeyTransferJwe *crypt.Jwe
+	// Ciphertext is a generated data key encrypted under the master key
+	Ciphertext []byte
 }
 
 func (mw loggingMiddleware) TransferKeyWithEvidence(ctx context.Context, req TransferKeyRequest) (*TransferKeyResponse, error) {
@@ -64,7 +92,7 @@ func (mw loggingMiddleware) TransferKeyWithEvidence(ctx context.Context, req Tra
 	return resp, err
 }
 
-func (svc service) TransferKeyWithEvidence(_ context.Context, req TransferKeyRequest) (*TransferKeyResponse, error) {
+func (svc service) TransferKeyWithEvidence(ctx context.Context, req TransferKeyRequest) (*TransferKeyResponse, error) {
 	key, err := svc.remoteManager.RetrieveKey(req.KeyId)
 	if err != nil {
 		if err.Error() == RecordNotFound {
@@ -76,12 +104,55 @@ func (svc service) TransferKeyWithEvidence(_ context.Context, req TransferKeyReq
 		}
 	}
 
-	transferPolicy, err := svc.repository.KeyTransferPolicyStore.Retrieve(key.TransferPolicyID)
+	return svc.transferWithEvidence(ctx, req, key.KeyInfo.Algorithm, key.KeyInfo.KeyEncoding, key.TransferPolicyID)
+}
+
+// transferWithEvidence releases the key or secret of the request to a workload whose attestation
+// satisfies the key transfer policy. Without evidence or attestation token, a verifier nonce is
+// returned for the workload to attest with.
+func (svc service) transferWithEvidence(ctx context.Context, req TransferKeyRequest, keyAlgorithm, defaultKeyEncoding string, transferPolicyID uuid.UUID) (*TransferKeyResponse, error) {
+
+	transferPolicy, err := svc.repository.KeyTransferPolicyStore.Retrieve(transferPolicyID)
 	if err != nil {
 		logrus.WithError(err).Error("Key transfer policy retrieve failed")
 		return nil, &HandledError{Code: http.StatusInternalServerError, Message: "Failed to retrieve key transfer policy for the key"}
 	}
 
+	tokenClaims, nonceResp, err := svc.attestWithEvidence(req, transferPolicy)
+	if err != nil || nonceResp != nil {
+		return nonceResp, err
+	}
+
+	responseFormat := req.ResponseFormat
+	if responseFormat == "" {
+		responseFormat = transferPolicy.ResponseFormat
+	}
+	envelopeVersion := transferEnvelopeVersion(req, transferPolicy)
+	keyEncoding := req.KeyTransferRequest.KeyEncoding
+	if keyEncoding == "" {
+		keyEncoding = defaultKeyEncoding
+	}
+	transferResponse, httpStatus, err := svc.validateClaimsAndGetKey(ctx, tokenClaims, transferPolicy, keyAlgorithm, tokenClaims.AttesterHeldData, req.KeyId, responseFormat, envelopeVersion, keyEncoding)
+	if err != nil {
+		return nil, &HandledError{Code: httpStatus, Message: err.Error()}
+	}
+
+	resp := &TransferKeyResponse{}
+	switch transferResponse := transferResponse.(type) {
+	case *crypt.Jwe:
+		resp.KeyTransferJwe = transferResponse
+	case *model.KeyTransferResponse:
+		resp.KeyTransferResponse = transferResponse
+	}
+	return resp, nil
+}
+
+// attestWithEvidence returns the claims of the attestation token of the workload, after checking
+// that the token is valid for the attestation type of the key transfer policy and bound to the
+// attester held data. Without evidence or attestation token, it returns a verifier nonce for the
+// workload to attest with instead.
+func (svc service) attestWithEvidence(req TransferKeyRequest, transferPolicy *model.KeyTransferPolicy) (*model.AttestationTokenClaim, *TransferKeyResponse, error) {
+
 	var token string
 	itaRequestID := req.KeyId.String()
 	if req.AttestationType == "" {
@@ -90,7 +161,11 @@ func (svc service) TransferKeyWithEvidence(_ context.Context, req TransferKeyReq
 			nonceResp, err := svc.itaApiClient.GetNonce(nonceArgs)
 			if err != nil {
 				logrus.WithError(err).Error("Error retrieving nonce from Trust Authority service")
-				return nil, &HandledError{Code: http.StatusBadGateway, Message: "Error retrieving nonce from Trust Authority service"}
+				return nil, nil, &HandledError{Code: http.StatusBadGateway, Message: "Error retrieving nonce from Trust Authority service"}
+			}
+			if err := svc.recordIssuedNonce(nonceResp.Nonce); err != nil {
+				logrus.WithError(err).Error("Error recording the verifier nonce")
+				return nil, nil, &HandledError{Code: http.StatusServiceUnavailable, Message: "Too many verifier nonces are outstanding, retry later"}
 			}
 
 			resp := &TransferKeyResponse{
@@ -98,14 +173,14 @@ func (svc service) TransferKeyWithEvidence(_ context.Context, req TransferKeyReq
 				AttestationType:     transferPolicy.AttestationType.String(),
 				KeyTransferResponse: nil,
 			}
-			return resp, nil
+			return nil, resp, nil
 		} else {
 			token = req.KeyTransferRequest.AttestationToken
 		}
 	} else {
 		if req.AttestationType != transferPolicy.AttestationType.String() {
 			logrus.Error("attestation-type in request header does not match with attestation-type in key-transfer policy")
-			return nil, &HandledError{Code: http.StatusUnauthorized, Message: "attestation-type in request header does not match with attestation-type in key-transfer policy"}
+			return nil, nil, &HandledError{Code: http.StatusUnauthorized, Message: "attestation-type in request header does not match with attestation-type in key-transfer policy"}
 		}
 
 		var policyIds []uuid.UUID
@@ -132,7 +207,7 @@ func (svc service) TransferKeyWithEvidence(_ context.Context, req TransferKeyReq
 		tokenResp, err := svc.itaApiClient.GetToken(tokenRequest)
 		if err != nil {
 			logrus.WithError(err).Error("Error retrieving token from Trust Authority service")
-			return nil, &HandledError{Code: http.StatusBadGateway, Message: "Error retrieving token from Trust Authority service"}
+			return nil, nil, &HandledError{Code: http.StatusBadGateway, Message: "Error retrieving token from Trust Authority service"}
 		}
 		token = tokenResp.Token
 	}
@@ -140,24 +215,33 @@ func (svc service) TransferKeyWithEvidence(_ context.Context, req TransferKeyReq
 	claims, err := svc.authenticateToken(token)
 	if err != nil {
 		logrus.WithError(err).Error("Failed to authenticate attestation-token")
-		return nil, &HandledError{Code: http.StatusUnauthorized, Message: "Failed to authenticate attestation-token"}
+		return nil, nil, &HandledError{Code: http.StatusUnauthorized, Message: "Failed to authenticate attestation-token"}
 	}
 
 	tokenClaims := claims.(*model.AttestationTokenClaim)
 	if tokenClaims.AttesterType != transferPolicy.AttestationType {
 		logrus.Error("attestation-token is not valid for attestation-type in key-transfer policy")
-		return nil, &HandledError{Code: http.StatusUnauthorized, Message: "attestation-token is not valid for attestation-type in key-transfer policy"}
+		return nil, nil, &HandledError{Code: http.StatusUnauthorized, Message: "attestation-token is not valid for attestation-type in key-transfer policy"}
 	}
 
-	transferResponse, httpStatus, err := svc.validateClaimsAndGetKey(tokenClaims, transferPolicy, key.KeyInfo.Algorithm, tokenClaims.AttesterHeldData, req.KeyId)
-	if err != nil {
-		return nil, &HandledError{Code: httpStatus, Message: err.Error()}
+	if err := svc.verifyAttestationBinding(tokenClaims, req); err != nil {
+		logrus.WithError(err).Error("Failed to verify the binding of the attester held data to the attestation")
+		return nil, nil, &HandledError{Code: http.StatusUnauthorized, Message: "attestation-token is not bound to the attester held data"}
 	}
+	return tokenClaims, nil, nil
+}
+
+// transferEnvelopeVersion returns the wrapped key envelope version requested by the workload, or
+// else of the key transfer policy. Version 2 is the default.
+func transferEnvelopeVersion(req TransferKeyRequest, transferPolicy *model.KeyTransferPolicy) int {
 
-	resp := &TransferKeyResponse{
-		KeyTransferResponse: transferResponse.(*model.KeyTransferResponse),
+	if req.EnvelopeVersion != 0 {
+		return req.EnvelopeVersion
 	}
-	return resp, nil
+	if transferPolicy.EnvelopeVersion != 0 {
+		return transferPolicy.EnvelopeVersion
+	}
+	return model.EnvelopeVersion2
 }
 
 func (svc service) authenticateToken(token string) (interface{}, error) {
@@ -175,7 +259,86 @@ func (svc service) authenticateToken(token string) (interface{}, error) {
 	return claims, nil
 }
 
-func (svc service) validateClaimsAndGetKey(tokenClaims *model.AttestationTokenClaim, transferPolicy *model.KeyTransferPolicy, keyAlgorithm, userData string, keyId uuid.UUID) (interface{}, int, error) {
+// verifyAttestationBinding checks that the report data of the TEE binds the attester held data to
+// the verifier nonce of the attestation token, unless the report data hash is configured as none.
+// When key transfers require a nonce issued by this KBS, the nonce must also be one handed out by
+// this KBS, and it is consumed so that a token can be used for a single key transfer.
+func (svc service) verifyAttestationBinding(tokenClaims *model.AttestationTokenClaim, req TransferKeyRequest) error {
+
+	hashScheme := strings.ToLower(svc.config.ReportDataHash)
+	if hashScheme != constant.ReportDataHashNone {
+		if tokenClaims.VerifierNonce == nil {
+			return errors.New("attestation-token does not hold a verifier nonce")
+		}
+		if req.AttestationType != "" && !verifierNoncesEqual(req.KeyTransferRequest.VerifierNonce, tokenClaims.VerifierNonce) {
+			return errors.New("Verifier nonce in attestation-token does not match the nonce in the request")
+		}
+		if err := validateReportDataBinding(tokenClaims, hashScheme); err != nil {
+			return err
+		}
+	}
+
+	if !svc.config.RequireIssuedNonce {
+		return nil
+	}
+	if tokenClaims.VerifierNonce == nil {
+		return errors.New("attestation-token does not hold a verifier nonce")
+	}
+	return svc.consumeIssuedNonce(tokenClaims.VerifierNonce)
+}
+
+// recordIssuedNonce remembers a verifier nonce handed out to a workload until it is used for a
+// key transfer or expires. It fails when MaxIssuedVerifierNonces nonces are outstanding, rather
+// than forgetting nonces that were handed out.
+func (svc service) recordIssuedNonce(nonce *itaConnector.VerifierNonce) error {
+
+	if !svc.config.RequireIssuedNonce || nonce == nil {
+		return nil
+	}
+	if svc.issuedNonces == nil {
+		return errors.New("Issued verifier nonces are not tracked")
+	}
+
+	issuedNoncesLock.Lock()
+	defer issuedNoncesLock.Unlock()
+
+	svc.issuedNonces.GC()
+	if svc.issuedNonces.Len() >= svc.issuedNonces.Cap() {
+		return errors.Errorf("%d issued verifier nonces are outstanding", svc.issuedNonces.Len())
+	}
+	svc.issuedNonces.Store(base64.StdEncoding.EncodeToString(nonce.Val), nonce)
+	return nil
+}
+
+// consumeIssuedNonce removes the verifier nonce from the issued nonces, it fails when the nonce
+// was not issued by this KBS, has expired or was already used
+func (svc service) consumeIssuedNonce(nonce *itaConnector.VerifierNonce) error {
+
+	if svc.issuedNonces == nil {
+		return errors.New("Issued verifier nonces are not tracked")
+	}
+
+	issuedNoncesLock.Lock()
+	defer issuedNoncesLock.Unlock()
+
+	nonceKey := base64.StdEncoding.EncodeToString(nonce.Val)
+	issuedNonce, ok := svc.issuedNonces.Load(nonceKey)
+	if !ok || !verifierNoncesEqual(issuedNonce.(*itaConnector.VerifierNonce), nonce) {
+		return errors.New("Verifier nonce in attestation-token was not issued by the KBS or was already used")
+	}
+	svc.issuedNonces.Delete(nonceKey)
+	return nil
+}
+
+func verifierNoncesEqual(nonce, other *itaConnector.VerifierNonce) bool {
+
+	if nonce == nil || other == nil {
+		return false
+	}
+	return bytes.Equal(nonce.Val, other.Val) && bytes.Equal(nonce.Iat, other.Iat) && bytes.Equal(nonce.Signature, other.Signature)
+}
+
+func (svc service) validateClaimsAndGetKey(ctx context.Context, tokenClaims *model.AttestationTokenClaim, transferPolicy *model.KeyTransferPolicy, keyAlgorithm, userData string, keyId uuid.UUID, responseFormat string, envelopeVersion int, keyEncoding string) (interface{}, int, error) {
 
 	err := validateAttestationTokenClaims(tokenClaims, transferPolicy)
 	if err != nil {
@@ -183,22 +346,108 @@ func (svc service) validateClaimsAndGetKey(tokenClaims *model.AttestationTokenCl
 		return nil, http.StatusUnauthorized, &HandledError{Message: "Token claims validation against key-transfer-policy failed"}
 	}
 
-	return svc.getWrappedKey(keyAlgorithm, userData, keyId, transferPolicy.AttestationType)
+	return svc.getWrappedKey(ctx, keyAlgorithm, userData, keyId, transferPolicy, responseFormat, envelopeVersion, keyEncoding)
 }
 
-func (svc service) getWrappedKey(keyAlgorithm, userData string, id uuid.UUID, attesterType model.AttesterType) (interface{}, int, error) {
+func (svc service) getWrappedKey(ctx context.Context, keyAlgorithm, userData string, id uuid.UUID, transferPolicy *model.KeyTransferPolicy, responseFormat string, envelopeVersion int, keyEncoding string) (interface{}, int, error) {
+
+	if keyEncoding != "" && !isKeyEncodingAllowed(keyAlgorithm, keyEncoding) {
+		logrus.Errorf("Key encoding %s is not supported for %s keys", keyEncoding, keyAlgorithm)
+		return nil, http.StatusBadRequest, &HandledError{Message: "Key encoding is not supported for the key algorithm"}
+	}
 
-	publicKey, err := getPublicKey(userData, attesterType)
+	publicKey, status, err := getWorkloadPublicKey(userData, transferPolicy, responseFormat)
 	if err != nil {
-		logrus.WithError(err).Error("Error in getting public key")
-		return nil, http.StatusInternalServerError, &HandledError{Message: "Error in getting public key"}
+		return nil, status, err
 	}
 
-	secretKey, status, err := getSecretKey(svc.remoteManager, id)
-	defer crypt.ZeroizeByteArray(secretKey.([]byte))
+	// keys of key managers that wrap keys themselves are never seen by the KBS in plaintext
+	wrappedResponse, status, err := getKeyWrappedByKeyManager(ctx, svc.remoteManager, id, publicKey)
 	if err != nil {
 		return nil, status, err
 	}
+	if wrappedResponse != nil {
+		// the key is wrapped with AES-KWP, which has no JWE content encryption algorithm
+		if responseFormat == model.KeyTransferFormatJWE {
+			logrus.Error("Key wrapped by its key manager cannot be returned as JWE")
+			return nil, http.StatusNotAcceptable, &HandledError{Message: "Key wrapped by its key manager cannot be returned as JWE"}
+		}
+		// key managers wrap private keys in PKCS#8 and AES keys raw
+		if keyEncoding != "" && keyEncoding != model.KeyEncodingPKCS8 && keyEncoding != model.KeyEncodingRaw {
+			logrus.Errorf("Key wrapped by its key manager cannot be returned in %s encoding", keyEncoding)
+			return nil, http.StatusNotAcceptable, &HandledError{Message: "Key wrapped by its key manager cannot be returned in the requested encoding"}
+		}
+		return wrappedResponse, status, nil
+	}
+
+	var secretKey interface{}
+	if keyAlgorithm == constant.CRYPTOALGSECRET {
+		secretKey, status, err = getSecret(ctx, svc.remoteManager, id)
+	} else {
+		secretKey, status, err = getSecretKey(ctx, svc.remoteManager, id)
+	}
+	if err != nil {
+		return nil, status, err
+	}
+	defer crypt.ZeroizeByteArray(secretKey.([]byte))
+
+	keyByte, err := encodeKey(keyAlgorithm, secretKey.([]byte), keyEncoding, id)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to encode secret key")
+		return nil, http.StatusInternalServerError, &HandledError{Message: "Failed to encode secret key"}
+	}
+	defer crypt.ZeroizeByteArray(keyByte)
+
+	return wrapKeyToWorkload(publicKey, keyAlgorithm, keyByte, keyEncoding, id, transferPolicy, responseFormat, envelopeVersion)
+}
+
+// getWorkloadPublicKey returns the workload public key held in the attester held data, which must
+// be a hybrid public key if and only if the key transfer policy requires hybrid key encapsulation
+func getWorkloadPublicKey(userData string, transferPolicy *model.KeyTransferPolicy, responseFormat string) (crypto.PublicKey, int, error) {
+
+	publicKey, err := getPublicKey(userData, transferPolicy.AttestationType)
+	if err != nil {
+		logrus.WithError(err).Error("Error in getting public key")
+		return nil, http.StatusBadRequest, &HandledError{Message: "Error in getting public key"}
+	}
+
+	// a hybrid public key is required by, and only accepted with, hybrid key encapsulation
+	_, isHybrid := publicKey.(*crypt.HybridPublicKey)
+	if isHybrid != (transferPolicy.KeyEncapsulation == model.KeyEncapsulationHybridMLKEM768) {
+		logrus.Error("Public key does not match the key encapsulation of the key transfer policy")
+		return nil, http.StatusBadRequest, &HandledError{Message: "Public key does not match the key encapsulation of the key transfer policy"}
+	}
+	if isHybrid && responseFormat == model.KeyTransferFormatJWE {
+		logrus.Error("Hybrid key encapsulation cannot be returned as JWE")
+		return nil, http.StatusNotAcceptable, &HandledError{Message: "Hybrid key encapsulation cannot be returned as JWE"}
+	}
+	return publicKey, http.StatusOK, nil
+}
+
+// wrapKeyToWorkload returns the key bytes wrapped under an SWK that is wrapped to, or derived with
+// hybrid key encapsulation from, the workload public key, in the response format and envelope
+// version of the transfer
+func wrapKeyToWorkload(publicKey crypto.PublicKey, keyAlgorithm string, keyByte []byte, keyEncoding string, id uuid.UUID, transferPolicy *model.KeyTransferPolicy, responseFormat string, envelopeVersion int) (interface{}, int, error) {
+
+	if keyEncoding == "" {
+		keyEncoding = detectKeyEncoding(keyAlgorithm, keyByte)
+	}
+
+	// the metadata of a version 2 envelope binds the wrapped key to the key and the policy
+	var metadata *model.WrappedKeyMetadata
+	if envelopeVersion == model.EnvelopeVersion2 {
+		metadata = &model.WrappedKeyMetadata{
+			KeyID:       id,
+			KeyVersion:  1,
+			Algorithm:   keyAlgorithm,
+			KeyEncoding: keyEncoding,
+			PolicyID:    transferPolicy.ID,
+		}
+	}
+
+	if hybridKey, isHybrid := publicKey.(*crypt.HybridPublicKey); isHybrid {
+		return encapsulateKey(hybridKey, keyByte, metadata)
+	}
 
 	swk, err := CreateSwk()
 	defer crypt.ZeroizeByteArray(swk)
@@ -207,49 +456,189 @@ func (svc service) getWrappedKey(keyAlgorithm, userData string, id uuid.UUID, at
 		return nil, http.StatusInternalServerError, &HandledError{Message: "Error in creating SWK key"}
 	}
 
-	var bytes, keyByte, nonceByte []byte
-	switch keyAlgorithm {
-	case constant.CRYPTOALGAES:
-		keyByte = secretKey.([]byte)
+	if responseFormat == model.KeyTransferFormatJWE {
+		jwe, err := crypt.EncryptJwe(publicKey, swk, keyByte, id.String())
+		if err != nil {
+			logrus.WithError(err).Error("Failed to encrypt secret key as JWE")
+			return nil, http.StatusInternalServerError, &HandledError{Message: "Failed to encrypt secret key as JWE"}
+		}
+		return jwe, http.StatusOK, nil
+	}
+
+	return wrapKeyWithSwk(publicKey, keyByte, swk, metadata)
+}
 
-	case constant.CRYPTOALGRSA:
-		privatePem := pem.EncodeToMemory(
-			&pem.Block{
-				Type:  "RSA PRIVATE KEY",
-				Bytes: secretKey.([]byte),
-			},
-		)
+// encodeKey returns the key bytes of a key of the algorithm in the encoding, or unchanged when the
+// encoding is empty. The key ID is the kid of JWK encoded keys.
+func encodeKey(keyAlgorithm string, keyByte []byte, encoding string, id uuid.UUID) ([]byte, error) {
 
-		decodedBlock, _ := pem.Decode(privatePem)
-		if decodedBlock == nil {
-			logrus.Error("Failed to decode secret key")
-			return nil, http.StatusInternalServerError, &HandledError{Message: "Failed to decode secret key"}
+	if encoding == "" || encoding == detectKeyEncoding(keyAlgorithm, keyByte) {
+		return append([]byte{}, keyByte...), nil
+	}
+
+	if constant.SymmetricAlgorithms[keyAlgorithm] {
+		if encoding != model.KeyEncodingJWK {
+			return nil, errors.Errorf("%s keys cannot be encoded as %s", keyAlgorithm, encoding)
 		}
-		keyByte = decodedBlock.Bytes
-		defer crypt.ZeroizeByteArray(decodedBlock.Bytes)
-		defer crypt.ZeroizeByteArray(privatePem)
+		jwk := crypt.NewOctJwk(keyByte)
+		jwk.KeyID = id.String()
+		if keyAlgorithm == constant.CRYPTOALGHMAC {
+			// HMAC keys are HMAC-SHA256 or HMAC-SHA384 keys by their length
+			jwk.Algorithm = fmt.Sprintf("HS%d", len(keyByte)*8)
+		}
+		return json.Marshal(jwk)
+	}
 
-	case constant.CRYPTOALGEC:
-		privatePem := pem.EncodeToMemory(
-			&pem.Block{
-				Type:  "EC PRIVATE KEY",
-				Bytes: secretKey.([]byte),
-			},
-		)
+	privateKey, err := crypt.ParsePrivateKeyDer(keyByte)
+	if err != nil {
+		return nil, err
+	}
+	if rsaKey, ok := privateKey.(*rsa.PrivateKey); ok {
+		defer crypt.ZeroizeRSAPrivateKey(rsaKey)
+	}
 
-		decodedBlock, _ := pem.Decode(privatePem)
-		if decodedBlock == nil {
-			logrus.Error("Failed to decode secret key")
-			return nil, http.StatusInternalServerError, &HandledError{Message: "Failed to decode secret key"}
+	switch encoding {
+	case model.KeyEncodingPKCS8:
+		return crypt.MarshalPKCS8PrivateKey(privateKey)
+	case model.KeyEncodingPKCS1:
+		rsaKey, ok := privateKey.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("Only RSA keys can be encoded as PKCS#1")
 		}
-		keyByte = decodedBlock.Bytes
-		defer crypt.ZeroizeByteArray(decodedBlock.Bytes)
-		defer crypt.ZeroizeByteArray(privatePem)
+		return x509.MarshalPKCS1PrivateKey(rsaKey), nil
+	case model.KeyEncodingSEC1:
+		ecKey, ok := privateKey.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("Only EC keys can be encoded as SEC1")
+		}
+		return crypt.MarshalECPrivateKey(ecKey)
+	case model.KeyEncodingJWK:
+		jwk, err := crypt.NewPrivateJwk(privateKey)
+		if err != nil {
+			return nil, err
+		}
+		jwk.KeyID = id.String()
+		return json.Marshal(jwk)
+	default:
+		return nil, errors.Errorf("Key encoding %s is not supported", encoding)
+	}
+}
+
+// detectKeyEncoding returns the encoding of the key bytes of a key of the algorithm, raw for
+// symmetric keys and secrets and PKCS#8, PKCS#1 or SEC1 DER for private keys, as key managers
+// return either of them. Ed25519 and X25519 keys are always PKCS#8.
+func detectKeyEncoding(keyAlgorithm string, keyByte []byte) string {
+
+	if constant.SymmetricAlgorithms[keyAlgorithm] {
+		return model.KeyEncodingRaw
+	}
+	if keyAlgorithm == constant.CRYPTOALGED25519 || keyAlgorithm == constant.CRYPTOALGX25519 {
+		return model.KeyEncodingPKCS8
+	}
+
+	// a PKCS#8 private key is a version followed by an algorithm identifier, the other encodings
+	// are a version followed by an integer or an octet string
+	input := cryptobyte.String(keyByte)
+	var privateKey cryptobyte.String
+	var version int
+	if input.ReadASN1(&privateKey, cryptobyte_asn1.SEQUENCE) && privateKey.ReadASN1Integer(&version) &&
+		privateKey.PeekASN1Tag(cryptobyte_asn1.SEQUENCE) {
+		return model.KeyEncodingPKCS8
+	}
+	if keyAlgorithm == constant.CRYPTOALGEC {
+		return model.KeyEncodingSEC1
+	}
+	return model.KeyEncodingPKCS1
+}
+
+// encapsulateKey returns the key wrapped under an SWK derived with hybrid key encapsulation to
+// the workload public key, together with the ML-KEM ciphertext and ephemeral ECDH public key the
+// workload derives the SWK from
+func encapsulateKey(hybridKey *crypt.HybridPublicKey, keyByte []byte, metadata *model.WrappedKeyMetadata) (interface{}, int, error) {
+
+	swk, mlkemCiphertext, ephemeralKey, err := crypt.HybridEncapsulate(hybridKey)
+	defer crypt.ZeroizeByteArray(swk)
+	if err != nil {
+		logrus.WithError(err).Error("Hybrid key encapsulation failed")
+		return nil, http.StatusInternalServerError, &HandledError{Message: "Failed to wrap key"}
+	}
+	ephemeralKeyDer, err := x509.MarshalPKIXPublicKey(ephemeralKey)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to marshal ephemeral public key")
+		return nil, http.StatusInternalServerError, &HandledError{Message: "Failed to wrap key"}
+	}
+
+	transferResponse, status, err := sealKeyWithSwk(keyByte, swk, metadata)
+	if err != nil {
+		return nil, status, err
+	}
+	transferResponse.KeyEncapsulation = hybridKey.Name()
+	transferResponse.MLKEMCiphertext = mlkemCiphertext
+	transferResponse.EphemeralPublicKey = ephemeralKeyDer
+	return transferResponse, http.StatusOK, nil
+}
+
+// wrapKeyWithSwk returns the key wrapped under the SWK with AES-GCM, and the SWK wrapped to the
+// workload public key
+func wrapKeyWithSwk(publicKey crypto.PublicKey, keyByte, swk []byte, metadata *model.WrappedKeyMetadata) (interface{}, int, error) {
+
+	transferResponse, status, err := sealKeyWithSwk(keyByte, swk, metadata)
+	if err != nil {
+		return nil, status, err
+	}
+
+	// Wrap SWK with public key
+	switch publicKey := publicKey.(type) {
+	case *rsa.PublicKey:
+		wrappedSWK, status, err := wrapKey(publicKey, swk, sha256.New(), nil)
+		if err != nil {
+			return nil, status, err
+		}
+		transferResponse.WrappedSWK = wrappedSWK.([]byte)
+
+	case *ecdsa.PublicKey:
+		wrappedSWK, ephemeralKey, err := crypt.EcdhEsWrapKey(publicKey, swk)
+		if err != nil {
+			logrus.WithError(err).Error("Wrap key failed")
+			return nil, http.StatusInternalServerError, &HandledError{Message: "Failed to wrap key"}
+		}
+		ephemeralKeyDer, err := x509.MarshalPKIXPublicKey(ephemeralKey)
+		if err != nil {
+			logrus.WithError(err).Error("Failed to marshal ephemeral public key")
+			return nil, http.StatusInternalServerError, &HandledError{Message: "Failed to wrap key"}
+		}
+		transferResponse.WrappedSWK = wrappedSWK
+		transferResponse.SWKWrapAlgorithm = model.SWKWrapAlgorithmECDHES
+		transferResponse.EphemeralPublicKey = ephemeralKeyDer
+
+	default:
+		logrus.Errorf("Public key type %T is not supported", publicKey)
+		return nil, http.StatusBadRequest, &HandledError{Message: "Public key type is not supported"}
+	}
+	return transferResponse, http.StatusOK, nil
+}
+
+// sealKeyWithSwk returns the transfer response with the key encrypted under the SWK with AES-GCM,
+// preceded by the little endian IV length, tag length and ciphertext length and the IV. Without
+// metadata this is the version 1 envelope. The version 2 envelope is prefixed with the little
+// endian envelope version, the length of the JSON encoded metadata and the metadata, which are
+// the additional authenticated data of AES-GCM.
+func sealKeyWithSwk(keyByte, swk []byte, metadata *model.WrappedKeyMetadata) (*model.KeyTransferResponse, int, error) {
+
+	envelopeHeader := []byte{}
+	if metadata != nil {
+		metadataJson, err := json.Marshal(metadata)
+		if err != nil {
+			logrus.WithError(err).Error("Failed to encode wrapped key metadata")
+			return nil, http.StatusInternalServerError, &HandledError{Message: "Failed to encrypt secret key with swk"}
+		}
+		envelopeHeader = binary.LittleEndian.AppendUint32(envelopeHeader, uint32(model.EnvelopeVersion2))
+		envelopeHeader = binary.LittleEndian.AppendUint32(envelopeHeader, uint32(len(metadataJson)))
+		envelopeHeader = append(envelopeHeader, metadataJson...)
 	}
 
-	defer crypt.ZeroizeByteArray(keyByte)
 	// Wrap secret key with swk
-	bytes, nonceByte, err = AesEncrypt(keyByte, swk)
+	bytes, nonceByte, err := AesEncrypt(keyByte, swk, envelopeHeader)
 	if err != nil {
 		logrus.Error("Failed to encrypt secret key with swk")
 		return nil, http.StatusInternalServerError, &HandledError{Message: "Failed to encrypt secret key with swk"}
@@ -263,30 +652,127 @@ func (svc service) getWrappedKey(keyAlgorithm, userData string, id uuid.UUID, at
 	binary.LittleEndian.PutUint32(keyMetaData[8:], uint32(len(bytes)))
 
 	wrappedKey := []byte{}
+	wrappedKey = append(wrappedKey, envelopeHeader...)
 	wrappedKey = append(wrappedKey, keyMetaData...)
 	wrappedKey = append(wrappedKey, nonceByte...)
 	wrappedKey = append(wrappedKey, bytes...)
 
-	// Wrap SWK with public key
-	wrappedSWK, status, err := wrapKey(publicKey, swk, sha256.New(), nil)
-	if err != nil {
-		return nil, status, err
-	}
-
 	transferResponse := &model.KeyTransferResponse{
 		WrappedKey: wrappedKey,
-		WrappedSWK: wrappedSWK.([]byte),
+	}
+	if metadata != nil {
+		transferResponse.EnvelopeVersion = model.EnvelopeVersion2
 	}
 	return transferResponse, http.StatusOK, nil
 }
 
-func getPublicKey(userData string, attesterType model.AttesterType) (*rsa.PublicKey, error) {
+// openSealedKey returns the key and the metadata of a version 2 envelope sealed under the SWK by
+// sealKeyWithSwk
+func openSealedKey(wrappedKey, swk []byte) ([]byte, *model.WrappedKeyMetadata, error) {
+
+	metadata, err := sealedKeyMetadata(wrappedKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	envelopeHeader := wrappedKey[:8+binary.LittleEndian.Uint32(wrappedKey[4:])]
+
+	keyMetaData := wrappedKey[len(envelopeHeader):]
+	ivLength := uint64(binary.LittleEndian.Uint32(keyMetaData[0:]))
+	cipherTextLength := uint64(binary.LittleEndian.Uint32(keyMetaData[8:]))
+	keyMetaData = keyMetaData[ivSize+tagSize+wrapSize:]
+	if uint64(len(keyMetaData)) != ivLength+cipherTextLength {
+		return nil, nil, errors.New("wrapped key length does not match its envelope")
+	}
+
+	keyByte, err := AesDecrypt(keyMetaData[ivLength:], swk, keyMetaData[:ivLength], envelopeHeader)
+	if err != nil {
+		return nil, nil, err
+	}
+	return keyByte, metadata, nil
+}
+
+// sealedKeyMetadata returns the metadata of a version 2 envelope without opening it. The
+// metadata is not authenticated until the envelope is opened with openSealedKey.
+func sealedKeyMetadata(wrappedKey []byte) (*model.WrappedKeyMetadata, error) {
+
+	if len(wrappedKey) < 8 || binary.LittleEndian.Uint32(wrappedKey[0:]) != uint32(model.EnvelopeVersion2) {
+		return nil, errors.New("wrapped key is not a version 2 envelope")
+	}
+	metadataLength := uint64(binary.LittleEndian.Uint32(wrappedKey[4:]))
+	if uint64(len(wrappedKey)) < 8+metadataLength+uint64(ivSize+tagSize+wrapSize) {
+		return nil, errors.New("wrapped key is too short")
+	}
+	var metadata model.WrappedKeyMetadata
+	if err := json.Unmarshal(wrappedKey[8:8+metadataLength], &metadata); err != nil {
+		return nil, errors.Wrap(err, "failed to decode wrapped key metadata")
+	}
+	return &metadata, nil
+}
+
+// getPublicKey returns the workload public key held in the runtime data of the attestation token.
+// The runtime data is a PKIX, ASN.1 DER public key, a JWK, a JWK Set holding the ECDH and ML-KEM
+// keys of a hybrid public key, or an RSA public key given as a 4 byte little endian exponent
+// followed by the modulus.
+func getPublicKey(userData string, attesterType model.AttesterType) (crypto.PublicKey, error) {
 
 	key, err := base64.StdEncoding.DecodeString(userData)
 	if err != nil {
 		return nil, errors.New("failed to decode user data")
 	}
 
+	var publicKey crypto.PublicKey
+	switch {
+	case len(key) > 0 && key[0] == '{':
+		var jwkSet crypt.JwkSet
+		if err := json.Unmarshal(key, &jwkSet); err != nil {
+			return nil, errors.Wrap(err, "failed to decode JWK in user data")
+		}
+		if len(jwkSet.Keys) > 0 {
+			publicKey, err = crypt.NewHybridPublicKey(&jwkSet)
+			if err != nil {
+				return nil, err
+			}
+			break
+		}
+
+		var jwk crypt.Jwk
+		if err := json.Unmarshal(key, &jwk); err != nil {
+			return nil, errors.Wrap(err, "failed to decode JWK in user data")
+		}
+		publicKey, err = jwk.PublicKey()
+		if err != nil {
+			return nil, err
+		}
+
+	case len(key) > 0 && key[0] == asn1Sequence:
+		publicKey, err = x509.ParsePKIXPublicKey(key)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse public key in user data")
+		}
+
+	default:
+		publicKey, err = getRsaPublicKey(key, attesterType)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := crypt.CheckWrappingPublicKey(publicKey); err != nil {
+		return nil, err
+	}
+	// imposing lower limit on the size of the public key for enhanced security reasons
+	if rsaPublicKey, ok := publicKey.(*rsa.PublicKey); ok && rsaPublicKey.N.BitLen() <= 2048 {
+		return nil, errors.New("RSA key size must be greater than 2048 bits")
+	}
+	return publicKey, nil
+}
+
+// getRsaPublicKey returns the RSA public key of the exponent and modulus layout of the runtime data
+func getRsaPublicKey(key []byte, attesterType model.AttesterType) (*rsa.PublicKey, error) {
+
+	if len(key) <= 4 {
+		return nil, errors.New("user data is too short to hold a public key")
+	}
 	modArr := key[4:]
 	var eb uint32
 	n := big.Int{}
@@ -300,18 +786,13 @@ func getPublicKey(userData string, attesterType model.AttesterType) (*rsa.Public
 	eb = binary.LittleEndian.Uint32(key[:])
 	n.SetBytes(modArr)
 
-	// imposing lower limit on the size of the public key for enhanced security reasons
-	if n.BitLen() <= 2048 {
-		return nil, errors.New("RSA key size must be greater than 2048 bits")
-	}
-
 	pubKey := rsa.PublicKey{N: &n, E: int(eb)}
 	return &pubKey, nil
 }
 
-func getSecretKey(remoteManager *keymanager.RemoteManager, id uuid.UUID) (interface{}, int, error) {
+func getSecretKey(ctx context.Context, remoteManager *keymanager.RemoteManager, id uuid.UUID) (interface{}, int, error) {
 
-	secretKey, err := remoteManager.TransferKey(id)
+	secretKey, err := remoteManager.TransferKey(ctx, id)
 	if err != nil {
 		if err.Error() == RecordNotFound {
 			logrus.Error("Key with specified id could not be located")
@@ -324,6 +805,56 @@ func getSecretKey(remoteManager *keymanager.RemoteManager, id uuid.UUID) (interf
 	return secretKey, http.StatusOK, nil
 }
 
+// getSecret returns the data of an opaque secret held by its key manager
+func getSecret(ctx context.Context, remoteManager *keymanager.RemoteManager, id uuid.UUID) (interface{}, int, error) {
+
+	secret, err := remoteManager.TransferSecret(ctx, id)
+	if err != nil {
+		if err.Error() == RecordNotFound {
+			logrus.Error("Secret with specified id could not be located")
+			return nil, http.StatusNotFound, &HandledError{Message: "Secret with specified id does not exist"}
+		} else {
+			logrus.WithError(err).Error("Secret transfer failed")
+			return nil, http.StatusInternalServerError, &HandledError{Message: "Failed to transfer Secret"}
+		}
+	}
+	return secret, http.StatusOK, nil
+}
+
+// getKeyWrappedByKeyManager returns the key wrapped by its key manager, or nil when the key
+// manager cannot wrap keys. The key manager wraps an ephemeral AES key to publicKey, which takes
+// the place of the SWK, followed by the key wrapped under the ephemeral key with AES-KWP.
+func getKeyWrappedByKeyManager(ctx context.Context, remoteManager *keymanager.RemoteManager, id uuid.UUID, publicKey crypto.PublicKey) (interface{}, int, error) {
+
+	wrapped, err := remoteManager.WrapKey(ctx, id, publicKey)
+	if errors.Is(err, keymanager.ErrKeyWrapNotSupported) {
+		return nil, http.StatusOK, nil
+	} else if errors.Is(err, keymanager.ErrWrappingKeyNotSupported) {
+		logrus.WithError(err).Error("Key manager cannot wrap the key to the workload public key")
+		return nil, http.StatusBadRequest, &HandledError{Message: "Key can only be transferred to RSA public keys"}
+	} else if err != nil {
+		if err.Error() == RecordNotFound {
+			logrus.Error("Key with specified id could not be located")
+			return nil, http.StatusNotFound, &HandledError{Message: "Key with specified id does not exist"}
+		}
+		logrus.WithError(err).Error("Key wrap failed")
+		return nil, http.StatusInternalServerError, &HandledError{Message: "Failed to transfer Key"}
+	}
+
+	// key managers wrap keys to RSA public keys only
+	size := publicKey.(*rsa.PublicKey).Size()
+	if len(wrapped) <= size {
+		logrus.Error("Wrapped key returned by key manager is too short")
+		return nil, http.StatusInternalServerError, &HandledError{Message: "Failed to transfer Key"}
+	}
+	transferResponse := &model.KeyTransferResponse{
+		WrappedKey:    wrapped[size:],
+		WrappedSWK:    wrapped[:size],
+		WrapAlgorithm: model.WrapAlgorithmAESKWP,
+	}
+	return transferResponse, http.StatusOK, nil
+}
+
 func wrapKey(publicKey *rsa.PublicKey, secretKey []byte, hash hash.Hash, label []byte) (interface{}, int, error) {
 
 	// Wrap secret key with public key
@@ -347,8 +878,8 @@ func CreateSwk() ([]byte, error) {
 	return keyBytes, nil
 }
 
-// AesEncrypt encrypts plain bytes using AES key passed as param
-func AesEncrypt(data, key []byte) ([]byte, []byte, error) {
+// AesEncrypt encrypts plain bytes using AES key passed as param, authenticating the additional data
+func AesEncrypt(data, key, additionalData []byte) ([]byte, []byte, error) {
 
 	// generate a new aes cipher using key
 	block, err := aes.NewCipher(key)
@@ -375,5 +906,23 @@ func AesEncrypt(data, key []byte) ([]byte, []byte, error) {
 	}
 
 	// here we encrypt data using the Seal function
-	return gcm.Seal(nil, nonce, data, nil), nonce, nil
+	return gcm.Seal(nil, nonce, data, additionalData), nonce, nil
+}
+
+// AesDecrypt decrypts the data encrypted by AesEncrypt with the AES key and nonce, authenticating
+// the additional data
+func AesDecrypt(data, key, nonce, additionalData []byte) ([]byte, error) {
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return nil, errors.New("invalid nonce size")
+	}
+	return gcm.Open(nil, nonce, data, additionalData)
 }
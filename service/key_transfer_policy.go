@@ -33,6 +33,9 @@ func (mw loggingMiddleware) CreateKeyTransferPolicy(ctx context.Context, ktp mod
 
 func (svc service) CreateKeyTransferPolicy(_ context.Context, policyCreateRequest model.KeyTransferPolicy) (*model.KeyTransferPolicy, error) {
 
+	// ID and creation time are always assigned by the store for new policies
+	policyCreateRequest.ID = uuid.Nil
+	policyCreateRequest.CreatedAt = time.Time{}
 	createdPolicy, err := svc.repository.KeyTransferPolicyStore.Create(&policyCreateRequest)
 	if err != nil {
 		log.WithError(err).Error("Key transfer policy create failed")
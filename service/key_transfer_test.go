@@ -7,19 +7,43 @@
 package service
 
 import (
+	"bytes"
 	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/mlkem"
+	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
+	"encoding/base64"
 	"encoding/binary"
+	"encoding/json"
 	"encoding/pem"
 	jwtlib "github.com/golang-jwt/jwt/v4"
 	"github.com/google/uuid"
 	itaConnector "github.com/intel/trustauthority-client/go-connector"
 	"github.com/onsi/gomega"
 	"github.com/pkg/errors"
+	"github.com/shaj13/libcache"
 	"github.com/stretchr/testify/mock"
+	"golang.org/x/crypto/hkdf"
+	"intel/kbs/v1/clients/ita"
+	"intel/kbs/v1/config"
+	"intel/kbs/v1/constant"
+	"intel/kbs/v1/crypt"
+	"intel/kbs/v1/keymanager"
 	"intel/kbs/v1/model"
+	"intel/kbs/v1/repository"
+	"io"
+	"net/http"
+	"strings"
 	"testing"
+	"time"
 )
 
 var (
@@ -37,6 +61,15 @@ var (
 	}
 )
 
+// tokenVerifierNonce returns the verifier nonce the attestation token was issued for
+func tokenVerifierNonce(t *testing.T, token string) *itaConnector.VerifierNonce {
+	tokenClaims := &model.AttestationTokenClaim{}
+	if _, err := crypt.GetTokenClaims(parseJWTToken(token, []byte("")), token, &tokenClaims); err != nil {
+		t.Fatal(err)
+	}
+	return tokenClaims.VerifierNonce
+}
+
 func TestKeyTransferRSA(t *testing.T) {
 	g := gomega.NewGomegaWithT(t)
 	itaClientConnector.On("GetToken", mock.Anything).Return(sgxTokenResp, nil).Once()
@@ -48,7 +81,7 @@ func TestKeyTransferRSA(t *testing.T) {
 
 	svc := LoggingMiddleware()(svcInstance)
 	g.Expect(svc).NotTo(gomega.BeNil())
-	nonce := &itaConnector.VerifierNonce{}
+	nonce := tokenVerifierNonce(t, sgxToken)
 
 	transReq := &model.KeyTransferRequest{
 		Quote:         []byte(""),
@@ -78,7 +111,7 @@ func TestSGXKeyTransfer(t *testing.T) {
 
 	svc := LoggingMiddleware()(svcInstance)
 	g.Expect(svc).NotTo(gomega.BeNil())
-	nonce := &itaConnector.VerifierNonce{}
+	nonce := tokenVerifierNonce(t, sgxToken)
 
 	transReq := &model.KeyTransferRequest{
 		Quote:         []byte(""),
@@ -97,6 +130,99 @@ func TestSGXKeyTransfer(t *testing.T) {
 	g.Expect(err).NotTo(gomega.HaveOccurred())
 }
 
+func TestKeyTransferReportDataBinding(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	jwtToken := parseJWTToken(sgxToken, []byte(""))
+	tokenClaims := &model.AttestationTokenClaim{}
+	_, err := crypt.GetTokenClaims(jwtToken, sgxToken, &tokenClaims)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	itaClient := ita.NewMockClient()
+	itaClient.On("GetNonce", mock.Anything).Return(itaConnector.GetNonceResponse{Nonce: tokenClaims.VerifierNonce}, nil)
+	itaClient.On("GetToken", mock.Anything).Return(sgxTokenResp, nil)
+	itaClient.On("VerifyToken", mock.Anything).Return(jwtToken, nil)
+	kmipClient.On("GetKey", mock.Anything, mock.Anything).Return(key, nil)
+	kmipKeyManager.On("TransferKey", mock.AnythingOfType("*model.KeyAttributes")).Return([]uint8(key), nil)
+
+	// a single issued nonce can be outstanding
+	issuedNonces := libcache.FIFO.New(1)
+	issuedNonces.SetTTL(time.Minute)
+	svc := service{
+		itaApiClient:           itaClient,
+		itaTokenVerifierClient: itaClient,
+		repository: &repository.Repository{
+			KeyStore:               keyStore,
+			KeyTransferPolicyStore: keyTransPolicyStore,
+		},
+		remoteManager: kRemoteManager,
+		config:        &config.Configuration{ReportDataHash: constant.ReportDataHashAuto},
+		issuedNonces:  issuedNonces,
+	}
+	request := TransferKeyRequest{
+		KeyId:           rsaKeyId,
+		AttestationType: "SGX",
+		KeyTransferRequest: &model.KeyTransferRequest{
+			VerifierNonce: &itaConnector.VerifierNonce{Val: []byte("nonce")},
+		},
+	}
+	nonceRequest := TransferKeyRequest{KeyId: rsaKeyId, KeyTransferRequest: &model.KeyTransferRequest{}}
+
+	// the nonce in the request does not match the nonce in the token
+	_, err = svc.TransferKeyWithEvidence(context.Background(), request)
+	g.Expect(err).To(gomega.HaveOccurred())
+	g.Expect(err.(*HandledError).Code).To(gomega.Equal(http.StatusUnauthorized))
+
+	// the report data is a SHA-256 hash, not a SHA-512 hash
+	request.KeyTransferRequest.VerifierNonce = tokenClaims.VerifierNonce
+	svc.config.ReportDataHash = constant.ReportDataHashSHA512
+	_, err = svc.TransferKeyWithEvidence(context.Background(), request)
+	g.Expect(err).To(gomega.HaveOccurred())
+	g.Expect(err.(*HandledError).Code).To(gomega.Equal(http.StatusUnauthorized))
+
+	// by default the nonce may be obtained from Trust Authority directly and is not tracked
+	svc.config.ReportDataHash = constant.ReportDataHashAuto
+	_, err = svc.TransferKeyWithEvidence(context.Background(), request)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	_, err = svc.TransferKeyWithEvidence(context.Background(), request)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	_, err = svc.TransferKeyWithEvidence(context.Background(), nonceRequest)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(issuedNonces.Len()).To(gomega.Equal(0))
+
+	// the nonce was not issued by this KBS
+	svc.config.RequireIssuedNonce = true
+	_, err = svc.TransferKeyWithEvidence(context.Background(), request)
+	g.Expect(err).To(gomega.HaveOccurred())
+	g.Expect(err.(*HandledError).Code).To(gomega.Equal(http.StatusUnauthorized))
+
+	resp, err := svc.TransferKeyWithEvidence(context.Background(), nonceRequest)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(resp.Nonce).To(gomega.Equal(tokenClaims.VerifierNonce))
+
+	// no nonce is issued while the issued nonces are full
+	_, err = svc.TransferKeyWithEvidence(context.Background(), nonceRequest)
+	g.Expect(err).To(gomega.HaveOccurred())
+	g.Expect(err.(*HandledError).Code).To(gomega.Equal(http.StatusServiceUnavailable))
+
+	_, err = svc.TransferKeyWithEvidence(context.Background(), request)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	// the nonce can be used for a single key transfer
+	_, err = svc.TransferKeyWithEvidence(context.Background(), request)
+	g.Expect(err).To(gomega.HaveOccurred())
+	g.Expect(err.(*HandledError).Code).To(gomega.Equal(http.StatusUnauthorized))
+
+	_, err = svc.TransferKeyWithEvidence(context.Background(), nonceRequest)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	svc.config.ReportDataHash = constant.ReportDataHashNone
+	svc.config.RequireIssuedNonce = false
+	request.KeyTransferRequest.VerifierNonce = &itaConnector.VerifierNonce{Val: []byte("nonce")}
+	_, err = svc.TransferKeyWithEvidence(context.Background(), request)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+}
+
 func TestTDXKeyTransfer(t *testing.T) {
 	g := gomega.NewGomegaWithT(t)
 
@@ -109,7 +235,7 @@ func TestTDXKeyTransfer(t *testing.T) {
 
 	svc := LoggingMiddleware()(svcInstance)
 	g.Expect(svc).NotTo(gomega.BeNil())
-	nonce := &itaConnector.VerifierNonce{}
+	nonce := tokenVerifierNonce(t, tdxToken)
 
 	transReq := &model.KeyTransferRequest{
 		Quote:         []byte(""),
@@ -220,11 +346,433 @@ func TestKeyTransferInvalidSecretKey(t *testing.T) {
 func TestGetSecretKey(t *testing.T) {
 	g := gomega.NewGomegaWithT(t)
 	tmpId := uuid.New()
-	_, _, err := getSecretKey(kRemoteManager, tmpId)
+	_, _, err := getSecretKey(context.Background(), kRemoteManager, tmpId)
 
 	g.Expect(err).To(gomega.HaveOccurred())
 }
 
+func TestGetWrappedKeyJwe(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	secretKey := make([]byte, 32)
+	_, err := rand.Read(secretKey)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	keyManager := keymanager.NewMockKmipManager(kmipClient)
+	// the transferred key is zeroized after it is encrypted
+	keyManager.On("TransferKey", mock.AnythingOfType("*model.KeyAttributes")).Return(append([]byte{}, secretKey...), nil)
+	svc := service{
+		repository:    &repository.Repository{KeyStore: keyStore},
+		remoteManager: keymanager.NewRemoteManager(keyStore, keyManager),
+	}
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 3072)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	publicKeyDer, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	userData, err := loadPublicKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyDer}))
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	keyId := uuid.MustParse("ee37c360-7eae-4250-a677-6ee12adce8e2")
+	resp, _, err := svc.getWrappedKey(context.Background(), "AES", base64.StdEncoding.EncodeToString(userData), keyId, &model.KeyTransferPolicy{AttestationType: model.TDX}, model.KeyTransferFormatJWE, model.EnvelopeVersion1, "")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	jwe, ok := resp.(*crypt.Jwe)
+	g.Expect(ok).To(gomega.BeTrue())
+	g.Expect(strings.Count(jwe.Compact(), ".")).To(gomega.Equal(4))
+
+	// decrypt the JWE as a workload would
+	header, err := base64.RawURLEncoding.DecodeString(jwe.Protected)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(string(header)).To(gomega.ContainSubstring(`"alg":"RSA-OAEP-256","enc":"A256GCM"`))
+	encryptedKey, _ := base64.RawURLEncoding.DecodeString(jwe.EncryptedKey)
+	cek, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, encryptedKey, nil)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	iv, _ := base64.RawURLEncoding.DecodeString(jwe.Iv)
+	ciphertext, _ := base64.RawURLEncoding.DecodeString(jwe.Ciphertext)
+	tag, _ := base64.RawURLEncoding.DecodeString(jwe.Tag)
+	block, err := aes.NewCipher(cek)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	gcm, err := cipher.NewGCM(block)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	plaintext, err := gcm.Open(nil, iv, append(ciphertext, tag...), []byte(jwe.Protected))
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(plaintext).To(gomega.Equal(secretKey))
+}
+
+func TestGetPublicKey(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	ecKeyDer, err := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	ecdhKey, err := ecKey.PublicKey.ECDH()
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	ecJwk, err := crypt.NewEcJwk(ecdhKey)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	ecJwkJson, err := json.Marshal(ecJwk)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	edPublicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	edKeyDer, err := x509.MarshalPKIXPublicKey(edPublicKey)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	// RSA exponent and modulus
+	key, err := getPublicKey(publicKey, model.TDX)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(key).To(gomega.BeAssignableToTypeOf(&rsa.PublicKey{}))
+
+	// PKIX, ASN.1 DER
+	key, err = getPublicKey(base64.StdEncoding.EncodeToString(ecKeyDer), model.TDX)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(key.(*ecdsa.PublicKey).Equal(&ecKey.PublicKey)).To(gomega.BeTrue())
+
+	// JWK
+	key, err = getPublicKey(base64.StdEncoding.EncodeToString(ecJwkJson), model.SGX)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(key.(*ecdsa.PublicKey).Equal(&ecKey.PublicKey)).To(gomega.BeTrue())
+
+	_, err = getPublicKey(base64.StdEncoding.EncodeToString(edKeyDer), model.TDX)
+	g.Expect(err).To(gomega.HaveOccurred())
+	_, err = getPublicKey(base64.StdEncoding.EncodeToString([]byte{1, 0}), model.TDX)
+	g.Expect(err).To(gomega.HaveOccurred())
+}
+
+func TestGetWrappedKeyEc(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	keyManager := keymanager.NewMockKmipManager(kmipClient)
+	keyManager.On("TransferKey", mock.AnythingOfType("*model.KeyAttributes")).Return(make([]byte, 32), nil)
+	svc := service{
+		repository:    &repository.Repository{KeyStore: keyStore},
+		remoteManager: keymanager.NewRemoteManager(keyStore, keyManager),
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	ecKeyDer, err := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	userData := base64.StdEncoding.EncodeToString(ecKeyDer)
+
+	keyId := uuid.MustParse("ee37c360-7eae-4250-a677-6ee12adce8e2")
+	resp, _, err := svc.getWrappedKey(context.Background(), "AES", userData, keyId, &model.KeyTransferPolicy{AttestationType: model.TDX}, "", model.EnvelopeVersion1, "")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	transferResponse := resp.(*model.KeyTransferResponse)
+	g.Expect(transferResponse.SWKWrapAlgorithm).To(gomega.Equal(model.SWKWrapAlgorithmECDHES))
+	// AES key wrap of the 256 bit SWK
+	g.Expect(transferResponse.WrappedSWK).To(gomega.HaveLen(40))
+	ephemeralKey, err := x509.ParsePKIXPublicKey(transferResponse.EphemeralPublicKey)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(ephemeralKey.(*ecdsa.PublicKey).Curve).To(gomega.Equal(elliptic.P384()))
+
+	resp, _, err = svc.getWrappedKey(context.Background(), "AES", userData, keyId, &model.KeyTransferPolicy{AttestationType: model.TDX}, model.KeyTransferFormatJWE, model.EnvelopeVersion1, "")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	header, err := base64.RawURLEncoding.DecodeString(resp.(*crypt.Jwe).Protected)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(string(header)).To(gomega.ContainSubstring(`"alg":"ECDH-ES+A256KW"`))
+	g.Expect(string(header)).To(gomega.ContainSubstring(`"epk":{"kty":"EC","crv":"P-384"`))
+}
+
+func TestGetWrappedKeyHybrid(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	secretKey := make([]byte, 32)
+	_, err := rand.Read(secretKey)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	keyManager := keymanager.NewMockKmipManager(kmipClient)
+	keyManager.On("TransferKey", mock.AnythingOfType("*model.KeyAttributes")).Return(append([]byte{}, secretKey...), nil)
+	svc := service{
+		repository:    &repository.Repository{KeyStore: keyStore},
+		remoteManager: keymanager.NewRemoteManager(keyStore, keyManager),
+	}
+
+	x25519Key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	mlkemKey, err := mlkem.GenerateKey768()
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	jwkSet := crypt.JwkSet{Keys: []crypt.Jwk{
+		{
+			KeyType: crypt.JwkKeyTypeOKP,
+			Curve:   crypt.JwkCurveX25519,
+			X:       base64.RawURLEncoding.EncodeToString(x25519Key.PublicKey().Bytes()),
+		},
+		{
+			KeyType:   crypt.JwkKeyTypeAKP,
+			Algorithm: crypt.JwkAlgMlKem768,
+			Pub:       base64.RawURLEncoding.EncodeToString(mlkemKey.EncapsulationKey().Bytes()),
+		},
+	}}
+	jwkSetJson, err := json.Marshal(jwkSet)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	userData := base64.StdEncoding.EncodeToString(jwkSetJson)
+
+	keyId := uuid.MustParse("ee37c360-7eae-4250-a677-6ee12adce8e2")
+	resp, _, err := svc.getWrappedKey(context.Background(), "AES", userData, keyId, &model.KeyTransferPolicy{AttestationType: model.TDX, KeyEncapsulation: model.KeyEncapsulationHybridMLKEM768}, "", model.EnvelopeVersion1, "")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	transferResponse := resp.(*model.KeyTransferResponse)
+	g.Expect(transferResponse.KeyEncapsulation).To(gomega.Equal("ML-KEM-768+X25519"))
+	g.Expect(transferResponse.WrappedSWK).To(gomega.BeEmpty())
+
+	// derive the SWK and unwrap the key as a workload would
+	mlkemSecret, err := mlkemKey.Decapsulate(transferResponse.MLKEMCiphertext)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	ephemeralKey, err := x509.ParsePKIXPublicKey(transferResponse.EphemeralPublicKey)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	ecdhSecret, err := x25519Key.ECDH(ephemeralKey.(*ecdh.PublicKey))
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	info := []byte("KBS hybrid key encapsulation v1")
+	info = append(info, transferResponse.MLKEMCiphertext...)
+	info = append(info, ephemeralKey.(*ecdh.PublicKey).Bytes()...)
+	info = append(info, x25519Key.PublicKey().Bytes()...)
+	swk := make([]byte, 32)
+	_, err = io.ReadFull(hkdf.New(sha256.New, append(mlkemSecret, ecdhSecret...), nil, info), swk)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	wrappedKey := transferResponse.WrappedKey
+	ivLength := binary.LittleEndian.Uint32(wrappedKey[0:])
+	block, err := aes.NewCipher(swk)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	gcm, err := cipher.NewGCM(block)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	plaintext, err := gcm.Open(nil, wrappedKey[12:12+ivLength], wrappedKey[12+ivLength:], nil)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(plaintext).To(gomega.Equal(secretKey))
+
+	// the key encapsulation of the policy must match the public key
+	_, status, err := svc.getWrappedKey(context.Background(), "AES", userData, keyId, &model.KeyTransferPolicy{AttestationType: model.TDX}, "", model.EnvelopeVersion1, "")
+	g.Expect(err).To(gomega.HaveOccurred())
+	g.Expect(status).To(gomega.Equal(400))
+	_, status, err = svc.getWrappedKey(context.Background(), "AES", publicKey, keyId, &model.KeyTransferPolicy{AttestationType: model.TDX, KeyEncapsulation: model.KeyEncapsulationHybridMLKEM768}, "", model.EnvelopeVersion1, "")
+	g.Expect(err).To(gomega.HaveOccurred())
+	g.Expect(status).To(gomega.Equal(400))
+	_, status, err = svc.getWrappedKey(context.Background(), "AES", userData, keyId, &model.KeyTransferPolicy{AttestationType: model.TDX, KeyEncapsulation: model.KeyEncapsulationHybridMLKEM768}, model.KeyTransferFormatJWE, model.EnvelopeVersion1, "")
+	g.Expect(err).To(gomega.HaveOccurred())
+	g.Expect(status).To(gomega.Equal(406))
+}
+
+func TestGetWrappedKeyEnvelopeVersion2(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	secretKey := make([]byte, 32)
+	_, err := rand.Read(secretKey)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	keyManager := keymanager.NewMockKmipManager(kmipClient)
+	keyManager.On("TransferKey", mock.AnythingOfType("*model.KeyAttributes")).Return(append([]byte{}, secretKey...), nil)
+	svc := service{
+		repository:    &repository.Repository{KeyStore: keyStore},
+		remoteManager: keymanager.NewRemoteManager(keyStore, keyManager),
+	}
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 3072)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	userData := make([]byte, 4)
+	binary.LittleEndian.PutUint32(userData, uint32(privateKey.E))
+	userData = append(userData, privateKey.N.Bytes()...)
+
+	keyId := uuid.MustParse("ee37c360-7eae-4250-a677-6ee12adce8e2")
+	transferPolicy := &model.KeyTransferPolicy{ID: uuid.New(), AttestationType: model.TDX}
+	resp, _, err := svc.getWrappedKey(context.Background(), "AES", base64.StdEncoding.EncodeToString(userData), keyId, transferPolicy, "", model.EnvelopeVersion2, "")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	transferResponse := resp.(*model.KeyTransferResponse)
+	g.Expect(transferResponse.EnvelopeVersion).To(gomega.Equal(model.EnvelopeVersion2))
+
+	// parse the envelope as a workload would
+	wrappedKey := transferResponse.WrappedKey
+	g.Expect(binary.LittleEndian.Uint32(wrappedKey[0:])).To(gomega.Equal(uint32(model.EnvelopeVersion2)))
+	headerLength := 8 + binary.LittleEndian.Uint32(wrappedKey[4:])
+	var metadata model.WrappedKeyMetadata
+	g.Expect(json.Unmarshal(wrappedKey[8:headerLength], &metadata)).To(gomega.Succeed())
+	g.Expect(metadata).To(gomega.Equal(model.WrappedKeyMetadata{
+		KeyID:       keyId,
+		KeyVersion:  1,
+		Algorithm:   "AES",
+		KeyEncoding: model.KeyEncodingRaw,
+		PolicyID:    transferPolicy.ID,
+	}))
+
+	swk, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, transferResponse.WrappedSWK, nil)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	block, err := aes.NewCipher(swk)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	gcm, err := cipher.NewGCM(block)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	header := wrappedKey[:headerLength]
+	sealed := wrappedKey[headerLength:]
+	ivLength := binary.LittleEndian.Uint32(sealed[0:])
+	plaintext, err := gcm.Open(nil, sealed[12:12+ivLength], sealed[12+ivLength:], header)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(plaintext).To(gomega.Equal(secretKey))
+
+	// the metadata is authenticated
+	tampered := append([]byte{}, header...)
+	copy(tampered[bytes.Index(tampered, []byte(keyId.String())):], uuid.New().String())
+	_, err = gcm.Open(nil, sealed[12:12+ivLength], sealed[12+ivLength:], tampered)
+	g.Expect(err).To(gomega.HaveOccurred())
+}
+
+func TestDetectKeyEncoding(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	pkcs8Key, err := x509.MarshalPKCS8PrivateKey(rsaKey)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	sec1Key, err := x509.MarshalECPrivateKey(ecKey)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	g.Expect(detectKeyEncoding("AES", make([]byte, 32))).To(gomega.Equal(model.KeyEncodingRaw))
+	g.Expect(detectKeyEncoding("RSA", pkcs8Key)).To(gomega.Equal(model.KeyEncodingPKCS8))
+	g.Expect(detectKeyEncoding("RSA", x509.MarshalPKCS1PrivateKey(rsaKey))).To(gomega.Equal(model.KeyEncodingPKCS1))
+	g.Expect(detectKeyEncoding("EC", sec1Key)).To(gomega.Equal(model.KeyEncodingSEC1))
+}
+
+func TestEncodeKey(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	keyId := uuid.MustParse("ee37c360-7eae-4250-a677-6ee12adce8e2")
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	pkcs1Key := x509.MarshalPKCS1PrivateKey(rsaKey)
+	pkcs8Key, err := encodeKey("RSA", pkcs1Key, model.KeyEncodingPKCS8, keyId)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	privateKey, err := x509.ParsePKCS8PrivateKey(pkcs8Key)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(privateKey.(*rsa.PrivateKey).Equal(rsaKey)).To(gomega.BeTrue())
+	encoded, err := encodeKey("RSA", pkcs8Key, model.KeyEncodingPKCS1, keyId)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(encoded).To(gomega.Equal(pkcs1Key))
+
+	encoded, err = encodeKey("RSA", pkcs8Key, model.KeyEncodingJWK, keyId)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	var jwk crypt.Jwk
+	g.Expect(json.Unmarshal(encoded, &jwk)).To(gomega.Succeed())
+	g.Expect(jwk.KeyID).To(gomega.Equal(keyId.String()))
+	g.Expect(jwk.D).To(gomega.Equal(base64.RawURLEncoding.EncodeToString(rsaKey.D.Bytes())))
+	publicKey, err := jwk.PublicKey()
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(publicKey.(*rsa.PublicKey).Equal(&rsaKey.PublicKey)).To(gomega.BeTrue())
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	ecPkcs8Key, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	encoded, err = encodeKey("EC", ecPkcs8Key, model.KeyEncodingSEC1, keyId)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	sec1Key, err := x509.ParseECPrivateKey(encoded)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(sec1Key.Equal(ecKey)).To(gomega.BeTrue())
+	encoded, err = encodeKey("EC", ecPkcs8Key, model.KeyEncodingJWK, keyId)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(string(encoded)).To(gomega.ContainSubstring(`"kty":"EC"`))
+	g.Expect(string(encoded)).To(gomega.ContainSubstring(`"crv":"P-384"`))
+
+	aesKey := make([]byte, 32)
+	encoded, err = encodeKey("AES", aesKey, "", keyId)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(encoded).To(gomega.Equal(aesKey))
+	encoded, err = encodeKey("AES", aesKey, model.KeyEncodingJWK, keyId)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(string(encoded)).To(gomega.Equal(`{"kty":"oct","kid":"` + keyId.String() + `","k":"` + base64.RawURLEncoding.EncodeToString(aesKey) + `"}`))
+	_, err = encodeKey("AES", aesKey, model.KeyEncodingPKCS8, keyId)
+	g.Expect(err).To(gomega.HaveOccurred())
+}
+
+func TestEncodeKeyAlgorithms(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	keyId := uuid.MustParse("ee37c360-7eae-4250-a677-6ee12adce8e2")
+
+	ed25519Key := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	ed25519Pkcs8Key, err := x509.MarshalPKCS8PrivateKey(ed25519Key)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(detectKeyEncoding("ED25519", ed25519Pkcs8Key)).To(gomega.Equal(model.KeyEncodingPKCS8))
+	encoded, err := encodeKey("ED25519", ed25519Pkcs8Key, model.KeyEncodingJWK, keyId)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(string(encoded)).To(gomega.ContainSubstring(`"kty":"OKP"`))
+	g.Expect(string(encoded)).To(gomega.ContainSubstring(`"crv":"Ed25519"`))
+	g.Expect(string(encoded)).To(gomega.ContainSubstring(`"d":"` + base64.RawURLEncoding.EncodeToString(ed25519Key.Seed()) + `"`))
+
+	x25519Key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	x25519Pkcs8Key, err := x509.MarshalPKCS8PrivateKey(x25519Key)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	encoded, err = encodeKey("X25519", x25519Pkcs8Key, model.KeyEncodingJWK, keyId)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(string(encoded)).To(gomega.ContainSubstring(`"crv":"X25519"`))
+	_, err = encodeKey("X25519", x25519Pkcs8Key, model.KeyEncodingSEC1, keyId)
+	g.Expect(err).To(gomega.HaveOccurred())
+
+	// secp256k1 keys are not supported by crypto/x509
+	secp256k1Key, err := crypt.GenerateSecp256k1Key()
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	secp256k1Pkcs8Key, err := crypt.MarshalPKCS8PrivateKey(secp256k1Key)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	encoded, err = encodeKey("EC", secp256k1Pkcs8Key, model.KeyEncodingSEC1, keyId)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	sec1Key, err := crypt.ParseECPrivateKey(encoded)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(sec1Key.D).To(gomega.Equal(secp256k1Key.D))
+	encoded, err = encodeKey("EC", encoded, model.KeyEncodingPKCS8, keyId)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(encoded).To(gomega.Equal(secp256k1Pkcs8Key))
+	encoded, err = encodeKey("EC", secp256k1Pkcs8Key, model.KeyEncodingJWK, keyId)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(string(encoded)).To(gomega.ContainSubstring(`"crv":"secp256k1"`))
+
+	hmacKey := make([]byte, 48)
+	g.Expect(isKeyEncodingAllowed("HMAC", model.KeyEncodingRaw)).To(gomega.BeTrue())
+	g.Expect(isKeyEncodingAllowed("CHACHA20", model.KeyEncodingPKCS8)).To(gomega.BeFalse())
+	encoded, err = encodeKey("HMAC", hmacKey, model.KeyEncodingJWK, keyId)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(string(encoded)).To(gomega.Equal(`{"kty":"oct","alg":"HS384","kid":"` + keyId.String() + `","k":"` + base64.RawURLEncoding.EncodeToString(hmacKey) + `"}`))
+}
+
+func TestGetWrappedKeyEncoding(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	keyManager := keymanager.NewMockKmipManager(kmipClient)
+	keyManager.On("TransferKey", mock.AnythingOfType("*model.KeyAttributes")).Return(make([]byte, 32), nil)
+	svc := service{
+		repository:    &repository.Repository{KeyStore: keyStore},
+		remoteManager: keymanager.NewRemoteManager(keyStore, keyManager),
+	}
+	keyId := uuid.MustParse("ee37c360-7eae-4250-a677-6ee12adce8e2")
+	transferPolicy := &model.KeyTransferPolicy{AttestationType: model.TDX}
+
+	resp, _, err := svc.getWrappedKey(context.Background(), "AES", publicKey, keyId, transferPolicy, "", model.EnvelopeVersion2, model.KeyEncodingJWK)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(string(resp.(*model.KeyTransferResponse).WrappedKey)).To(gomega.ContainSubstring(`"key_encoding":"jwk"`))
+
+	_, status, err := svc.getWrappedKey(context.Background(), "AES", publicKey, keyId, transferPolicy, "", model.EnvelopeVersion2, model.KeyEncodingSEC1)
+	g.Expect(err).To(gomega.HaveOccurred())
+	g.Expect(status).To(gomega.Equal(400))
+}
+
+func TestTransferKeyPublicKeyTypes(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	keyManager := keymanager.NewMockKmipManager(kmipClient)
+	keyManager.On("TransferKey", mock.AnythingOfType("*model.KeyAttributes")).Return(make([]byte, 32), nil)
+	svc := service{
+		repository:    &repository.Repository{KeyStore: keyStore},
+		remoteManager: keymanager.NewRemoteManager(keyStore, keyManager),
+	}
+	keyId := uuid.MustParse("ee37c360-7eae-4250-a677-6ee12adce8e2")
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	resp, err := svc.TransferKey(context.Background(), TransferKeyRequest{KeyId: keyId, PublicKey: &ecKey.PublicKey})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(resp.KeyTransferResponse.SWKWrapAlgorithm).To(gomega.Equal(model.SWKWrapAlgorithmECDHES))
+	g.Expect(resp.KeyTransferResponse.EphemeralPublicKey).NotTo(gomega.BeEmpty())
+
+	edPublicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	_, err = svc.TransferKey(context.Background(), TransferKeyRequest{KeyId: keyId, PublicKey: edPublicKey})
+	g.Expect(err).To(gomega.HaveOccurred())
+	g.Expect(err.(*HandledError).Code).To(gomega.Equal(400))
+}
+
 // ParseJWTToken parses a JWT token string and returns a jwt.Token object.
 func parseJWTToken(tokenString string, secretKey []byte) *jwtlib.Token {
 	token, _ := jwtlib.Parse(tokenString, func(token *jwtlib.Token) (interface{}, error) {
@@ -0,0 +1,263 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"github.com/sirupsen/logrus"
+	"intel/kbs/v1/constant"
+	"intel/kbs/v1/crypt"
+	"net/http"
+	"time"
+
+	"intel/kbs/v1/model"
+
+	"github.com/google/uuid"
+)
+
+func (mw loggingMiddleware) CreateSecret(ctx context.Context, req model.SecretRequest) (*model.SecretResponse, error) {
+	log = logrus.WithField("user", ctx.Value(constant.LogUserID))
+	var err error
+	defer func(begin time.Time) {
+		log.Tracef("CreateSecret took %s since %s", time.Since(begin), begin)
+		if err != nil {
+			log.WithError(err)
+		}
+	}(time.Now())
+	resp, err := mw.next.CreateSecret(ctx, req)
+	return resp, err
+}
+
+func (svc service) CreateSecret(ctx context.Context, secretCreateReq model.SecretRequest) (*model.SecretResponse, error) {
+
+	data, err := base64.StdEncoding.DecodeString(secretCreateReq.Data)
+	if err != nil {
+		log.WithError(err).Error("Secret data is not a valid base64 string")
+		return nil, &HandledError{Code: http.StatusBadRequest, Message: "Secret data is not a valid base64 string"}
+	}
+	defer crypt.ZeroizeByteArray(data)
+
+	if len(data) == 0 {
+		log.Error("Secret data must be provided")
+		return nil, &HandledError{Code: http.StatusBadRequest, Message: "Secret data must be provided"}
+	}
+	if maxSize := svc.secretMaxSize(); len(data) > maxSize {
+		log.Errorf("Secret of %d bytes exceeds the maximum size of %d bytes", len(data), maxSize)
+		return nil, &HandledError{Code: http.StatusRequestEntityTooLarge, Message: "Secret exceeds the maximum secret size"}
+	}
+
+	if secretCreateReq.TransferPolicyID != uuid.Nil {
+		_, err := svc.repository.KeyTransferPolicyStore.Retrieve(secretCreateReq.TransferPolicyID)
+		if err != nil {
+			if err.Error() == RecordNotFound {
+				log.Errorf("Key transfer policy with specified id could not be located")
+				return nil, &HandledError{Code: http.StatusBadRequest, Message: "Key transfer policy with specified id does not exist"}
+			}
+			log.WithError(err).Error("Key transfer policy retrieve failed")
+			return nil, &HandledError{Code: http.StatusInternalServerError, Message: "Failed to retrieve key transfer policy"}
+		}
+	}
+
+	if secretCreateReq.KeyManager != "" && !svc.isKeyManagerBackend(secretCreateReq.KeyManager) {
+		log.Errorf("Key manager %s is not configured", secretCreateReq.KeyManager)
+		return nil, &HandledError{Code: http.StatusBadRequest, Message: "Key manager with specified name is not configured"}
+	}
+
+	log.Debug("Create secret request received")
+	createdSecret, err := svc.remoteManager.CreateSecret(ctx, &secretCreateReq, data)
+	if err != nil {
+		log.WithError(err).Error("Secret create failed")
+		return nil, &HandledError{Code: http.StatusInternalServerError, Message: "Failed to create secret"}
+	}
+	return createdSecret, nil
+}
+
+// secretMaxSize returns the configured maximum size of a secret in bytes
+func (svc service) secretMaxSize() int {
+	if svc.config == nil || svc.config.SecretMaxSize <= 0 {
+		return constant.DefaultSecretMaxSize
+	}
+	return svc.config.SecretMaxSize
+}
+
+func (mw loggingMiddleware) SearchSecrets(ctx context.Context, sfc *model.SecretFilterCriteria) ([]*model.SecretResponse, error) {
+	var err error
+	defer func(begin time.Time) {
+		log.Tracef("SearchSecrets took %s since %s", time.Since(begin), begin)
+		if err != nil {
+			log.WithError(err)
+		}
+	}(time.Now())
+	resp, err := mw.next.SearchSecrets(ctx, sfc)
+	return resp, err
+}
+
+func (svc service) SearchSecrets(_ context.Context, filter *model.SecretFilterCriteria) ([]*model.SecretResponse, error) {
+
+	secrets, err := svc.remoteManager.SearchSecrets(filter)
+	if err != nil {
+		log.WithError(err).Error("Secret search failed")
+		return nil, &HandledError{Code: http.StatusInternalServerError, Message: "Failed to search secrets"}
+	}
+	return secrets, nil
+}
+
+func (mw loggingMiddleware) DeleteSecret(ctx context.Context, id uuid.UUID) (interface{}, error) {
+	var err error
+	defer func(begin time.Time) {
+		log.Tracef("DeleteSecret took %s since %s", time.Since(begin), begin)
+		if err != nil {
+			log.WithError(err)
+		}
+	}(time.Now())
+	resp, err := mw.next.DeleteSecret(ctx, id)
+	return resp, err
+}
+
+func (svc service) DeleteSecret(ctx context.Context, secretId uuid.UUID) (interface{}, error) {
+	err := svc.remoteManager.DeleteSecret(ctx, secretId)
+	if err != nil {
+		if err.Error() == RecordNotFound {
+			log.Error("Secret with specified id could not be located")
+			return nil, &HandledError{Code: http.StatusNotFound, Message: "Secret with specified id does not exist"}
+		} else {
+			log.WithError(err).Error("Secret delete failed")
+			return nil, &HandledError{Code: http.StatusInternalServerError, Message: "Failed to delete secret"}
+		}
+	}
+	return nil, nil
+}
+
+func (mw loggingMiddleware) RetrieveSecret(ctx context.Context, id uuid.UUID) (interface{}, error) {
+	var err error
+	defer func(begin time.Time) {
+		log.Tracef("RetrieveSecret took %s since %s", time.Since(begin), begin)
+		if err != nil {
+			log.WithError(err)
+		}
+	}(time.Now())
+	resp, err := mw.next.RetrieveSecret(ctx, id)
+	return resp, err
+}
+
+func (svc service) RetrieveSecret(_ context.Context, secretId uuid.UUID) (interface{}, error) {
+	secret, err := svc.remoteManager.RetrieveSecret(secretId)
+	if err != nil {
+		if err.Error() == RecordNotFound {
+			log.Error("Secret with specified id could not be located")
+			return nil, &HandledError{Code: http.StatusNotFound, Message: "Secret with specified id does not exist"}
+		} else {
+			log.WithError(err).Error("Secret retrieve failed")
+			return nil, &HandledError{Code: http.StatusInternalServerError, Message: "Failed to retrieve secret"}
+		}
+	}
+
+	return secret, nil
+}
+
+func (mw loggingMiddleware) UpdateSecret(ctx context.Context, request model.SecretUpdateRequest) (*model.SecretResponse, error) {
+	var err error
+	defer func(begin time.Time) {
+		log.Tracef("UpdateSecret took %s since %s", time.Since(begin), begin)
+		if err != nil {
+			log.WithError(err)
+		}
+	}(time.Now())
+	resp, err := mw.next.UpdateSecret(ctx, request)
+	return resp, err
+}
+
+func (svc service) UpdateSecret(_ context.Context, secretUpdateReq model.SecretUpdateRequest) (*model.SecretResponse, error) {
+
+	if secretUpdateReq.TransferPolicyID == uuid.Nil {
+		log.Error("Key transfer policy must be provided")
+		return nil, &HandledError{Code: http.StatusBadRequest, Message: "Key transfer policy must be provided"}
+	}
+	transferPolicy, err := svc.repository.KeyTransferPolicyStore.Retrieve(secretUpdateReq.TransferPolicyID)
+	if err != nil || transferPolicy == nil {
+		log.WithError(err).Error("Key transfer policy retrieve failed")
+		return nil, &HandledError{Code: http.StatusBadRequest, Message: "Failed to retrieve key transfer policy"}
+	}
+
+	updatedSecret, err := svc.remoteManager.UpdateSecret(&secretUpdateReq)
+	if err != nil {
+		if err.Error() == RecordNotFound {
+			log.WithError(err).Errorf("Secret update request failed, secret with ID %s not found", secretUpdateReq.SecretId.String())
+			return nil, &HandledError{Code: http.StatusNotFound, Message: "Secret with specified id does not exist"}
+		} else {
+			log.WithError(err).Error("Secret update request failed")
+			return nil, &HandledError{Code: http.StatusInternalServerError, Message: "Failed to update secret with the given key transfer policy ID"}
+		}
+	}
+	return updatedSecret, nil
+}
+
+func (mw loggingMiddleware) TransferSecret(ctx context.Context, req TransferKeyRequest) (*TransferKeyResponse, error) {
+	var err error
+	defer func(begin time.Time) {
+		log.Tracef("TransferSecret took %s since %s", time.Since(begin), begin)
+		if err != nil {
+			log.WithError(err)
+		}
+	}(time.Now())
+	resp, err := mw.next.TransferSecret(ctx, req)
+	return resp, err
+}
+
+// TransferSecret returns the secret wrapped to the public key of the request. Secrets can be
+// larger than what RSA-OAEP can encrypt, so they are always wrapped under an SWK.
+func (svc service) TransferSecret(ctx context.Context, req TransferKeyRequest) (*TransferKeyResponse, error) {
+	secret, status, err := getSecret(ctx, svc.remoteManager, req.KeyId)
+	if err != nil {
+		return nil, &HandledError{Code: status, Message: err.Error()}
+	}
+	defer crypt.ZeroizeByteArray(secret.([]byte))
+
+	swk, err := CreateSwk()
+	defer crypt.ZeroizeByteArray(swk)
+	if err != nil {
+		log.Error("Error in creating SWK key")
+		return nil, &HandledError{Code: http.StatusInternalServerError, Message: "Error in creating SWK key"}
+	}
+	wrappedResponse, status, err := wrapKeyWithSwk(req.PublicKey, secret.([]byte), swk, nil)
+	if err != nil {
+		return nil, &HandledError{Code: status, Message: err.Error()}
+	}
+
+	resp := &TransferKeyResponse{
+		KeyTransferResponse: wrappedResponse.(*model.KeyTransferResponse),
+	}
+	return resp, nil
+}
+
+func (mw loggingMiddleware) TransferSecretWithEvidence(ctx context.Context, req TransferKeyRequest) (*TransferKeyResponse, error) {
+	var err error
+	defer func(begin time.Time) {
+		logrus.Tracef("TransferSecretWithEvidence took %s since %s", time.Since(begin), begin)
+		if err != nil {
+			logrus.WithError(err)
+		}
+	}(time.Now())
+	resp, err := mw.next.TransferSecretWithEvidence(ctx, req)
+	return resp, err
+}
+
+func (svc service) TransferSecretWithEvidence(ctx context.Context, req TransferKeyRequest) (*TransferKeyResponse, error) {
+	secret, err := svc.remoteManager.RetrieveSecret(req.KeyId)
+	if err != nil {
+		if err.Error() == RecordNotFound {
+			logrus.WithError(err).Error("Secret with specified id doesn't exist")
+			return nil, &HandledError{Code: http.StatusNotFound, Message: "Secret with specified id does not exist"}
+		} else {
+			logrus.WithError(err).Error("Secret retrieval failed")
+			return nil, &HandledError{Code: http.StatusInternalServerError, Message: "Failed to retrieve secret"}
+		}
+	}
+
+	return svc.transferWithEvidence(ctx, req, constant.CRYPTOALGSECRET, "", secret.TransferPolicyID)
+}
@@ -0,0 +1,219 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package service
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"intel/kbs/v1/config"
+	"intel/kbs/v1/constant"
+	"intel/kbs/v1/crypt"
+	"intel/kbs/v1/keymanager"
+	"intel/kbs/v1/localkeystore"
+	"intel/kbs/v1/model"
+	"intel/kbs/v1/repository"
+	"intel/kbs/v1/repository/mocks"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	itaConnector "github.com/intel/trustauthority-client/go-connector"
+	"github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+)
+
+var sgxPolicyId = uuid.MustParse("ee37c360-7eae-4250-a677-6ee12adce8e2")
+
+// newSecretTestService returns a service whose keys and secrets are held by a local key manager
+func newSecretTestService(t *testing.T) service {
+	dir := t.TempDir()
+	masterKey, err := keymanager.LoadLocalKeystoreMasterKey(&config.LocalConfig{MasterKeyFile: filepath.Join(dir, "master.key")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	localKeyStore, err := localkeystore.NewLocalKeyStore(filepath.Join(dir, "keystore"), masterKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secretKeyStore := mocks.NewFakeKeyStore()
+	return service{
+		itaApiClient:           itaClientConnector,
+		itaTokenVerifierClient: itaClientConnector,
+		repository: &repository.Repository{
+			KeyStore:               secretKeyStore,
+			KeyTransferPolicyStore: keyTransPolicyStore,
+		},
+		remoteManager: keymanager.NewRemoteManager(secretKeyStore, keymanager.NewLocalManager(localKeyStore)),
+		config:        &config.Configuration{SecretMaxSize: 32, ReportDataHash: constant.ReportDataHashNone},
+	}
+}
+
+func TestSecretLifecycle(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	svc := newSecretTestService(t)
+	data := []byte("secret-database-password")
+
+	request := model.SecretRequest{
+		Data:             base64.StdEncoding.EncodeToString(data),
+		ContentType:      "text/plain",
+		TransferPolicyID: sgxPolicyId,
+	}
+	secret, err := LoggingMiddleware()(svc).CreateSecret(context.Background(), request)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(secret.Size).To(gomega.Equal(len(data)))
+	g.Expect(secret.ContentType).To(gomega.Equal("text/plain"))
+
+	retrieved, err := svc.RetrieveSecret(context.Background(), secret.ID)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(retrieved.(*model.SecretResponse).ID).To(gomega.Equal(secret.ID))
+
+	secrets, err := svc.SearchSecrets(context.Background(), &model.SecretFilterCriteria{TransferPolicyId: sgxPolicyId})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(secrets).To(gomega.HaveLen(1))
+
+	// the secret is not a key
+	_, err = svc.RetrieveKey(context.Background(), secret.ID)
+	g.Expect(err.(*HandledError).Code).To(gomega.Equal(http.StatusNotFound))
+	_, err = svc.DeleteKey(context.Background(), secret.ID)
+	g.Expect(err.(*HandledError).Code).To(gomega.Equal(http.StatusNotFound))
+
+	updated, err := svc.UpdateSecret(context.Background(), model.SecretUpdateRequest{SecretId: secret.ID, TransferPolicyID: uuid.MustParse("73755fda-c910-46be-821f-e8ddeab189e9")})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(updated.TransferPolicyID).To(gomega.Equal(uuid.MustParse("73755fda-c910-46be-821f-e8ddeab189e9")))
+	_, err = svc.UpdateSecret(context.Background(), model.SecretUpdateRequest{SecretId: secret.ID, TransferPolicyID: uuid.New()})
+	g.Expect(err.(*HandledError).Code).To(gomega.Equal(http.StatusBadRequest))
+
+	_, err = svc.DeleteSecret(context.Background(), secret.ID)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	_, err = svc.RetrieveSecret(context.Background(), secret.ID)
+	g.Expect(err.(*HandledError).Code).To(gomega.Equal(http.StatusNotFound))
+}
+
+func TestSecretCreateNegative(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	svc := newSecretTestService(t)
+
+	tests := []struct {
+		name    string
+		request model.SecretRequest
+		code    int
+	}{
+		{
+			name:    "secret exceeds the maximum size",
+			request: model.SecretRequest{Data: base64.StdEncoding.EncodeToString(make([]byte, 33)), ContentType: "application/octet-stream"},
+			code:    http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:    "secret data is empty",
+			request: model.SecretRequest{ContentType: "application/octet-stream"},
+			code:    http.StatusBadRequest,
+		},
+		{
+			name:    "key transfer policy does not exist",
+			request: model.SecretRequest{Data: "c2VjcmV0", ContentType: "text/plain", TransferPolicyID: uuid.New()},
+			code:    http.StatusBadRequest,
+		},
+		{
+			name:    "key manager is not configured",
+			request: model.SecretRequest{Data: "c2VjcmV0", ContentType: "text/plain", KeyManager: "hsm"},
+			code:    http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		_, err := svc.CreateSecret(context.Background(), tt.request)
+		g.Expect(err).To(gomega.HaveOccurred(), tt.name)
+		g.Expect(err.(*HandledError).Code).To(gomega.Equal(tt.code), tt.name)
+	}
+}
+
+func TestSecretTransfer(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	svc := newSecretTestService(t)
+	data := []byte("secret-database-password")
+
+	secret, err := svc.CreateSecret(context.Background(), model.SecretRequest{
+		Data:             base64.StdEncoding.EncodeToString(data),
+		ContentType:      "text/plain",
+		TransferPolicyID: sgxPolicyId,
+	})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 3072)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	resp, err := LoggingMiddleware()(svc).TransferSecret(context.Background(), TransferKeyRequest{KeyId: secret.ID, PublicKey: &privateKey.PublicKey})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	// the secret is wrapped under the SWK in a version 1 envelope
+	swk, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, resp.KeyTransferResponse.WrappedSWK, nil)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	wrapped := resp.KeyTransferResponse.WrappedKey
+	ivLength := binary.LittleEndian.Uint32(wrapped[0:])
+	block, err := aes.NewCipher(swk)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	gcm, err := cipher.NewGCM(block)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	unwrapped, err := gcm.Open(nil, wrapped[12:12+ivLength], wrapped[12+ivLength:], nil)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(unwrapped).To(gomega.Equal(data))
+
+	// a secret cannot be transferred as a key
+	_, err = svc.TransferKey(context.Background(), TransferKeyRequest{KeyId: secret.ID, PublicKey: &privateKey.PublicKey})
+	g.Expect(err.(*HandledError).Code).To(gomega.Equal(http.StatusNotFound))
+	_, err = svc.TransferKeyWithEvidence(context.Background(), TransferKeyRequest{KeyId: secret.ID, KeyTransferRequest: &model.KeyTransferRequest{}})
+	g.Expect(err.(*HandledError).Code).To(gomega.Equal(http.StatusNotFound))
+	_, err = svc.TransferSecret(context.Background(), TransferKeyRequest{KeyId: uuid.New(), PublicKey: &privateKey.PublicKey})
+	g.Expect(err.(*HandledError).Code).To(gomega.Equal(http.StatusNotFound))
+}
+
+func TestSecretTransferWithEvidence(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	svc := newSecretTestService(t)
+
+	itaClientConnector.On("GetToken", mock.Anything).Return(sgxTokenResp, nil).Once()
+	jwtToken := parseJWTToken(sgxToken, []byte(""))
+	itaClientConnector.On("VerifyToken", mock.Anything).Return(jwtToken, nil).Once()
+
+	secret, err := svc.CreateSecret(context.Background(), model.SecretRequest{
+		Data:             base64.StdEncoding.EncodeToString([]byte("secret-database-password")),
+		ContentType:      "text/plain",
+		TransferPolicyID: sgxPolicyId,
+	})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	request := TransferKeyRequest{
+		KeyId:           secret.ID,
+		AttestationType: "SGX",
+		KeyTransferRequest: &model.KeyTransferRequest{
+			Quote:         []byte(""),
+			VerifierNonce: &itaConnector.VerifierNonce{},
+			RuntimeData:   []byte(""),
+			EventLog:      []byte(""),
+		},
+	}
+	resp, err := LoggingMiddleware()(svc).TransferSecretWithEvidence(context.Background(), request)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(resp.KeyTransferResponse.WrappedKey).NotTo(gomega.BeEmpty())
+	g.Expect(resp.KeyTransferResponse.EnvelopeVersion).To(gomega.Equal(model.EnvelopeVersion2))
+
+	_, err = svc.TransferSecretWithEvidence(context.Background(), TransferKeyRequest{KeyId: uuid.New(), KeyTransferRequest: &model.KeyTransferRequest{}})
+	g.Expect(err.(*HandledError).Code).To(gomega.Equal(http.StatusNotFound))
+
+	// secrets cannot be encoded as private keys
+	g.Expect(isKeyEncodingAllowed(constant.CRYPTOALGSECRET, model.KeyEncodingPKCS8)).To(gomega.BeFalse())
+	g.Expect(isKeyEncodingAllowed(constant.CRYPTOALGSECRET, model.KeyEncodingRaw)).To(gomega.BeTrue())
+	jwk, err := encodeKey(constant.CRYPTOALGSECRET, []byte("secret"), model.KeyEncodingJWK, secret.ID)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(string(jwk)).To(gomega.ContainSubstring(`"kty":"oct"`))
+	crypt.ZeroizeByteArray(jwk)
+}
@@ -19,6 +19,7 @@ import (
 	"intel/kbs/v1/model"
 	"intel/kbs/v1/repository"
 	"intel/kbs/v1/version"
+	"net/http"
 	"time"
 
 	"github.com/google/uuid"
@@ -27,15 +28,26 @@ import (
 type Service interface {
 	CreateKey(context.Context, model.KeyRequest) (*model.KeyResponse, error)
 	SearchKeys(context.Context, *model.KeyFilterCriteria) ([]*model.KeyResponse, error)
+	DiscoverKmipKeys(context.Context, *model.KmipObjectFilterCriteria) ([]*model.KmipObject, error)
 	DeleteKey(context.Context, uuid.UUID) (interface{}, error)
 	UpdateKey(context.Context, model.KeyUpdateRequest) (*model.KeyResponse, error)
 	RetrieveKey(context.Context, uuid.UUID) (interface{}, error)
+	RetrievePublicKey(context.Context, uuid.UUID) (*PublicKeyResponse, error)
 	CreateKeyTransferPolicy(context.Context, model.KeyTransferPolicy) (*model.KeyTransferPolicy, error)
 	SearchKeyTransferPolicies(context.Context, *model.KeyTransferPolicyFilterCriteria) ([]model.KeyTransferPolicy, error)
 	DeleteKeyTransferPolicy(context.Context, uuid.UUID) (interface{}, error)
 	RetrieveKeyTransferPolicy(context.Context, uuid.UUID) (interface{}, error)
 	TransferKey(context.Context, TransferKeyRequest) (*TransferKeyResponse, error)
 	TransferKeyWithEvidence(context.Context, TransferKeyRequest) (*TransferKeyResponse, error)
+	GenerateDataKey(context.Context, DataKeyRequest) (*TransferKeyResponse, error)
+	DecryptDataKey(context.Context, DataKeyRequest) (*TransferKeyResponse, error)
+	CreateSecret(context.Context, model.SecretRequest) (*model.SecretResponse, error)
+	SearchSecrets(context.Context, *model.SecretFilterCriteria) ([]*model.SecretResponse, error)
+	DeleteSecret(context.Context, uuid.UUID) (interface{}, error)
+	UpdateSecret(context.Context, model.SecretUpdateRequest) (*model.SecretResponse, error)
+	RetrieveSecret(context.Context, uuid.UUID) (interface{}, error)
+	TransferSecret(context.Context, TransferKeyRequest) (*TransferKeyResponse, error)
+	TransferSecretWithEvidence(context.Context, TransferKeyRequest) (*TransferKeyResponse, error)
 	CreateUser(context.Context, *model.User) (*model.UserResponse, error)
 	UpdateUser(context.Context, *model.UpdateUserRequest) (*model.UserResponse, error)
 	SearchUser(context.Context, *model.UserFilterCriteria) ([]model.UserResponse, error)
@@ -51,10 +63,16 @@ type service struct {
 	repository             *repository.Repository
 	remoteManager          *keymanager.RemoteManager
 	config                 *config.Configuration
+	// issuedNonces holds the verifier nonces handed out by this KBS that were not yet used for
+	// a key transfer, when key transfers require a nonce issued by this KBS
+	issuedNonces libcache.Cache
 }
 
 func NewService(itaApiClient connector.Connector, itaTokenVerifierClient connector.Connector, repo *repository.Repository, remoteManager *keymanager.RemoteManager, configuration *config.Configuration) (Service, error) {
 
+	issuedNonces := libcache.FIFO.New(constant.MaxIssuedVerifierNonces)
+	issuedNonces.SetTTL(time.Minute * constant.DefaultVerifierNonceValidityMins)
+
 	var svc Service
 	{
 		svc = service{
@@ -63,6 +81,7 @@ func NewService(itaApiClient connector.Connector, itaTokenVerifierClient connect
 			repository:             repo,
 			remoteManager:          remoteManager,
 			config:                 configuration,
+			issuedNonces:           issuedNonces,
 		}
 	}
 
@@ -83,22 +102,38 @@ func (e HandledError) Error() string {
 	return fmt.Sprintf("%d: %s", e.Code, e.Message)
 }
 
+// newScope returns a scope granting the method on the endpoint path under the API prefix, and
+// nothing else
+func newScope(name, path, method string) token.Scope {
+	return token.NewScope(name, fmt.Sprintf("^/%s/%s%s$", constant.ServiceName, constant.ApiVersion, path), "^"+method+"$")
+}
+
 func SetupAuthZ(jwtKeeper *jwtStrategy.StaticSecret) (*model.JwtAuthz, error) {
 	cache := libcache.FIFO.New(0)
 	cache.SetTTL(time.Minute * 5)
 
-	opt := token.SetScopes(token.NewScope(constant.KeyTransferPolicyCreate, "/key-transfer-policies", "POST"),
-		token.NewScope(constant.KeyTransferPolicySearch, "/key-transfer-policies", "GET"),
-		token.NewScope(constant.KeyTransferPolicyDelete, "/key-transfer-policies", "DELETE"),
-		token.NewScope(constant.KeyCreate, "/keys", "POST"),
-		token.NewScope(constant.KeySearch, "/keys", "GET"),
-		token.NewScope(constant.KeyDelete, "/keys", "DELETE"),
-		token.NewScope(constant.KeyUpdate, "/keys", "PUT"),
-		token.NewScope(constant.KeyTransfer, "/keys/"+constant.UUIDReg, "POST"),
-		token.NewScope(constant.UserCreate, "/users", "POST"),
-		token.NewScope(constant.UserSearch, "/users", "GET"),
-		token.NewScope(constant.UserUpdate, "/users", "PUT"),
-		token.NewScope(constant.UserDelete, "/users", "DELETE"))
+	// go-guardian matches the scope endpoints and methods as unanchored regular expressions, they
+	// are anchored so that a scope does not grant the endpoints nested under its own
+	keyIdPath := "/keys/" + constant.UUIDReg
+	secretIdPath := "/secrets/" + constant.UUIDReg
+	opt := token.SetScopes(newScope(constant.KeyTransferPolicyCreate, "/key-transfer-policies", http.MethodPost),
+		newScope(constant.KeyTransferPolicySearch, "/key-transfer-policies(/"+constant.UUIDReg+")?", http.MethodGet),
+		newScope(constant.KeyTransferPolicyDelete, "/key-transfer-policies/"+constant.UUIDReg, http.MethodDelete),
+		newScope(constant.KeyCreate, "/keys", http.MethodPost),
+		newScope(constant.KeySearch, "/keys(/kmip-objects|/"+constant.UUIDReg+")?", http.MethodGet),
+		newScope(constant.KeyDelete, keyIdPath, http.MethodDelete),
+		newScope(constant.KeyUpdate, keyIdPath, http.MethodPut),
+		newScope(constant.KeyTransfer, keyIdPath, http.MethodPost),
+		newScope(constant.KeyPublicKey, keyIdPath+"/public-key", http.MethodGet),
+		newScope(constant.SecretCreate, "/secrets", http.MethodPost),
+		newScope(constant.SecretSearch, "/secrets(/"+constant.UUIDReg+")?", http.MethodGet),
+		newScope(constant.SecretDelete, secretIdPath, http.MethodDelete),
+		newScope(constant.SecretUpdate, secretIdPath, http.MethodPut),
+		newScope(constant.SecretTransfer, secretIdPath, http.MethodPost),
+		newScope(constant.UserCreate, "/users", http.MethodPost),
+		newScope(constant.UserSearch, "/users(/"+constant.UUIDReg+")?", http.MethodGet),
+		newScope(constant.UserUpdate, "/users/"+constant.UUIDReg, http.MethodPut),
+		newScope(constant.UserDelete, "/users/"+constant.UUIDReg, http.MethodDelete))
 	strategy := jwtStrategy.New(cache, jwtKeeper, opt)
 
 	jwtAuth := model.JwtAuthz{
@@ -7,8 +7,14 @@
 package service
 
 import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
 	_ "github.com/shaj13/libcache/fifo"
 	"github.com/sirupsen/logrus"
+	"hash"
 	"intel/kbs/v1/constant"
 	"intel/kbs/v1/model"
 	"reflect"
@@ -45,6 +51,55 @@ func validateAttestationTokenClaims(tokenClaims *model.AttestationTokenClaim, tr
 	}
 }
 
+// reportDataLength is the length of the report data of SGX and TDX reports
+const reportDataLength = 64
+
+// validateReportDataBinding recomputes the report data of the TEE as the hash of the verifier
+// nonce value, the nonce issue time and the attester held data, the way the Trust Authority client
+// binds runtime data to a quote, and compares it with the report data in the token claims. With
+// the auto hash scheme TDX report data is a SHA-512 hash and SGX report data a SHA-256 hash padded
+// with zeros.
+func validateReportDataBinding(tokenClaims *model.AttestationTokenClaim, hashScheme string) error {
+
+	var reportDataHex string
+	var newHash func() hash.Hash
+	switch tokenClaims.AttesterType {
+	case model.SGX:
+		reportDataHex, newHash = tokenClaims.SgxReportData, sha256.New
+	case model.TDX:
+		reportDataHex, newHash = tokenClaims.TdxReportData, sha512.New
+	default:
+		return errors.New("Unsupported attestation-type")
+	}
+	switch hashScheme {
+	case constant.ReportDataHashSHA256:
+		newHash = sha256.New
+	case constant.ReportDataHashSHA512:
+		newHash = sha512.New
+	}
+
+	reportData, err := hex.DecodeString(reportDataHex)
+	if err != nil || len(reportData) != reportDataLength {
+		return errors.New("Report data in attestation-token is not valid")
+	}
+	heldData, err := base64.StdEncoding.DecodeString(tokenClaims.AttesterHeldData)
+	if err != nil {
+		return errors.Wrap(err, "Failed to decode attester held data")
+	}
+
+	digest := newHash()
+	digest.Write(tokenClaims.VerifierNonce.Val)
+	digest.Write(tokenClaims.VerifierNonce.Iat)
+	digest.Write(heldData)
+	expectedReportData := make([]byte, reportDataLength)
+	copy(expectedReportData, digest.Sum(nil))
+
+	if subtle.ConstantTimeCompare(expectedReportData, reportData) != 1 {
+		return errors.New("Report data in attestation-token does not match the verifier nonce and attester held data")
+	}
+	return nil
+}
+
 func isPolicyIdMatched(tokenPolicyIds []model.PolicyClaim, keyPolicyIds []uuid.UUID) bool {
 	for _, tokenPolicyId := range tokenPolicyIds {
 		if contains(keyPolicyIds, tokenPolicyId.Id) {
@@ -270,3 +325,21 @@ func contains(s interface{}, elem interface{}) bool {
 	}
 	return false
 }
+
+// isKeyEncodingAllowed returns whether keys of the algorithm can be transferred in the encoding
+func isKeyEncodingAllowed(keyAlgorithm, encoding string) bool {
+
+	switch encoding {
+	case model.KeyEncodingJWK:
+		return true
+	case model.KeyEncodingPKCS8:
+		return !constant.SymmetricAlgorithms[keyAlgorithm]
+	case model.KeyEncodingRaw:
+		return constant.SymmetricAlgorithms[keyAlgorithm]
+	case model.KeyEncodingPKCS1:
+		return keyAlgorithm == constant.CRYPTOALGRSA
+	case model.KeyEncodingSEC1:
+		return keyAlgorithm == constant.CRYPTOALGEC
+	}
+	return false
+}
@@ -7,9 +7,12 @@
 package service
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"github.com/google/uuid"
 	"github.com/onsi/gomega"
+	"intel/kbs/v1/constant"
+	"intel/kbs/v1/crypt"
 	"intel/kbs/v1/model"
 	cns "intel/kbs/v1/repository/mocks/constants"
 	"testing"
@@ -385,3 +388,38 @@ func TestValidateAttestationTokenClaims(t *testing.T) {
 	err := validateAttestationTokenClaims(tokenClaims, transferPolicy)
 	g.Expect(err).To(gomega.HaveOccurred())
 }
+
+func TestValidateReportDataBinding(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	for _, token := range []string{sgxToken, tdxToken} {
+		tokenClaims := &model.AttestationTokenClaim{}
+		_, err := crypt.GetTokenClaims(parseJWTToken(token, []byte("")), token, &tokenClaims)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+
+		err = validateReportDataBinding(tokenClaims, constant.ReportDataHashAuto)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+
+		attesterHeldData := tokenClaims.AttesterHeldData
+		tokenClaims.AttesterHeldData = base64.StdEncoding.EncodeToString([]byte("runtime data"))
+		err = validateReportDataBinding(tokenClaims, constant.ReportDataHashAuto)
+		g.Expect(err).To(gomega.HaveOccurred())
+		tokenClaims.AttesterHeldData = attesterHeldData
+
+		tokenClaims.VerifierNonce.Iat = []byte("2024-01-01 00:00:00 +0000 UTC")
+		err = validateReportDataBinding(tokenClaims, constant.ReportDataHashAuto)
+		g.Expect(err).To(gomega.HaveOccurred())
+	}
+
+	sgxClaims := &model.AttestationTokenClaim{}
+	_, err := crypt.GetTokenClaims(parseJWTToken(sgxToken, []byte("")), sgxToken, &sgxClaims)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	err = validateReportDataBinding(sgxClaims, constant.ReportDataHashSHA256)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	err = validateReportDataBinding(sgxClaims, constant.ReportDataHashSHA512)
+	g.Expect(err).To(gomega.HaveOccurred())
+
+	sgxClaims.SgxReportData = "0e3625ea"
+	err = validateReportDataBinding(sgxClaims, constant.ReportDataHashAuto)
+	g.Expect(err).To(gomega.HaveOccurred())
+}
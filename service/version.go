@@ -27,5 +27,11 @@ func (mw loggingMiddleware) GetVersion(ctx context.Context) (*version.ServiceVer
 }
 
 func (svc service) GetVersion(ctx context.Context) (*version.ServiceVersion, error) {
-	return version.GetVersion(), nil
+	serviceVersion := *version.GetVersion()
+	if svc.remoteManager != nil {
+		if kmipVersions := svc.remoteManager.KmipVersions(); len(kmipVersions) > 0 {
+			serviceVersion.KmipVersions = kmipVersions
+		}
+	}
+	return &serviceVersion, nil
 }
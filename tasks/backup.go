@@ -0,0 +1,202 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package tasks
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"intel/kbs/v1/constant"
+	"intel/kbs/v1/crypt"
+	"intel/kbs/v1/keymanager"
+	"intel/kbs/v1/model"
+	"intel/kbs/v1/repository"
+)
+
+const (
+	backupArchiveVersion = 1
+	// the passphrase derived key is split into the archive encryption key and the key wrapping key
+	backupKeySize = 32
+)
+
+var backupArchiveAdditionalData = []byte("kbs-backup-v1")
+
+// backupArchive is the on-disk format of a KBS backup. The contents are encrypted under a key
+// derived from the backup passphrase and the archive is signed with the backup signing key.
+type backupArchive struct {
+	Version int `json:"version"`
+	crypt.PassphraseKdf
+	SignerPublicKey []byte `json:"signer_public_key"`
+	Contents        []byte `json:"contents"`
+	Signature       []byte `json:"signature,omitempty"`
+}
+
+// backupContents is the plaintext of an archive
+type backupContents struct {
+	CreatedAt time.Time                 `json:"created_at"`
+	Keys      []backupKey               `json:"keys"`
+	Policies  []model.KeyTransferPolicy `json:"policies"`
+	Users     []model.UserInfo          `json:"users"`
+}
+
+// backupKey holds the repository record of a key. The key material of vault and local keys is
+// wrapped under the backup key, kmip, vault transit, pkcs11 and plugin keys are kept as references
+// to their backend.
+type backupKey struct {
+	Attributes model.KeyAttributes `json:"attributes"`
+	// KeyManagerType is the type of the backend holding the key, i.e. vault, vault-transit, kmip,
+	// pkcs11, plugin or local
+	KeyManagerType string `json:"key_manager_type"`
+	WrappedKey     []byte `json:"wrapped_key,omitempty"`
+}
+
+type Backup struct {
+	Repository *repository.Repository
+	KeyManager *keymanager.MultiKeyManager
+	Passphrase string
+	SigningKey *rsa.PrivateKey
+}
+
+// CreateBackup writes an encrypted and signed archive of all keys, key transfer policies and users to w
+func (b *Backup) CreateBackup(w io.Writer) error {
+	log.Info("Creating KBS backup")
+
+	if b.SigningKey == nil {
+		return errors.New("Signing key is required to create a backup")
+	}
+	keys, err := b.Repository.KeyStore.Search(nil)
+	if err != nil {
+		return errors.Wrap(err, "Failed to read keys")
+	}
+	policies, err := b.Repository.KeyTransferPolicyStore.Search(nil)
+	if err != nil {
+		return errors.Wrap(err, "Failed to read key transfer policies")
+	}
+	users, err := b.Repository.UserStore.Search(nil)
+	if err != nil {
+		return errors.Wrap(err, "Failed to read users")
+	}
+
+	kdf, err := crypt.NewPassphraseKdf()
+	if err != nil {
+		return err
+	}
+	archiveCipher, keyWrapCipher, err := newBackupCiphers(kdf, b.Passphrase)
+	if err != nil {
+		return err
+	}
+
+	contents := backupContents{
+		CreatedAt: time.Now().UTC(),
+		Keys:      make([]backupKey, 0, len(keys)),
+		Policies:  policies,
+		Users:     users,
+	}
+	for i := range keys {
+		backendName := b.KeyManager.BackendName(&keys[i])
+		_, backendType, err := b.KeyManager.Backend(backendName)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to back up key %s", keys[i].ID)
+		}
+		key := backupKey{
+			Attributes:     keys[i],
+			KeyManagerType: backendType,
+		}
+		key.Attributes.KeyManager = backendName
+		if backendType == constant.VaultKeyManager || backendType == constant.LocalKeyManager {
+			keyBytes, err := b.KeyManager.TransferKey(context.Background(), &keys[i])
+			if err != nil {
+				return errors.Wrapf(err, "Failed to read key material of key %s", keys[i].ID)
+			}
+			key.WrappedKey, err = keyWrapCipher.Seal(keyBytes, backupKeyAdditionalData(&keys[i]))
+			crypt.ZeroizeByteArray(keyBytes)
+			if err != nil {
+				return errors.Wrapf(err, "Failed to wrap key %s", keys[i].ID)
+			}
+		}
+		contents.Keys = append(contents.Keys, key)
+	}
+
+	plaintext, err := json.Marshal(contents)
+	if err != nil {
+		return errors.Wrap(err, "Failed to marshal backup contents")
+	}
+	sealedContents, err := archiveCipher.Seal(plaintext, backupArchiveAdditionalData)
+	crypt.ZeroizeByteArray(plaintext)
+	if err != nil {
+		return errors.Wrap(err, "Failed to encrypt backup contents")
+	}
+
+	signerPublicKey, err := x509.MarshalPKIXPublicKey(&b.SigningKey.PublicKey)
+	if err != nil {
+		return errors.Wrap(err, "Failed to marshal signer public key")
+	}
+	archive := backupArchive{
+		Version:         backupArchiveVersion,
+		PassphraseKdf:   *kdf,
+		SignerPublicKey: signerPublicKey,
+		Contents:        sealedContents,
+	}
+	digest, err := archive.digest()
+	if err != nil {
+		return err
+	}
+	archive.Signature, err = rsa.SignPSS(rand.Reader, b.SigningKey, crypto.SHA384, digest, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	if err != nil {
+		return errors.Wrap(err, "Failed to sign backup archive")
+	}
+
+	if err := json.NewEncoder(w).Encode(archive); err != nil {
+		return errors.Wrap(err, "Failed to write backup archive")
+	}
+	log.Infof("Backed up %d keys, %d key transfer policies and %d users", len(contents.Keys), len(policies), len(users))
+	return nil
+}
+
+// digest returns the SHA-384 digest over every field of the archive except the signature
+func (ba *backupArchive) digest() ([]byte, error) {
+	unsigned := *ba
+	unsigned.Signature = nil
+	bytes, err := json.Marshal(unsigned)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to marshal backup archive")
+	}
+	digest := sha512.Sum384(bytes)
+	return digest[:], nil
+}
+
+// newBackupCiphers derives the archive encryption cipher and the key wrapping cipher from passphrase
+func newBackupCiphers(kdf *crypt.PassphraseKdf, passphrase string) (*crypt.AeadCipher, *crypt.AeadCipher, error) {
+	derivedKey, err := kdf.DeriveKey(passphrase, 2*backupKeySize)
+	defer crypt.ZeroizeByteArray(derivedKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	archiveCipher, err := crypt.NewAeadCipher(derivedKey[:backupKeySize])
+	if err != nil {
+		return nil, nil, err
+	}
+	keyWrapCipher, err := crypt.NewAeadCipher(derivedKey[backupKeySize:])
+	if err != nil {
+		return nil, nil, err
+	}
+	return archiveCipher, keyWrapCipher, nil
+}
+
+// backupKeyAdditionalData binds wrapped key material to the key it belongs to
+func backupKeyAdditionalData(key *model.KeyAttributes) []byte {
+	return []byte("kbs-backup-key/" + key.ID.String() + "/" + key.Algorithm)
+}
@@ -0,0 +1,287 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package tasks
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	"intel/kbs/v1/crypt"
+	"intel/kbs/v1/keymanager"
+	"intel/kbs/v1/model"
+	"intel/kbs/v1/repository"
+)
+
+// newTestKeyManager routes keys to a single backend named after its type
+func newTestKeyManager(backendType string, km keymanager.KeyManager) *keymanager.MultiKeyManager {
+	multiKeyManager := keymanager.NewMultiKeyManager(backendType)
+	multiKeyManager.AddBackend(backendType, backendType, km)
+	return multiKeyManager
+}
+
+// memoryKeyManager keeps key material in memory the way vault does, or the way a kmip server
+// does when kmip is set
+type memoryKeyManager struct {
+	keys map[uuid.UUID][]byte
+	kmip bool
+	// failRegisterCall makes the nth call to RegisterKey fail
+	failRegisterCall int
+	registerCalls    int
+}
+
+func (km *memoryKeyManager) CreateKey(context.Context, *model.KeyRequest) (*model.KeyAttributes, error) {
+	return nil, nil
+}
+
+func (km *memoryKeyManager) DeleteKey(_ context.Context, attributes *model.KeyAttributes) error {
+	delete(km.keys, attributes.ID)
+	return nil
+}
+
+func (km *memoryKeyManager) RegisterKey(_ context.Context, request *model.KeyRequest) (*model.KeyAttributes, error) {
+	km.registerCalls++
+	if km.registerCalls == km.failRegisterCall {
+		return nil, errors.New("register failed")
+	}
+	keyBytes, err := base64.StdEncoding.DecodeString(request.KeyInfo.KeyData)
+	if err != nil {
+		return nil, err
+	}
+	if request.KeyInfo.Algorithm == "RSA" || request.KeyInfo.Algorithm == "EC" {
+		privateKey, err := crypt.GetPrivateKeyFromPem(keyBytes)
+		if err != nil {
+			return nil, err
+		}
+		keyBytes, _ = x509.MarshalPKCS8PrivateKey(privateKey)
+	}
+	km.keys[request.KeyId] = keyBytes
+	var kmipKeyID string
+	if km.kmip {
+		kmipKeyID = "kmip-" + request.KeyId.String()
+	}
+	return &model.KeyAttributes{
+		ID:               request.KeyId,
+		KmipKeyID:        kmipKeyID,
+		Algorithm:        request.KeyInfo.Algorithm,
+		KeyLength:        request.KeyInfo.KeyLength,
+		TransferPolicyId: request.TransferPolicyID,
+		CreatedAt:        time.Now().UTC(),
+	}, nil
+}
+
+func (km *memoryKeyManager) TransferKey(_ context.Context, attributes *model.KeyAttributes) ([]byte, error) {
+	return append([]byte{}, km.keys[attributes.ID]...), nil
+}
+
+type backupFixture struct {
+	repo       *repository.Repository
+	keyManager *memoryKeyManager
+	signingKey *rsa.PrivateKey
+	policy     *model.KeyTransferPolicy
+	user       *model.UserInfo
+	aesKey     *model.KeyAttributes
+	rsaKey     *model.KeyAttributes
+}
+
+func newBackupFixture(t *testing.T) *backupFixture {
+	g := gomega.NewGomegaWithT(t)
+	f := &backupFixture{
+		repo:       repository.NewDirectoryRepository(newTestRepositoryDir(t), nil),
+		keyManager: &memoryKeyManager{keys: map[uuid.UUID][]byte{}},
+	}
+
+	var err error
+	f.signingKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	f.policy, err = f.repo.KeyTransferPolicyStore.Create(&model.KeyTransferPolicy{AttestationType: model.TDX})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	f.user, err = f.repo.UserStore.Create(&model.UserInfo{ID: uuid.New(), Username: "testAdmin", Permissions: []string{"*:*"}})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	aesKey := []byte("0123456789abcdef0123456789abcdef")
+	f.aesKey = &model.KeyAttributes{ID: uuid.New(), Algorithm: "AES", KeyLength: 256, TransferPolicyId: f.policy.ID, CreatedAt: time.Now().UTC()}
+	f.keyManager.keys[f.aesKey.ID] = aesKey
+	_, err = f.repo.KeyStore.Create(f.aesKey)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	rsaKeyBytes, err := x509.MarshalPKCS8PrivateKey(rsaKey)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	f.rsaKey = &model.KeyAttributes{ID: uuid.New(), Algorithm: "RSA", KeyLength: 2048, TransferPolicyId: f.policy.ID, CreatedAt: time.Now().UTC()}
+	f.keyManager.keys[f.rsaKey.ID] = rsaKeyBytes
+	_, err = f.repo.KeyStore.Create(f.rsaKey)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	return f
+}
+
+func (f *backupFixture) createBackup(t *testing.T) []byte {
+	g := gomega.NewGomegaWithT(t)
+	backup := Backup{
+		Repository: f.repo,
+		KeyManager: newTestKeyManager("vault", f.keyManager),
+		Passphrase: "testPassphrase",
+		SigningKey: f.signingKey,
+	}
+	var archive bytes.Buffer
+	g.Expect(backup.CreateBackup(&archive)).To(gomega.Succeed())
+	return archive.Bytes()
+}
+
+func TestBackupRestore(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	source := newBackupFixture(t)
+	archive := source.createBackup(t)
+
+	// key material must not be readable from the archive
+	g.Expect(bytes.Contains(archive, source.keyManager.keys[source.aesKey.ID])).To(gomega.BeFalse())
+	g.Expect(bytes.Contains(archive, []byte("testAdmin"))).To(gomega.BeFalse())
+
+	target := &memoryKeyManager{keys: map[uuid.UUID][]byte{}}
+	targetRepo := repository.NewDirectoryRepository(newTestRepositoryDir(t), nil)
+	restore := Restore{
+		Repository:      targetRepo,
+		KeyManager:      newTestKeyManager("vault", target),
+		Passphrase:      "testPassphrase",
+		SignerPublicKey: &source.signingKey.PublicKey,
+	}
+	g.Expect(restore.RestoreBackup(bytes.NewReader(archive))).To(gomega.Succeed())
+
+	policy, err := targetRepo.KeyTransferPolicyStore.Retrieve(source.policy.ID)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(policy.CreatedAt.Equal(source.policy.CreatedAt)).To(gomega.BeTrue())
+	user, err := targetRepo.UserStore.Retrieve(source.user.ID)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(user.Username).To(gomega.Equal("testAdmin"))
+	for _, key := range []*model.KeyAttributes{source.aesKey, source.rsaKey} {
+		restoredKey, err := targetRepo.KeyStore.Retrieve(key.ID)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(restoredKey.TransferPolicyId).To(gomega.Equal(source.policy.ID))
+		g.Expect(restoredKey.KeyManager).To(gomega.Equal("vault"))
+		g.Expect(target.keys[key.ID]).To(gomega.Equal(source.keyManager.keys[key.ID]))
+	}
+
+	// restoring again conflicts with the existing records
+	err = restore.RestoreBackup(bytes.NewReader(archive))
+	g.Expect(err).To(gomega.HaveOccurred())
+
+	restore.OnConflict = RestoreConflictSkip
+	g.Expect(restore.RestoreBackup(bytes.NewReader(archive))).To(gomega.Succeed())
+
+	restore.OnConflict = RestoreConflictOverwrite
+	g.Expect(restore.RestoreBackup(bytes.NewReader(archive))).To(gomega.Succeed())
+	users, err := targetRepo.UserStore.Search(nil)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(users).To(gomega.HaveLen(1))
+
+	restore.OnConflict = "invalid"
+	g.Expect(restore.RestoreBackup(bytes.NewReader(archive))).NotTo(gomega.Succeed())
+}
+
+func TestRestoreRejectsInvalidArchive(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	source := newBackupFixture(t)
+	archive := source.createBackup(t)
+
+	newRestore := func() *Restore {
+		return &Restore{
+			Repository:      repository.NewDirectoryRepository(newTestRepositoryDir(t), nil),
+			KeyManager:      newTestKeyManager("vault", &memoryKeyManager{keys: map[uuid.UUID][]byte{}}),
+			Passphrase:      "testPassphrase",
+			SignerPublicKey: &source.signingKey.PublicKey,
+		}
+	}
+
+	// wrong passphrase
+	restore := newRestore()
+	restore.Passphrase = "wrongPassphrase"
+	g.Expect(restore.RestoreBackup(bytes.NewReader(archive))).NotTo(gomega.Succeed())
+
+	// unexpected signer
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	restore = newRestore()
+	restore.SignerPublicKey = &otherKey.PublicKey
+	g.Expect(restore.RestoreBackup(bytes.NewReader(archive))).NotTo(gomega.Succeed())
+
+	// backend of the keys is not configured
+	restore = newRestore()
+	restore.KeyManager = newTestKeyManager("kmip", &memoryKeyManager{keys: map[uuid.UUID][]byte{}, kmip: true})
+	g.Expect(restore.RestoreBackup(bytes.NewReader(archive))).NotTo(gomega.Succeed())
+
+	// backend of the keys has a different type
+	restore = newRestore()
+	restore.KeyManager = keymanager.NewMultiKeyManager("vault")
+	restore.KeyManager.AddBackend("vault", "kmip", &memoryKeyManager{keys: map[uuid.UUID][]byte{}, kmip: true})
+	g.Expect(restore.RestoreBackup(bytes.NewReader(archive))).NotTo(gomega.Succeed())
+
+	// modified contents
+	var tampered backupArchive
+	g.Expect(json.Unmarshal(archive, &tampered)).To(gomega.Succeed())
+	tampered.Contents[len(tampered.Contents)-1] ^= 0x01
+	tamperedBytes, err := json.Marshal(tampered)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(newRestore().RestoreBackup(bytes.NewReader(tamperedBytes))).NotTo(gomega.Succeed())
+
+	// nothing is written by a rejected restore
+	restore = newRestore()
+	restore.Passphrase = "wrongPassphrase"
+	g.Expect(restore.RestoreBackup(bytes.NewReader(archive))).NotTo(gomega.Succeed())
+	keys, err := restore.Repository.KeyStore.Search(nil)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(keys).To(gomega.BeEmpty())
+}
+
+func TestRestoreRollback(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	f := newBackupFixture(t)
+	archive := f.createBackup(t)
+
+	// the key material changed since the backup
+	current := map[uuid.UUID][]byte{}
+	for id := range f.keyManager.keys {
+		f.keyManager.keys[id] = append([]byte{}, f.keyManager.keys[id]...)
+		if id == f.aesKey.ID {
+			f.keyManager.keys[id] = []byte("fedcba9876543210fedcba9876543210")
+		}
+		current[id] = f.keyManager.keys[id]
+	}
+
+	// the second key fails to be restored after the first one was replaced
+	f.keyManager.failRegisterCall = 2
+	restore := Restore{
+		Repository:      f.repo,
+		KeyManager:      newTestKeyManager("vault", f.keyManager),
+		Passphrase:      "testPassphrase",
+		SignerPublicKey: &f.signingKey.PublicKey,
+		OnConflict:      RestoreConflictOverwrite,
+	}
+	g.Expect(restore.RestoreBackup(bytes.NewReader(archive))).NotTo(gomega.Succeed())
+
+	// the state before the restore is back
+	for _, key := range []*model.KeyAttributes{f.aesKey, f.rsaKey} {
+		_, err := f.repo.KeyStore.Retrieve(key.ID)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(f.keyManager.keys[key.ID]).To(gomega.Equal(current[key.ID]))
+	}
+	_, err := f.repo.KeyTransferPolicyStore.Retrieve(f.policy.ID)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	users, err := f.repo.UserStore.Search(nil)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(users).To(gomega.HaveLen(1))
+}
@@ -31,8 +31,8 @@ func (ac *CreateAdminUser) CreateAdminUser() error {
 	// check if a user with same name exists already
 	existingUsers, err := ac.UserStore.Search(&model.UserFilterCriteria{Username: ac.AdminUsername})
 	if len(existingUsers) != 0 {
-		log.Warnf("Failed to create admin user. User with same username %s already exists", ac.AdminUsername)
-		return nil
+		log.Infof("User with same username %s already exists", ac.AdminUsername)
+		return ac.addAdminPermissions(&existingUsers[0])
 	} else if err != nil {
 		log.WithError(err).Errorf("Error search for a user with given username %s", ac.AdminUsername)
 		return errors.New("Error searching for a user before creating a new admin user")
@@ -59,3 +59,29 @@ func (ac *CreateAdminUser) CreateAdminUser() error {
 	log.Infof("Successfully created an admin user with name %s", user.Username)
 	return nil
 }
+
+// addAdminPermissions grants the secret permissions the existing admin user is missing. Other
+// permissions removed from the admin user by an administrator are not granted again.
+func (ac *CreateAdminUser) addAdminPermissions(user *model.UserInfo) error {
+
+	granted := make(map[string]bool, len(user.Permissions))
+	for _, permission := range user.Permissions {
+		granted[permission] = true
+	}
+	var missing []string
+	for _, permission := range constant.SecretPermissions {
+		if !granted[permission] {
+			missing = append(missing, permission)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	user.Permissions = append(user.Permissions, missing...)
+	if _, err := ac.UserStore.Update(user); err != nil {
+		return errors.Wrap(err, "Error adding secret permissions to the existing admin user")
+	}
+	log.Warnf("Granted permissions %v to the existing admin user %s", missing, user.Username)
+	return nil
+}
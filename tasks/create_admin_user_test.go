@@ -7,7 +7,10 @@
 package tasks
 
 import (
+	"github.com/google/uuid"
 	"github.com/onsi/gomega"
+	"intel/kbs/v1/constant"
+	"intel/kbs/v1/model"
 	"intel/kbs/v1/repository/mocks"
 	"testing"
 )
@@ -49,4 +52,41 @@ func TestCreateAdminUserWithSameName(t *testing.T) {
 
 	err := ac.CreateAdminUser()
 	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	// the existing user is granted the secret permissions it is missing
+	users, err := userStore.Search(&model.UserFilterCriteria{Username: "userAdmin"})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(users).To(gomega.HaveLen(1))
+	g.Expect(users[0].Permissions).To(gomega.ConsistOf(constant.SecretPermissions))
+}
+
+func TestCreateAdminUserAddsMissingPermissions(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	var userStore *mocks.MockUserStore = mocks.NewFakeUserStore()
+	user, err := userStore.Create(&model.UserInfo{
+		ID:          uuid.New(),
+		Username:    "legacyAdmin",
+		Permissions: []string{constant.KeySearch, constant.KeyCreate, "custom:permission"},
+	})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	ac := CreateAdminUser{
+		AdminUsername: "legacyAdmin",
+		AdminPassword: "testPassword",
+		UserStore:     userStore,
+	}
+
+	g.Expect(ac.CreateAdminUser()).To(gomega.Succeed())
+	updated, err := userStore.Retrieve(user.ID)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(updated.Permissions).To(gomega.ContainElements(constant.SecretPermissions))
+	g.Expect(updated.Permissions).To(gomega.ContainElement("custom:permission"))
+	// permissions other than the secret permissions are not granted again
+	g.Expect(updated.Permissions).NotTo(gomega.ContainElement(constant.KeyDelete))
+	g.Expect(updated.Permissions).To(gomega.HaveLen(len(constant.SecretPermissions) + 3))
+
+	// running the setup again changes nothing
+	g.Expect(ac.CreateAdminUser()).To(gomega.Succeed())
+	updated, err = userStore.Retrieve(user.ID)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(updated.Permissions).To(gomega.HaveLen(len(constant.SecretPermissions) + 3))
 }
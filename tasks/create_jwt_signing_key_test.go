@@ -7,14 +7,17 @@
 package tasks
 
 import (
-	"github.com/onsi/gomega"
+	"path/filepath"
 	"testing"
+
+	"github.com/onsi/gomega"
 )
 
 func TestCreateJWTSigningKey(t *testing.T) {
 	g := gomega.NewGomegaWithT(t)
+	dir := t.TempDir()
 	csk := CreateSigningKey{
-		JWTSigningKeyPath: "../test/jwt-signing.key",
+		JWTSigningKeyPath: filepath.Join(dir, "jwt-signing.key"),
 	}
 	err := csk.CreateJWTSigningKey()
 	g.Expect(err).NotTo(gomega.HaveOccurred())
@@ -22,8 +25,9 @@ func TestCreateJWTSigningKey(t *testing.T) {
 
 func TestCreateJWTSigningKeyWithInvalidPath(t *testing.T) {
 	g := gomega.NewGomegaWithT(t)
+	dir := t.TempDir()
 	csk := CreateSigningKey{
-		JWTSigningKeyPath: "../testFolder/jwt-signing.key",
+		JWTSigningKeyPath: filepath.Join(dir, "testFolder", "jwt-signing.key"),
 	}
 	err := csk.CreateJWTSigningKey()
 	g.Expect(err).To(gomega.HaveOccurred())
@@ -7,15 +7,18 @@
 package tasks
 
 import (
-	"github.com/onsi/gomega"
+	"path/filepath"
 	"testing"
+
+	"github.com/onsi/gomega"
 )
 
 func TestCreateTLSSigningKeyCert(t *testing.T) {
 	g := gomega.NewGomegaWithT(t)
+	dir := t.TempDir()
 	tlsCs := TLSKeyAndCert{
-		TLSCertPath: "../test/tls.crt",
-		TLSKeyPath:  "../test/tls.key",
+		TLSCertPath: filepath.Join(dir, "tls.crt"),
+		TLSKeyPath:  filepath.Join(dir, "tls.key"),
 		TlsSanList:  "localhost",
 	}
 	err := tlsCs.GenerateTLSKeyandCert()
@@ -24,9 +27,10 @@ func TestCreateTLSSigningKeyCert(t *testing.T) {
 
 func TestCreateTLSSigningKeyCertWithInvalidCertPath(t *testing.T) {
 	g := gomega.NewGomegaWithT(t)
+	dir := t.TempDir()
 	tlsCs := TLSKeyAndCert{
-		TLSCertPath: "../test/invalidFolder/tls.crt",
-		TLSKeyPath:  "../test/tls.key",
+		TLSCertPath: filepath.Join(dir, "invalidFolder", "tls.crt"),
+		TLSKeyPath:  filepath.Join(dir, "tls.key"),
 	}
 	err := tlsCs.GenerateTLSKeyandCert()
 	g.Expect(err).To(gomega.HaveOccurred())
@@ -34,9 +38,10 @@ func TestCreateTLSSigningKeyCertWithInvalidCertPath(t *testing.T) {
 
 func TestCreateTLSSigningKeyCertWithInvalidKeyPath(t *testing.T) {
 	g := gomega.NewGomegaWithT(t)
+	dir := t.TempDir()
 	tlsCs := TLSKeyAndCert{
-		TLSCertPath: "../test/tls.crt",
-		TLSKeyPath:  "../test/invalidFolder/tls.key",
+		TLSCertPath: filepath.Join(dir, "tls.crt"),
+		TLSKeyPath:  filepath.Join(dir, "invalidFolder", "tls.key"),
 	}
 	err := tlsCs.GenerateTLSKeyandCert()
 	g.Expect(err).To(gomega.HaveOccurred())
@@ -44,9 +49,10 @@ func TestCreateTLSSigningKeyCertWithInvalidKeyPath(t *testing.T) {
 
 func TestGenerateAndStoreCertificateInvalidSanList(t *testing.T) {
 	g := gomega.NewGomegaWithT(t)
+	dir := t.TempDir()
 	tlsCs := TLSKeyAndCert{
-		TLSCertPath: "../test/tls.crt",
-		TLSKeyPath:  "../test/tls.key",
+		TLSCertPath: filepath.Join(dir, "tls.crt"),
+		TLSKeyPath:  filepath.Join(dir, "tls.key"),
 		TlsSanList:  "invalid,::value",
 	}
 
@@ -0,0 +1,165 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package tasks
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"intel/kbs/v1/constant"
+	"intel/kbs/v1/crypt"
+	"intel/kbs/v1/keymanager"
+	"intel/kbs/v1/model"
+	"intel/kbs/v1/repository"
+)
+
+type MigrateKeys struct {
+	KeyStore   repository.KeyStore
+	KeyManager *keymanager.MultiKeyManager
+	// From and To are the names of the configured key manager backends
+	From string
+	To   string
+	// DryRun reads every key from the source without registering it in the target
+	DryRun bool
+	// DeleteSource removes the key from the source backend once it is migrated
+	DeleteSource bool
+}
+
+// MigrateKeys moves the key material of every key held by the source backend into the target
+// backend, keeping the key IDs. Key records are updated as each key is migrated, so a failed
+// migration can be resumed by running it again.
+func (mk *MigrateKeys) MigrateKeys() error {
+
+	if mk.From == mk.To {
+		return errors.New("Source and target key managers must be different")
+	}
+	if _, _, err := mk.KeyManager.Backend(mk.From); err != nil {
+		return errors.Wrap(err, "Invalid source key manager")
+	}
+	_, targetType, err := mk.KeyManager.Backend(mk.To)
+	if err != nil {
+		return errors.Wrap(err, "Invalid target key manager")
+	}
+
+	keys, err := mk.KeyStore.Search(nil)
+	if err != nil {
+		return errors.Wrap(err, "Failed to read keys")
+	}
+
+	var pending []model.KeyAttributes
+	for _, key := range keys {
+		if mk.KeyManager.BackendName(&key) == mk.From {
+			pending = append(pending, key)
+		}
+	}
+	log.Infof("Migrating %d of %d keys from %s to %s", len(pending), len(keys), mk.From, mk.To)
+
+	var failed int
+	for i := range pending {
+		key := &pending[i]
+		if err := mk.migrateKey(key, targetType); err != nil {
+			log.WithError(err).Errorf("[%d/%d] Failed to migrate key %s", i+1, len(pending), key.ID)
+			failed++
+			continue
+		}
+		if mk.DryRun {
+			log.Infof("[%d/%d] Key %s can be migrated", i+1, len(pending), key.ID)
+		} else {
+			log.Infof("[%d/%d] Migrated key %s", i+1, len(pending), key.ID)
+		}
+	}
+
+	if failed > 0 {
+		return errors.Errorf("Failed to migrate %d of %d keys, run the migration again to retry them", failed, len(pending))
+	}
+	return nil
+}
+
+func (mk *MigrateKeys) migrateKey(key *model.KeyAttributes, targetType string) error {
+
+	if targetType == constant.KmipKeyManager && !keymanager.KmipRegisterAlgorithms[key.Algorithm] {
+		return errors.Errorf("%s keys are not supported by %s", key.Algorithm, targetType)
+	}
+
+	keyBytes, err := mk.KeyManager.TransferKey(context.Background(), key)
+	if err != nil {
+		return errors.Wrap(err, "Failed to read key from source")
+	}
+	defer crypt.ZeroizeByteArray(keyBytes)
+
+	keyData, err := registerKeyData(key.Algorithm, keyBytes)
+	if err != nil {
+		return err
+	}
+	if mk.DryRun {
+		return nil
+	}
+
+	request := &model.KeyRequest{
+		KeyId: key.ID,
+		KeyInfo: &model.KeyInfo{
+			Algorithm:   key.Algorithm,
+			KeyLength:   key.KeyLength,
+			CurveType:   key.CurveType,
+			KeyData:     keyData,
+			KeyEncoding: key.KeyEncoding,
+		},
+		TransferPolicyID: key.TransferPolicyId,
+		KeyManager:       mk.To,
+	}
+	registered, err := mk.KeyManager.RegisterKey(context.Background(), request)
+	if err != nil {
+		return errors.Wrap(err, "Failed to register key in target")
+	}
+
+	sourceKey := *key
+	sourceKey.KeyManager = mk.From
+	key.KmipKeyID = registered.KmipKeyID
+	key.KeyManager = registered.KeyManager
+	if _, err := mk.KeyStore.Update(key); err != nil {
+		return errors.Wrap(err, "Failed to update key record")
+	}
+
+	if mk.DeleteSource {
+		if err := mk.KeyManager.DeleteKey(context.Background(), &sourceKey); err != nil {
+			log.WithError(err).Warnf("Key %s was migrated but could not be deleted from the source", key.ID)
+		}
+	}
+	return nil
+}
+
+// registerKeyData converts key material returned by KeyManager.TransferKey into the key_data
+// format accepted by KeyManager.RegisterKey
+func registerKeyData(algorithm string, keyBytes []byte) (string, error) {
+
+	// symmetric keys and opaque secrets are registered as their value
+	if constant.SymmetricAlgorithms[algorithm] {
+		return base64.StdEncoding.EncodeToString(keyBytes), nil
+	}
+
+	// vault returns PKCS#8 private keys, kmip returns PKCS#1 private keys
+	privateKey, err := crypt.ParsePKCS8PrivateKey(keyBytes)
+	if err != nil {
+		var pkcs1Err error
+		if privateKey, pkcs1Err = x509.ParsePKCS1PrivateKey(keyBytes); pkcs1Err != nil {
+			return "", errors.Wrap(err, "Failed to parse private key")
+		}
+	}
+	privateKeyBytes, err := crypt.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to marshal private key")
+	}
+	defer crypt.ZeroizeByteArray(privateKeyBytes)
+
+	privateKeyPem := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateKeyBytes})
+	defer crypt.ZeroizeByteArray(privateKeyPem)
+	return base64.StdEncoding.EncodeToString(privateKeyPem), nil
+}
@@ -0,0 +1,84 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package tasks
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/onsi/gomega"
+	"intel/kbs/v1/keymanager"
+	"intel/kbs/v1/model"
+)
+
+func TestMigrateKeys(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	f := newBackupFixture(t)
+	target := &memoryKeyManager{keys: map[uuid.UUID][]byte{}, kmip: true}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	ecKeyBytes, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	ecKeyAttributes := &model.KeyAttributes{ID: uuid.New(), Algorithm: "EC", CurveType: "secp384r1"}
+	f.keyManager.keys[ecKeyAttributes.ID] = ecKeyBytes
+	_, err = f.repo.KeyStore.Create(ecKeyAttributes)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	edKey := &model.KeyAttributes{ID: uuid.New(), Algorithm: "ED25519"}
+	f.keyManager.keys[edKey.ID] = []byte("unsupported")
+	_, err = f.repo.KeyStore.Create(edKey)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	keyManager := keymanager.NewMultiKeyManager("vault")
+	keyManager.AddBackend("vault", "vault", f.keyManager)
+	keyManager.AddBackend("hsm", "kmip", target)
+
+	mk := MigrateKeys{
+		KeyStore:   f.repo.KeyStore,
+		KeyManager: keyManager,
+		From:       "vault",
+		To:         "hsm",
+		DryRun:     true,
+	}
+
+	// dry run only reads the keys, the ED25519 key is reported as not supported by kmip
+	g.Expect(mk.MigrateKeys()).NotTo(gomega.Succeed())
+	g.Expect(target.keys).To(gomega.BeEmpty())
+
+	g.Expect(f.repo.KeyStore.Delete(edKey.ID)).To(gomega.Succeed())
+	delete(f.keyManager.keys, edKey.ID)
+	mk.DryRun = false
+	mk.DeleteSource = true
+	g.Expect(mk.MigrateKeys()).To(gomega.Succeed())
+	for _, key := range []*model.KeyAttributes{f.aesKey, f.rsaKey, ecKeyAttributes} {
+		migrated, err := f.repo.KeyStore.Retrieve(key.ID)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(migrated.KmipKeyID).To(gomega.Equal("kmip-" + key.ID.String()))
+		g.Expect(migrated.KeyManager).To(gomega.Equal("hsm"))
+		g.Expect(migrated.TransferPolicyId).To(gomega.Equal(key.TransferPolicyId))
+		g.Expect(migrated.CreatedAt.Equal(key.CreatedAt)).To(gomega.BeTrue())
+		g.Expect(target.keys).To(gomega.HaveKey(key.ID))
+	}
+	// EC keys are registered in kmip in PKCS#8 format
+	g.Expect(target.keys[ecKeyAttributes.ID]).To(gomega.Equal(ecKeyBytes))
+	g.Expect(f.keyManager.keys).To(gomega.BeEmpty())
+
+	// migrated keys are not migrated again
+	target.keys = map[uuid.UUID][]byte{}
+	g.Expect(mk.MigrateKeys()).To(gomega.Succeed())
+	g.Expect(target.keys).To(gomega.BeEmpty())
+
+	mk.To = "vault"
+	g.Expect(mk.MigrateKeys()).NotTo(gomega.Succeed())
+	mk.To = "unknown"
+	g.Expect(mk.MigrateKeys()).NotTo(gomega.Succeed())
+}
@@ -0,0 +1,479 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package tasks
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"intel/kbs/v1/constant"
+	"intel/kbs/v1/crypt"
+	"intel/kbs/v1/keymanager"
+	"intel/kbs/v1/model"
+	"intel/kbs/v1/repository"
+	"intel/kbs/v1/repository/directory"
+)
+
+const (
+	// RestoreConflictFail aborts the restore before anything is written when a record already exists
+	RestoreConflictFail = "fail"
+	// RestoreConflictSkip keeps the existing record
+	RestoreConflictSkip = "skip"
+	// RestoreConflictOverwrite replaces the existing record with the one from the archive
+	RestoreConflictOverwrite = "overwrite"
+)
+
+type Restore struct {
+	Repository *repository.Repository
+	KeyManager *keymanager.MultiKeyManager
+	Passphrase string
+	// SignerPublicKey is the public key of the KBS that created the archive
+	SignerPublicKey *rsa.PublicKey
+	// OnConflict is one of RestoreConflictFail, RestoreConflictSkip or RestoreConflictOverwrite
+	OnConflict string
+}
+
+// RestoreBackup validates the archive read from r and imports its keys, key transfer policies
+// and users, preserving their IDs
+func (rs *Restore) RestoreBackup(r io.Reader) error {
+	log.Info("Restoring KBS backup")
+
+	onConflict := strings.ToLower(rs.OnConflict)
+	if onConflict == "" {
+		onConflict = RestoreConflictFail
+	}
+	if onConflict != RestoreConflictFail && onConflict != RestoreConflictSkip && onConflict != RestoreConflictOverwrite {
+		return errors.Errorf("Invalid conflict policy %s, must be one of %s, %s or %s", rs.OnConflict, RestoreConflictFail, RestoreConflictSkip, RestoreConflictOverwrite)
+	}
+
+	contents, keyWrapCipher, err := rs.openArchive(r)
+	if err != nil {
+		return err
+	}
+
+	if err := rs.validateBackupContents(contents); err != nil {
+		return errors.Wrap(err, "Invalid backup archive")
+	}
+
+	conflicts, err := rs.findConflicts(contents)
+	if err != nil {
+		return err
+	}
+	if onConflict == RestoreConflictFail && len(conflicts) > 0 {
+		return errors.Errorf("Backup conflicts with %d existing records: %s", len(conflicts), strings.Join(conflicts, ", "))
+	}
+
+	// every key is unwrapped and the key material of every key that is replaced is read before
+	// anything is written, so that a restore that is bound to fail leaves the KBS untouched
+	keys := make([]*preparedKey, 0, len(contents.Keys))
+	for i := range contents.Keys {
+		key, err := rs.prepareKey(&contents.Keys[i], keyWrapCipher, onConflict)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to restore key %s", contents.Keys[i].Attributes.ID)
+		}
+		if key != nil {
+			keys = append(keys, key)
+		}
+	}
+
+	journal := &restoreJournal{}
+	restored, err := rs.restoreRecords(contents, keys, onConflict, journal)
+	if err != nil {
+		log.WithError(err).Error("Restore failed, undoing the restored records")
+		journal.rollback()
+		return errors.Wrap(err, "Restore failed and was rolled back")
+	}
+	skipped := len(contents.Policies) + len(contents.Users) + len(contents.Keys) - restored
+
+	log.Infof("Restored %d records from backup created at %s, skipped %d existing records", restored, contents.CreatedAt, skipped)
+	return nil
+}
+
+// restoreJournal records how to undo every change of a restore, so that a restore that fails
+// partway can be rolled back to the state before the restore
+type restoreJournal struct {
+	undo []func() error
+}
+
+func (j *restoreJournal) record(undo func() error) {
+	j.undo = append(j.undo, undo)
+}
+
+// rollback undoes the recorded changes in reverse order
+func (j *restoreJournal) rollback() {
+	for i := len(j.undo) - 1; i >= 0; i-- {
+		if err := j.undo[i](); err != nil {
+			log.WithError(err).Error("Failed to undo a restored record, the KBS state must be checked")
+		}
+	}
+}
+
+// preparedKey is a key of the archive ready to be restored. Existing holds the key it replaces
+// and existingRequest re-registers the key material of the replaced key on rollback.
+type preparedKey struct {
+	backup          *backupKey
+	request         *model.KeyRequest
+	existing        *model.KeyAttributes
+	existingRequest *model.KeyRequest
+}
+
+// prepareKey unwraps the key material of key and, when key replaces an existing key, reads the
+// key material of the existing key. It returns nil when the existing key is kept.
+func (rs *Restore) prepareKey(key *backupKey, keyWrapCipher *crypt.AeadCipher, onConflict string) (*preparedKey, error) {
+
+	prepared := &preparedKey{backup: key}
+	existing, err := rs.Repository.KeyStore.Retrieve(key.Attributes.ID)
+	if existing != nil {
+		if onConflict == RestoreConflictSkip {
+			return nil, nil
+		}
+		prepared.existing = existing
+		if prepared.existingRequest, err = rs.existingKeyRequest(existing); err != nil {
+			return nil, errors.Wrap(err, "Failed to read the key to replace")
+		}
+	} else if err != nil && err.Error() != directory.RecordNotFound {
+		return nil, errors.Wrap(err, "Failed to read key")
+	}
+
+	// vault transit, pkcs11 and plugin keys are not exported, the key is expected to still exist
+	if key.KeyManagerType == constant.VaultTransitKeyManager || key.KeyManagerType == constant.Pkcs11KeyManager ||
+		key.KeyManagerType == constant.PluginKeyManager {
+		return prepared, nil
+	}
+
+	prepared.request = newKeyRequest(&key.Attributes)
+	if len(key.WrappedKey) > 0 {
+		keyBytes, err := keyWrapCipher.Open(key.WrappedKey, backupKeyAdditionalData(&key.Attributes))
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to unwrap key material")
+		}
+		defer crypt.ZeroizeByteArray(keyBytes)
+		if prepared.request.KeyInfo.KeyData, err = registerKeyData(key.Attributes.Algorithm, keyBytes); err != nil {
+			return nil, err
+		}
+	}
+	return prepared, nil
+}
+
+// existingKeyRequest returns the request that registers the key material of an existing vault or
+// local key again, or nil for keys that are only references to their backend
+func (rs *Restore) existingKeyRequest(key *model.KeyAttributes) (*model.KeyRequest, error) {
+
+	_, backendType, err := rs.KeyManager.Backend(rs.KeyManager.BackendName(key))
+	if err != nil {
+		return nil, err
+	}
+	if backendType != constant.VaultKeyManager && backendType != constant.LocalKeyManager {
+		return nil, nil
+	}
+	keyBytes, err := rs.KeyManager.TransferKey(context.Background(), key)
+	if err != nil {
+		return nil, err
+	}
+	defer crypt.ZeroizeByteArray(keyBytes)
+
+	request := newKeyRequest(key)
+	if request.KeyInfo.KeyData, err = registerKeyData(key.Algorithm, keyBytes); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// restoreRecords writes the key transfer policies, users and keys of the archive, recording every
+// change in journal. It returns the number of restored records.
+func (rs *Restore) restoreRecords(contents *backupContents, keys []*preparedKey, onConflict string, journal *restoreJournal) (int, error) {
+
+	var restored int
+	for i := range contents.Policies {
+		policy := &contents.Policies[i]
+		existing, err := rs.Repository.KeyTransferPolicyStore.Retrieve(policy.ID)
+		if existing != nil {
+			if onConflict == RestoreConflictSkip {
+				continue
+			}
+			if err := rs.Repository.KeyTransferPolicyStore.Delete(policy.ID); err != nil {
+				return restored, errors.Wrapf(err, "Failed to replace key transfer policy %s", policy.ID)
+			}
+			journal.record(func() error {
+				_, err := rs.Repository.KeyTransferPolicyStore.Create(existing)
+				return err
+			})
+		} else if err != nil && err.Error() != directory.RecordNotFound {
+			return restored, errors.Wrapf(err, "Failed to read key transfer policy %s", policy.ID)
+		}
+		if _, err := rs.Repository.KeyTransferPolicyStore.Create(policy); err != nil {
+			return restored, errors.Wrapf(err, "Failed to restore key transfer policy %s", policy.ID)
+		}
+		journal.record(func() error {
+			return rs.Repository.KeyTransferPolicyStore.Delete(policy.ID)
+		})
+		restored++
+	}
+
+	for i := range contents.Users {
+		user := &contents.Users[i]
+		existing, err := rs.conflictingUsers(user)
+		if err != nil {
+			return restored, err
+		}
+		if len(existing) > 0 && onConflict == RestoreConflictSkip {
+			continue
+		}
+		for j := range existing {
+			existingUser := &existing[j]
+			if err := rs.Repository.UserStore.Delete(existingUser.ID); err != nil {
+				return restored, errors.Wrapf(err, "Failed to replace user %s", existingUser.ID)
+			}
+			journal.record(func() error {
+				_, err := rs.Repository.UserStore.Create(existingUser)
+				return err
+			})
+		}
+		if _, err := rs.Repository.UserStore.Create(user); err != nil {
+			return restored, errors.Wrapf(err, "Failed to restore user %s", user.ID)
+		}
+		journal.record(func() error {
+			return rs.Repository.UserStore.Delete(user.ID)
+		})
+		restored++
+	}
+
+	for _, key := range keys {
+		if key.existing != nil {
+			existing := key.existing
+			if err := rs.deleteKey(existing); err != nil {
+				return restored, errors.Wrapf(err, "Failed to replace key %s", existing.ID)
+			}
+			existingRequest := key.existingRequest
+			journal.record(func() error {
+				return rs.registerKey(existing, existingRequest)
+			})
+		}
+		if err := rs.registerKey(&key.backup.Attributes, key.request); err != nil {
+			return restored, errors.Wrapf(err, "Failed to restore key %s", key.backup.Attributes.ID)
+		}
+		restoredKey := key.backup.Attributes
+		journal.record(func() error {
+			return rs.deleteKey(&restoredKey)
+		})
+		restored++
+	}
+	return restored, nil
+}
+
+// openArchive verifies the archive signature and decrypts its contents
+func (rs *Restore) openArchive(r io.Reader) (*backupContents, *crypt.AeadCipher, error) {
+
+	if rs.SignerPublicKey == nil {
+		return nil, nil, errors.New("Signer public key is required to restore a backup")
+	}
+
+	var archive backupArchive
+	if err := json.NewDecoder(r).Decode(&archive); err != nil {
+		return nil, nil, errors.Wrap(err, "Failed to read backup archive")
+	}
+	if archive.Version != backupArchiveVersion {
+		return nil, nil, errors.Errorf("Unsupported backup archive version %d", archive.Version)
+	}
+
+	expectedSigner, err := x509.MarshalPKIXPublicKey(rs.SignerPublicKey)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Failed to marshal signer public key")
+	}
+	if !bytes.Equal(expectedSigner, archive.SignerPublicKey) {
+		return nil, nil, errors.New("Backup archive was not signed by the expected signer")
+	}
+	digest, err := archive.digest()
+	if err != nil {
+		return nil, nil, err
+	}
+	err = rsa.VerifyPSS(rs.SignerPublicKey, crypto.SHA384, digest, archive.Signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Backup archive signature verification failed")
+	}
+
+	archiveCipher, keyWrapCipher, err := newBackupCiphers(&archive.PassphraseKdf, rs.Passphrase)
+	if err != nil {
+		return nil, nil, err
+	}
+	plaintext, err := archiveCipher.Open(archive.Contents, backupArchiveAdditionalData)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Failed to decrypt backup archive, the passphrase may be incorrect")
+	}
+	defer crypt.ZeroizeByteArray(plaintext)
+
+	var contents backupContents
+	if err := json.Unmarshal(plaintext, &contents); err != nil {
+		return nil, nil, errors.Wrap(err, "Failed to unmarshal backup contents")
+	}
+	return &contents, keyWrapCipher, nil
+}
+
+// validateBackupContents checks that every record has an ID, that the backend of every key is
+// configured and that every key refers to a key transfer policy that exists after the restore
+func (rs *Restore) validateBackupContents(contents *backupContents) error {
+
+	policyIDs := map[uuid.UUID]bool{}
+	for _, policy := range contents.Policies {
+		if policy.ID == uuid.Nil {
+			return errors.New("key transfer policy without an ID")
+		}
+		policyIDs[policy.ID] = true
+	}
+	for _, user := range contents.Users {
+		if user.ID == uuid.Nil || user.Username == "" {
+			return errors.New("user without an ID or username")
+		}
+	}
+	for _, key := range contents.Keys {
+		if key.Attributes.ID == uuid.Nil {
+			return errors.New("key without an ID")
+		}
+		backendName := rs.KeyManager.BackendName(&key.Attributes)
+		_, backendType, err := rs.KeyManager.Backend(backendName)
+		if err != nil {
+			return errors.Wrapf(err, "key %s cannot be restored", key.Attributes.ID)
+		}
+		if backendType != key.KeyManagerType {
+			return errors.Errorf("key %s was backed up from a %s backend but backend %s is %s", key.Attributes.ID, key.KeyManagerType, backendName, backendType)
+		}
+		if (backendType == constant.VaultKeyManager || backendType == constant.LocalKeyManager) && len(key.WrappedKey) == 0 {
+			return errors.Errorf("key %s has no key material", key.Attributes.ID)
+		}
+		if backendType == constant.KmipKeyManager && key.Attributes.KmipKeyID == "" {
+			return errors.Errorf("key %s has no kmip key ID", key.Attributes.ID)
+		}
+		policyID := key.Attributes.TransferPolicyId
+		if policyID == uuid.Nil || policyIDs[policyID] {
+			continue
+		}
+		if _, err := rs.Repository.KeyTransferPolicyStore.Retrieve(policyID); err != nil {
+			return errors.Errorf("key %s refers to unknown key transfer policy %s", key.Attributes.ID, policyID)
+		}
+	}
+	return nil
+}
+
+// findConflicts returns a description of every archive record that already exists
+func (rs *Restore) findConflicts(contents *backupContents) ([]string, error) {
+
+	var conflicts []string
+	for _, policy := range contents.Policies {
+		existing, err := rs.Repository.KeyTransferPolicyStore.Retrieve(policy.ID)
+		if err != nil && err.Error() != directory.RecordNotFound {
+			return nil, errors.Wrapf(err, "Failed to read key transfer policy %s", policy.ID)
+		}
+		if existing != nil {
+			conflicts = append(conflicts, "key transfer policy "+policy.ID.String())
+		}
+	}
+	for i := range contents.Users {
+		existing, err := rs.conflictingUsers(&contents.Users[i])
+		if err != nil {
+			return nil, err
+		}
+		if len(existing) > 0 {
+			conflicts = append(conflicts, "user "+contents.Users[i].Username)
+		}
+	}
+	for _, key := range contents.Keys {
+		existing, err := rs.Repository.KeyStore.Retrieve(key.Attributes.ID)
+		if err != nil && err.Error() != directory.RecordNotFound {
+			return nil, errors.Wrapf(err, "Failed to read key %s", key.Attributes.ID)
+		}
+		if existing != nil {
+			conflicts = append(conflicts, "key "+key.Attributes.ID.String())
+		}
+	}
+	return conflicts, nil
+}
+
+// conflictingUsers returns the existing users with the same ID or username as user
+func (rs *Restore) conflictingUsers(user *model.UserInfo) ([]model.UserInfo, error) {
+
+	var conflicting []model.UserInfo
+	existing, err := rs.Repository.UserStore.Retrieve(user.ID)
+	if err != nil && err.Error() != directory.RecordNotFound {
+		return nil, errors.Wrapf(err, "Failed to read user %s", user.ID)
+	}
+	if existing != nil {
+		conflicting = append(conflicting, *existing)
+	}
+
+	sameName, err := rs.Repository.UserStore.Search(&model.UserFilterCriteria{Username: user.Username})
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to search for user %s", user.Username)
+	}
+	for _, u := range sameName {
+		if u.ID != user.ID {
+			conflicting = append(conflicting, u)
+		}
+	}
+	return conflicting, nil
+}
+
+func (rs *Restore) deleteKey(key *model.KeyAttributes) error {
+
+	// kmip, vault transit, pkcs11 and plugin keys are only references, the key on the backend is kept
+	_, backendType, err := rs.KeyManager.Backend(rs.KeyManager.BackendName(key))
+	if err != nil {
+		return err
+	}
+	if backendType == constant.VaultKeyManager || backendType == constant.LocalKeyManager {
+		if err := rs.KeyManager.DeleteKey(context.Background(), key); err != nil {
+			return err
+		}
+	}
+	return rs.Repository.KeyStore.Delete(key.ID)
+}
+
+// newKeyRequest returns the request that registers a key with its attributes under its ID
+func newKeyRequest(attributes *model.KeyAttributes) *model.KeyRequest {
+	return &model.KeyRequest{
+		KeyId: attributes.ID,
+		KeyInfo: &model.KeyInfo{
+			Algorithm:   attributes.Algorithm,
+			KeyLength:   attributes.KeyLength,
+			CurveType:   attributes.CurveType,
+			KmipKeyID:   attributes.KmipKeyID,
+			KeyEncoding: attributes.KeyEncoding,
+		},
+		TransferPolicyID: attributes.TransferPolicyId,
+		KeyManager:       attributes.KeyManager,
+	}
+}
+
+// registerKey registers the key material of request with the key manager under the original ID of
+// the key and stores its record. Keys without a request are only references to their backend and
+// just their record is stored.
+func (rs *Restore) registerKey(attributes *model.KeyAttributes, request *model.KeyRequest) error {
+
+	if request == nil {
+		keyAttributes := *attributes
+		_, err := rs.Repository.KeyStore.Create(&keyAttributes)
+		return err
+	}
+
+	keyAttributes, err := rs.KeyManager.RegisterKey(context.Background(), request)
+	if err != nil {
+		return err
+	}
+	keyAttributes.TransferLink = attributes.TransferLink
+	keyAttributes.ContentType = attributes.ContentType
+	keyAttributes.CreatedAt = attributes.CreatedAt
+	_, err = rs.Repository.KeyStore.Create(keyAttributes)
+	return err
+}
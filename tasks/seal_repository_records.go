@@ -0,0 +1,57 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package tasks
+
+import (
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"intel/kbs/v1/constant"
+	"intel/kbs/v1/repository/directory"
+)
+
+type SealRepositoryRecords struct {
+	BasePath string
+	Sealer   directory.RecordSealer
+}
+
+var recordDirs = map[string]string{
+	directory.KeyRecordKind:               constant.KeysDir,
+	directory.KeyTransferPolicyRecordKind: constant.KeysTransferPolicyDir,
+	directory.UserRecordKind:              constant.UserDir,
+}
+
+// SealRepositoryRecords seals the plaintext records written before repository encryption was enabled
+func (srr *SealRepositoryRecords) SealRepositoryRecords() error {
+	log.Info("Sealing plaintext repository records")
+
+	for kind, dir := range recordDirs {
+		count, err := directory.SealRecords(srr.BasePath+dir, kind, srr.Sealer)
+		if err != nil {
+			return errors.Wrapf(err, "Error while sealing %s records", kind)
+		}
+		if count > 0 {
+			log.Infof("Sealed %d plaintext %s records", count, kind)
+		}
+	}
+	return nil
+}
+
+// CheckRecordsSealed fails when plaintext records written before repository encryption was
+// enabled are left, since they cannot be read once records are sealed
+func (srr *SealRepositoryRecords) CheckRecordsSealed() error {
+	for kind, dir := range recordDirs {
+		count, err := directory.CountUnsealedRecords(srr.BasePath + dir)
+		if err != nil {
+			return errors.Wrapf(err, "Error while checking %s records", kind)
+		}
+		if count > 0 {
+			return errors.Errorf("Found %d plaintext %s records written before repository encryption was enabled, "+
+				"set REPOSITORY_ENCRYPTION_SEAL_EXISTING_RECORDS=true to seal them on start", count, kind)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package tasks
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/onsi/gomega"
+	"intel/kbs/v1/constant"
+	"intel/kbs/v1/crypt"
+	"intel/kbs/v1/model"
+	"intel/kbs/v1/repository"
+)
+
+func newTestRepositoryDir(t *testing.T) string {
+	basePath := t.TempDir() + "/"
+	for _, dir := range []string{constant.KeysDir, constant.KeysTransferPolicyDir, constant.UserDir} {
+		if err := os.MkdirAll(basePath+dir, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return basePath
+}
+
+func TestSealRepositoryRecords(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	basePath := newTestRepositoryDir(t)
+
+	// records written before encryption was enabled
+	plainRepo := repository.NewDirectoryRepository(basePath, nil)
+	user, err := plainRepo.UserStore.Create(&model.UserInfo{Username: "testAdmin"})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	sealer, err := crypt.NewAeadCipher(make([]byte, 32))
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	sealedRepo := repository.NewDirectoryRepository(basePath, sealer)
+	_, err = sealedRepo.UserStore.Retrieve(user.ID)
+	g.Expect(err).To(gomega.HaveOccurred())
+
+	srr := SealRepositoryRecords{
+		BasePath: basePath,
+		Sealer:   sealer,
+	}
+	err = srr.CheckRecordsSealed()
+	g.Expect(err).To(gomega.HaveOccurred())
+	g.Expect(err.Error()).To(gomega.ContainSubstring("REPOSITORY_ENCRYPTION_SEAL_EXISTING_RECORDS"))
+
+	err = srr.SealRepositoryRecords()
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(srr.CheckRecordsSealed()).To(gomega.Succeed())
+
+	sealedUser, err := sealedRepo.UserStore.Retrieve(user.ID)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(sealedUser.Username).To(gomega.Equal("testAdmin"))
+
+	// sealing again must leave sealed records untouched
+	err = srr.SealRepositoryRecords()
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	_, err = sealedRepo.UserStore.Retrieve(user.ID)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+}
+
+func TestSealedRecordTamperDetection(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	basePath := newTestRepositoryDir(t)
+
+	sealer, err := crypt.NewAeadCipher(make([]byte, 32))
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	repo := repository.NewDirectoryRepository(basePath, sealer)
+
+	first, err := repo.KeyStore.Create(&model.KeyAttributes{ID: uuid.New(), Algorithm: "AES", KeyLength: 256})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	second, err := repo.KeyStore.Create(&model.KeyAttributes{ID: uuid.New(), Algorithm: "AES", KeyLength: 128})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	// flipping a bit of the ciphertext must be detected
+	firstPath := filepath.Join(basePath+constant.KeysDir, first.ID.String())
+	data, err := os.ReadFile(firstPath)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	data[len(data)-1] ^= 0x01
+	g.Expect(os.WriteFile(firstPath, data, 0600)).To(gomega.Succeed())
+	_, err = repo.KeyStore.Retrieve(first.ID)
+	g.Expect(err).To(gomega.HaveOccurred())
+
+	// a valid record copied over another record must be detected
+	data, err = os.ReadFile(filepath.Join(basePath+constant.KeysDir, second.ID.String()))
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(os.WriteFile(firstPath, data, 0600)).To(gomega.Succeed())
+	_, err = repo.KeyStore.Retrieve(first.ID)
+	g.Expect(err).To(gomega.HaveOccurred())
+
+	// a plaintext record must be rejected
+	g.Expect(os.WriteFile(firstPath, []byte(`{"id":"`+first.ID.String()+`","algorithm":"AES"}`), 0600)).To(gomega.Succeed())
+	_, err = repo.KeyStore.Retrieve(first.ID)
+	g.Expect(err).To(gomega.HaveOccurred())
+
+	_, err = repo.KeyStore.Retrieve(second.ID)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+}
@@ -0,0 +1,121 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package http
+
+import (
+	"context"
+	"net/http"
+
+	"intel/kbs/v1/constant"
+	"intel/kbs/v1/model"
+	"intel/kbs/v1/service"
+
+	"github.com/go-kit/kit/endpoint"
+	httpTransport "github.com/go-kit/kit/transport/http"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+func setDataKeyHandler(svc service.Service, router *mux.Router, options []httpTransport.ServerOption, authz *model.JwtAuthz) error {
+
+	keyIdExpr := "/keys/" + idReg
+
+	generateDataKeyHandler := httpTransport.NewServer(
+		makeGenerateDataKeyHTTPEndpoint(svc),
+		decodeGenerateDataKeyHTTPRequest,
+		encodeDataKeyHTTPResponse,
+		options...,
+	)
+
+	router.Handle(keyIdExpr+"/datakey", generateDataKeyHandler).Methods(http.MethodPost)
+
+	decryptDataKeyHandler := httpTransport.NewServer(
+		makeDecryptDataKeyHTTPEndpoint(svc),
+		decodeDecryptDataKeyHTTPRequest,
+		encodeDataKeyHTTPResponse,
+		options...,
+	)
+
+	router.Handle(keyIdExpr+"/datakey/decrypt", decryptDataKeyHandler).Methods(http.MethodPost)
+
+	return nil
+}
+
+func makeGenerateDataKeyHTTPEndpoint(svc service.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(service.DataKeyRequest)
+		return svc.GenerateDataKey(ctx, req)
+	}
+}
+
+func makeDecryptDataKeyHTTPEndpoint(svc service.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(service.DataKeyRequest)
+		return svc.DecryptDataKey(ctx, req)
+	}
+}
+
+func decodeGenerateDataKeyHTTPRequest(_ context.Context, r *http.Request) (interface{}, error) {
+
+	if r.Header.Get(constant.HTTPHeaderKeyAccept) != constant.HTTPHeaderValueApplicationJson {
+		log.Error(ErrInvalidAcceptHeader.Error())
+		return nil, ErrInvalidAcceptHeader
+	}
+
+	var dataKeyReq model.DataKeyRequest
+	req, err := decodeAttestedHTTPRequest(r, &dataKeyReq, &dataKeyReq.KeyTransferRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	if dataKeyReq.KeyLength != 0 && !allowedAESKeyLengths[dataKeyReq.KeyLength] {
+		log.Errorf("Invalid data key length %d", dataKeyReq.KeyLength)
+		return nil, ErrInvalidRequest
+	}
+
+	return service.DataKeyRequest{TransferKeyRequest: req, KeyLength: dataKeyReq.KeyLength}, nil
+}
+
+func decodeDecryptDataKeyHTTPRequest(_ context.Context, r *http.Request) (interface{}, error) {
+
+	if r.Header.Get(constant.HTTPHeaderKeyAccept) != constant.HTTPHeaderValueApplicationJson {
+		log.Error(ErrInvalidAcceptHeader.Error())
+		return nil, ErrInvalidAcceptHeader
+	}
+
+	var decryptReq model.DataKeyDecryptRequest
+	req, err := decodeAttestedHTTPRequest(r, &decryptReq, &decryptReq.KeyTransferRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	// the ciphertext is not needed to request a verifier nonce
+	if r.ContentLength != 0 && len(decryptReq.Ciphertext) == 0 {
+		log.Error("Data key ciphertext is missing in the request")
+		return nil, ErrInvalidRequest
+	}
+
+	return service.DataKeyRequest{TransferKeyRequest: req, Ciphertext: decryptReq.Ciphertext}, nil
+}
+
+func encodeDataKeyHTTPResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	resp := response.(*service.TransferKeyResponse)
+
+	header := w.Header()
+	header.Set(constant.HTTPHeaderKeyContentType, constant.HTTPHeaderValueApplicationJson)
+	header.Set(constant.HTTPHeaderKeyAttestationType, resp.AttestationType)
+	w.WriteHeader(http.StatusOK)
+
+	if resp.KeyTransferResponse == nil {
+		return encodeJsonResponse(ctx, w, resp.Nonce)
+	}
+
+	return encodeJsonResponse(ctx, w, &model.DataKeyResponse{
+		KeyTransferResponse: resp.KeyTransferResponse,
+		Ciphertext:          resp.Ciphertext,
+	})
+}
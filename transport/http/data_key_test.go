@@ -0,0 +1,75 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"intel/kbs/v1/model"
+	"intel/kbs/v1/service"
+
+	"github.com/google/uuid"
+	"github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestDataKeyHandler(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	resp := &service.TransferKeyResponse{
+		KeyTransferResponse: &model.KeyTransferResponse{WrappedKey: []byte("wrapped-key"), WrappedSWK: []byte("wrapped-swk")},
+		Ciphertext:          []byte("ciphertext"),
+	}
+
+	mockService := &MockService{}
+	mockService.On("GenerateDataKey", mock.Anything, mock.Anything).Return(resp, nil)
+	mockService.On("DecryptDataKey", mock.Anything, mock.Anything).Return(resp, nil)
+	handler := createMockHandler(mockService)
+
+	keyUrl := "/kbs/v1/keys/" + uuid.New().String()
+	tests := []struct {
+		name   string
+		url    string
+		body   string
+		accept string
+		code   int
+	}{
+		{"generate", keyUrl + "/datakey", `{"attestation_token": "token", "key_length": 128}`, HTTPMediaTypeJson, http.StatusOK},
+		{"generate nonce", keyUrl + "/datakey", "", HTTPMediaTypeJson, http.StatusOK},
+		{"generate invalid key length", keyUrl + "/datakey", `{"attestation_token": "token", "key_length": 64}`, HTTPMediaTypeJson, http.StatusBadRequest},
+		{"generate invalid accept", keyUrl + "/datakey", `{"attestation_token": "token"}`, "application/jose", http.StatusUnsupportedMediaType},
+		{"decrypt", keyUrl + "/datakey/decrypt", `{"attestation_token": "token", "ciphertext": "Y2lwaGVydGV4dA=="}`, HTTPMediaTypeJson, http.StatusOK},
+		{"decrypt without ciphertext", keyUrl + "/datakey/decrypt", `{"attestation_token": "token"}`, HTTPMediaTypeJson, http.StatusBadRequest},
+		{"decrypt unknown field", keyUrl + "/datakey/decrypt", `{"attestation_token": "token", "ciphertext": "Y2lwaGVydGV4dA==", "key_length": 128}`, HTTPMediaTypeJson, http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		req, _ := http.NewRequest(http.MethodPost, test.url, bytes.NewReader([]byte(test.body)))
+		req.Header.Set("Accept", test.accept)
+		req.Header.Set("Content-type", HTTPMediaTypeJson)
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+
+		res := recorder.Result()
+		data, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(recorder.Code).To(gomega.Equal(test.code), test.name)
+
+		if test.code == http.StatusOK && test.body != "" {
+			var dataKeyResp model.DataKeyResponse
+			g.Expect(json.Unmarshal(data, &dataKeyResp)).To(gomega.Succeed())
+			g.Expect(dataKeyResp.WrappedKey).To(gomega.Equal(resp.KeyTransferResponse.WrappedKey))
+			g.Expect(dataKeyResp.Ciphertext).To(gomega.Equal(resp.Ciphertext))
+		}
+	}
+}
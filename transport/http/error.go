@@ -22,4 +22,5 @@ var (
 	ErrInvalidQueryParam        = errors.New("Invalid query parameter provided. Refer to API doc for details.")
 	ErrInvalidFilterCriteria    = errors.New("Invalid filter criteria")
 	ErrInvalidAttestationType   = errors.New("Invalid attestion type header")
+	ErrInvalidEnvelopeVersion   = errors.New("Invalid envelope version header")
 )
@@ -39,6 +39,8 @@ func NewHTTPHandler(svc service.Service, conf *config.Configuration, jwtAuthz *m
 			setKeyHandler,
 			setKeyTransferPolicyHandler,
 			setKeyTransferHandler,
+			setDataKeyHandler,
+			setSecretHandler,
 			setCreateAuthTokenHandler,
 			setUserHandler,
 		}
@@ -89,7 +91,7 @@ func errorEncoder(_ context.Context, err error, w http.ResponseWriter) {
 
 func errToCode(err error) int {
 	switch err {
-	case ErrInvalidRequest, ErrJsonDecodeFailed, ErrEmptyRequestBody, ErrReadRequestFailed, ErrTooManyQueryParams, ErrInvalidQueryParam, ErrInvalidFilterCriteria, ErrBase64DecodeFailed, ErrInvalidAttestationType:
+	case ErrInvalidRequest, ErrJsonDecodeFailed, ErrEmptyRequestBody, ErrReadRequestFailed, ErrTooManyQueryParams, ErrInvalidQueryParam, ErrInvalidFilterCriteria, ErrBase64DecodeFailed, ErrInvalidAttestationType, ErrInvalidEnvelopeVersion:
 		return http.StatusBadRequest
 	case ErrInvalidContentTypeHeader, ErrInvalidAcceptHeader:
 		return http.StatusUnsupportedMediaType
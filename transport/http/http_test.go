@@ -73,6 +73,11 @@ func (svc *MockService) RetrieveKey(ctx context.Context, keyId uuid.UUID) (inter
 	return args.Get(0).(interface{}), args.Error(1)
 }
 
+func (svc *MockService) RetrievePublicKey(ctx context.Context, keyId uuid.UUID) (*service.PublicKeyResponse, error) {
+	args := svc.Called(ctx)
+	return args.Get(0).(*service.PublicKeyResponse), args.Error(1)
+}
+
 func (svc *MockService) GetVersion(ctx context.Context) (*version.ServiceVersion, error) {
 	args := svc.Called(ctx)
 	return args.Get(0).(*version.ServiceVersion), args.Error(1)
@@ -93,11 +98,61 @@ func (svc *MockService) TransferKeyWithEvidence(ctx context.Context, req service
 	return args.Get(0).(*service.TransferKeyResponse), args.Error(1)
 }
 
+func (svc *MockService) GenerateDataKey(ctx context.Context, req service.DataKeyRequest) (*service.TransferKeyResponse, error) {
+	args := svc.Called(ctx)
+	return args.Get(0).(*service.TransferKeyResponse), args.Error(1)
+}
+
+func (svc *MockService) DecryptDataKey(ctx context.Context, req service.DataKeyRequest) (*service.TransferKeyResponse, error) {
+	args := svc.Called(ctx)
+	return args.Get(0).(*service.TransferKeyResponse), args.Error(1)
+}
+
 func (svc *MockService) SearchKeys(ctx context.Context, filter *model.KeyFilterCriteria) ([]*model.KeyResponse, error) {
 	args := svc.Called(ctx)
 	return args.Get(0).([]*model.KeyResponse), args.Error(1)
 }
 
+func (svc *MockService) DiscoverKmipKeys(ctx context.Context, criteria *model.KmipObjectFilterCriteria) ([]*model.KmipObject, error) {
+	args := svc.Called(ctx, criteria)
+	return args.Get(0).([]*model.KmipObject), args.Error(1)
+}
+
+func (svc *MockService) CreateSecret(ctx context.Context, req model.SecretRequest) (*model.SecretResponse, error) {
+	args := svc.Called(ctx)
+	return args.Get(0).(*model.SecretResponse), args.Error(1)
+}
+
+func (svc *MockService) SearchSecrets(ctx context.Context, filter *model.SecretFilterCriteria) ([]*model.SecretResponse, error) {
+	args := svc.Called(ctx, filter)
+	return args.Get(0).([]*model.SecretResponse), args.Error(1)
+}
+
+func (svc *MockService) DeleteSecret(ctx context.Context, secretId uuid.UUID) (interface{}, error) {
+	args := svc.Called(ctx)
+	return args.Get(0).(interface{}), args.Error(1)
+}
+
+func (svc *MockService) UpdateSecret(ctx context.Context, request model.SecretUpdateRequest) (*model.SecretResponse, error) {
+	args := svc.Called(ctx)
+	return args.Get(0).(*model.SecretResponse), args.Error(1)
+}
+
+func (svc *MockService) RetrieveSecret(ctx context.Context, secretId uuid.UUID) (interface{}, error) {
+	args := svc.Called(ctx)
+	return args.Get(0).(interface{}), args.Error(1)
+}
+
+func (svc *MockService) TransferSecret(ctx context.Context, req service.TransferKeyRequest) (*service.TransferKeyResponse, error) {
+	args := svc.Called(ctx)
+	return args.Get(0).(*service.TransferKeyResponse), args.Error(1)
+}
+
+func (svc *MockService) TransferSecretWithEvidence(ctx context.Context, req service.TransferKeyRequest) (*service.TransferKeyResponse, error) {
+	args := svc.Called(ctx)
+	return args.Get(0).(*service.TransferKeyResponse), args.Error(1)
+}
+
 func (svc *MockService) CreateUser(ctx context.Context, user *model.User) (*model.UserResponse, error) {
 	args := svc.Called(ctx)
 	return args.Get(0).(*model.UserResponse), args.Error(1)
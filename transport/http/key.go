@@ -8,10 +8,11 @@ package http
 
 import (
 	"context"
-	"crypto/rsa"
 	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
 	"io"
+	"mime"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -35,13 +36,36 @@ const (
 	KeyLength        = "keyLength"
 	CurveType        = "curveType"
 	TransferPolicyId = "transferPolicyId"
+	KeyManager       = "keyManager"
+	Name             = "name"
 )
 
 var (
-	allowedAlgorithms    = map[string]bool{"AES": true, "RSA": true, "EC": true, "aes": true, "rsa": true, "ec": true}
-	allowedCurveTypes    = map[string]bool{"secp256r1": true, "secp384r1": true, "secp521r1": true, "prime256v1": true}
-	allowedAESKeyLengths = map[int]bool{128: true, 192: true, 256: true}
-	allowedRSAKeyLengths = map[int]bool{2048: true, 3072: true, 4096: true, 7680: true}
+	allowedAlgorithms = map[string]bool{"AES": true, "RSA": true, "EC": true, "HMAC": true, "CHACHA20": true, "ED25519": true, "X25519": true,
+		"aes": true, "rsa": true, "ec": true, "hmac": true, "chacha20": true, "ed25519": true, "x25519": true}
+	allowedCurveTypes         = map[string]bool{"secp256r1": true, "secp384r1": true, "secp521r1": true, "prime256v1": true, constant.CurveSecp256k1: true}
+	allowedAESKeyLengths      = map[int]bool{128: true, 192: true, 256: true}
+	allowedRSAKeyLengths      = map[int]bool{2048: true, 3072: true, 4096: true, 7680: true}
+	allowedHMACKeyLengths     = map[int]bool{256: true, 384: true}
+	allowedChaCha20KeyLengths = map[int]bool{256: true}
+	allowedKeyEncodings       = map[string]map[string]bool{
+		constant.CRYPTOALGAES:      {model.KeyEncodingRaw: true, model.KeyEncodingJWK: true},
+		constant.CRYPTOALGHMAC:     {model.KeyEncodingRaw: true, model.KeyEncodingJWK: true},
+		constant.CRYPTOALGCHACHA20: {model.KeyEncodingRaw: true, model.KeyEncodingJWK: true},
+		constant.CRYPTOALGRSA:      {model.KeyEncodingPKCS1: true, model.KeyEncodingPKCS8: true, model.KeyEncodingJWK: true},
+		constant.CRYPTOALGEC:       {model.KeyEncodingSEC1: true, model.KeyEncodingPKCS8: true, model.KeyEncodingJWK: true},
+		constant.CRYPTOALGED25519:  {model.KeyEncodingPKCS8: true, model.KeyEncodingJWK: true},
+		constant.CRYPTOALGX25519:   {model.KeyEncodingPKCS8: true, model.KeyEncodingJWK: true},
+	}
+	// algorithms of the keys that can be discovered on a KMIP server
+	allowedKmipAlgorithms = map[string]bool{constant.CRYPTOALGAES: true, constant.CRYPTOALGRSA: true, constant.CRYPTOALGEC: true,
+		constant.CRYPTOALGHMAC: true, constant.CRYPTOALGCHACHA20: true}
+	// symmetric key lengths by algorithm, key_data of these algorithms is the key value
+	allowedSymmetricKeyLengths = map[string]map[int]bool{
+		constant.CRYPTOALGAES:      allowedAESKeyLengths,
+		constant.CRYPTOALGHMAC:     allowedHMACKeyLengths,
+		constant.CRYPTOALGCHACHA20: allowedChaCha20KeyLengths,
+	}
 )
 
 func setKeyHandler(svc service.Service, router *mux.Router, options []httpTransport.ServerOption, auth *model.JwtAuthz) error {
@@ -83,6 +107,15 @@ func setKeyHandler(svc service.Service, router *mux.Router, options []httpTransp
 
 	router.Handle("/keys", authMiddleware(searchKeysHandler, auth)).Methods(http.MethodGet)
 
+	discoverKmipKeysHandler := httpTransport.NewServer(
+		makeDiscoverKmipKeysEndpoint(svc),
+		decodeDiscoverKmipKeysHTTPRequest,
+		encodeDiscoverKmipKeysHTTPResponse,
+		options...,
+	)
+
+	router.Handle("/keys/kmip-objects", authMiddleware(discoverKmipKeysHandler, auth)).Methods(http.MethodGet)
+
 	updateKeyHandler := httpTransport.NewServer(
 		makeUpdateKeyEndpoint(svc),
 		decodeUpdateKeyHTTPRequest,
@@ -101,6 +134,15 @@ func setKeyHandler(svc service.Service, router *mux.Router, options []httpTransp
 
 	router.Handle(keyIdExpr, authMiddleware(transferKeyHandler, auth)).Methods(http.MethodPost)
 
+	getPublicKeyHandler := httpTransport.NewServer(
+		makeRetrievePublicKeyEndpoint(svc),
+		decodeRetrievePublicKeyHTTPRequest,
+		encodeRetrievePublicKeyHTTPResponse,
+		append(options, httpTransport.ServerBefore(httpTransport.PopulateRequestContext))...,
+	)
+
+	router.Handle(keyIdExpr+"/public-key", authMiddleware(getPublicKeyHandler, auth)).Methods(http.MethodGet)
+
 	return nil
 }
 
@@ -118,6 +160,13 @@ func makeSearchKeysEndpoint(svc service.Service) endpoint.Endpoint {
 	}
 }
 
+func makeDiscoverKmipKeysEndpoint(svc service.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		criteria := request.(*model.KmipObjectFilterCriteria)
+		return svc.DiscoverKmipKeys(ctx, criteria)
+	}
+}
+
 func makeDeleteKeyEndpoint(svc service.Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		id := request.(uuid.UUID)
@@ -132,6 +181,13 @@ func makeRetrieveKeyEndpoint(svc service.Service) endpoint.Endpoint {
 	}
 }
 
+func makeRetrievePublicKeyEndpoint(svc service.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		id := request.(uuid.UUID)
+		return svc.RetrievePublicKey(ctx, id)
+	}
+}
+
 func makeUpdateKeyEndpoint(svc service.Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		req := request.(model.KeyUpdateRequest)
@@ -192,6 +248,35 @@ func decodeRetrieveHTTPRequest(_ context.Context, r *http.Request) (interface{},
 	return id, nil
 }
 
+func decodeRetrievePublicKeyHTTPRequest(_ context.Context, r *http.Request) (interface{}, error) {
+
+	if _, err := publicKeyMediaType(r.Header.Get(constant.HTTPHeaderKeyAccept)); err != nil {
+		log.Error(ErrInvalidAcceptHeader.Error())
+		return nil, ErrInvalidAcceptHeader
+	}
+
+	id := uuid.MustParse(mux.Vars(r)["id"])
+	return id, nil
+}
+
+// publicKeyMediaType returns the first media type of the Accept header a public key can be
+// encoded in: PEM, DER or JWK. application/json is answered with the JWK.
+func publicKeyMediaType(accept string) (string, error) {
+
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case constant.HTTPHeaderValueApplicationXPEMFile, constant.HTTPHeaderValueApplicationOctet,
+			constant.HTTPHeaderValueApplicationJwkJson, constant.HTTPHeaderValueApplicationJson:
+			return mediaType, nil
+		}
+	}
+	return "", ErrInvalidAcceptHeader
+}
+
 func decodeDeleteHTTPRequest(_ context.Context, r *http.Request) (interface{}, error) {
 
 	id := uuid.MustParse(mux.Vars(r)["id"])
@@ -262,6 +347,36 @@ func decodeSearchKeysHTTPRequest(_ context.Context, r *http.Request) (interface{
 	return criteria, nil
 }
 
+func decodeDiscoverKmipKeysHTTPRequest(_ context.Context, r *http.Request) (interface{}, error) {
+
+	if r.Header.Get(constant.HTTPHeaderKeyAccept) != constant.HTTPHeaderValueApplicationJson {
+		log.Error(ErrInvalidAcceptHeader.Error())
+		return nil, ErrInvalidAcceptHeader
+	}
+
+	queryKeys := map[string]bool{
+		KeyManager: true,
+		Name:       true,
+		Algorithm:  true,
+		KeyLength:  true,
+	}
+
+	// all keys are listed when no filter is given
+	queryValues := r.URL.Query()
+	if len(queryValues) > 0 {
+		if err := ValidateQueryParamKeys(queryValues, queryKeys); err != nil {
+			return nil, err
+		}
+	}
+
+	criteria, err := getKmipObjectFilterCriteria(queryValues)
+	if err != nil {
+		log.WithError(err).Error(ErrInvalidFilterCriteria.Error())
+		return nil, ErrInvalidFilterCriteria
+	}
+	return criteria, nil
+}
+
 func decodeTransferHTTPRequest(_ context.Context, r *http.Request) (interface{}, error) {
 
 	if r.Header.Get(constant.HTTPHeaderKeyContentType) != constant.HTTPHeaderValueApplicationXPEMFile {
@@ -294,10 +409,14 @@ func decodeTransferHTTPRequest(_ context.Context, r *http.Request) (interface{},
 		log.WithError(err).Error(ErrInvalidRequest.Error())
 		return nil, ErrInvalidRequest
 	}
+	if err := crypt.CheckWrappingPublicKey(key); err != nil {
+		log.WithError(err).Error(ErrInvalidRequest.Error())
+		return nil, ErrInvalidRequest
+	}
 
 	req := service.TransferKeyRequest{
 		KeyId:     id,
-		PublicKey: key.(*rsa.PublicKey),
+		PublicKey: key,
 	}
 
 	return req, nil
@@ -321,6 +440,45 @@ func encodeRetrieveHTTPResponse(ctx context.Context, w http.ResponseWriter, resp
 	return encodeJsonResponse(ctx, w, response)
 }
 
+func encodeRetrievePublicKeyHTTPResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	resp := response.(*service.PublicKeyResponse)
+
+	accept, _ := ctx.Value(httpTransport.ContextKeyRequestAccept).(string)
+	contentType, err := publicKeyMediaType(accept)
+	if err != nil {
+		return err
+	}
+
+	var body []byte
+	switch contentType {
+	case constant.HTTPHeaderValueApplicationXPEMFile, constant.HTTPHeaderValueApplicationOctet:
+		publicKeyDer, err := crypt.MarshalPKIXPublicKey(resp.PublicKey)
+		if err != nil {
+			return errors.Wrap(err, "Failed to marshal public key")
+		}
+		body = publicKeyDer
+		if contentType == constant.HTTPHeaderValueApplicationXPEMFile {
+			body = pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyDer})
+		}
+	default:
+		jwk, err := crypt.NewPublicJwk(resp.PublicKey)
+		if err != nil {
+			return errors.Wrap(err, "Failed to encode public key as JWK")
+		}
+		jwk.KeyID = resp.KeyID.String()
+		body, err = json.Marshal(jwk)
+		if err != nil {
+			return errors.Wrap(err, "Failed to marshal public key JWK")
+		}
+	}
+
+	header := w.Header()
+	header.Set(constant.HTTPHeaderKeyContentType, contentType)
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(body)
+	return err
+}
+
 func encodeDeleteHTTPResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
 	w.WriteHeader(http.StatusNoContent)
 	return encodeJsonResponse(ctx, w, nil)
@@ -336,6 +494,16 @@ func encodeSearchKeysHTTPResponse(ctx context.Context, w http.ResponseWriter, re
 	return encodeJsonResponse(ctx, w, resp)
 }
 
+func encodeDiscoverKmipKeysHTTPResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	resp := response.([]*model.KmipObject)
+
+	header := w.Header()
+	header.Set(constant.HTTPHeaderKeyContentType, constant.HTTPHeaderValueApplicationJson)
+	w.WriteHeader(http.StatusOK)
+
+	return encodeJsonResponse(ctx, w, resp)
+}
+
 func encodeTransferHTTPResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
 	resp := response.(*service.TransferKeyResponse)
 
@@ -356,44 +524,62 @@ func validateKeyCreateRequest(keyCreateReq model.KeyRequest) error {
 		return errors.New("key algorithm is not supported")
 	}
 
-	if strings.ToUpper(algorithm) == constant.CRYPTOALGEC {
+	// EC keys are sized by their curve, Ed25519 and X25519 keys have a fixed size
+	switch strings.ToUpper(algorithm) {
+	case constant.CRYPTOALGEC:
 		if keyCreateReq.KeyInfo.CurveType == "" {
 			return errors.New("curve_type must be provided")
 		} else if !allowedCurveTypes[keyCreateReq.KeyInfo.CurveType] {
 			return errors.New("curve_type is not supported")
 		}
-	}
-
-	if keyCreateReq.KeyInfo.KeyLength == 0 {
-		return errors.New("Key length is missing")
-	}
-
-	if strings.ToUpper(algorithm) == constant.CRYPTOALGAES {
-		if !allowedAESKeyLengths[keyCreateReq.KeyInfo.KeyLength] {
+	case constant.CRYPTOALGED25519, constant.CRYPTOALGX25519:
+	case constant.CRYPTOALGRSA:
+		if keyCreateReq.KeyInfo.KeyLength == 0 {
+			return errors.New("Key length is missing")
+		} else if !allowedRSAKeyLengths[keyCreateReq.KeyInfo.KeyLength] {
 			return errors.New("key_length is not supported")
 		}
-	} else {
-		if !allowedRSAKeyLengths[keyCreateReq.KeyInfo.KeyLength] {
+	default:
+		if keyCreateReq.KeyInfo.KeyLength == 0 {
+			return errors.New("Key length is missing")
+		} else if !allowedSymmetricKeyLengths[strings.ToUpper(algorithm)][keyCreateReq.KeyInfo.KeyLength] {
 			return errors.New("key_length is not supported")
 		}
 	}
 
+	keyEncoding := keyCreateReq.KeyInfo.KeyEncoding
+	if keyEncoding != "" && !allowedKeyEncodings[strings.ToUpper(algorithm)][keyEncoding] {
+		return errors.New("key_encoding is not supported for the key algorithm")
+	}
+
 	keyData := keyCreateReq.KeyInfo.KeyData
 	kmipKeyID := keyCreateReq.KeyInfo.KmipKeyID
 	if keyData != "" {
 		decodedKey, err := base64.StdEncoding.DecodeString(keyData)
 		if err != nil {
-			return errors.New("key_data must be base64 encoded string for AES key and the private key in PEM format for RSA/EC keys")
+			return errors.New("key_data must be base64 encoded string for AES, HMAC and ChaCha20 keys and the private key in PEM format for RSA, EC, Ed25519 and X25519 keys")
 		}
 		if strings.ToUpper(algorithm) == constant.CRYPTOALGAES && !allowedAESKeyLengths[len(decodedKey)*8] {
 			return errors.New("key_data must be base64 encoded string for AES key of 256, 192 or 128 bits")
 		}
+		if strings.ToUpper(algorithm) == constant.CRYPTOALGHMAC && !allowedHMACKeyLengths[len(decodedKey)*8] {
+			return errors.New("key_data must be base64 encoded string for HMAC key of 256 or 384 bits")
+		}
+		if strings.ToUpper(algorithm) == constant.CRYPTOALGCHACHA20 && !allowedChaCha20KeyLengths[len(decodedKey)*8] {
+			return errors.New("key_data must be base64 encoded string for ChaCha20 key of 256 bits")
+		}
 	} else if kmipKeyID != "" {
 		if err := ValidateStrings([]string{kmipKeyID}); err != nil {
 			return errors.New("kmip_key_id must be a valid string")
 		}
 	}
 
+	if keyCreateReq.KeyManager != "" {
+		if err := ValidateStrings([]string{keyCreateReq.KeyManager}); err != nil {
+			return errors.New("key_manager must be a valid string")
+		}
+	}
+
 	return nil
 }
 
@@ -416,7 +602,7 @@ func getKeyFilterCriteria(params url.Values) (*model.KeyFilterCriteria, error) {
 		if err != nil {
 			return nil, errors.Wrap(err, "Invalid keyLength query param value, must be Integer")
 		}
-		if !allowedAESKeyLengths[length] && !allowedRSAKeyLengths[length] {
+		if !allowedAESKeyLengths[length] && !allowedRSAKeyLengths[length] && !allowedHMACKeyLengths[length] {
 			return nil, errors.New("Valid keyLength must be specified")
 		}
 		criteria.KeyLength = length
@@ -440,3 +626,46 @@ func getKeyFilterCriteria(params url.Values) (*model.KeyFilterCriteria, error) {
 	}
 	return &criteria, nil
 }
+
+// getKmipObjectFilterCriteria checks for set filter params in the kmip key discovery request and returns a valid KmipObjectFilterCriteria
+func getKmipObjectFilterCriteria(params url.Values) (*model.KmipObjectFilterCriteria, error) {
+
+	criteria := model.KmipObjectFilterCriteria{}
+
+	// keyManager
+	if param := strings.TrimSpace(params.Get(KeyManager)); param != "" {
+		if err := ValidateStrings([]string{param}); err != nil {
+			return nil, errors.New("Valid keyManager must be specified")
+		}
+		criteria.KeyManager = param
+	}
+
+	// name
+	if param := strings.TrimSpace(params.Get(Name)); param != "" {
+		if len(param) > constant.UserCredsMaxLen || ValidateStrings([]string{param}) != nil {
+			return nil, errors.New("Valid name must be specified")
+		}
+		criteria.Name = param
+	}
+
+	// algorithm
+	if param := strings.TrimSpace(params.Get(Algorithm)); param != "" {
+		if !allowedAlgorithms[param] || !allowedKmipAlgorithms[strings.ToUpper(param)] {
+			return nil, errors.New("Valid algorithm must be specified")
+		}
+		criteria.Algorithm = strings.ToUpper(param)
+	}
+
+	// keyLength
+	if param := strings.TrimSpace(params.Get(KeyLength)); param != "" {
+		length, err := strconv.Atoi(param)
+		if err != nil {
+			return nil, errors.Wrap(err, "Invalid keyLength query param value, must be Integer")
+		}
+		if length <= 0 {
+			return nil, errors.New("Valid keyLength must be specified")
+		}
+		criteria.KeyLength = length
+	}
+	return &criteria, nil
+}
@@ -8,12 +8,23 @@ package http
 
 import (
 	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
 	httpTransport "github.com/go-kit/kit/transport/http"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"github.com/onsi/gomega"
+	"github.com/shaj13/go-guardian/v2/auth"
 	jwtStrategy "github.com/shaj13/go-guardian/v2/auth/strategies/jwt"
 	"github.com/stretchr/testify/mock"
+	"intel/kbs/v1/constant"
 	"intel/kbs/v1/model"
 	"intel/kbs/v1/service"
 	"io"
@@ -21,6 +32,7 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 )
 
 var (
@@ -251,6 +263,30 @@ func TestKeyCreateHandlerInvalidReq(t *testing.T) {
 	res = recorder.Result()
 	defer res.Body.Close()
 
+	_, err = io.ReadAll(res.Body)
+	if err != nil {
+		t.Errorf("expected error to be nil got %v", err)
+	}
+	g.Expect(recorder.Code).To(gomega.Equal(http.StatusBadRequest))
+	keyJson = `{
+		"key_information":{
+                      "algorithm": "AES",
+                      "key_length": 256,
+                      "key_encoding": "pkcs8"
+		}
+        }`
+
+	req, _ = http.NewRequest(http.MethodPost, "/kbs/v1/keys", bytes.NewReader([]byte(keyJson)))
+	req.Header.Set("Accept", HTTPMediaTypeJson)
+	req.Header.Set("Content-type", HTTPMediaTypeJson)
+	req.Header.Set("Authorization", "Bearer "+authToken)
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+
+	res = recorder.Result()
+	defer res.Body.Close()
+
 	_, err = io.ReadAll(res.Body)
 	if err != nil {
 		t.Errorf("expected error to be nil got %v", err)
@@ -294,6 +330,44 @@ func TestKeyCreateHandler(t *testing.T) {
 	g.Expect(recorder.Code).To(gomega.Equal(http.StatusCreated))
 }
 
+func TestKeyCreateHandlerAlgorithms(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	keyCreateRes := &model.KeyResponse{}
+
+	mockService := &MockService{}
+	mockService.On("CreateKey", mock.Anything, mock.Anything).Return(keyCreateRes, nil)
+	handler := createMockHandler(mockService)
+
+	err := setKeyHandler(mockService, mux.NewRouter(), nil, jwtAuth)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	tests := []struct {
+		keyInfo string
+		code    int
+	}{
+		{keyInfo: `{"algorithm": "HMAC", "key_length": 384}`, code: http.StatusCreated},
+		{keyInfo: `{"algorithm": "HMAC", "key_length": 128}`, code: http.StatusBadRequest},
+		{keyInfo: `{"algorithm": "HMAC", "key_length": 256, "key_data": "` + base64.StdEncoding.EncodeToString(make([]byte, 16)) + `"}`, code: http.StatusBadRequest},
+		{keyInfo: `{"algorithm": "CHACHA20", "key_length": 256, "key_encoding": "jwk"}`, code: http.StatusCreated},
+		{keyInfo: `{"algorithm": "CHACHA20", "key_length": 128}`, code: http.StatusBadRequest},
+		{keyInfo: `{"algorithm": "ED25519"}`, code: http.StatusCreated},
+		{keyInfo: `{"algorithm": "ED25519", "key_encoding": "raw"}`, code: http.StatusBadRequest},
+		{keyInfo: `{"algorithm": "X25519", "key_encoding": "pkcs8"}`, code: http.StatusCreated},
+		{keyInfo: `{"algorithm": "EC", "curve_type": "secp256k1"}`, code: http.StatusCreated},
+	}
+	for _, tt := range tests {
+		keyJson := `{"key_information": ` + tt.keyInfo + `}`
+		req, _ := http.NewRequest(http.MethodPost, "/kbs/v1/keys", bytes.NewReader([]byte(keyJson)))
+		req.Header.Set("Accept", HTTPMediaTypeJson)
+		req.Header.Set("Content-type", HTTPMediaTypeJson)
+		req.Header.Set("Authorization", "Bearer "+authToken)
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		g.Expect(recorder.Code).To(gomega.Equal(tt.code), tt.keyInfo)
+	}
+}
+
 func TestKeyCreateValidKeyData(t *testing.T) {
 	g := gomega.NewGomegaWithT(t)
 	keyCreateRes := &model.KeyResponse{}
@@ -472,6 +546,81 @@ func TestKeyRetrieveHandler(t *testing.T) {
 	g.Expect(recorder.Code).To(gomega.Equal(http.StatusOK))
 }
 
+func TestKeyPublicKeyHandler(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	publicKeyDer, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	keyId := uuid.New()
+
+	mockService := &MockService{}
+	mockService.On("RetrievePublicKey", mock.Anything).Return(&service.PublicKeyResponse{KeyID: keyId, PublicKey: &privateKey.PublicKey}, nil)
+	mockService.On("RetrieveKey", mock.Anything, mock.Anything).Return(&model.KeyResponse{}, nil)
+	handler := createMockHandler(mockService)
+
+	// a token granting nothing but the public key retrieval
+	publicKeyToken, err := jwtStrategy.IssueAccessToken(auth.NewUserInfo("verifier", "verifier", nil, nil), jwtAuth.JwtSecretKeeper,
+		jwtStrategy.SetNamedScopes(constant.KeyPublicKey), jwtStrategy.SetExpDuration(time.Minute))
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	// a token granting the key search and retrieval, whose endpoint is a prefix of the public key endpoint
+	searchToken, err := jwtStrategy.IssueAccessToken(auth.NewUserInfo("auditor", "auditor", nil, nil), jwtAuth.JwtSecretKeeper,
+		jwtStrategy.SetNamedScopes(constant.KeySearch), jwtStrategy.SetExpDuration(time.Minute))
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	tests := []struct {
+		name        string
+		path        string
+		accept      string
+		token       string
+		code        int
+		contentType string
+	}{
+		{name: "PEM", path: "/public-key", accept: HTTPMediaTypePem, token: authToken, code: http.StatusOK, contentType: HTTPMediaTypePem},
+		{name: "DER", path: "/public-key", accept: "application/octet-stream", token: authToken, code: http.StatusOK, contentType: "application/octet-stream"},
+		{name: "JWK", path: "/public-key", accept: "application/jwk+json", token: authToken, code: http.StatusOK, contentType: "application/jwk+json"},
+		{name: "first acceptable media type", path: "/public-key", accept: "text/html, application/json", token: authToken, code: http.StatusOK, contentType: HTTPMediaTypeJson},
+		{name: "public key permission", path: "/public-key", accept: HTTPMediaTypePem, token: publicKeyToken, code: http.StatusOK, contentType: HTTPMediaTypePem},
+		{name: "negative test - unsupported accept header", path: "/public-key", accept: "application/jose", token: authToken, code: http.StatusUnsupportedMediaType},
+		{name: "negative test - public key permission does not grant key retrieval", path: "", accept: HTTPMediaTypeJson, token: publicKeyToken, code: http.StatusUnauthorized},
+		{name: "search permission", path: "", accept: HTTPMediaTypeJson, token: searchToken, code: http.StatusOK},
+		{name: "negative test - search permission does not grant public key retrieval", path: "/public-key", accept: HTTPMediaTypePem, token: searchToken, code: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(http.MethodGet, "/kbs/v1/keys/"+keyId.String()+tt.path, nil)
+		req.Header.Set("Accept", tt.accept)
+		req.Header.Set("Authorization", "Bearer "+tt.token)
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+
+		g.Expect(recorder.Code).To(gomega.Equal(tt.code), tt.name)
+		// only the public key responses are checked
+		if tt.code != http.StatusOK || tt.path == "" {
+			continue
+		}
+		g.Expect(recorder.Header().Get("Content-Type")).To(gomega.Equal(tt.contentType), tt.name)
+		body := recorder.Body.Bytes()
+		switch tt.contentType {
+		case HTTPMediaTypePem:
+			block, _ := pem.Decode(body)
+			g.Expect(block).NotTo(gomega.BeNil(), tt.name)
+			g.Expect(block.Type).To(gomega.Equal("PUBLIC KEY"), tt.name)
+			g.Expect(block.Bytes).To(gomega.Equal(publicKeyDer), tt.name)
+		case "application/octet-stream":
+			g.Expect(body).To(gomega.Equal(publicKeyDer), tt.name)
+		default:
+			var jwk map[string]string
+			g.Expect(json.Unmarshal(body, &jwk)).To(gomega.Succeed(), tt.name)
+			g.Expect(jwk["kty"]).To(gomega.Equal("EC"), tt.name)
+			g.Expect(jwk["crv"]).To(gomega.Equal("P-256"), tt.name)
+			g.Expect(jwk["kid"]).To(gomega.Equal(keyId.String()), tt.name)
+			g.Expect(jwk).NotTo(gomega.HaveKey("d"), tt.name)
+		}
+	}
+}
+
 func TestKeyTransferHandlerInvalidContReq(t *testing.T) {
 	g := gomega.NewGomegaWithT(t)
 	keyTransferRes := &service.TransferKeyResponse{}
@@ -636,6 +785,45 @@ func TestKeyTransferInvalidKeyData(t *testing.T) {
 	g.Expect(recorder.Code).To(gomega.Equal(http.StatusBadRequest))
 }
 
+func TestKeyTransferPublicKeyTypes(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	keyTransferRes := &service.TransferKeyResponse{}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	edPublicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	tests := []struct {
+		name       string
+		publicKey  crypto.PublicKey
+		statusCode int
+	}{
+		{name: "EC P-384 key", publicKey: &ecKey.PublicKey, statusCode: http.StatusOK},
+		{name: "Ed25519 key", publicKey: edPublicKey, statusCode: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockService{}
+			mockService.On("TransferKey", mock.Anything, mock.Anything).Return(keyTransferRes, nil)
+			handler := createMockHandler(mockService)
+
+			publicKeyDer, err := x509.MarshalPKIXPublicKey(tt.publicKey)
+			g.Expect(err).NotTo(gomega.HaveOccurred())
+			keyPem := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyDer})
+
+			req, _ := http.NewRequest(http.MethodPost, "/kbs/v1/keys/"+uuid.New().String(), bytes.NewReader(keyPem))
+			req.Header.Set("Accept", HTTPMediaTypeJson)
+			req.Header.Set("Content-type", HTTPMediaTypePem)
+			req.Header.Set("Authorization", "Bearer "+authToken)
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+			g.Expect(recorder.Code).To(gomega.Equal(tt.statusCode))
+		})
+	}
+}
+
 func TestKeyUpdateHandler(t *testing.T) {
 	g := gomega.NewGomegaWithT(t)
 	resp := &model.KeyResponse{}
@@ -822,3 +1010,65 @@ func TestKeyUpdateHandlerInvalidTokenHeader(t *testing.T) {
 	}
 	g.Expect(recorder.Code).To(gomega.Equal(http.StatusUnauthorized))
 }
+
+func TestDiscoverKmipKeysHandler(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	resp := []*model.KmipObject{
+		{
+			KmipKeyID:  "1",
+			KeyManager: "hsm",
+			Names:      []string{"payments-key"},
+			Algorithm:  "AES",
+			KeyLength:  256,
+			State:      "Active",
+		},
+	}
+	criteria := &model.KmipObjectFilterCriteria{KeyManager: "hsm", Name: "payments-key", Algorithm: "AES", KeyLength: 256}
+
+	mockService := &MockService{}
+	mockService.On("DiscoverKmipKeys", mock.Anything, criteria).Return(resp, nil)
+	handler := createMockHandler(mockService)
+
+	req, _ := http.NewRequest(http.MethodGet, "/kbs/v1/keys/kmip-objects", nil)
+	req.Header.Set("Accept", HTTPMediaTypeJson)
+	req.Header.Set("Authorization", "Bearer "+authToken)
+
+	q := req.URL.Query()
+	q.Add(KeyManager, "hsm")
+	q.Add(Name, "payments-key")
+	q.Add(Algorithm, "aes")
+	q.Add(KeyLength, "256")
+	req.URL.RawQuery = q.Encode()
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+
+	res := recorder.Result()
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(recorder.Code).To(gomega.Equal(http.StatusOK))
+
+	var objects []*model.KmipObject
+	g.Expect(json.Unmarshal(data, &objects)).To(gomega.Succeed())
+	g.Expect(objects).To(gomega.Equal(resp))
+}
+
+func TestDiscoverKmipKeysHandlerInvalidQueryParam(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	mockService := &MockService{}
+	handler := createMockHandler(mockService)
+
+	for _, query := range []string{"curveType=secp256r1", "keyLength=-1", "algorithm=DES", "name=a%3Cb"} {
+		req, _ := http.NewRequest(http.MethodGet, "/kbs/v1/keys/kmip-objects?"+query, nil)
+		req.Header.Set("Accept", HTTPMediaTypeJson)
+		req.Header.Set("Authorization", "Bearer "+authToken)
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		g.Expect(recorder.Code).To(gomega.Equal(http.StatusBadRequest), query)
+	}
+	mockService.AssertNotCalled(t, "DiscoverKmipKeys", mock.Anything, mock.Anything)
+}
@@ -9,7 +9,10 @@ package http
 import (
 	"context"
 	"encoding/json"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"intel/kbs/v1/constant"
 	"intel/kbs/v1/model"
@@ -30,7 +33,7 @@ func setKeyTransferHandler(svc service.Service, router *mux.Router, options []ht
 		makeTransferKeyHTTPEndpoint(svc),
 		decodeTransferKeyHTTPRequest,
 		encodeTransferKeyHTTPResponse,
-		options...,
+		append(options, httpTransport.ServerBefore(httpTransport.PopulateRequestContext))...,
 	)
 
 	router.Handle(keyIdExpr+"/transfer", transferKeyHandler).Methods(http.MethodPost)
@@ -49,38 +52,59 @@ func decodeTransferKeyHTTPRequest(_ context.Context, r *http.Request) (interface
 
 	var keyTransferReq model.KeyTransferRequest
 
-	if r.Header.Get(constant.HTTPHeaderKeyAccept) != constant.HTTPHeaderValueApplicationJson {
+	responseFormat, err := transferResponseFormat(r.Header.Get(constant.HTTPHeaderKeyAccept))
+	if err != nil {
 		log.Error(ErrInvalidAcceptHeader.Error())
 		return nil, ErrInvalidAcceptHeader
 	}
 
+	req, err := decodeAttestedHTTPRequest(r, &keyTransferReq, &keyTransferReq)
+	if err != nil {
+		return nil, err
+	}
+	req.ResponseFormat = responseFormat
+
+	return req, nil
+}
+
+// decodeAttestedHTTPRequest decodes the request body, whose KeyTransferRequest holds the evidence
+// or attestation token of the workload, and returns the transfer request of the key or secret of
+// the path. Without body the workload requests a verifier nonce.
+func decodeAttestedHTTPRequest(r *http.Request, body interface{}, keyTransferReq *model.KeyTransferRequest) (service.TransferKeyRequest, error) {
+
+	envelopeVersion, err := transferEnvelopeVersion(r.Header.Get(constant.HTTPHeaderKeyEnvelopeVersion))
+	if err != nil {
+		log.Error(ErrInvalidEnvelopeVersion.Error())
+		return service.TransferKeyRequest{}, ErrInvalidEnvelopeVersion
+	}
+
 	id := uuid.MustParse(mux.Vars(r)["id"])
 	attestType := r.Header.Get(constant.HTTPHeaderKeyAttestationType)
 
 	if r.ContentLength != 0 {
 		if r.Header.Get(constant.HTTPHeaderKeyContentType) != constant.HTTPHeaderValueApplicationJson {
 			log.Error(ErrInvalidContentTypeHeader.Error())
-			return nil, ErrInvalidContentTypeHeader
+			return service.TransferKeyRequest{}, ErrInvalidContentTypeHeader
 		}
 
 		dec := json.NewDecoder(r.Body)
 		dec.DisallowUnknownFields()
 
-		err := dec.Decode(&keyTransferReq)
+		err = dec.Decode(body)
 		if err != nil {
 			log.WithError(err).Error(ErrJsonDecodeFailed.Error())
-			return nil, ErrJsonDecodeFailed
+			return service.TransferKeyRequest{}, ErrJsonDecodeFailed
 		}
 
 		if attestType != "" {
 			if attestType != "SGX" && attestType != "TDX" {
 				log.Error(ErrInvalidAttestationType.Error())
-				return nil, ErrInvalidAttestationType
+				return service.TransferKeyRequest{}, ErrInvalidAttestationType
 			}
 		} else {
 			if keyTransferReq.AttestationToken == "" {
 				log.Error(ErrInvalidRequest.Error())
-				return nil, ErrInvalidRequest
+				return service.TransferKeyRequest{}, ErrInvalidRequest
 			}
 		}
 	}
@@ -88,15 +112,62 @@ func decodeTransferKeyHTTPRequest(_ context.Context, r *http.Request) (interface
 	req := service.TransferKeyRequest{
 		KeyId:              id,
 		AttestationType:    attestType,
-		KeyTransferRequest: &keyTransferReq,
+		KeyTransferRequest: keyTransferReq,
+		EnvelopeVersion:    envelopeVersion,
 	}
 
 	return req, nil
 }
 
+// transferEnvelopeVersion returns the wrapped key envelope version requested in the
+// Envelope-Version header, or 0 to leave the choice to the key transfer policy
+func transferEnvelopeVersion(header string) (int, error) {
+
+	switch header {
+	case "":
+		return 0, nil
+	case strconv.Itoa(model.EnvelopeVersion1):
+		return model.EnvelopeVersion1, nil
+	case strconv.Itoa(model.EnvelopeVersion2):
+		return model.EnvelopeVersion2, nil
+	default:
+		return 0, ErrInvalidEnvelopeVersion
+	}
+}
+
+// transferResponseFormat returns the key transfer response format requested in the Accept
+// header. The JOSE media types request the jwe format, application/json leaves the choice to the
+// key transfer policy.
+func transferResponseFormat(accept string) (string, error) {
+
+	responseFormat := ""
+	acceptable := false
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case constant.HTTPHeaderValueApplicationJose, constant.HTTPHeaderValueApplicationJoseJson:
+			responseFormat = model.KeyTransferFormatJWE
+			acceptable = true
+		case constant.HTTPHeaderValueApplicationJson:
+			acceptable = true
+		}
+	}
+	if !acceptable {
+		return "", ErrInvalidAcceptHeader
+	}
+	return responseFormat, nil
+}
+
 func encodeTransferKeyHTTPResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
 	resp := response.(*service.TransferKeyResponse)
 
+	if resp.KeyTransferJwe != nil {
+		return encodeTransferKeyJweResponse(ctx, w, resp)
+	}
+
 	header := w.Header()
 	header.Set(constant.HTTPHeaderKeyContentType, constant.HTTPHeaderValueApplicationJson)
 	header.Set(constant.HTTPHeaderKeyAttestationType, resp.AttestationType)
@@ -108,3 +179,33 @@ func encodeTransferKeyHTTPResponse(ctx context.Context, w http.ResponseWriter, r
 
 	return encodeJsonResponse(ctx, w, resp.KeyTransferResponse)
 }
+
+// encodeTransferKeyJweResponse writes the JWE Compact Serialization when application/jose is the
+// first accepted media type and the flattened JWE JSON Serialization otherwise
+func encodeTransferKeyJweResponse(ctx context.Context, w http.ResponseWriter, resp *service.TransferKeyResponse) error {
+
+	contentType := constant.HTTPHeaderValueApplicationJoseJson
+	accept, _ := ctx.Value(httpTransport.ContextKeyRequestAccept).(string)
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+		if err != nil {
+			continue
+		}
+		if mediaType == constant.HTTPHeaderValueApplicationJose || mediaType == constant.HTTPHeaderValueApplicationJoseJson ||
+			mediaType == constant.HTTPHeaderValueApplicationJson {
+			contentType = mediaType
+			break
+		}
+	}
+
+	header := w.Header()
+	header.Set(constant.HTTPHeaderKeyContentType, contentType)
+	header.Set(constant.HTTPHeaderKeyAttestationType, resp.AttestationType)
+	w.WriteHeader(http.StatusOK)
+
+	if contentType == constant.HTTPHeaderValueApplicationJose {
+		_, err := w.Write([]byte(resp.KeyTransferJwe.Compact()))
+		return err
+	}
+	return encodeJsonResponse(ctx, w, resp.KeyTransferJwe)
+}
@@ -182,6 +182,24 @@ func validateKeyTransferPolicy(policyCreateReq model.KeyTransferPolicy) error {
 			return errors.Wrap(err, "Input validation failed for TDX Attributes")
 		}
 	}
+
+	switch policyCreateReq.ResponseFormat {
+	case "", model.KeyTransferFormatLegacy, model.KeyTransferFormatJWE:
+	default:
+		return errors.New("Invalid response format")
+	}
+
+	switch policyCreateReq.KeyEncapsulation {
+	case "", model.KeyEncapsulationClassical, model.KeyEncapsulationHybridMLKEM768:
+	default:
+		return errors.New("Invalid key encapsulation")
+	}
+
+	switch policyCreateReq.EnvelopeVersion {
+	case 0, model.EnvelopeVersion1, model.EnvelopeVersion2:
+	default:
+		return errors.New("Invalid envelope version")
+	}
 	return nil
 }
 
@@ -11,8 +11,11 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"intel/kbs/v1/crypt"
+	"intel/kbs/v1/model"
 	"intel/kbs/v1/service"
 
 	"github.com/google/uuid"
@@ -54,6 +57,106 @@ func TestKeyTransferWithEvidenceHandler(t *testing.T) {
 	g.Expect(recorder.Code).To(gomega.Equal(http.StatusOK))
 }
 
+func TestKeyTransferJweCompactResponse(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	resp := &service.TransferKeyResponse{
+		KeyTransferJwe: &crypt.Jwe{Protected: "p", EncryptedKey: "k", Iv: "i", Ciphertext: "c", Tag: "t"},
+	}
+
+	keyId := uuid.New()
+
+	mockService := &MockService{}
+	mockService.On("TransferKeyWithEvidence", mock.Anything, mock.Anything).Return(resp, nil)
+	handler := createMockHandler(mockService)
+
+	err := setKeyHandler(mockService, mux.NewRouter(), nil, jwtAuth)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	req, _ := http.NewRequest(http.MethodPost, "/kbs/v1/keys/"+keyId.String()+"/transfer", nil)
+	req.Header.Set("Accept", "application/jose, application/json;q=0.5")
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+
+	res := recorder.Result()
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(recorder.Code).To(gomega.Equal(http.StatusOK))
+	g.Expect(res.Header.Get("Content-Type")).To(gomega.Equal("application/jose"))
+	g.Expect(string(data)).To(gomega.Equal("p.k.i.c.t"))
+}
+
+func TestKeyTransferJweJsonResponse(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	resp := &service.TransferKeyResponse{
+		KeyTransferJwe: &crypt.Jwe{Protected: "p", EncryptedKey: "k", Iv: "i", Ciphertext: "c", Tag: "t"},
+	}
+
+	keyId := uuid.New()
+
+	mockService := &MockService{}
+	mockService.On("TransferKeyWithEvidence", mock.Anything, mock.Anything).Return(resp, nil)
+	handler := createMockHandler(mockService)
+
+	err := setKeyHandler(mockService, mux.NewRouter(), nil, jwtAuth)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	req, _ := http.NewRequest(http.MethodPost, "/kbs/v1/keys/"+keyId.String()+"/transfer", nil)
+	req.Header.Set("Accept", "application/jose+json")
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+
+	res := recorder.Result()
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(recorder.Code).To(gomega.Equal(http.StatusOK))
+	g.Expect(res.Header.Get("Content-Type")).To(gomega.Equal("application/jose+json"))
+	g.Expect(strings.TrimSpace(string(data))).To(gomega.Equal(`{"protected":"p","encrypted_key":"k","iv":"i","ciphertext":"c","tag":"t"}`))
+}
+
+func TestTransferResponseFormat(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	format, err := transferResponseFormat("application/json")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(format).To(gomega.BeEmpty())
+
+	format, err = transferResponseFormat("application/jose+json; charset=utf-8")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(format).To(gomega.Equal(model.KeyTransferFormatJWE))
+
+	format, err = transferResponseFormat("application/json, application/jose")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(format).To(gomega.Equal(model.KeyTransferFormatJWE))
+
+	_, err = transferResponseFormat("text/plain")
+	g.Expect(err).To(gomega.HaveOccurred())
+}
+
+func TestTransferEnvelopeVersion(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	version, err := transferEnvelopeVersion("")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(version).To(gomega.BeZero())
+
+	version, err = transferEnvelopeVersion("1")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(version).To(gomega.Equal(model.EnvelopeVersion1))
+
+	version, err = transferEnvelopeVersion("2")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(version).To(gomega.Equal(model.EnvelopeVersion2))
+
+	_, err = transferEnvelopeVersion("3")
+	g.Expect(err).To(gomega.MatchError(ErrInvalidEnvelopeVersion))
+}
+
 func TestKeyTransferWithInvalidHeader(t *testing.T) {
 	g := gomega.NewGomegaWithT(t)
 	resp := &service.TransferKeyResponse{}
@@ -0,0 +1,334 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package http
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"intel/kbs/v1/constant"
+	"intel/kbs/v1/model"
+	"intel/kbs/v1/service"
+
+	"github.com/go-kit/kit/endpoint"
+	httpTransport "github.com/go-kit/kit/transport/http"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	ContentType = "contentType"
+)
+
+func setSecretHandler(svc service.Service, router *mux.Router, options []httpTransport.ServerOption, auth *model.JwtAuthz) error {
+
+	secretIdExpr := "/secrets/" + idReg
+	createSecretHandler := httpTransport.NewServer(
+		makeCreateSecretEndpoint(svc),
+		decodeCreateSecretHTTPRequest,
+		encodeCreateUpdateSecretHTTPResponse,
+		options...,
+	)
+
+	router.Handle("/secrets", authMiddleware(createSecretHandler, auth)).Methods(http.MethodPost)
+
+	getSecretHandler := httpTransport.NewServer(
+		makeRetrieveSecretEndpoint(svc),
+		decodeRetrieveHTTPRequest,
+		encodeRetrieveHTTPResponse,
+		options...,
+	)
+
+	router.Handle(secretIdExpr, authMiddleware(getSecretHandler, auth)).Methods(http.MethodGet)
+
+	deleteSecretHandler := httpTransport.NewServer(
+		makeDeleteSecretEndpoint(svc),
+		decodeDeleteHTTPRequest,
+		encodeDeleteHTTPResponse,
+		options...,
+	)
+
+	router.Handle(secretIdExpr, authMiddleware(deleteSecretHandler, auth)).Methods(http.MethodDelete)
+
+	searchSecretsHandler := httpTransport.NewServer(
+		makeSearchSecretsEndpoint(svc),
+		decodeSearchSecretsHTTPRequest,
+		encodeSearchSecretsHTTPResponse,
+		options...,
+	)
+
+	router.Handle("/secrets", authMiddleware(searchSecretsHandler, auth)).Methods(http.MethodGet)
+
+	updateSecretHandler := httpTransport.NewServer(
+		makeUpdateSecretEndpoint(svc),
+		decodeUpdateSecretHTTPRequest,
+		encodeCreateUpdateSecretHTTPResponse,
+		options...,
+	)
+
+	router.Handle(secretIdExpr, authMiddleware(updateSecretHandler, auth)).Methods(http.MethodPut)
+
+	transferSecretHandler := httpTransport.NewServer(
+		makeTransferSecretEndpoint(svc),
+		decodeTransferHTTPRequest,
+		encodeTransferHTTPResponse,
+		options...,
+	)
+
+	router.Handle(secretIdExpr, authMiddleware(transferSecretHandler, auth)).Methods(http.MethodPost)
+
+	// secrets are released to attested workloads like keys
+	transferSecretWithEvidenceHandler := httpTransport.NewServer(
+		makeTransferSecretWithEvidenceEndpoint(svc),
+		decodeTransferKeyHTTPRequest,
+		encodeTransferKeyHTTPResponse,
+		append(options, httpTransport.ServerBefore(httpTransport.PopulateRequestContext))...,
+	)
+
+	router.Handle(secretIdExpr+"/transfer", transferSecretWithEvidenceHandler).Methods(http.MethodPost)
+
+	return nil
+}
+
+func makeCreateSecretEndpoint(svc service.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(model.SecretRequest)
+		return svc.CreateSecret(ctx, req)
+	}
+}
+
+func makeSearchSecretsEndpoint(svc service.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		filter := request.(*model.SecretFilterCriteria)
+		return svc.SearchSecrets(ctx, filter)
+	}
+}
+
+func makeDeleteSecretEndpoint(svc service.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		id := request.(uuid.UUID)
+		return svc.DeleteSecret(ctx, id)
+	}
+}
+
+func makeRetrieveSecretEndpoint(svc service.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		id := request.(uuid.UUID)
+		return svc.RetrieveSecret(ctx, id)
+	}
+}
+
+func makeUpdateSecretEndpoint(svc service.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(model.SecretUpdateRequest)
+		return svc.UpdateSecret(ctx, req)
+	}
+}
+
+func makeTransferSecretEndpoint(svc service.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(service.TransferKeyRequest)
+		return svc.TransferSecret(ctx, req)
+	}
+}
+
+func makeTransferSecretWithEvidenceEndpoint(svc service.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(service.TransferKeyRequest)
+		return svc.TransferSecretWithEvidence(ctx, req)
+	}
+}
+
+func decodeCreateSecretHTTPRequest(_ context.Context, r *http.Request) (interface{}, error) {
+
+	if r.Header.Get(constant.HTTPHeaderKeyContentType) != constant.HTTPHeaderValueApplicationJson {
+		log.Error(ErrInvalidContentTypeHeader.Error())
+		return nil, ErrInvalidContentTypeHeader
+	}
+
+	if r.Header.Get(constant.HTTPHeaderKeyAccept) != constant.HTTPHeaderValueApplicationJson {
+		log.Error(ErrInvalidAcceptHeader.Error())
+		return nil, ErrInvalidAcceptHeader
+	}
+
+	if r.ContentLength == 0 {
+		log.Error(ErrEmptyRequestBody.Error())
+		return nil, ErrEmptyRequestBody
+	}
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	var secretCreateReq model.SecretRequest
+	err := dec.Decode(&secretCreateReq)
+	if err != nil {
+		log.WithError(err).Error(ErrJsonDecodeFailed.Error())
+		return nil, ErrJsonDecodeFailed
+	}
+
+	if err := validateSecretCreateRequest(secretCreateReq); err != nil {
+		log.WithError(err).Error(ErrInvalidRequest.Error())
+		return nil, ErrInvalidRequest
+	}
+
+	return secretCreateReq, nil
+}
+
+func decodeUpdateSecretHTTPRequest(_ context.Context, r *http.Request) (interface{}, error) {
+
+	if r.Header.Get(constant.HTTPHeaderKeyContentType) != constant.HTTPHeaderValueApplicationJson {
+		log.Error(ErrInvalidContentTypeHeader.Error())
+		return nil, ErrInvalidContentTypeHeader
+	}
+
+	if r.Header.Get(constant.HTTPHeaderKeyAccept) != constant.HTTPHeaderValueApplicationJson {
+		log.Error(ErrInvalidAcceptHeader.Error())
+		return nil, ErrInvalidAcceptHeader
+	}
+
+	if r.ContentLength == 0 {
+		log.Error(ErrEmptyRequestBody.Error())
+		return nil, ErrEmptyRequestBody
+	}
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	var secretUpdateReq model.SecretUpdateRequest
+	err := dec.Decode(&secretUpdateReq)
+	if err != nil {
+		log.WithError(err).Error(ErrJsonDecodeFailed.Error())
+		return nil, ErrJsonDecodeFailed
+	}
+
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		log.WithError(err).Error("Invalid secret UUID format")
+		return nil, errors.New("Invalid secret UUID format")
+	}
+	secretUpdateReq.SecretId = id
+
+	return secretUpdateReq, nil
+}
+
+func decodeSearchSecretsHTTPRequest(_ context.Context, r *http.Request) (interface{}, error) {
+
+	if r.Header.Get(constant.HTTPHeaderKeyAccept) != constant.HTTPHeaderValueApplicationJson {
+		log.Error(ErrInvalidAcceptHeader.Error())
+		return nil, ErrInvalidAcceptHeader
+	}
+
+	queryKeys := map[string]bool{
+		ContentType:      true,
+		TransferPolicyId: true,
+	}
+
+	// all secrets are listed when no filter is given
+	queryValues := r.URL.Query()
+	if len(queryValues) > 0 {
+		if err := ValidateQueryParamKeys(queryValues, queryKeys); err != nil {
+			return nil, err
+		}
+	}
+
+	criteria, err := getSecretFilterCriteria(queryValues)
+	if err != nil {
+		log.WithError(err).Error(ErrInvalidFilterCriteria.Error())
+		return nil, ErrInvalidFilterCriteria
+	}
+	return criteria, nil
+}
+
+func encodeCreateUpdateSecretHTTPResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	resp := response.(*model.SecretResponse)
+
+	header := w.Header()
+	header.Set(constant.HTTPHeaderKeyContentType, constant.HTTPHeaderValueApplicationJson)
+	w.WriteHeader(http.StatusCreated)
+
+	return encodeJsonResponse(ctx, w, resp)
+}
+
+func encodeSearchSecretsHTTPResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	resp := response.([]*model.SecretResponse)
+
+	header := w.Header()
+	header.Set(constant.HTTPHeaderKeyContentType, constant.HTTPHeaderValueApplicationJson)
+	w.WriteHeader(http.StatusOK)
+
+	return encodeJsonResponse(ctx, w, resp)
+}
+
+// validateSecretCreateRequest checks for various attributes in the Create Secret request and returns error or nil.
+// The size of the secret is checked against the configured maximum by the service.
+func validateSecretCreateRequest(secretCreateReq model.SecretRequest) error {
+
+	if secretCreateReq.Data == "" {
+		return errors.New("secret data is missing")
+	}
+	if _, err := base64.StdEncoding.DecodeString(secretCreateReq.Data); err != nil {
+		return errors.New("data must be a base64 encoded string")
+	}
+
+	if err := validateContentType(secretCreateReq.ContentType); err != nil {
+		return err
+	}
+
+	if secretCreateReq.KeyManager != "" {
+		if err := ValidateStrings([]string{secretCreateReq.KeyManager}); err != nil {
+			return errors.New("key_manager must be a valid string")
+		}
+	}
+
+	return nil
+}
+
+// validateContentType checks that the content type of a secret is a valid media type
+func validateContentType(contentType string) error {
+
+	if contentType == "" {
+		return errors.New("content_type is missing")
+	}
+	if len(contentType) > constant.UserCredsMaxLen {
+		return errors.New("content_type is too long")
+	}
+	if _, _, err := mime.ParseMediaType(contentType); err != nil {
+		return errors.Wrap(err, "content_type must be a valid media type")
+	}
+	return nil
+}
+
+// getSecretFilterCriteria checks for set filter params in the Search request and returns a valid SecretFilterCriteria
+func getSecretFilterCriteria(params url.Values) (*model.SecretFilterCriteria, error) {
+
+	criteria := model.SecretFilterCriteria{}
+
+	// contentType
+	if param := strings.TrimSpace(params.Get(ContentType)); param != "" {
+		if err := validateContentType(param); err != nil {
+			return nil, errors.Wrap(err, "Valid contentType must be specified")
+		}
+		criteria.ContentType = param
+	}
+
+	// transferPolicyId
+	if param := strings.TrimSpace(params.Get(TransferPolicyId)); param != "" {
+		id, err := uuid.Parse(param)
+		if err != nil {
+			return nil, errors.Wrap(err, "Invalid transferPolicyId query param value, must be UUID")
+		}
+		criteria.TransferPolicyId = id
+	}
+	return &criteria, nil
+}
@@ -0,0 +1,201 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package http
+
+import (
+	"bytes"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+	"intel/kbs/v1/model"
+	"intel/kbs/v1/service"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSecretCreateHandler(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	secretCreateRes := &model.SecretResponse{}
+
+	mockService := &MockService{}
+	mockService.On("CreateSecret", mock.Anything, mock.Anything).Return(secretCreateRes, nil)
+	handler := createMockHandler(mockService)
+
+	err := setSecretHandler(mockService, mux.NewRouter(), nil, jwtAuth)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	secretJson := `{
+		"data": "c2VjcmV0LWRhdGFiYXNlLXBhc3N3b3Jk",
+		"content_type": "text/plain; charset=utf-8"
+	}`
+
+	req, _ := http.NewRequest(http.MethodPost, "/kbs/v1/secrets", bytes.NewReader([]byte(secretJson)))
+	req.Header.Set("Accept", HTTPMediaTypeJson)
+	req.Header.Set("Content-type", HTTPMediaTypeJson)
+	req.Header.Set("Authorization", "Bearer "+authToken)
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+
+	res := recorder.Result()
+	defer res.Body.Close()
+
+	_, err = io.ReadAll(res.Body)
+	if err != nil {
+		t.Errorf("expected error to be nil got %v", err)
+	}
+	g.Expect(recorder.Code).To(gomega.Equal(http.StatusCreated))
+}
+
+func TestSecretCreateHandlerInvalidReq(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	secretCreateRes := &model.SecretResponse{}
+
+	mockService := &MockService{}
+	mockService.On("CreateSecret", mock.Anything, mock.Anything).Return(secretCreateRes, nil)
+	handler := createMockHandler(mockService)
+
+	invalidRequests := []string{
+		// data is missing
+		`{"content_type": "text/plain"}`,
+		// data is not base64
+		`{"data": "not base64!", "content_type": "text/plain"}`,
+		// content type is missing
+		`{"data": "c2VjcmV0"}`,
+		// content type is not a media type
+		`{"data": "c2VjcmV0", "content_type": "text/plain; charset"}`,
+		// unknown field
+		`{"data": "c2VjcmV0", "content_type": "text/plain", "algorithm": "AES"}`,
+	}
+	for _, secretJson := range invalidRequests {
+		req, _ := http.NewRequest(http.MethodPost, "/kbs/v1/secrets", bytes.NewReader([]byte(secretJson)))
+		req.Header.Set("Accept", HTTPMediaTypeJson)
+		req.Header.Set("Content-type", HTTPMediaTypeJson)
+		req.Header.Set("Authorization", "Bearer "+authToken)
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		g.Expect(recorder.Code).To(gomega.Equal(http.StatusBadRequest), secretJson)
+	}
+}
+
+func TestSecretSearchHandler(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	var resp []*model.SecretResponse
+	policyId := uuid.New()
+
+	mockService := &MockService{}
+	mockService.On("SearchSecrets", mock.Anything, &model.SecretFilterCriteria{ContentType: "application/json", TransferPolicyId: policyId}).Return(resp, nil)
+	mockService.On("SearchSecrets", mock.Anything, &model.SecretFilterCriteria{}).Return(resp, nil)
+	handler := createMockHandler(mockService)
+
+	req, _ := http.NewRequest(http.MethodGet, "/kbs/v1/secrets", nil)
+	req.Header.Set("Accept", HTTPMediaTypeJson)
+	req.Header.Set("Authorization", "Bearer "+authToken)
+	q := req.URL.Query()
+	q.Add(ContentType, "application/json")
+	q.Add(TransferPolicyId, policyId.String())
+	req.URL.RawQuery = q.Encode()
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	g.Expect(recorder.Code).To(gomega.Equal(http.StatusOK))
+
+	// all secrets are listed without filter
+	req, _ = http.NewRequest(http.MethodGet, "/kbs/v1/secrets", nil)
+	req.Header.Set("Accept", HTTPMediaTypeJson)
+	req.Header.Set("Authorization", "Bearer "+authToken)
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	g.Expect(recorder.Code).To(gomega.Equal(http.StatusOK))
+
+	req, _ = http.NewRequest(http.MethodGet, "/kbs/v1/secrets?algorithm=AES", nil)
+	req.Header.Set("Accept", HTTPMediaTypeJson)
+	req.Header.Set("Authorization", "Bearer "+authToken)
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	g.Expect(recorder.Code).To(gomega.Equal(http.StatusBadRequest))
+}
+
+func TestSecretRetrieveUpdateDeleteHandlers(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	secretId := uuid.New()
+
+	mockService := &MockService{}
+	mockService.On("RetrieveSecret", mock.Anything).Return(&model.SecretResponse{}, nil)
+	mockService.On("UpdateSecret", mock.Anything).Return(&model.SecretResponse{}, nil)
+	mockService.On("DeleteSecret", mock.Anything).Return(&model.SecretResponse{}, nil)
+	handler := createMockHandler(mockService)
+
+	req, _ := http.NewRequest(http.MethodGet, "/kbs/v1/secrets/"+secretId.String(), nil)
+	req.Header.Set("Accept", HTTPMediaTypeJson)
+	req.Header.Set("Authorization", "Bearer "+authToken)
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	g.Expect(recorder.Code).To(gomega.Equal(http.StatusOK))
+
+	updateJson := `{"transfer_policy_id": "` + uuid.NewString() + `"}`
+	req, _ = http.NewRequest(http.MethodPut, "/kbs/v1/secrets/"+secretId.String(), bytes.NewReader([]byte(updateJson)))
+	req.Header.Set("Accept", HTTPMediaTypeJson)
+	req.Header.Set("Content-type", HTTPMediaTypeJson)
+	req.Header.Set("Authorization", "Bearer "+authToken)
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	g.Expect(recorder.Code).To(gomega.Equal(http.StatusCreated))
+
+	req, _ = http.NewRequest(http.MethodDelete, "/kbs/v1/secrets/"+secretId.String(), nil)
+	req.Header.Set("Authorization", "Bearer "+authToken)
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	g.Expect(recorder.Code).To(gomega.Equal(http.StatusNoContent))
+
+	// the admin routes require a bearer token
+	req, _ = http.NewRequest(http.MethodDelete, "/kbs/v1/secrets/"+secretId.String(), nil)
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	g.Expect(recorder.Code).To(gomega.Equal(http.StatusUnauthorized))
+}
+
+func TestSecretTransferHandlers(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	secretId := uuid.New()
+	transferRes := &service.TransferKeyResponse{KeyTransferResponse: &model.KeyTransferResponse{}}
+
+	mockService := &MockService{}
+	mockService.On("TransferSecret", mock.Anything).Return(transferRes, nil)
+	mockService.On("TransferSecretWithEvidence", mock.Anything).Return(transferRes, nil)
+	handler := createMockHandler(mockService)
+
+	req, _ := http.NewRequest(http.MethodPost, "/kbs/v1/secrets/"+secretId.String(), bytes.NewReader([]byte(envelopeKey)))
+	req.Header.Set("Accept", HTTPMediaTypeJson)
+	req.Header.Set("Content-type", HTTPMediaTypePem)
+	req.Header.Set("Authorization", "Bearer "+authToken)
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	g.Expect(recorder.Code).To(gomega.Equal(http.StatusOK))
+	mockService.AssertCalled(t, "TransferSecret", mock.Anything)
+
+	transferJson := `{"attestation_token": "token"}`
+	req, _ = http.NewRequest(http.MethodPost, "/kbs/v1/secrets/"+secretId.String()+"/transfer", bytes.NewReader([]byte(transferJson)))
+	req.Header.Set("Accept", HTTPMediaTypeJson)
+	req.Header.Set("Content-type", HTTPMediaTypeJson)
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	g.Expect(recorder.Code).To(gomega.Equal(http.StatusOK))
+	mockService.AssertCalled(t, "TransferSecretWithEvidence", mock.Anything)
+}
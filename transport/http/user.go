@@ -27,8 +27,8 @@ const (
 )
 
 var (
-	allowedAPIs           = map[string]bool{"users": true, "keys": true, "key-transfer-policies": true}
-	allowedAPIPermissions = map[string]bool{"create": true, "delete": true, "search": true, "update": true, "transfer": true}
+	allowedAPIs           = map[string]bool{"users": true, "keys": true, "secrets": true, "key-transfer-policies": true}
+	allowedAPIPermissions = map[string]bool{"create": true, "delete": true, "search": true, "update": true, "transfer": true, "public_key": true}
 )
 
 func setUserHandler(svc service.Service, router *mux.Router, options []httpTransport.ServerOption, auth *model.JwtAuthz) error {
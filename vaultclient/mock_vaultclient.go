@@ -7,7 +7,9 @@
 package vaultclient
 
 import (
+	"crypto/rsa"
 	"github.com/stretchr/testify/mock"
+	"intel/kbs/v1/config"
 	"intel/kbs/v1/model"
 )
 
@@ -22,8 +24,8 @@ func NewMockVaultClient() *MockVaultClient {
 }
 
 // InitializeClient mocks base method
-func (m *MockVaultClient) InitializeClient(serverIP, serverPort, clientToken string) error {
-	args := m.Called(serverIP, serverPort, clientToken)
+func (m *MockVaultClient) InitializeClient(vaultConfig *config.VaultConfig) error {
+	args := m.Called(vaultConfig)
 	return args.Error(0)
 }
 
@@ -50,3 +52,61 @@ func (m *MockVaultClient) ListKeys() ([]interface{}, error) {
 	args := m.Called()
 	return args.Get(0).([]interface{}), args.Error(1)
 }
+
+// MockTransitClient is a mock of TransitClient interface
+type MockTransitClient struct {
+	mock.Mock
+}
+
+// NewMockTransitClient creates a new mock instance
+func NewMockTransitClient() *MockTransitClient {
+	return &MockTransitClient{}
+}
+
+// InitializeClient mocks base method
+func (m *MockTransitClient) InitializeClient(vaultConfig *config.VaultConfig) error {
+	args := m.Called(vaultConfig)
+	return args.Error(0)
+}
+
+// CreateKey mocks base method
+func (m *MockTransitClient) CreateKey(name, keyType string) error {
+	args := m.Called(name, keyType)
+	return args.Error(0)
+}
+
+// ImportKey mocks base method
+func (m *MockTransitClient) ImportKey(name, keyType string, keyMaterial []byte) error {
+	args := m.Called(name, keyType, keyMaterial)
+	return args.Error(0)
+}
+
+// DeleteKey mocks base method
+func (m *MockTransitClient) DeleteKey(name string) error {
+	args := m.Called(name)
+	return args.Error(0)
+}
+
+// ExportKey mocks base method
+func (m *MockTransitClient) ExportKey(name, exportType string) ([]byte, error) {
+	args := m.Called(name, exportType)
+	return args.Get(0).([]byte), args.Error(1)
+}
+
+// ExportWrappedKey mocks base method
+func (m *MockTransitClient) ExportWrappedKey(name string, publicKey *rsa.PublicKey) ([]byte, error) {
+	args := m.Called(name, publicKey)
+	return args.Get(0).([]byte), args.Error(1)
+}
+
+// Encrypt mocks base method
+func (m *MockTransitClient) Encrypt(name string, plaintext []byte) ([]byte, error) {
+	args := m.Called(name, plaintext)
+	return args.Get(0).([]byte), args.Error(1)
+}
+
+// Decrypt mocks base method
+func (m *MockTransitClient) Decrypt(name string, ciphertext []byte) ([]byte, error) {
+	args := m.Called(name, ciphertext)
+	return args.Get(0).([]byte), args.Error(1)
+}
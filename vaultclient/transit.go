@@ -0,0 +1,226 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package vaultclient
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"intel/kbs/v1/config"
+	"intel/kbs/v1/crypt"
+)
+
+const (
+	// transit export types
+	TransitExportEncryptionKey = "encryption-key"
+	TransitExportSigningKey    = "signing-key"
+
+	transitWrapKeyPrefix = "kbs-wrap-"
+)
+
+// TransitClient manages keys in a vault transit secrets engine
+type TransitClient interface {
+	InitializeClient(*config.VaultConfig) error
+	CreateKey(name, keyType string) error
+	ImportKey(name, keyType string, keyMaterial []byte) error
+	DeleteKey(name string) error
+	ExportKey(name, exportType string) ([]byte, error)
+	ExportWrappedKey(name string, publicKey *rsa.PublicKey) ([]byte, error)
+	Encrypt(name string, plaintext []byte) ([]byte, error)
+	Decrypt(name string, ciphertext []byte) ([]byte, error)
+}
+
+type transitClient struct {
+	vaultClient
+}
+
+func NewTransitClient() TransitClient {
+	return &transitClient{}
+}
+
+// CreateKey creates an exportable transit key of the given transit key type
+func (tc *transitClient) CreateKey(name, keyType string) error {
+	_, err := tc.c.Write(tc.keyPath(name), map[string]interface{}{
+		"type":       keyType,
+		"exportable": true,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "Failed to create transit key %s", name)
+	}
+	return nil
+}
+
+// ImportKey imports key material as an exportable transit key. The key material is wrapped to
+// the transit wrapping key before it is sent, asymmetric keys must be PKCS#8 DER.
+func (tc *transitClient) ImportKey(name, keyType string, keyMaterial []byte) error {
+	secret, err := tc.c.Read(tc.mountPath + "/wrapping_key")
+	if err != nil {
+		return errors.Wrap(err, "Failed to read transit wrapping key")
+	}
+	if secret == nil {
+		return errors.New("Transit wrapping key is not available")
+	}
+	publicKeyPem, _ := secret.Data["public_key"].(string)
+	publicKey, err := crypt.GetPublicKeyFromPem([]byte(publicKeyPem))
+	if err != nil {
+		return errors.Wrap(err, "Failed to parse transit wrapping key")
+	}
+	wrappingKey, ok := publicKey.(*rsa.PublicKey)
+	if !ok {
+		return errors.New("Transit wrapping key is not an RSA key")
+	}
+
+	ciphertext, err := crypt.WrapKeyForImport(wrappingKey, keyMaterial)
+	if err != nil {
+		return err
+	}
+	_, err = tc.c.Write(tc.keyPath(name)+"/import", map[string]interface{}{
+		"ciphertext":    base64.StdEncoding.EncodeToString(ciphertext),
+		"type":          keyType,
+		"hash_function": "SHA256",
+		"exportable":    true,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "Failed to import transit key %s", name)
+	}
+	return nil
+}
+
+func (tc *transitClient) DeleteKey(name string) error {
+	// transit keys can only be deleted once deletion is allowed in their config
+	_, err := tc.c.Write(tc.keyPath(name)+"/config", map[string]interface{}{
+		"deletion_allowed": true,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "Failed to allow deletion of transit key %s", name)
+	}
+	if _, err := tc.c.Delete(tc.keyPath(name)); err != nil {
+		return errors.Wrapf(err, "Failed to delete transit key %s", name)
+	}
+	log.Infof("vaultclient/transit:DeleteKey() Deleted transit key %s", name)
+	return nil
+}
+
+// ExportKey returns the plaintext of the latest version of a transit key. AES keys are returned
+// as raw bytes, asymmetric keys as DER.
+func (tc *transitClient) ExportKey(name, exportType string) ([]byte, error) {
+	exported, err := tc.readLatestKey(fmt.Sprintf("%s/export/%s/%s/latest", tc.mountPath, exportType, name))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to export transit key %s", name)
+	}
+	defer crypt.ZeroizeByteArray(exported)
+
+	if block, _ := pem.Decode(exported); block != nil {
+		return block.Bytes, nil
+	}
+	keyBytes, err := base64.StdEncoding.DecodeString(string(exported))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to decode transit key %s", name)
+	}
+	return keyBytes, nil
+}
+
+// ExportWrappedKey returns the latest version of a transit key wrapped to publicKey with
+// CKM_RSA_AES_KEY_WRAP, so that the key material does not leave vault in plaintext. publicKey is
+// imported as a temporary transit key for the duration of the export.
+func (tc *transitClient) ExportWrappedKey(name string, publicKey *rsa.PublicKey) ([]byte, error) {
+	publicKeyBytes, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to marshal wrapping public key")
+	}
+	wrapKeyName := transitWrapKeyPrefix + uuid.NewString()
+	_, err = tc.c.Write(tc.keyPath(wrapKeyName)+"/import", map[string]interface{}{
+		"public_key": string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyBytes})),
+		"type":       fmt.Sprintf("rsa-%d", publicKey.N.BitLen()),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to import wrapping public key into transit")
+	}
+	defer func() {
+		if err := tc.DeleteKey(wrapKeyName); err != nil {
+			log.WithError(err).Warnf("vaultclient/transit:ExportWrappedKey() Failed to delete temporary transit key %s", wrapKeyName)
+		}
+	}()
+
+	wrapped, err := tc.readLatestKey(fmt.Sprintf("%s/byok-export/%s/%s/latest", tc.mountPath, wrapKeyName, name))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to export wrapped transit key %s", name)
+	}
+	wrappedKey, err := base64.StdEncoding.DecodeString(string(wrapped))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to decode wrapped transit key %s", name)
+	}
+	return wrappedKey, nil
+}
+
+// Encrypt encrypts plaintext under the latest version of a transit key. The ciphertext is the
+// transit ciphertext string, prefixed with the key version.
+func (tc *transitClient) Encrypt(name string, plaintext []byte) ([]byte, error) {
+	secret, err := tc.c.Write(tc.mountPath+"/encrypt/"+name, map[string]interface{}{
+		"plaintext": base64.StdEncoding.EncodeToString(plaintext),
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to encrypt with transit key %s", name)
+	} else if secret == nil {
+		return nil, errors.New("Unexpected transit encrypt response")
+	}
+	ciphertext, ok := secret.Data["ciphertext"].(string)
+	if !ok {
+		return nil, errors.New("Unexpected transit encrypt response")
+	}
+	return []byte(ciphertext), nil
+}
+
+// Decrypt decrypts a ciphertext returned by Encrypt for the transit key
+func (tc *transitClient) Decrypt(name string, ciphertext []byte) ([]byte, error) {
+	secret, err := tc.c.Write(tc.mountPath+"/decrypt/"+name, map[string]interface{}{
+		"ciphertext": string(ciphertext),
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to decrypt with transit key %s", name)
+	} else if secret == nil {
+		return nil, errors.New("Unexpected transit decrypt response")
+	}
+	plaintext, ok := secret.Data["plaintext"].(string)
+	if !ok {
+		return nil, errors.New("Unexpected transit decrypt response")
+	}
+	plaintextBytes, err := base64.StdEncoding.DecodeString(plaintext)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to decode plaintext of transit key %s", name)
+	}
+	return plaintextBytes, nil
+}
+
+// readLatestKey reads an export response and returns the single key version it contains
+func (tc *transitClient) readLatestKey(path string) ([]byte, error) {
+	secret, err := tc.c.Read(path)
+	if err != nil {
+		return nil, err
+	} else if secret == nil {
+		return nil, ErrKeyNotFound
+	}
+	keys, ok := secret.Data["keys"].(map[string]interface{})
+	if !ok || len(keys) != 1 {
+		return nil, errors.New("Unexpected transit export response")
+	}
+	for _, key := range keys {
+		if keyString, ok := key.(string); ok {
+			return []byte(keyString), nil
+		}
+	}
+	return nil, errors.New("Unexpected transit export response")
+}
+
+func (tc *transitClient) keyPath(name string) string {
+	return tc.mountPath + "/keys/" + name
+}
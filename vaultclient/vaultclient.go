@@ -7,17 +7,30 @@
 package vaultclient
 
 import (
+	"context"
 	"encoding/json"
 	"github.com/hashicorp/vault/api"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+	"intel/kbs/v1/config"
 	constants "intel/kbs/v1/constant"
 	"intel/kbs/v1/model"
 	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// maxLoginRetryInterval bounds the wait between attempts to log in again once the token expired
+const maxLoginRetryInterval = time.Minute
+
+// ErrKeyNotFound is returned when the requested key does not exist on the vault server
+var ErrKeyNotFound = errors.New("key not found")
+
 type VaultClient interface {
-	InitializeClient(string, string, string) error
+	InitializeClient(*config.VaultConfig) error
 	CreateKey(*model.KeyAttributes) error
 	DeleteKey(string) error
 	GetKey(string) ([]byte, error)
@@ -25,35 +38,215 @@ type VaultClient interface {
 }
 
 type vaultClient struct {
-	c *(api.Logical)
+	client     *api.Client
+	c          *(api.Logical)
+	authMethod string
+	config     config.VaultConfig
+	mountPath  string
 }
 
 func NewVaultClient() VaultClient {
 	return &vaultClient{}
 }
 
-func (vc *vaultClient) InitializeClient(serverIP string, serverPort string, clientToken string) error {
+func (vc *vaultClient) InitializeClient(vaultConfig *config.VaultConfig) error {
+	scheme := "http"
+	if vaultConfig.TLSEnabled {
+		scheme = "https"
+	}
 	serverURL := url.URL{
-		Scheme: "http",
-		Host:   serverIP + ":" + serverPort,
+		Scheme: scheme,
+		Host:   vaultConfig.ServerIP + ":" + vaultConfig.ServerPort,
 	}
-	// vaultAddr := "http://" + serverIP + ":" + serverPort
-	vaultAddr := serverURL.String()
-	config := &api.Config{
-		Address: vaultAddr,
+	apiConfig := api.DefaultConfig()
+	if apiConfig.Error != nil {
+		return errors.Wrap(apiConfig.Error, "vaultclient/vaultclient:InitializeClient() Failed to read vault client defaults")
 	}
+	apiConfig.Address = serverURL.String()
 
-	client, err := api.NewClient(config)
+	if vaultConfig.TLSEnabled {
+		err := apiConfig.ConfigureTLS(&api.TLSConfig{
+			CACert:        vaultConfig.CACertPath,
+			ClientCert:    vaultConfig.ClientCertPath,
+			ClientKey:     vaultConfig.ClientKeyPath,
+			TLSServerName: vaultConfig.TLSServerName,
+		})
+		if err != nil {
+			return errors.Wrap(err, "vaultclient/vaultclient:InitializeClient() Failed to configure vault client TLS")
+		}
+	}
+
+	client, err := api.NewClient(apiConfig)
 	if err != nil {
 		return errors.New("vaultclient/vaultclient:InitializeClient() Failed to initiaize vault client.")
 	}
-	client.SetToken(clientToken)
+	if vaultConfig.Namespace != "" {
+		client.SetNamespace(vaultConfig.Namespace)
+	}
+	vc.client = client
+	vc.c = client.Logical()
+	vc.config = *vaultConfig
+	vc.mountPath = strings.Trim(vaultConfig.MountPath, "/")
+	if vc.mountPath == "" {
+		vc.mountPath = constants.DefaultVaultMountPath
+	}
+	vc.authMethod = strings.ToLower(vaultConfig.AuthMethod)
+	if vc.authMethod == "" {
+		vc.authMethod = constants.VaultAuthToken
+	}
+
+	if vc.authMethod == constants.VaultAuthToken {
+		client.SetToken(vaultConfig.ClientToken)
+		go vc.manageTokenLifetime(nil)
+	} else {
+		secret, err := vc.login()
+		if err != nil {
+			return errors.Wrapf(err, "vaultclient/vaultclient:InitializeClient() Failed to log in to vault with the %s auth method", vc.authMethod)
+		}
+		go vc.manageTokenLifetime(secret)
+	}
 
 	log.Info("vaultclient/vaultclient:InitializeClient() Vault client initialized")
-	vc.c = client.Logical()
 	return nil
 }
 
+// login authenticates with the configured auth method and sets the token of the client
+func (vc *vaultClient) login() (*api.Secret, error) {
+
+	data := map[string]interface{}{}
+	switch vc.authMethod {
+	case constants.VaultAuthAppRole:
+		data["role_id"] = vc.config.RoleID
+		data["secret_id"] = vc.config.SecretID
+	case constants.VaultAuthKubernetes:
+		tokenPath := vc.config.ServiceAccountTokenPath
+		if tokenPath == "" {
+			tokenPath = constants.DefaultVaultServiceAccountTokenPath
+		}
+		jwt, err := os.ReadFile(filepath.Clean(tokenPath))
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to read kubernetes service account token")
+		}
+		data["role"] = vc.config.Role
+		data["jwt"] = strings.TrimSpace(string(jwt))
+	case constants.VaultAuthCert:
+		if vc.config.Role != "" {
+			data["name"] = vc.config.Role
+		}
+	default:
+		return nil, errors.Errorf("Unsupported vault auth method: %s", vc.authMethod)
+	}
+
+	mountPath := vc.config.AuthMountPath
+	if mountPath == "" {
+		mountPath = vc.authMethod
+	}
+
+	// a stale token must not be sent along with the login request
+	vc.client.ClearToken()
+	secret, err := vc.c.Write("auth/"+strings.Trim(mountPath, "/")+"/login", data)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Auth == nil || secret.Auth.ClientToken == "" {
+		return nil, errors.New("Vault login response does not contain a client token")
+	}
+	vc.client.SetToken(secret.Auth.ClientToken)
+	log.Infof("vaultclient/vaultclient:login() Logged in to vault with the %s auth method", vc.authMethod)
+	return secret, nil
+}
+
+// manageTokenLifetime keeps the client token valid in the background. The token is renewed
+// through its lease until it reaches its max TTL, after which the client logs in again. A
+// static client token cannot be replaced, so it is only renewed.
+func (vc *vaultClient) manageTokenLifetime(secret *api.Secret) {
+
+	if secret == nil {
+		tokenSecret, err := vc.lookupClientToken()
+		if err != nil {
+			log.WithError(err).Warn("vaultclient/vaultclient:manageTokenLifetime() Failed to look up vault client token, it will not be renewed")
+			return
+		}
+		secret = tokenSecret
+	}
+
+	for {
+		if secret.Auth.LeaseDuration == 0 {
+			log.Debug("vaultclient/vaultclient:manageTokenLifetime() Vault token does not expire")
+			return
+		}
+
+		watcher, err := vc.client.NewLifetimeWatcher(&api.LifetimeWatcherInput{Secret: secret})
+		if err != nil {
+			log.WithError(err).Error("vaultclient/vaultclient:manageTokenLifetime() Failed to watch vault token lifetime")
+			return
+		}
+		go watcher.Start()
+		err = waitForTokenExpiry(watcher)
+		watcher.Stop()
+		if err != nil {
+			log.WithError(err).Warn("vaultclient/vaultclient:manageTokenLifetime() Failed to renew vault token")
+		}
+
+		if vc.authMethod == constants.VaultAuthToken {
+			log.Error("vaultclient/vaultclient:manageTokenLifetime() Vault client token expired and cannot be renewed, configure a new client token")
+			return
+		}
+		secret = vc.loginWithRetry()
+	}
+}
+
+// lookupClientToken returns the static client token in the form returned by a login
+func (vc *vaultClient) lookupClientToken() (*api.Secret, error) {
+
+	tokenSecret, err := vc.client.Auth().Token().LookupSelf()
+	if err != nil {
+		return nil, err
+	}
+	renewable, err := tokenSecret.TokenIsRenewable()
+	if err != nil {
+		return nil, err
+	}
+	ttl, err := tokenSecret.TokenTTL()
+	if err != nil {
+		return nil, err
+	}
+	return &api.Secret{
+		Auth: &api.SecretAuth{
+			ClientToken:   vc.client.Token(),
+			Renewable:     renewable,
+			LeaseDuration: int(ttl.Seconds()),
+		},
+	}, nil
+}
+
+func waitForTokenExpiry(watcher *api.LifetimeWatcher) error {
+	for {
+		select {
+		case err := <-watcher.DoneCh():
+			return err
+		case renewal := <-watcher.RenewCh():
+			log.Debugf("vaultclient/vaultclient:waitForTokenExpiry() Renewed vault token at %s", renewal.RenewedAt)
+		}
+	}
+}
+
+// loginWithRetry logs in again, backing off while the vault server cannot be reached
+func (vc *vaultClient) loginWithRetry() *api.Secret {
+	retryInterval := time.Second
+	for {
+		secret, err := vc.login()
+		if err == nil {
+			return secret
+		}
+		log.WithError(err).Errorf("vaultclient/vaultclient:loginWithRetry() Failed to log in to vault, retrying in %s", retryInterval)
+		time.Sleep(retryInterval)
+		if retryInterval *= 2; retryInterval > maxLoginRetryInterval {
+			retryInterval = maxLoginRetryInterval
+		}
+	}
+}
+
 func (vc *vaultClient) CreateKey(keyAttrib *model.KeyAttributes) error {
 	id := keyAttrib.ID
 
@@ -62,20 +255,47 @@ func (vc *vaultClient) CreateKey(keyAttrib *model.KeyAttributes) error {
 		log.Errorf("Error while marshalling key attributes: %s", err.Error())
 		return err
 	}
+	data := map[string]interface{}{
+		id.String(): string(jsonKey),
+	}
 
-	_, err = vc.c.Write(constants.VAULT_KEY_ROOT_PATH+id.String(),
-		map[string]interface{}{
-			id.String(): string(jsonKey),
-		})
+	if !vc.isKVv2() {
+		return vc.client.KVv1(vc.mountPath).Put(context.Background(), id.String(), data)
+	}
+	cas, err := vc.checkAndSetVersion(id.String())
 	if err != nil {
 		return err
 	}
-	return nil
+	_, err = vc.client.KVv2(vc.mountPath).Put(context.Background(), id.String(), data, api.WithCheckAndSet(cas))
+	return err
+}
 
+// checkAndSetVersion returns the version a kv v2 write of the key must replace. Only a key that
+// does not exist, or whose current version is deleted, may be written.
+func (vc *vaultClient) checkAndSetVersion(keyID string) (int, error) {
+	metadata, err := vc.client.KVv2(vc.mountPath).GetMetadata(context.Background(), keyID)
+	if errors.Is(err, api.ErrSecretNotFound) {
+		return 0, nil
+	} else if err != nil {
+		return 0, errors.Wrapf(err, "Failed to read metadata of key %s from vault server", keyID)
+	}
+	current := metadata.Versions[strconv.Itoa(metadata.CurrentVersion)]
+	if !current.Destroyed && current.DeletionTime.IsZero() {
+		return 0, errors.Errorf("Key %s already exists on vault server", keyID)
+	}
+	return metadata.CurrentVersion, nil
 }
 
 func (vc *vaultClient) DeleteKey(keyID string) error {
-	_, err := vc.c.Delete(constants.VAULT_KEY_ROOT_PATH + keyID)
+	var err error
+	if !vc.isKVv2() {
+		err = vc.client.KVv1(vc.mountPath).Delete(context.Background(), keyID)
+	} else if vc.config.KVSoftDelete {
+		err = vc.client.KVv2(vc.mountPath).Delete(context.Background(), keyID)
+	} else {
+		// destroys every version of the key along with its metadata
+		err = vc.client.KVv2(vc.mountPath).DeleteMetadata(context.Background(), keyID)
+	}
 	if err != nil {
 		return errors.Wrapf(err, "Failed to delete key %s from vault server", keyID)
 	}
@@ -84,27 +304,47 @@ func (vc *vaultClient) DeleteKey(keyID string) error {
 }
 
 func (vc *vaultClient) GetKey(keyID string) ([]byte, error) {
-	secret, err := vc.c.Read(constants.VAULT_KEY_ROOT_PATH + keyID)
-	if err != nil {
+	var secret *api.KVSecret
+	var err error
+	if vc.isKVv2() {
+		secret, err = vc.client.KVv2(vc.mountPath).Get(context.Background(), keyID)
+	} else {
+		secret, err = vc.client.KVv1(vc.mountPath).Get(context.Background(), keyID)
+	}
+	// the latest version of a soft deleted kv v2 key has no data
+	if errors.Is(err, api.ErrSecretNotFound) || (err == nil && secret.Data == nil) {
+		return nil, errors.Wrapf(ErrKeyNotFound, "Failed to retrieve the key from vault. key with ID %s", keyID)
+	} else if err != nil {
 		return nil, errors.Wrap(err, "Failed to retrieve key from vault server.")
-	} else if secret == nil {
-		return nil, errors.Errorf("Failed to retrieve the key from vault. key with ID %s is not found", keyID)
 	}
 	log.Info("vaultclient/vaultclient:GetKey() Retrieved key from vault server")
 
-	data := secret.Data[keyID]
-	keyInfo := data.(string)
+	keyInfo, ok := secret.Data[keyID].(string)
+	if !ok {
+		return nil, errors.Errorf("Key %s on vault server has unexpected format", keyID)
+	}
 	val := []byte(keyInfo)
 	return val, nil
 }
 
 func (vc *vaultClient) ListKeys() ([]interface{}, error) {
-	keyMap, err := vc.c.List(constants.VAULT_KEY_ROOT_PATH)
+	listPath := vc.mountPath + "/"
+	if vc.isKVv2() {
+		listPath = vc.mountPath + "/metadata/"
+	}
+	keyMap, err := vc.c.List(listPath)
 	if err != nil {
 		return nil, err
 	}
+	if keyMap == nil {
+		return []interface{}{}, nil
+	}
 
 	listOfKeys := keyMap.Data["keys"].([]interface{})
 
 	return listOfKeys, nil
 }
+
+func (vc *vaultClient) isKVv2() bool {
+	return vc.config.KVVersion == constants.VaultKVVersion2
+}
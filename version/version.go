@@ -21,6 +21,8 @@ type ServiceVersion struct {
 	Version   string `json:"version"`
 	GitHash   string `json:"gitHash"`
 	BuildDate string `json:"buildDate"`
+	// KmipVersions maps each kmip key manager backend to the protocol version negotiated with its server
+	KmipVersions map[string]string `json:"kmipVersions,omitempty"`
 }
 
 var ver = ServiceVersion{